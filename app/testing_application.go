@@ -3,30 +3,37 @@ package app
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
-	"firebase.google.com/go/v4/auth"
+	"github.com/atomi-ai/atomi/migrations"
 	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/stripe/stripe-go/v74"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-type MockAuthApp struct{}
+type MockAuthenticator struct{}
 
-func (ma *MockAuthApp) AuthAndDecode(_ context.Context, _ string) (*auth.Token, error) {
-	mockDecodedToken := &auth.Token{
-		Claims: map[string]interface{}{
-			"email": "john.doe@example.com",
-		},
-	}
-	return mockDecodedToken, nil
+func (ma *MockAuthenticator) Authenticate(_ context.Context, _ string) (*utils.Principal, error) {
+	return &utils.Principal{
+		Subject:       "mock-subject",
+		Email:         "john.doe@example.com",
+		EmailVerified: true,
+		Provider:      "mock",
+	}, nil
 }
 
 type MockStripeWrapper struct{}
 
-func (ms *MockStripeWrapper) CreateCustomer(email string) (*stripe.Customer, error) {
+func (ms *MockStripeWrapper) CreateCustomer(_ context.Context, email string) (*stripe.Customer, error) {
 	mockCustomer := &stripe.Customer{
 		ID:    "cus_mock_id",
 		Email: email,
@@ -34,35 +41,85 @@ func (ms *MockStripeWrapper) CreateCustomer(email string) (*stripe.Customer, err
 	return mockCustomer, nil
 }
 
-type MockBlobStorage struct{}
+// MockBlobStorage 记录删掉的private文件，测试用来检查过期的导出有没有被清理。
+type MockBlobStorage struct {
+	Deleted []string
+}
 
-func (mbs *MockBlobStorage) UploadFile(filePath string) (string, error) {
+func (mbs *MockBlobStorage) UploadFile(_ context.Context, filePath string) (string, error) {
 	log.Infof("Mock upload %v", filePath)
 	return "", nil
 }
 
+func (mbs *MockBlobStorage) UploadPrivateFile(_ context.Context, filePath string, ttl time.Duration) (string, string, error) {
+	log.Infof("Mock private upload %v, ttl: %v", filePath, ttl)
+	return filepath.Base(filePath), "https://example.com/" + filepath.Base(filePath), nil
+}
+
+func (mbs *MockBlobStorage) DeletePrivateFile(_ context.Context, blobName string) error {
+	mbs.Deleted = append(mbs.Deleted, blobName)
+	return nil
+}
+
+// InitializeTestingApplication 每次都从一个空库开始。默认用/tmp/<dbName>的SQLite文件；
+// TEST_DB_DRIVER=postgres 的时候连 TEST_DB_DSN，每个dbName用一个单独的schema。
 func InitializeTestingApplication(dbName string) (*Application, error) {
-	// 创建一个内存中的SQLite数据库
-	dsn := fmt.Sprintf("file:/tmp/%v", dbName)
-	//dsn := fmt.Sprintf("file:%v?mode=memory&cache=shared", dbName)
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	db, err := openTestingDB(dbName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to in-memory SQLite database: %w", err)
+		return nil, err
 	}
 
-	// 自动迁移模型
-	models.AutoMigrate(db)
+	// 和线上一样用版本化的迁移建表
+	if err = migrations.Migrate(context.Background(), db); err != nil {
+		return nil, fmt.Errorf("failed to migrate testing database: %w", err)
+	}
 
 	// 使用Mock替换Firebase和Stripe等外部服务
-	mockAuthApp := new(MockAuthApp)
+	mockAuthenticator := new(MockAuthenticator)
 	mockStripeWrapper := new(MockStripeWrapper)
 	mockBlobStorage := new(MockBlobStorage)
 
 	// 创建一个用于测试的 *Application 实例
-	app, err := InitializeApplication(db, mockAuthApp, mockBlobStorage, mockStripeWrapper)
+	app, err := InitializeApplication(db, mockAuthenticator, mockBlobStorage, mockStripeWrapper)
 	if err != nil {
 		return nil, err
 	}
 
 	return app, nil
 }
+
+func openTestingDB(dbName string) (*gorm.DB, error) {
+	switch driver := os.Getenv("TEST_DB_DRIVER"); driver {
+	case "", models.DriverSQLite:
+		path := filepath.Join(os.TempDir(), dbName)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		db, err := gorm.Open(sqlite.Open("file:"+path), &gorm.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to SQLite database: %w", err)
+		}
+		return db, nil
+	case models.DriverPostgres:
+		config, err := pgx.ParseConfig(os.Getenv("TEST_DB_DSN"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid TEST_DB_DSN: %w", err)
+		}
+		admin, err := gorm.Open(postgres.New(postgres.Config{Conn: stdlib.OpenDB(*config)}), &gorm.Config{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to PostgreSQL database: %w", err)
+		}
+		schema := pgx.Identifier{dbName}.Sanitize()
+		err = admin.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE").Exec("CREATE SCHEMA " + schema).Error
+		if sqlDB, _ := admin.DB(); sqlDB != nil {
+			sqlDB.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset schema %v: %w", dbName, err)
+		}
+		config.RuntimeParams["search_path"] = dbName
+		return gorm.Open(postgres.New(postgres.Config{Conn: stdlib.OpenDB(*config)}), &gorm.Config{})
+	default:
+		return nil, fmt.Errorf("unsupported TEST_DB_DRIVER %q", driver)
+	}
+}
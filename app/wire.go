@@ -14,21 +14,29 @@ import (
 )
 
 type Application struct {
-	AuthWrapper    utils.AuthAppWrapper
+	Authenticator  utils.Authenticator
 	BlobStorage    utils.BlobStorage
 	StripeWrapper  utils.StripeWrapper
 	AuthMiddleware middlewares.AuthMiddleware
+	Authorizer     middlewares.Authorizer
+	RateLimiter    middlewares.RateLimiter
 
-	AddressController      controllers.AddressController
-	ImageController        controllers.ImageController
-	LoginController        controllers.LoginController
-	ManagerStoreController controllers.ManagerStoreController
-	OrderController        controllers.OrderController
-	StoreController        controllers.StoreController
-	StripeController       controllers.StripeController
-	UserController         controllers.UserController
+	AddressController         controllers.AddressController
+	AdminController           controllers.AdminController
+	HealthController          controllers.HealthController
+	ImageController           controllers.ImageController
+	LoginController           controllers.LoginController
+	ManagerStoreController    controllers.ManagerStoreController
+	OrderController           controllers.OrderController
+	ReportController          controllers.ReportController
+	StoreController           controllers.StoreController
+	StoreInvitationController controllers.StoreInvitationController
+	StripeController          controllers.StripeController
+	UserController            controllers.UserController
 
 	AddressRepository           repositories.AddressRepository
+	APIKeyRepository            repositories.APIKeyRepository
+	AuditLogRepository          repositories.AuditLogRepository
 	DeleteUserRequestRepository repositories.DeleteUserRequestRepository
 	ManagerStoreRepository      repositories.ManagerStoreRepository
 	OrderRepository             repositories.OrderRepository
@@ -36,32 +44,51 @@ type Application struct {
 	ProductRepository           repositories.ProductRepository
 	ProductStoreRepository      repositories.ProductStoreRepository
 	StoreRepository             repositories.StoreRepository
+	StoreMembershipRepository   repositories.StoreMembershipRepository
+	StoreInvitationRepository   repositories.StoreInvitationRepository
 	UserAddressRepository       repositories.UserAddressRepository
 	UserRepository              repositories.UserRepository
-	UserStoreRepository         repositories.UserStoreRepository
 	TaxRateRepository           repositories.TaxRateRepository
+	UserExportRequestRepository repositories.UserExportRequestRepository
+	Transactor                  repositories.Transactor
 
-	AddressService      services.AddressService
-	OrderService        services.OrderService
-	ProductStoreService services.ProductStoreService
-	StripeService       services.StripeService
-	UserService         services.UserService
-	TaxRateService      services.TaxRateService
+	AddressService          services.AddressService
+	AdminService            services.AdminService
+	APIKeyService           services.APIKeyService
+	OrderService            services.OrderService
+	ProductStoreService     services.ProductStoreService
+	StoreInvitationService  services.StoreInvitationService
+	StripeService           services.StripeService
+	UserService             services.UserService
+	UserProvisioningService services.UserProvisioningService
+	TaxRateService          services.TaxRateService
+	TaxCalculationService   services.TaxCalculationService
+	TaxReportService        services.TaxReportService
+	TaxRateImportService    services.TaxRateImportService
+	UserExportService       services.UserExportService
 }
 
-func InitializeApplication(db *gorm.DB, authWrapper utils.AuthAppWrapper, blobStorage utils.BlobStorage, stripeWrapper utils.StripeWrapper) (*Application, error) {
+func InitializeApplication(db *gorm.DB, authenticator utils.Authenticator, blobStorage utils.BlobStorage, stripeWrapper utils.StripeWrapper) (*Application, error) {
 	wire.Build(
 		middlewares.NewAuthMiddleware,
+		middlewares.NewAuthorizer,
+		middlewares.NewRateLimiter,
 
 		controllers.NewAddressControl,
+		controllers.NewAdminController,
+		controllers.NewHealthController,
 		controllers.NewImageController,
 		controllers.NewLoginController,
 		controllers.NewManagerStoreController,
 		controllers.NewOrderController,
+		controllers.NewReportController,
 		controllers.NewStoreController,
+		controllers.NewStoreInvitationController,
 		controllers.NewStripeController,
 		controllers.NewUserController,
 		repositories.NewAddressRepository,
+		repositories.NewAPIKeyRepository,
+		repositories.NewAuditLogRepository,
 		repositories.NewDeleteUserRequestRepository,
 		repositories.NewManagerStoreRepository,
 		repositories.NewOrderItemRepository,
@@ -69,17 +96,34 @@ func InitializeApplication(db *gorm.DB, authWrapper utils.AuthAppWrapper, blobSt
 		repositories.NewProductRepository,
 		repositories.NewProductStoreRepository,
 		repositories.NewStoreRepository,
+		repositories.NewStoreMembershipRepository,
+		repositories.NewStoreInvitationRepository,
 		repositories.NewUserAddressRepository,
 		repositories.NewUserRepository,
-		repositories.NewUserStoreRepository,
 		repositories.NewTaxRateRepository,
+		repositories.NewUserExportRequestRepository,
+		repositories.NewTransactor,
 		services.NewAddressService,
+		services.NewAddressValidator,
+		services.NewGeocoder,
+		services.NewAdminService,
+		services.NewAPIKeyService,
+		services.NewHealthRegistry,
 		services.NewOrderService,
 		services.NewProductStoreService,
+		services.NewStoreInvitationService,
 		services.NewStripeService,
 		services.NewUserService,
+		services.NewUserProvisioningService,
 		services.NewUberService,
 		services.NewTaxRateService,
+		services.NewTaxCalculationService,
+		services.NewTaxReportService,
+		services.NewFXRateProvider,
+		services.NewTaxRateImportService,
+		services.NewUserExportService,
+		utils.NewLogNotifier,
+		utils.NewRateLimitBackend,
 
 		wire.Struct(new(Application), "*"),
 	)
@@ -17,49 +17,85 @@ import (
 
 // Injectors from wire.go:
 
-func InitializeApplication(db *gorm.DB, authWrapper utils.AuthAppWrapper, blobStorage utils.BlobStorage, stripeWrapper utils.StripeWrapper) (*Application, error) {
+func InitializeApplication(db *gorm.DB, authenticator utils.Authenticator, blobStorage utils.BlobStorage, stripeWrapper utils.StripeWrapper) (*Application, error) {
+	apiKeyRepository := repositories.NewAPIKeyRepository(db)
 	userRepository := repositories.NewUserRepository(db)
-	authMiddleware := middlewares.NewAuthMiddleware(userRepository, authWrapper)
+	storeRepository := repositories.NewStoreRepository(db)
+	auditLogRepository := repositories.NewAuditLogRepository(db)
+	transactor := repositories.NewTransactor(db)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepository, userRepository, storeRepository, auditLogRepository, transactor)
+	storeInvitationRepository := repositories.NewStoreInvitationRepository(db)
+	storeMembershipRepository := repositories.NewStoreMembershipRepository(db)
+	notifier := utils.NewLogNotifier()
+	storeInvitationService := services.NewStoreInvitationService(storeInvitationRepository, storeMembershipRepository, storeRepository, notifier)
+	userProvisioningService := services.NewUserProvisioningService(userRepository, stripeWrapper, storeInvitationService)
+	authMiddleware := middlewares.NewAuthMiddleware(authenticator, apiKeyService, userProvisioningService)
+	orderRepository := repositories.NewOrderRepository(db)
+	authorizer := middlewares.NewAuthorizer(storeRepository, orderRepository)
+	rateLimitBackend, err := utils.NewRateLimitBackend()
+	if err != nil {
+		return nil, err
+	}
+	rateLimiter := middlewares.NewRateLimiter(rateLimitBackend)
 	addressRepository := repositories.NewAddressRepository(db)
 	userAddressRepository := repositories.NewUserAddressRepository(db)
-	addressService := services.NewAddressService(userRepository, addressRepository, userAddressRepository)
-	userService := services.NewUserService(userRepository)
-	addressController := controllers.NewAddressControl(addressService, userService, addressRepository)
+	taxRateRepository := repositories.NewTaxRateRepository(db)
+	geocoder := services.NewGeocoder()
+	addressValidator := services.NewAddressValidator(taxRateRepository, geocoder)
+	addressService := services.NewAddressService(userRepository, addressRepository, userAddressRepository, addressValidator, transactor)
+	userService := services.NewUserService(userRepository, userAddressRepository)
+	addressController := controllers.NewAddressControl(addressService, userService)
+	adminService := services.NewAdminService(userRepository, orderRepository, storeRepository, storeMembershipRepository, auditLogRepository, transactor)
+	taxRateImportService := services.NewTaxRateImportService(taxRateRepository, auditLogRepository, transactor)
+	adminController := controllers.NewAdminController(authorizer, adminService, apiKeyService, taxRateImportService)
+	uberService := services.NewUberService()
+	userExportRequestRepository := repositories.NewUserExportRequestRepository(db)
+	stripeService := services.NewStripeService()
+	userExportService := services.NewUserExportService(userExportRequestRepository, userAddressRepository, storeMembershipRepository, orderRepository, stripeService, blobStorage, notifier)
+	healthRegistry := services.NewHealthRegistry(db, authenticator, blobStorage, stripeWrapper, uberService, userExportService)
+	healthController := controllers.NewHealthController(healthRegistry)
 	imageController := controllers.NewImageController(blobStorage)
-	loginController := controllers.NewLoginController(userRepository, stripeWrapper)
+	loginController := controllers.NewLoginController(userProvisioningService)
 	managerStoreRepository := repositories.NewManagerStoreRepository(db)
-	orderRepository := repositories.NewOrderRepository(db)
 	productRepository := repositories.NewProductRepository(db)
 	productStoreRepository := repositories.NewProductStoreRepository(db)
-	storeRepository := repositories.NewStoreRepository(db)
-	productStoreService := services.NewProductStoreService(productRepository, productStoreRepository)
-	managerStoreController := controllers.NewManagerStoreController(managerStoreRepository, orderRepository, productRepository, productStoreRepository, storeRepository, productStoreService)
+	productStoreService := services.NewProductStoreService(productRepository, productStoreRepository, storeRepository)
+	managerStoreController := controllers.NewManagerStoreController(authorizer, managerStoreRepository, storeMembershipRepository, orderRepository, productRepository, productStoreRepository, productStoreService, storeInvitationService)
 	orderItemRepository := repositories.NewOrderItemRepository(db)
-	taxRateRepository := repositories.NewTaxRateRepository(db)
-	stripeService := services.NewStripeService()
-	uberService := services.NewUberService()
 	taxRateService := services.NewTaxRateService(taxRateRepository)
-	orderService := services.NewOrderService(orderRepository, orderItemRepository, stripeService, uberService)
-	orderController := controllers.NewOrderController(orderService, uberService, taxRateService)
-	userStoreRepository := repositories.NewUserStoreRepository(db)
-	storeController := controllers.NewStoreController(managerStoreRepository, productStoreRepository, storeRepository, userStoreRepository)
-	stripeController := controllers.NewStripeController(userService, stripeService, orderService, uberService, addressRepository)
+	taxCalculationService := services.NewTaxCalculationService(taxRateService)
+	orderService := services.NewOrderService(orderRepository, orderItemRepository, stripeService, uberService, taxCalculationService, storeRepository)
+	orderController := controllers.NewOrderController(orderService, uberService, taxRateService, addressService)
+	fxRateProvider := services.NewFXRateProvider()
+	taxReportService := services.NewTaxReportService(orderRepository, fxRateProvider)
+	reportController := controllers.NewReportController(authorizer, taxReportService)
+	storeController := controllers.NewStoreController(managerStoreRepository, productStoreRepository, storeRepository, storeMembershipRepository)
+	storeInvitationController := controllers.NewStoreInvitationController(storeInvitationService)
+	stripeController := controllers.NewStripeController(userService, stripeService, orderService, uberService, addressService)
 	deleteUserRequestRepository := repositories.NewDeleteUserRequestRepository(db)
-	userController := controllers.NewUserController(userService, deleteUserRequestRepository)
+	userController := controllers.NewUserController(userService, userExportService, deleteUserRequestRepository)
 	application := &Application{
-		AuthWrapper:                 authWrapper,
+		Authenticator:               authenticator,
 		BlobStorage:                 blobStorage,
 		StripeWrapper:               stripeWrapper,
 		AuthMiddleware:              authMiddleware,
+		Authorizer:                  authorizer,
+		RateLimiter:                 rateLimiter,
 		AddressController:           addressController,
+		AdminController:             adminController,
+		HealthController:            healthController,
 		ImageController:             imageController,
 		LoginController:             loginController,
 		ManagerStoreController:      managerStoreController,
 		OrderController:             orderController,
+		ReportController:            reportController,
 		StoreController:             storeController,
+		StoreInvitationController:   storeInvitationController,
 		StripeController:            stripeController,
 		UserController:              userController,
 		AddressRepository:           addressRepository,
+		APIKeyRepository:            apiKeyRepository,
+		AuditLogRepository:          auditLogRepository,
 		DeleteUserRequestRepository: deleteUserRequestRepository,
 		ManagerStoreRepository:      managerStoreRepository,
 		OrderRepository:             orderRepository,
@@ -67,14 +103,27 @@ func InitializeApplication(db *gorm.DB, authWrapper utils.AuthAppWrapper, blobSt
 		ProductRepository:           productRepository,
 		ProductStoreRepository:      productStoreRepository,
 		StoreRepository:             storeRepository,
+		StoreMembershipRepository:   storeMembershipRepository,
+		StoreInvitationRepository:   storeInvitationRepository,
 		UserAddressRepository:       userAddressRepository,
 		UserRepository:              userRepository,
-		UserStoreRepository:         userStoreRepository,
+		TaxRateRepository:           taxRateRepository,
+		UserExportRequestRepository: userExportRequestRepository,
+		Transactor:                  transactor,
 		AddressService:              addressService,
+		AdminService:                adminService,
+		APIKeyService:               apiKeyService,
 		OrderService:                orderService,
 		ProductStoreService:         productStoreService,
+		StoreInvitationService:      storeInvitationService,
 		StripeService:               stripeService,
 		UserService:                 userService,
+		UserProvisioningService:     userProvisioningService,
+		TaxRateService:              taxRateService,
+		TaxCalculationService:       taxCalculationService,
+		TaxReportService:            taxReportService,
+		TaxRateImportService:        taxRateImportService,
+		UserExportService:           userExportService,
 	}
 	return application, nil
 }
@@ -82,21 +131,29 @@ func InitializeApplication(db *gorm.DB, authWrapper utils.AuthAppWrapper, blobSt
 // wire.go:
 
 type Application struct {
-	AuthWrapper    utils.AuthAppWrapper
+	Authenticator  utils.Authenticator
 	BlobStorage    utils.BlobStorage
 	StripeWrapper  utils.StripeWrapper
 	AuthMiddleware middlewares.AuthMiddleware
+	Authorizer     middlewares.Authorizer
+	RateLimiter    middlewares.RateLimiter
 
-	AddressController      controllers.AddressController
-	ImageController        controllers.ImageController
-	LoginController        controllers.LoginController
-	ManagerStoreController controllers.ManagerStoreController
-	OrderController        controllers.OrderController
-	StoreController        controllers.StoreController
-	StripeController       controllers.StripeController
-	UserController         controllers.UserController
+	AddressController         controllers.AddressController
+	AdminController           controllers.AdminController
+	HealthController          controllers.HealthController
+	ImageController           controllers.ImageController
+	LoginController           controllers.LoginController
+	ManagerStoreController    controllers.ManagerStoreController
+	OrderController           controllers.OrderController
+	ReportController          controllers.ReportController
+	StoreController           controllers.StoreController
+	StoreInvitationController controllers.StoreInvitationController
+	StripeController          controllers.StripeController
+	UserController            controllers.UserController
 
 	AddressRepository           repositories.AddressRepository
+	APIKeyRepository            repositories.APIKeyRepository
+	AuditLogRepository          repositories.AuditLogRepository
 	DeleteUserRequestRepository repositories.DeleteUserRequestRepository
 	ManagerStoreRepository      repositories.ManagerStoreRepository
 	OrderRepository             repositories.OrderRepository
@@ -104,13 +161,26 @@ type Application struct {
 	ProductRepository           repositories.ProductRepository
 	ProductStoreRepository      repositories.ProductStoreRepository
 	StoreRepository             repositories.StoreRepository
+	StoreMembershipRepository   repositories.StoreMembershipRepository
+	StoreInvitationRepository   repositories.StoreInvitationRepository
 	UserAddressRepository       repositories.UserAddressRepository
 	UserRepository              repositories.UserRepository
-	UserStoreRepository         repositories.UserStoreRepository
+	TaxRateRepository           repositories.TaxRateRepository
+	UserExportRequestRepository repositories.UserExportRequestRepository
+	Transactor                  repositories.Transactor
 
-	AddressService      services.AddressService
-	OrderService        services.OrderService
-	ProductStoreService services.ProductStoreService
-	StripeService       services.StripeService
-	UserService         services.UserService
+	AddressService          services.AddressService
+	AdminService            services.AdminService
+	APIKeyService           services.APIKeyService
+	OrderService            services.OrderService
+	ProductStoreService     services.ProductStoreService
+	StoreInvitationService  services.StoreInvitationService
+	StripeService           services.StripeService
+	UserService             services.UserService
+	UserProvisioningService services.UserProvisioningService
+	TaxRateService          services.TaxRateService
+	TaxCalculationService   services.TaxCalculationService
+	TaxReportService        services.TaxReportService
+	TaxRateImportService    services.TaxRateImportService
+	UserExportService       services.UserExportService
 }
@@ -1,18 +1,20 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/atomi-ai/atomi/models"
-	"github.com/atomi-ai/atomi/repositories"
 	"github.com/atomi-ai/atomi/services"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type AddressController interface {
 	GetAllAddressesForUser(c *gin.Context)
 	AddAddressForUser(c *gin.Context)
+	UpdateAddressForUser(c *gin.Context)
 	DeleteAddressForUser(c *gin.Context)
 	SetDefaultShippingAddress(c *gin.Context)
 	SetDefaultBillingAddress(c *gin.Context)
@@ -22,14 +24,12 @@ type AddressController interface {
 }
 
 type AddressControllerImpl struct {
-	AddressRepo    repositories.AddressRepository
 	AddressService services.AddressService
 	UserService    services.UserService
 }
 
-func NewAddressControl(addressServoce services.AddressService, userService services.UserService, addressRepo repositories.AddressRepository) AddressController {
+func NewAddressControl(addressServoce services.AddressService, userService services.UserService) AddressController {
 	return &AddressControllerImpl{
-		AddressRepo:    addressRepo,
 		AddressService: addressServoce,
 		UserService:    userService,
 	}
@@ -38,7 +38,7 @@ func NewAddressControl(addressServoce services.AddressService, userService servi
 func (ac *AddressControllerImpl) GetAllAddressesForUser(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 
-	addresses, err := ac.AddressService.GetAddressesByUserID(user.ID)
+	addresses, err := ac.AddressService.GetAddressesByUserID(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -56,22 +56,58 @@ func (ac *AddressControllerImpl) AddAddressForUser(c *gin.Context) {
 		return
 	}
 
-	savedAddress, err := ac.AddressService.AddAddressForUser(user, &address)
+	savedAddress, err := ac.AddressService.AddAddressForUser(c.Request.Context(), user, &address)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondAddressError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, savedAddress)
 }
 
+// UpdateAddressForUser 返回的是新的地址（新的ID），原来的地址留给历史订单。
+func (ac *AddressControllerImpl) UpdateAddressForUser(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	addressID, err := strconv.ParseInt(c.Param("addressId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	var address models.Address
+	if err := c.ShouldBindJSON(&address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	savedAddress, err := ac.AddressService.UpdateAddressForUser(c.Request.Context(), user, addressID, &address)
+	if err != nil {
+		respondAddressError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, savedAddress)
+}
+
+func respondAddressError(c *gin.Context, err error) {
+	var validationErr *services.AddressValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidAddress.Error(), "fields": validationErr.Fields})
+	case errors.Is(err, services.ErrUserAddressNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 func (ac *AddressControllerImpl) DeleteAddressForUser(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 	addressID, _ := strconv.ParseInt(c.Param("addressId"), 10, 64)
 
-	err := ac.AddressService.DeleteAddressForUser(user, addressID)
+	err := ac.AddressService.DeleteAddressForUser(c.Request.Context(), user, addressID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondAddressError(c, err)
 		return
 	}
 
@@ -82,9 +118,9 @@ func (ac *AddressControllerImpl) SetDefaultShippingAddress(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 	addressID, _ := strconv.ParseInt(c.Param("addressId"), 10, 64)
 
-	updatedUser, err := ac.UserService.SetDefaultShippingAddress(user, addressID)
+	updatedUser, err := ac.UserService.SetDefaultShippingAddress(c.Request.Context(), user, addressID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondAddressError(c, err)
 		return
 	}
 
@@ -95,9 +131,9 @@ func (ac *AddressControllerImpl) SetDefaultBillingAddress(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 	addressID, _ := strconv.ParseInt(c.Param("addressId"), 10, 64)
 
-	updatedUser, err := ac.UserService.SetDefaultBillingAddress(user, addressID)
+	updatedUser, err := ac.UserService.SetDefaultBillingAddress(c.Request.Context(), user, addressID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondAddressError(c, err)
 		return
 	}
 
@@ -107,9 +143,9 @@ func (ac *AddressControllerImpl) SetDefaultBillingAddress(c *gin.Context) {
 func (ac *AddressControllerImpl) GetDefaultShippingAddress(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 
-	address, err := ac.AddressRepo.FindByID(user.DefaultShippingAddressID)
+	address, err := ac.AddressService.GetAddressForUser(c.Request.Context(), user, user.DefaultShippingAddressID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondAddressError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, address)
@@ -118,9 +154,9 @@ func (ac *AddressControllerImpl) GetDefaultShippingAddress(c *gin.Context) {
 func (ac *AddressControllerImpl) GetDefaultBillingAddress(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 
-	address, err := ac.AddressRepo.FindByID(user.DefaultBillingAddressID)
+	address, err := ac.AddressService.GetAddressForUser(c.Request.Context(), user, user.DefaultBillingAddressID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondAddressError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, address)
@@ -129,7 +165,7 @@ func (ac *AddressControllerImpl) GetDefaultBillingAddress(c *gin.Context) {
 func (ac *AddressControllerImpl) DeleteAllAddressesForUser(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 
-	err := ac.AddressService.DeleteAllAddressesForUser(user)
+	err := ac.AddressService.DeleteAllAddressesForUser(c.Request.Context(), user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const defaultAdminPageSize = 50
+
+type AdminController interface {
+	RegisterRoutes(router *gin.RouterGroup)
+}
+
+type AdminControllerImpl struct {
+	authorizer           middlewares.Authorizer
+	adminService         services.AdminService
+	apiKeyService        services.APIKeyService
+	taxRateImportService services.TaxRateImportService
+}
+
+func NewAdminController(authorizer middlewares.Authorizer, adminService services.AdminService, apiKeyService services.APIKeyService,
+	taxRateImportService services.TaxRateImportService) AdminController {
+	return &AdminControllerImpl{
+		authorizer:           authorizer,
+		adminService:         adminService,
+		apiKeyService:        apiKeyService,
+		taxRateImportService: taxRateImportService,
+	}
+}
+
+func (ac *AdminControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.Use(ac.authorizer.Require(models.PermissionUserManage))
+	router.GET("/users", ac.searchUsers)
+	router.GET("/users/:user_id", ac.getUser)
+	router.PUT("/users/:user_id/role", ac.changeRole)
+	router.PUT("/users/:user_id/stores/:store_id", ac.assignStore)
+	router.DELETE("/users/:user_id/stores/:store_id", ac.unassignStore)
+	router.POST("/users/:user_id/suspend", ac.suspendUser)
+	router.POST("/users/:user_id/reactivate", ac.reactivateUser)
+	router.PUT("/users/:user_id/tax-exempt", ac.setTaxExempt)
+	router.GET("/users/:user_id/audit-logs", ac.getAuditLogs)
+
+	router.POST("/service-accounts", ac.createServiceAccount)
+	router.GET("/service-accounts", ac.listServiceAccounts)
+	router.POST("/service-accounts/:user_id/keys", ac.createAPIKey)
+	router.GET("/service-accounts/:user_id/keys", ac.listAPIKeys)
+	router.POST("/api-keys/:key_id/rotate", ac.rotateAPIKey)
+	router.DELETE("/api-keys/:key_id", ac.revokeAPIKey)
+
+	router.POST("/tax-rates/import", ac.importTaxRates)
+	router.GET("/tax-rates/datasets", ac.listTaxRateDatasets)
+	router.POST("/tax-rates/datasets/:dataset_id/activate", ac.activateTaxRateDataset)
+}
+
+func (ac *AdminControllerImpl) searchUsers(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultAdminPageSize)))
+	if err != nil || limit <= 0 {
+		limit = defaultAdminPageSize
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	users, err := ac.adminService.SearchUsers(ctx.Request.Context(), ctx.Query("q"), limit, offset)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, users)
+}
+
+func (ac *AdminControllerImpl) getUser(ctx *gin.Context) {
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	detail, err := ac.adminService.GetUserDetail(ctx.Request.Context(), userID)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, detail)
+}
+
+func (ac *AdminControllerImpl) changeRole(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Role models.Role `json:"role"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := ac.adminService.ChangeRole(ctx.Request.Context(), admin, userID, input.Role)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (ac *AdminControllerImpl) assignStore(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	userID, storeID, ok := parseUserAndStoreIDs(ctx)
+	if !ok {
+		return
+	}
+
+	input := struct {
+		Role models.StoreRelationship `json:"role"`
+	}{Role: models.StoreRelationshipOwner}
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	if err := ac.adminService.AssignStore(ctx.Request.Context(), admin, userID, storeID, input.Role); err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (ac *AdminControllerImpl) unassignStore(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	userID, storeID, ok := parseUserAndStoreIDs(ctx)
+	if !ok {
+		return
+	}
+
+	if err := ac.adminService.UnassignStore(ctx.Request.Context(), admin, userID, storeID); err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (ac *AdminControllerImpl) suspendUser(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+	user, err := ac.adminService.SuspendUser(ctx.Request.Context(), admin, userID, input.Reason)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (ac *AdminControllerImpl) reactivateUser(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := ac.adminService.ReactivateUser(ctx.Request.Context(), admin, userID)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (ac *AdminControllerImpl) setTaxExempt(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		TaxExempt *bool `json:"tax_exempt"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil || input.TaxExempt == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := ac.adminService.SetTaxExempt(ctx.Request.Context(), admin, userID, *input.TaxExempt)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (ac *AdminControllerImpl) getAuditLogs(ctx *gin.Context) {
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	auditLogs, err := ac.adminService.GetAuditLogs(ctx.Request.Context(), userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, auditLogs)
+}
+
+func parseUserAndStoreIDs(ctx *gin.Context) (int64, int64, bool) {
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, 0, false
+	}
+	storeID, err := strconv.ParseInt(ctx.Param("store_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return 0, 0, false
+	}
+	return userID, storeID, true
+}
+
+func respondAdminError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, services.ErrInvalidRole),
+		errors.Is(err, services.ErrInvalidServiceAccountName),
+		errors.Is(err, services.ErrInvalidPermission),
+		errors.Is(err, services.ErrStoreKeyPermission),
+		errors.Is(err, services.ErrNotServiceAccount),
+		errors.Is(err, services.ErrInvalidTaxRateFile):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSelfManagement):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserSuspended),
+		errors.Is(err, services.ErrUserNotSuspended),
+		errors.Is(err, services.ErrServiceAccountExists),
+		errors.Is(err, services.ErrAPIKeyRevoked):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.WithContext(ctx.Request.Context()).Errorf("Errors in admin request %v, err: \n%v", ctx.Request.URL, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (ac *AdminControllerImpl) createServiceAccount(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+
+	var input struct {
+		Name        string `json:"name" binding:"required"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, err := ac.apiKeyService.CreateServiceAccount(ctx.Request.Context(), admin, input.Name, input.DisplayName)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, user)
+}
+
+func (ac *AdminControllerImpl) listServiceAccounts(ctx *gin.Context) {
+	users, err := ac.apiKeyService.ListServiceAccounts(ctx.Request.Context())
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, users)
+}
+
+func (ac *AdminControllerImpl) createAPIKey(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input services.CreateAPIKeyInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	key, err := ac.apiKeyService.CreateKey(ctx.Request.Context(), admin, userID, input)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, key)
+}
+
+func (ac *AdminControllerImpl) listAPIKeys(ctx *gin.Context) {
+	userID, err := strconv.ParseInt(ctx.Param("user_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	keys, err := ac.apiKeyService.ListKeys(ctx.Request.Context(), userID)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, keys)
+}
+
+func (ac *AdminControllerImpl) rotateAPIKey(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	keyID, err := strconv.ParseInt(ctx.Param("key_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return
+	}
+	// grace_period 是旧key还能继续用的时间，譬如 "24h"，默认立即失效。
+	gracePeriod, err := time.ParseDuration(ctx.DefaultQuery("grace_period", "0s"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grace period"})
+		return
+	}
+
+	key, err := ac.apiKeyService.RotateKey(ctx.Request.Context(), admin, keyID, gracePeriod)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, key)
+}
+
+func (ac *AdminControllerImpl) revokeAPIKey(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	keyID, err := strconv.ParseInt(ctx.Param("key_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return
+	}
+
+	key, err := ac.apiKeyService.RevokeKey(ctx.Request.Context(), admin, keyID)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, key)
+}
+
+// importTaxRates 接收multipart的files字段（可以有多个csv），导入成新的税率版本，不需要重启。
+func (ac *AdminControllerImpl) importTaxRates(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	form, err := ctx.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Please provide tax rate csv files"})
+		return
+	}
+
+	files := make([]services.TaxRateFile, 0, len(form.File["files"]))
+	for _, header := range form.File["files"] {
+		file, err := header.Open()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+		files = append(files, services.TaxRateFile{Name: filepath.Base(header.Filename), Content: content})
+	}
+
+	dataset, err := ac.taxRateImportService.Import(ctx.Request.Context(), admin, files)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, dataset)
+}
+
+func (ac *AdminControllerImpl) listTaxRateDatasets(ctx *gin.Context) {
+	datasets, err := ac.taxRateImportService.ListDatasets(ctx.Request.Context())
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, datasets)
+}
+
+func (ac *AdminControllerImpl) activateTaxRateDataset(ctx *gin.Context) {
+	admin := ctx.MustGet("user").(*models.User)
+	datasetID, err := strconv.ParseInt(ctx.Param("dataset_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dataset ID"})
+		return
+	}
+
+	dataset, err := ac.taxRateImportService.Activate(ctx.Request.Context(), admin, datasetID)
+	if err != nil {
+		respondAdminError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, dataset)
+}
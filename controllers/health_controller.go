@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController interface {
+	// Liveness 对应 /healthz，只运行Liveness的检查，不检查外部依赖。
+	Liveness(c *gin.Context)
+	// Readiness 对应 /readyz，检查所有依赖，critical的检查失败或者正在关闭的时候返回503。
+	// 这两个接口不需要登录，只返回状态，不返回每个依赖的错误。
+	Readiness(c *gin.Context)
+	// Report 返回每个检查的详细结果，放在admin下面。
+	Report(c *gin.Context)
+}
+
+type HealthControllerImpl struct {
+	registry utils.HealthRegistry
+}
+
+func NewHealthController(registry utils.HealthRegistry) HealthController {
+	return &HealthControllerImpl{
+		registry: registry,
+	}
+}
+
+func (hc *HealthControllerImpl) Liveness(c *gin.Context) {
+	writeHealthReport(c, hc.registry.Liveness(c.Request.Context()), false)
+}
+
+func (hc *HealthControllerImpl) Readiness(c *gin.Context) {
+	hc.readiness(c, false)
+}
+
+func (hc *HealthControllerImpl) Report(c *gin.Context) {
+	hc.readiness(c, true)
+}
+
+func (hc *HealthControllerImpl) readiness(c *gin.Context, detailed bool) {
+	if utils.IsDraining() {
+		c.JSON(http.StatusServiceUnavailable, &utils.HealthReport{Status: utils.HealthStatusDraining})
+		return
+	}
+	writeHealthReport(c, hc.registry.Readiness(c.Request.Context()), detailed)
+}
+
+func writeHealthReport(c *gin.Context, report *utils.HealthReport, detailed bool) {
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+	if !detailed {
+		report = &utils.HealthReport{Status: report.Status}
+	}
+	c.JSON(status, report)
+}
@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/utils"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -26,15 +25,7 @@ func NewImageController(blobStorage utils.BlobStorage) ImageController {
 }
 
 func (ic *ImageControllerImpl) UploadImage(c *gin.Context) {
-	// 限制只有manager可以上传图片。
-	user, _ := c.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
+	// 权限检查(image:upload)在路由上的Authorizer里做。
 	file, err := c.FormFile("image")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Please provide an image file"})
@@ -51,9 +42,9 @@ func (ic *ImageControllerImpl) UploadImage(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
 		return
 	}
-	log.Debugf("xfguo: temporarily saved the file in '%v'", tempFilePath)
+	log.WithContext(c.Request.Context()).Debugf("xfguo: temporarily saved the file in '%v'", tempFilePath)
 
-	uploadedFileURL, err := ic.blobStorage.UploadFile(tempFilePath)
+	uploadedFileURL, err := ic.blobStorage.UploadFile(c.Request.Context(), tempFilePath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file to Azure Blob Storage"})
 		return
@@ -3,14 +3,10 @@ package controllers
 import (
 	"errors"
 
-	"firebase.google.com/go/v4/auth"
-	"github.com/atomi-ai/atomi/models"
-	"github.com/atomi-ai/atomi/repositories"
+	"github.com/atomi-ai/atomi/services"
 	"github.com/atomi-ai/atomi/utils"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
-	"github.com/stripe/stripe-go/v74"
-	"gorm.io/gorm"
 )
 
 type LoginController interface {
@@ -18,58 +14,30 @@ type LoginController interface {
 }
 
 type LoginControllerImpl struct {
-	UserRepository repositories.UserRepository
-	StripeWrapper  utils.StripeWrapper
+	ProvisioningService services.UserProvisioningService
 }
 
-func NewLoginController(userRepo repositories.UserRepository, wrapper utils.StripeWrapper) LoginController {
+func NewLoginController(provisioningService services.UserProvisioningService) LoginController {
 	return &LoginControllerImpl{
-		UserRepository: userRepo,
-		StripeWrapper:  wrapper,
+		ProvisioningService: provisioningService,
 	}
 }
 
+// Login 返回当前的用户，第一次登录的时候会创建用户。
+// 注册过的路由在AuthMiddleware里已经会自动创建用户了，这个接口留给客户端登录之后拉取用户信息。
 func (l *LoginControllerImpl) Login(c *gin.Context) {
-	token, _ := c.MustGet("decodedToken").(*auth.Token)
+	principal, _ := c.MustGet("principal").(*utils.Principal)
 
-	email, _ := token.Claims["email"].(string)
-	user, err := l.UserRepository.FindByEmail(email)
-	log.Debugf("xfguo: /api/login with user: %v", user)
+	user, err := l.ProvisioningService.Provision(c.Request.Context(), principal)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			user = &models.User{
-				Email: email,
-				Role:  "USER",
-			}
-		} else {
-			log.Errorf("Errors in fetching user(%v), err: \n%v", email, err)
-			c.JSON(500, gin.H{"error": "Error fetching user"})
+		if errors.Is(err, services.ErrEmailInUse) {
+			c.JSON(409, gin.H{"error": err.Error()})
 			return
 		}
-	}
-
-	dirty := false
-	if user.StripeCustomerID == "" {
-		dirty = true
-		stripeCustomer, err := l.createStripeCustomer(email)
-		if err != nil {
-			log.Errorf("Error creating Stripe customer(%v), err: \n%v", email, err)
-			c.JSON(500, gin.H{"error": "Error creating Stripe customer"})
-			return
-		}
-		user.StripeCustomerID = stripeCustomer.ID
-	}
-
-	if dirty {
-		if user, err = l.UserRepository.Save(user); err != nil {
-			log.Errorf("Errors in saving user %v, err: \n%v", user, err)
-			c.JSON(500, gin.H{"error": "Errors in saving user"})
-		}
+		log.WithContext(c.Request.Context()).Errorf("Errors in provisioning user(%v), err: \n%v", principal.Subject, err)
+		c.JSON(500, gin.H{"error": "Errors in provisioning user"})
+		return
 	}
 
 	c.JSON(200, user)
 }
-
-func (l *LoginControllerImpl) createStripeCustomer(email string) (*stripe.Customer, error) {
-	return l.StripeWrapper.CreateCustomer(email)
-}
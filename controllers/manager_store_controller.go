@@ -1,15 +1,18 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/atomi-ai/atomi/middlewares"
 	"github.com/atomi-ai/atomi/repositories"
 	"github.com/atomi-ai/atomi/services"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/atomi-ai/atomi/models"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type ManagerStoreController interface {
@@ -17,61 +20,59 @@ type ManagerStoreController interface {
 }
 
 type ManagerStoreControllerImpl struct {
+	authorizer             middlewares.Authorizer
 	managerStoreRepository repositories.ManagerStoreRepository
+	membershipRepository   repositories.StoreMembershipRepository
 	orderRepository        repositories.OrderRepository
 	productRepository      repositories.ProductRepository
 	productStoreRepository repositories.ProductStoreRepository
-	storeRepository        repositories.StoreRepository
 	productStoreService    services.ProductStoreService
+	invitationService      services.StoreInvitationService
 }
 
 func NewManagerStoreController(
+	authorizer middlewares.Authorizer,
 	managerStoreRepository repositories.ManagerStoreRepository,
+	membershipRepository repositories.StoreMembershipRepository,
 	orderRepository repositories.OrderRepository,
 	productRepository repositories.ProductRepository,
 	productStoreRepository repositories.ProductStoreRepository,
-	storeRepository repositories.StoreRepository,
-	productStoreService services.ProductStoreService) ManagerStoreController {
+	productStoreService services.ProductStoreService,
+	invitationService services.StoreInvitationService) ManagerStoreController {
 	return &ManagerStoreControllerImpl{
+		authorizer:             authorizer,
 		managerStoreRepository: managerStoreRepository,
+		membershipRepository:   membershipRepository,
 		orderRepository:        orderRepository,
 		productRepository:      productRepository,
 		productStoreRepository: productStoreRepository,
-		storeRepository:        storeRepository,
 		productStoreService:    productStoreService,
+		invitationService:      invitationService,
 	}
 }
 
 func (msc *ManagerStoreControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
 	// TODO(lamuguo): Please be consistent to use camelCase or snake_case. ("order_id" vs. "storeId")
-	router.GET("/stores", msc.getStoresForMgr)
-	router.POST("/store", msc.createStore)
-	router.DELETE("/store/:store_id", msc.deleteStore)
-	router.PUT("/store/:store_id", msc.assignStoreToUser)
-	router.GET("/products", msc.getProductsForMgr)
-	router.PUT("/store/add/:storeId/product/:productId", msc.AddProductToStore)
-	router.DELETE("/store/remove/:storeId/product/:productId", msc.RemoveProductFromStore)
-	router.POST("/store/:storeId/product", msc.CreateProductInStore)
-	router.PUT("/orders/:order_id/status", msc.UpdateOrderStatus)
-	router.GET("/store/:storeId/orders", msc.GetOrdersByStoreID)
-}
-
-func isAuthorized(user *models.User) bool {
-	if user == nil {
-		return false
-	}
-	return user.Role == models.RoleAdmin || user.Role == models.RoleMgr
+	require := msc.authorizer.Require
+	router.GET("/stores", require(models.PermissionStoreView), msc.getStoresForMgr)
+	router.POST("/store", require(models.PermissionStoreManage), msc.createStore)
+	router.DELETE("/store/:store_id", require(models.PermissionStoreManage, middlewares.StoreParam("store_id")), msc.deleteStore)
+	// 把任意一个店认领为自己的店，只有admin可以
+	router.PUT("/store/:store_id", require(models.PermissionUserManage), msc.assignStoreToUser)
+	router.GET("/products", require(models.PermissionStoreView), msc.getProductsForMgr)
+	router.PUT("/store/add/:storeId/product/:productId", require(models.PermissionProductEdit, middlewares.StoreParam("storeId")), msc.AddProductToStore)
+	router.DELETE("/store/remove/:storeId/product/:productId", require(models.PermissionProductEdit, middlewares.StoreParam("storeId")), msc.RemoveProductFromStore)
+	router.POST("/store/:storeId/product", require(models.PermissionProductEdit, middlewares.StoreParam("storeId")), msc.CreateProductInStore)
+	router.PUT("/orders/:order_id/status", require(models.PermissionOrderUpdate, msc.authorizer.OrderParam("order_id")), msc.UpdateOrderStatus)
+	router.GET("/store/:storeId/orders", require(models.PermissionOrderView, middlewares.StoreParam("storeId")), msc.GetOrdersByStoreID)
+	router.GET("/store/:storeId/members", require(models.PermissionStoreView, middlewares.StoreParam("storeId")), msc.getStoreMembers)
+	router.POST("/store/:storeId/invitations", require(models.PermissionStoreManage, middlewares.StoreParam("storeId")), msc.inviteToStore)
+	router.DELETE("/store/:store_id/invitations/:invitation_id", require(models.PermissionStoreManage, middlewares.StoreParam("store_id")), msc.revokeInvitation)
 }
 func (msc *ManagerStoreControllerImpl) getStoresForMgr(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
+	manager := ctx.MustGet("user").(*models.User)
 
-	stores, err := msc.managerStoreRepository.GetStoresByManagerID(manager.ID)
+	stores, err := msc.membershipRepository.FindStoresByStaff(ctx.Request.Context(), manager.ID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -80,15 +81,9 @@ func (msc *ManagerStoreControllerImpl) getStoresForMgr(ctx *gin.Context) {
 }
 
 func (msc *ManagerStoreControllerImpl) getProductsForMgr(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
+	manager := ctx.MustGet("user").(*models.User)
 
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
-	products, err := msc.productRepository.FindAllProductsForMgr(manager.ID)
+	products, err := msc.productRepository.FindAllProductsForMgr(ctx.Request.Context(), manager.ID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error in queries all products for one user"})
 		return
@@ -98,24 +93,23 @@ func (msc *ManagerStoreControllerImpl) getProductsForMgr(ctx *gin.Context) {
 }
 
 func (msc *ManagerStoreControllerImpl) createStore(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
+	manager := ctx.MustGet("user").(*models.User)
 
 	var store models.Store
 	if err := ctx.ShouldBindJSON(&store); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := msc.managerStoreRepository.Save(&store); err != nil {
+	err := msc.managerStoreRepository.Save(ctx.Request.Context(), &store)
+	if errors.Is(err, models.ErrInvalidCurrency) || errors.Is(err, models.ErrInvalidLocale) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if err := msc.managerStoreRepository.AssignStoreToUser(store.ID, manager.ID); err != nil {
+	if err := msc.membershipRepository.AddStaff(ctx.Request.Context(), store.ID, manager.ID, models.StoreRelationshipOwner); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -123,20 +117,12 @@ func (msc *ManagerStoreControllerImpl) createStore(ctx *gin.Context) {
 }
 
 func (msc *ManagerStoreControllerImpl) deleteStore(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
 	storeID, err := strconv.ParseInt(ctx.Param("store_id"), 10, 64)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
 		return
 	}
-	if err := msc.managerStoreRepository.DeleteStore(storeID); err != nil {
+	if err := msc.managerStoreRepository.DeleteStore(ctx.Request.Context(), storeID); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -144,20 +130,19 @@ func (msc *ManagerStoreControllerImpl) deleteStore(ctx *gin.Context) {
 }
 
 func (msc *ManagerStoreControllerImpl) assignStoreToUser(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
+	manager := ctx.MustGet("user").(*models.User)
 
 	storeID, err := strconv.ParseInt(ctx.Param("store_id"), 10, 64)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
 		return
 	}
-	if err := msc.managerStoreRepository.AssignStoreToUser(storeID, manager.ID); err != nil {
+	err = msc.membershipRepository.AddStaff(ctx.Request.Context(), storeID, manager.ID, models.StoreRelationshipOwner)
+	if errors.Is(err, models.ErrAlreadyStaff) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -165,25 +150,18 @@ func (msc *ManagerStoreControllerImpl) assignStoreToUser(ctx *gin.Context) {
 }
 
 func (msc *ManagerStoreControllerImpl) AddProductToStore(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
 	storeID, _ := strconv.ParseInt(ctx.Param("storeId"), 10, 64)
 	productID, _ := strconv.ParseInt(ctx.Param("productId"), 10, 64)
 
-	if !msc.storeRepository.CheckUserHasAccessToStore(manager, storeID) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to manage this store"})
-		return
-	}
-
-	err := msc.productStoreRepository.AddProductToStore(storeID, productID)
+	err := msc.productStoreService.AddProductToStore(ctx.Request.Context(), storeID, productID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add product to store"})
+		status := productErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			log.WithContext(ctx.Request.Context()).Errorf("Failed to add product to store: %v", err)
+			ctx.JSON(status, gin.H{"error": "Failed to add product to store"})
+			return
+		}
+		ctx.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -191,25 +169,12 @@ func (msc *ManagerStoreControllerImpl) AddProductToStore(ctx *gin.Context) {
 }
 
 func (msc *ManagerStoreControllerImpl) RemoveProductFromStore(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
 	storeID, _ := strconv.ParseInt(ctx.Param("storeId"), 10, 64)
 	productID, _ := strconv.ParseInt(ctx.Param("productId"), 10, 64)
 
-	if !msc.storeRepository.CheckUserHasAccessToStore(manager, storeID) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to manage this store"})
-		return
-	}
-
-	err := msc.productStoreRepository.RemoveProductFromStore(storeID, productID)
+	err := msc.productStoreRepository.RemoveProductFromStore(ctx.Request.Context(), storeID, productID)
 	if err != nil {
-		log.Errorf("Failed to remove product from store: %v", err)
+		log.WithContext(ctx.Request.Context()).Errorf("Failed to remove product from store: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove product from store"})
 		return
 	}
@@ -218,19 +183,9 @@ func (msc *ManagerStoreControllerImpl) RemoveProductFromStore(ctx *gin.Context)
 }
 
 func (msc *ManagerStoreControllerImpl) CreateProductInStore(c *gin.Context) {
-	user, _ := c.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
+	manager := c.MustGet("user").(*models.User)
 
 	storeID, _ := strconv.ParseInt(c.Param("storeId"), 10, 64)
-	if !msc.storeRepository.CheckUserHasAccessToStore(manager, storeID) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to manage this store"})
-		return
-	}
 
 	var product models.Product
 	if err := c.BindJSON(&product); err != nil {
@@ -238,31 +193,29 @@ func (msc *ManagerStoreControllerImpl) CreateProductInStore(c *gin.Context) {
 		return
 	}
 
-	createdProduct, err := msc.productStoreService.CreateProductInStore(user.(*models.User), storeID, &product)
+	createdProduct, err := msc.productStoreService.CreateProductInStore(c.Request.Context(), manager, storeID, &product)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(productErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusCreated, createdProduct)
 }
 
-func (msc *ManagerStoreControllerImpl) GetOrdersByStoreID(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
+func productErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrStoreNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrInvalidMoney), errors.Is(err, models.ErrInvalidCurrency), errors.Is(err, models.ErrCurrencyMismatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
 	}
+}
 
+func (msc *ManagerStoreControllerImpl) GetOrdersByStoreID(ctx *gin.Context) {
 	storeID, _ := strconv.ParseInt(ctx.Param("storeId"), 10, 64)
-	if !msc.storeRepository.CheckUserHasAccessToStore(manager, storeID) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to manage this store"})
-		return
-	}
-
-	orders, err := msc.orderRepository.GetOrdersByStoreID(storeID)
+	orders, err := msc.orderRepository.GetOrdersByStoreID(ctx.Request.Context(), storeID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving orders"})
 		return
@@ -272,14 +225,6 @@ func (msc *ManagerStoreControllerImpl) GetOrdersByStoreID(ctx *gin.Context) {
 }
 
 func (msc *ManagerStoreControllerImpl) UpdateOrderStatus(ctx *gin.Context) {
-	user, _ := ctx.Get("user")
-	manager := user.(*models.User)
-
-	if !isAuthorized(manager) {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
 	orderID, err := strconv.ParseInt(ctx.Param("order_id"), 10, 64)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
@@ -295,7 +240,7 @@ func (msc *ManagerStoreControllerImpl) UpdateOrderStatus(ctx *gin.Context) {
 		return
 	}
 
-	err = msc.orderRepository.UpdateOrderStatus(orderID, input.Status)
+	err = msc.orderRepository.UpdateOrderStatus(ctx.Request.Context(), orderID, input.Status)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating order status"})
 		return
@@ -303,3 +248,51 @@ func (msc *ManagerStoreControllerImpl) UpdateOrderStatus(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
 }
+
+func (msc *ManagerStoreControllerImpl) getStoreMembers(ctx *gin.Context) {
+	storeID, _ := strconv.ParseInt(ctx.Param("storeId"), 10, 64)
+
+	members, err := msc.invitationService.ListMembers(ctx.Request.Context(), storeID)
+	if err != nil {
+		respondInvitationError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, members)
+}
+
+func (msc *ManagerStoreControllerImpl) inviteToStore(ctx *gin.Context) {
+	manager := ctx.MustGet("user").(*models.User)
+	storeID, _ := strconv.ParseInt(ctx.Param("storeId"), 10, 64)
+
+	var input struct {
+		Email        string                   `json:"email" binding:"required"`
+		Relationship models.StoreRelationship `json:"relationship" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	invitation, err := msc.invitationService.Invite(ctx.Request.Context(), manager, storeID, input.Email, input.Relationship)
+	if err != nil {
+		respondInvitationError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusCreated, invitation)
+}
+
+func (msc *ManagerStoreControllerImpl) revokeInvitation(ctx *gin.Context) {
+	storeID, _ := strconv.ParseInt(ctx.Param("store_id"), 10, 64)
+	invitationID, err := strconv.ParseInt(ctx.Param("invitation_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	invitation, err := msc.invitationService.Revoke(ctx.Request.Context(), storeID, invitationID)
+	if err != nil {
+		respondInvitationError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, invitation)
+}
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/services"
@@ -16,25 +18,29 @@ type OrderController interface {
 	GetDelivery(c *gin.Context)
 	CreateDelivery(c *gin.Context)
 	GetTaxRate(c *gin.Context)
+	CalculateTax(c *gin.Context)
 }
 
 type OrderControllerImpl struct {
 	OrderService   services.OrderService
 	UberService    services.UberService
 	TaxRateService services.TaxRateService
+	AddressService services.AddressService
 }
 
-func NewOrderController(orderService services.OrderService, uberService services.UberService, taxRateService services.TaxRateService) OrderController {
+func NewOrderController(orderService services.OrderService, uberService services.UberService, taxRateService services.TaxRateService,
+	addressService services.AddressService) OrderController {
 	return &OrderControllerImpl{
 		OrderService:   orderService,
 		UberService:    uberService,
 		TaxRateService: taxRateService,
+		AddressService: addressService,
 	}
 }
 
 func (oc *OrderControllerImpl) GetUserOrders(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
-	orders, err := oc.OrderService.GetUserOrders(user.ID)
+	orders, err := oc.OrderService.GetUserOrders(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -51,7 +57,7 @@ func (oc *OrderControllerImpl) AddOrderForUser(c *gin.Context) {
 		return
 	}
 
-	savedOrder, err := oc.OrderService.AddOrderForUser(user, &order)
+	savedOrder, err := oc.OrderService.AddOrderForUser(c.Request.Context(), user, &order)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -67,7 +73,22 @@ func (oc *OrderControllerImpl) UberQuote(c *gin.Context) {
 		return
 	}
 
-	response, err := oc.UberService.Quote(&requestBody)
+	// 没有传送货地址的时候用保存的地址（默认是用户的默认收货地址），带上校验时的坐标
+	if requestBody.DropoffAddress == "" {
+		user := c.MustGet("user").(*models.User)
+		addressID := user.DefaultShippingAddressID
+		if id := c.Query("shipping_address_id"); id != "" {
+			addressID, _ = strconv.ParseInt(id, 10, 64)
+		}
+		address, err := oc.AddressService.GetAddressForUser(c.Request.Context(), user, addressID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping address not found"})
+			return
+		}
+		requestBody.SetDropoff(address)
+	}
+
+	response, err := oc.UberService.Quote(c.Request.Context(), &requestBody)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -78,7 +99,7 @@ func (oc *OrderControllerImpl) UberQuote(c *gin.Context) {
 
 func (oc *OrderControllerImpl) GetDelivery(c *gin.Context) {
 	deliveryID := c.Param("deliveryID")
-	response, err := oc.UberService.GetDelivery(deliveryID)
+	response, err := oc.UberService.GetDelivery(c.Request.Context(), deliveryID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -106,7 +127,7 @@ func (oc *OrderControllerImpl) CreateDelivery(c *gin.Context) {
 		}
 	}
 
-	response, err := oc.UberService.CreateDelivery(&requestBody)
+	response, err := oc.UberService.CreateDelivery(c.Request.Context(), &requestBody)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -121,10 +142,59 @@ func (oc *OrderControllerImpl) GetTaxRate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	taxRate, err := oc.TaxRateService.GetTaxRateByZipCodeAndState(&address)
+	taxRate, err := oc.TaxRateService.GetTaxRateByZipCodeAndState(c.Request.Context(), &address)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, taxRate)
 }
+
+// CalculateTax 按收货地址（默认是用户的默认收货地址）计算订单的税，返回带税额明细的订单。
+func (oc *OrderControllerImpl) CalculateTax(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	orderID, err := strconv.ParseInt(c.Param("order_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input struct {
+		ShippingAddressID int64 `json:"shipping_address_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+	if input.ShippingAddressID <= 0 {
+		input.ShippingAddressID = user.DefaultShippingAddressID
+	}
+	address, err := oc.AddressService.GetAddressForUser(c.Request.Context(), user, input.ShippingAddressID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping address not found"})
+		return
+	}
+
+	order, err := oc.OrderService.CalculateTax(c.Request.Context(), user, orderID, address)
+	if err != nil {
+		c.JSON(taxErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+func taxErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound), errors.Is(err, services.ErrStoreNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTaxRateNotFound), errors.Is(err, services.ErrInvalidOrderItem), errors.Is(err, models.ErrCurrencyMismatch),
+		errors.Is(err, services.ErrInvalidCheckout):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrOrderAlreadyPaid):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
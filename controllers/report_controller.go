@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const reportDateLayout = "2006-01-02"
+
+type ReportController interface {
+	RegisterRoutes(router *gin.RouterGroup)
+}
+
+type ReportControllerImpl struct {
+	authorizer       middlewares.Authorizer
+	taxReportService services.TaxReportService
+}
+
+func NewReportController(authorizer middlewares.Authorizer, taxReportService services.TaxReportService) ReportController {
+	return &ReportControllerImpl{
+		authorizer:       authorizer,
+		taxReportService: taxReportService,
+	}
+}
+
+func (rc *ReportControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.Use(rc.authorizer.Require(models.PermissionReportView))
+	router.GET("/tax-liability", rc.taxLiability)
+}
+
+// taxLiability 统计 from 到 to（都包括，UTC日期）之间付款的订单的销售额和税，format=csv的时候下载CSV。
+func (rc *ReportControllerImpl) taxLiability(ctx *gin.Context) {
+	from, err := time.Parse(reportDateLayout, ctx.Query("from"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+		return
+	}
+	to, err := time.Parse(reportDateLayout, ctx.Query("to"))
+	if err != nil || to.Before(from) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD not before from"})
+		return
+	}
+
+	report, err := rc.taxReportService.TaxLiabilityReport(ctx.Request.Context(), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if ctx.Query("format") != "csv" {
+		ctx.JSON(http.StatusOK, report)
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="tax-liability-%s-%s.csv"`,
+		from.Format(reportDateLayout), to.Format(reportDateLayout)))
+	ctx.Header("Content-Type", "text/csv")
+	ctx.Status(http.StatusOK)
+	if err = services.WriteTaxLiabilityCSV(ctx.Writer, report); err != nil {
+		log.WithContext(ctx.Request.Context()).Errorf("Errors in writing tax liability report, err: \n%v", err)
+	}
+}
@@ -18,25 +18,28 @@ type StoreController interface {
 	DeleteDefaultStore(c *gin.Context)
 	GetProductsByStoreID(c *gin.Context)
 	GetStoreInfo(c *gin.Context)
+	GetFavoriteStores(c *gin.Context)
+	AddFavoriteStore(c *gin.Context)
+	RemoveFavoriteStore(c *gin.Context)
 }
 
 type StoreControllerImpl struct {
 	ManagerStoreRepository repositories.ManagerStoreRepository
 	ProductStoreRepo       repositories.ProductStoreRepository
 	StoreRepo              repositories.StoreRepository
-	UserStoreRepo          repositories.UserStoreRepository
+	MembershipRepo         repositories.StoreMembershipRepository
 }
 
 func NewStoreController(
 	managerStoreRep repositories.ManagerStoreRepository,
 	psRepo repositories.ProductStoreRepository,
 	storeRepository repositories.StoreRepository,
-	usRepo repositories.UserStoreRepository) StoreController {
+	membershipRepo repositories.StoreMembershipRepository) StoreController {
 	return &StoreControllerImpl{
 		ManagerStoreRepository: managerStoreRep,
 		ProductStoreRepo:       psRepo,
 		StoreRepo:              storeRepository,
-		UserStoreRepo:          usRepo,
+		MembershipRepo:         membershipRepo,
 	}
 }
 
@@ -47,13 +50,13 @@ func (sc *StoreControllerImpl) GetDefaultStore(c *gin.Context) {
 		return
 	}
 
-	userStore, err := sc.UserStoreRepo.FindDefaultUserStore(userID)
+	membership, err := sc.MembershipRepo.FindDefaultStore(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Default store not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, userStore.Store)
+	c.JSON(http.StatusOK, membership.Store)
 }
 
 func (sc *StoreControllerImpl) SetDefaultStore(c *gin.Context) {
@@ -69,25 +72,13 @@ func (sc *StoreControllerImpl) SetDefaultStore(c *gin.Context) {
 		return
 	}
 
-	store, err := sc.StoreRepo.FindByID(storeID)
+	store, err := sc.StoreRepo.FindByID(c.Request.Context(), storeID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
 		return
 	}
 
-	userStore, err := sc.UserStoreRepo.FindDefaultUserStore(userID)
-	if err == nil {
-		userStore.IsEnable = false
-		_ = sc.UserStoreRepo.Save(userStore)
-	}
-
-	newUserStore := &models.UserStore{
-		UserID:   userID,
-		StoreID:  storeID,
-		IsEnable: true,
-	}
-
-	err = sc.UserStoreRepo.Save(newUserStore)
+	err = sc.MembershipRepo.SetDefaultStore(c.Request.Context(), userID, storeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting default store"})
 		return
@@ -97,7 +88,7 @@ func (sc *StoreControllerImpl) SetDefaultStore(c *gin.Context) {
 }
 
 func (sc *StoreControllerImpl) GetAllStores(c *gin.Context) {
-	stores, err := sc.StoreRepo.FindAll()
+	stores, err := sc.StoreRepo.FindAll(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving all stores"})
 		return
@@ -108,7 +99,7 @@ func (sc *StoreControllerImpl) GetAllStores(c *gin.Context) {
 
 func (sc *StoreControllerImpl) DeleteDefaultStore(c *gin.Context) {
 	user, _ := c.MustGet("user").(*models.User)
-	err := sc.UserStoreRepo.DisableDefaultStore(user.ID)
+	err := sc.MembershipRepo.DeleteDefaultStore(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting default store"})
 		return
@@ -125,7 +116,7 @@ func (sc *StoreControllerImpl) GetProductsByStoreID(c *gin.Context) {
 		return
 	}
 
-	productStores, err := sc.ProductStoreRepo.FindAllByStoreID(storeID)
+	productStores, err := sc.ProductStoreRepo.FindAllByStoreID(c.Request.Context(), storeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching products"})
 		return
@@ -155,7 +146,7 @@ func (sc *StoreControllerImpl) GetStoreInfo(c *gin.Context) {
 		return
 	}
 
-	store, err := sc.StoreRepo.FindByID(storeID)
+	store, err := sc.StoreRepo.FindByID(c.Request.Context(), storeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -163,3 +154,66 @@ func (sc *StoreControllerImpl) GetStoreInfo(c *gin.Context) {
 
 	c.JSON(http.StatusOK, store)
 }
+
+func (sc *StoreControllerImpl) GetFavoriteStores(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stores, err := sc.MembershipRepo.FindFavoriteStores(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrieving favorite stores"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stores)
+}
+
+func (sc *StoreControllerImpl) AddFavoriteStore(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	storeID, err := strconv.ParseInt(c.Param("store_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return
+	}
+
+	if _, err := sc.StoreRepo.FindByID(c.Request.Context(), storeID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		return
+	}
+
+	if err := sc.MembershipRepo.AddFavoriteStore(c.Request.Context(), userID, storeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding favorite store"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (sc *StoreControllerImpl) RemoveFavoriteStore(c *gin.Context) {
+	userID, err := getUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	storeID, err := strconv.ParseInt(c.Param("store_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return
+	}
+
+	if err := sc.MembershipRepo.RemoveFavoriteStore(c.Request.Context(), userID, storeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing favorite store"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// StoreInvitationController 给被邀请的人用，发邀请/撤销邀请在 ManagerStoreController 里。
+type StoreInvitationController interface {
+	AcceptInvitation(c *gin.Context)
+}
+
+type StoreInvitationControllerImpl struct {
+	InvitationService services.StoreInvitationService
+}
+
+func NewStoreInvitationController(invitationService services.StoreInvitationService) StoreInvitationController {
+	return &StoreInvitationControllerImpl{
+		InvitationService: invitationService,
+	}
+}
+
+func (ic *StoreInvitationControllerImpl) AcceptInvitation(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	invitation, err := ic.InvitationService.Accept(c.Request.Context(), user, c.Param("token"))
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, invitation)
+}
+
+func respondInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+	case errors.Is(err, services.ErrInvalidEmail), errors.Is(err, services.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvitationEmailMismatch):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvitationNotPending), errors.Is(err, models.ErrAlreadyStaff):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvitationExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		log.WithContext(c.Request.Context()).Errorf("Errors in invitation request %v, err: \n%v", c.Request.URL, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -2,16 +2,25 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/atomi-ai/atomi/models"
-	"github.com/atomi-ai/atomi/repositories"
 	"github.com/atomi-ai/atomi/services"
 	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"github.com/stripe/stripe-go/v74"
+	"github.com/stripe/stripe-go/v74/webhook"
 )
 
+// Stripe的事件不会超过这个大小
+const maxStripeWebhookBytes = 65536
+
 type StripeController interface {
 	AttachPaymentMethodToCustomer(c *gin.Context)
 	DeleteAllPaymentMethods(c *gin.Context)
@@ -20,23 +29,24 @@ type StripeController interface {
 	Pay(c *gin.Context)
 	ListPaymentIntents(c *gin.Context)
 	PaymentIntent(c *gin.Context)
+	Webhook(c *gin.Context)
 }
 
 type StripeControllerImpl struct {
-	UserService   services.UserService
-	StripeService services.StripeService
-	OrderService  services.OrderService
-	UberService   services.UberService
-	AddressRepo   repositories.AddressRepository
+	UserService    services.UserService
+	StripeService  services.StripeService
+	OrderService   services.OrderService
+	UberService    services.UberService
+	AddressService services.AddressService
 }
 
-func NewStripeController(userService services.UserService, stripeService services.StripeService, orderService services.OrderService, uberService services.UberService, addressRepo repositories.AddressRepository) StripeController {
+func NewStripeController(userService services.UserService, stripeService services.StripeService, orderService services.OrderService, uberService services.UberService, addressService services.AddressService) StripeController {
 	return &StripeControllerImpl{
-		UserService:   userService,
-		StripeService: stripeService,
-		OrderService:  orderService,
-		UberService:   uberService,
-		AddressRepo:   addressRepo,
+		UserService:    userService,
+		StripeService:  stripeService,
+		OrderService:   orderService,
+		UberService:    uberService,
+		AddressService: addressService,
 	}
 }
 
@@ -44,7 +54,7 @@ func (sc *StripeControllerImpl) AttachPaymentMethodToCustomer(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 	paymentMethodID := c.Param("paymentMethodId")
 
-	pm, err := sc.StripeService.AttachPaymentMethodToCustomer(user.StripeCustomerID, paymentMethodID)
+	pm, err := sc.StripeService.AttachPaymentMethodToCustomer(c.Request.Context(), user.StripeCustomerID, paymentMethodID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -56,7 +66,7 @@ func (sc *StripeControllerImpl) AttachPaymentMethodToCustomer(c *gin.Context) {
 func (sc *StripeControllerImpl) ListPaymentMethods(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 
-	iter, err := sc.StripeService.ListPaymentMethods(user.StripeCustomerID)
+	iter, err := sc.StripeService.ListPaymentMethods(c.Request.Context(), user.StripeCustomerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -83,7 +93,7 @@ func (sc *StripeControllerImpl) ListPaymentMethods(c *gin.Context) {
 func (sc *StripeControllerImpl) DeletePaymentMethod(c *gin.Context) {
 	paymentMethodID := c.Param("paymentMethodId")
 
-	pm, err := sc.StripeService.DeletePaymentMethod(paymentMethodID)
+	pm, err := sc.StripeService.DeletePaymentMethod(c.Request.Context(), paymentMethodID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -92,7 +102,7 @@ func (sc *StripeControllerImpl) DeletePaymentMethod(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 	if user.PaymentMethodID != nil && *user.PaymentMethodID == paymentMethodID {
 		// 如果匹配，将 PaymentMethodID 设置为 nil 并保存更改
-		_, err = sc.UserService.SetCurrentPaymentMethod(user, nil)
+		_, err = sc.UserService.SetCurrentPaymentMethod(c.Request.Context(), user, nil)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -116,7 +126,7 @@ func (sc *StripeControllerImpl) Pay(c *gin.Context) {
 		return
 	}
 
-	order, err := sc.OrderService.FindOrderByID(piRequest.OrderID)
+	order, err := sc.OrderService.FindOrderByID(c.Request.Context(), piRequest.OrderID)
 	if err != nil || order == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Order not found"})
 		return
@@ -127,30 +137,91 @@ func (sc *StripeControllerImpl) Pay(c *gin.Context) {
 		shippingAddrID = user.DefaultShippingAddressID
 	}
 
-	shippingAddr, err := sc.AddressRepo.FindByID(shippingAddrID)
+	shippingAddr, err := sc.AddressService.GetAddressForUser(c.Request.Context(), user, shippingAddrID)
+	if errors.Is(err, services.ErrUserAddressNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping address not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	pi, err := sc.StripeService.CreatePaymentIntent(user, &piRequest, shippingAddr)
+	fulfillment := piRequest.Fulfillment
+	if fulfillment == "" {
+		fulfillment = models.FulfillmentDelivery
+	}
+	// 要建Uber Delivery的时候服务端重新报价，运费按这个报价算；其他情况运费是0。已经付过款的订单返回409
+	var deliveryAddr *models.Address
+	if fulfillment == models.FulfillmentDelivery && piRequest.DeliveryData != nil {
+		deliveryAddr = shippingAddr
+	}
+	order, quote, err := sc.OrderService.PriceDelivery(c.Request.Context(), user, order.ID, deliveryAddr)
+	if err != nil {
+		c.JSON(taxErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// 付款之前按收货地址在服务端算一次税，明细保存在订单上并写进Stripe的metadata
+	order, err = sc.OrderService.CalculateTax(c.Request.Context(), user, order.ID, shippingAddr)
+	if err != nil {
+		c.JSON(taxErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	// 结账的币种要和店（订单）的币种一样
+	if !strings.EqualFold(piRequest.Currency, order.Total.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Payment currency %q does not match the store currency %v", piRequest.Currency, order.Total.Currency)})
+		return
+	}
+	// 客户端显示的金额和服务端算的不一样的时候不付款，让客户端刷新之后再确认
+	if piRequest.Money() != order.Total {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Payment amount %v does not match the order total %v", piRequest.Money(), order.Total)})
+		return
+	}
+
+	// 下单时的送货方式、地址和收货人保存在订单上，之后的Delivery按它建
+	order, err = sc.OrderService.CaptureContact(c.Request.Context(), user, order.ID, &services.CheckoutContact{
+		Fulfillment:   fulfillment,
+		Address:       shippingAddr,
+		RecipientName: piRequest.RecipientName,
+		Phone:         piRequest.RecipientPhone,
+		Notes:         piRequest.Notes,
+	})
+	if err != nil {
+		c.JSON(taxErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	pi, err := sc.StripeService.CreatePaymentIntent(c.Request.Context(), user, &piRequest, shippingAddr, order)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err = sc.OrderService.UpdatePaymentIntentID(piRequest.OrderID, pi.ID)
+	_, err = sc.OrderService.UpdatePaymentIntentID(c.Request.Context(), piRequest.OrderID, pi.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if pi.Status == stripe.PaymentIntentStatusSucceeded {
+		// 需要再次验证的支付之后由webhook记录
+		if err = sc.OrderService.MarkPaid(c.Request.Context(), pi.ID, time.Now()); err != nil {
+			log.WithContext(c.Request.Context()).Errorf("Errors in marking order %d as paid, err: \n%v", order.ID, err)
+		}
+	}
 
-	if piRequest.DeliveryData == nil {
+	if piRequest.DeliveryData == nil || order.Fulfillment != models.FulfillmentDelivery {
 		c.JSON(http.StatusOK, pi)
 		return
 	}
 
-	deliveryRequest := *piRequest.DeliveryData
+	deliveryRequest, err := sc.OrderService.BuildDeliveryData(c.Request.Context(), order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// 用服务端的报价，运费和订单上收的一样；地址、收货人和商品都以订单为准
+	deliveryRequest.QuoteID = &quote.ID
 	// 根据你的配置文件设置测试模式
 	testMode := viper.GetBool("testMode")
 
@@ -164,13 +235,13 @@ func (sc *StripeControllerImpl) Pay(c *gin.Context) {
 	}
 
 	// TODO: 改成由后台手动创建Delivery订单？
-	deliveryResponse, err := sc.UberService.CreateDelivery(&deliveryRequest)
+	deliveryResponse, err := sc.UberService.CreateDelivery(c.Request.Context(), deliveryRequest)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err = sc.OrderService.UpdateDeliveryID(piRequest.OrderID, deliveryResponse.ID)
+	_, err = sc.OrderService.UpdateDeliveryID(c.Request.Context(), piRequest.OrderID, deliveryResponse.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -182,7 +253,7 @@ func (sc *StripeControllerImpl) Pay(c *gin.Context) {
 func (sc *StripeControllerImpl) DeleteAllPaymentMethods(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 
-	iter, err := sc.StripeService.ListPaymentMethods(user.StripeCustomerID)
+	iter, err := sc.StripeService.ListPaymentMethods(c.Request.Context(), user.StripeCustomerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -191,7 +262,7 @@ func (sc *StripeControllerImpl) DeleteAllPaymentMethods(c *gin.Context) {
 	// 遍历迭代器并删除每个PaymentMethod
 	for iter.Next() {
 		paymentMethod := iter.PaymentMethod()
-		_, err := sc.StripeService.DeletePaymentMethod(paymentMethod.ID)
+		_, err := sc.StripeService.DeletePaymentMethod(c.Request.Context(), paymentMethod.ID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -204,7 +275,7 @@ func (sc *StripeControllerImpl) DeleteAllPaymentMethods(c *gin.Context) {
 		return
 	}
 
-	_, err = sc.UserService.SetCurrentPaymentMethod(user, nil)
+	_, err = sc.UserService.SetCurrentPaymentMethod(c.Request.Context(), user, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -215,7 +286,7 @@ func (sc *StripeControllerImpl) DeleteAllPaymentMethods(c *gin.Context) {
 
 func (sc *StripeControllerImpl) ListPaymentIntents(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
-	iter, err := sc.StripeService.ListPaymentIntents(user.StripeCustomerID)
+	iter, err := sc.StripeService.ListPaymentIntents(c.Request.Context(), user.StripeCustomerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -237,7 +308,7 @@ func (sc *StripeControllerImpl) ListPaymentIntents(c *gin.Context) {
 
 func (sc *StripeControllerImpl) PaymentIntent(c *gin.Context) {
 	paymentIntentID := c.Param("paymentIntentId")
-	paymentIntent, err := sc.StripeService.RetrievePaymentIntent(paymentIntentID)
+	paymentIntent, err := sc.StripeService.RetrievePaymentIntent(c.Request.Context(), paymentIntentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -245,3 +316,44 @@ func (sc *StripeControllerImpl) PaymentIntent(c *gin.Context) {
 
 	c.JSON(http.StatusOK, paymentIntent)
 }
+
+// Webhook 接收Stripe的事件（签名用stripeWebhookSecret验证），记录付款成功和退款，报税的报表按这些数据统计。
+func (sc *StripeControllerImpl) Webhook(c *gin.Context) {
+	secret := viper.GetString("stripeWebhookSecret")
+	if secret == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Stripe webhook is not configured"})
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxStripeWebhookBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	event, err := webhook.ConstructEvent(payload, c.GetHeader("Stripe-Signature"), secret)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	eventTime := time.Unix(event.Created, 0)
+	switch event.Type {
+	case "payment_intent.succeeded":
+		var pi stripe.PaymentIntent
+		if err = json.Unmarshal(event.Data.Raw, &pi); err == nil {
+			err = sc.OrderService.MarkPaid(ctx, pi.ID, eventTime)
+		}
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err = json.Unmarshal(event.Data.Raw, &charge); err == nil && charge.PaymentIntent != nil {
+			err = sc.OrderService.RecordRefund(ctx, charge.PaymentIntent.ID, models.NewMoney(charge.AmountRefunded, string(charge.Currency)), eventTime)
+		}
+	}
+	// 不是我们的订单的事件直接忽略，其他错误返回500让Stripe重试
+	if err != nil && !errors.Is(err, services.ErrOrderNotFound) {
+		log.WithContext(ctx).Errorf("Errors in handling Stripe event %v (%v), err: \n%v", event.ID, event.Type, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/repositories"
@@ -14,17 +15,21 @@ type UserController interface {
 	SetCurrentPaymentMethod(c *gin.Context)
 	GetUser(c *gin.Context)
 	SubmitDeleteUserRequest(c *gin.Context)
+	RequestDataExport(c *gin.Context)
+	GetDataExport(c *gin.Context)
 }
 
 type UserControllerImpl struct {
-	UserService services.UserService
-	DeleteRepo  repositories.DeleteUserRequestRepository
+	UserService       services.UserService
+	UserExportService services.UserExportService
+	DeleteRepo        repositories.DeleteUserRequestRepository
 }
 
-func NewUserController(userService services.UserService, deleteRepo repositories.DeleteUserRequestRepository) UserController {
+func NewUserController(userService services.UserService, userExportService services.UserExportService, deleteRepo repositories.DeleteUserRequestRepository) UserController {
 	return &UserControllerImpl{
-		UserService: userService,
-		DeleteRepo:  deleteRepo,
+		UserService:       userService,
+		UserExportService: userExportService,
+		DeleteRepo:        deleteRepo,
 	}
 }
 
@@ -38,10 +43,10 @@ func (uc *UserControllerImpl) SetCurrentPaymentMethod(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 	paymentMethodID := c.Param("paymentMethodId")
 
-	updatedUser, err := uc.UserService.SetCurrentPaymentMethod(user, &paymentMethodID)
+	updatedUser, err := uc.UserService.SetCurrentPaymentMethod(c.Request.Context(), user, &paymentMethodID)
 
 	if err != nil {
-		log.Errorf("Errors in updating payment method of user: %v(%v), err: \n%v", user, paymentMethodID, err)
+		log.WithContext(c.Request.Context()).Errorf("Errors in updating payment method of user: %v(%v), err: \n%v", user.ID, paymentMethodID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -52,13 +57,61 @@ func (uc *UserControllerImpl) SetCurrentPaymentMethod(c *gin.Context) {
 func (uc *UserControllerImpl) SubmitDeleteUserRequest(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 
-	err := uc.DeleteRepo.AddRequest(user.ID)
+	err := uc.DeleteRepo.AddRequest(c.Request.Context(), user.ID)
 
 	if err != nil {
-		log.Errorf("Errors in submitting delete user request: %v, err: \n%v", user, err)
+		log.WithContext(c.Request.Context()).Errorf("Errors in submitting delete user request: %v, err: \n%v", user.ID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Request submitted successfully"})
 }
+
+func (uc *UserControllerImpl) RequestDataExport(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	var input struct {
+		Format models.UserExportFormat `json:"format"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if input.Format != "" && input.Format != models.UserExportFormatJSON && input.Format != models.UserExportFormatZip {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported export format"})
+		return
+	}
+
+	request, err := uc.UserExportService.RequestExport(c.Request.Context(), user, input.Format)
+	if err != nil {
+		log.WithContext(c.Request.Context()).Errorf("Errors in requesting data export: %v, err: \n%v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, request)
+}
+
+func (uc *UserControllerImpl) GetDataExport(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	exportID, err := strconv.ParseInt(c.Param("exportId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export ID"})
+		return
+	}
+
+	request, err := uc.UserExportService.GetExport(c.Request.Context(), user, exportID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if request == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
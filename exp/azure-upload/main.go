@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/utils"
 	"log"
 )
@@ -14,7 +16,7 @@ func main() {
 		log.Fatalf("Failed to connect blob storage: #{err}")
 	}
 
-	blobURL, err := abs.UploadFile(localFilePath)
+	blobURL, err := abs.UploadFile(context.Background(), localFilePath)
 	if err != nil {
 		log.Fatalf("Failed to upload file to Azure Blob Storage: %v", err)
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/atomi-ai/atomi/models"
@@ -15,7 +16,7 @@ func main() {
 		Email: "test7@atomi.ai",
 		Role:  models.RoleUser,
 	}
-	_, err := userRepo.Save(user)
+	_, err := userRepo.Save(context.Background(), user)
 	if err != nil {
 		fmt.Errorf("Error saving user to database: %w", err)
 	}
@@ -0,0 +1,37 @@
+// dev-token 用 local auth provider 的配置签发一个token，方便离线开发的时候调用API：
+//
+//	CONFIG_FILE=config.yaml go run ./exp/dev-token -email user@atomi.ai
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/atomi-ai/atomi/utils"
+)
+
+func main() {
+	email := flag.String("email", "user@atomi.ai", "email in the token")
+	subject := flag.String("subject", "", "subject in the token, defaults to the email")
+	ttl := flag.Duration("ttl", 24*time.Hour, "how long the token is valid")
+	flag.Parse()
+
+	utils.LoadConfig()
+	issuer, err := utils.NewLocalIssuerFromConfig()
+	if err != nil {
+		fmt.Println("error initializing local issuer:", err)
+		os.Exit(1)
+	}
+
+	if *subject == "" {
+		*subject = *email
+	}
+	token, err := issuer.IssueToken(*subject, *email, *ttl)
+	if err != nil {
+		fmt.Println("error issuing token:", err)
+		os.Exit(1)
+	}
+	fmt.Println(token)
+}
@@ -50,7 +50,7 @@ func main() {
 	}
 
 	// Create
-	gormDB.Create(&models.Product{Name: "D42", Price: 100})
+	gormDB.Create(&models.Product{Name: "D42", Price: models.NewMoney(10000, models.DefaultCurrency)})
 
 	// Read
 	var product models.Product
@@ -58,7 +58,7 @@ func main() {
 	gormDB.First(&product, "code = ?", "D42") // find product with code D42
 
 	// Update - update product's price to 200
-	gormDB.Model(&product).Update("Price", 200)
+	gormDB.Model(&product).Update("price_amount", 20000)
 
 	// Delete - delete product
 	gormDB.Delete(&product)
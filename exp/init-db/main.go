@@ -10,6 +10,7 @@ import (
 	"github.com/atomi-ai/atomi/utils"
 
 	"firebase.google.com/go/v4/auth"
+	"github.com/atomi-ai/atomi/migrations"
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/repositories"
 	"github.com/atomi-ai/atomi/services"
@@ -22,12 +23,13 @@ const (
 )
 
 type TestEnvSetup struct {
-	ConfigRepository       repositories.ConfigRepository
-	ManagerStoreRepository repositories.ManagerStoreRepository
-	OrderRepository        repositories.OrderRepository
-	OrderItemRepository    repositories.OrderItemRepository
-	ProductRepository      repositories.ProductRepository
-	UserRepository         repositories.UserRepository
+	ConfigRepository          repositories.ConfigRepository
+	ManagerStoreRepository    repositories.ManagerStoreRepository
+	OrderRepository           repositories.OrderRepository
+	OrderItemRepository       repositories.OrderItemRepository
+	ProductRepository         repositories.ProductRepository
+	StoreMembershipRepository repositories.StoreMembershipRepository
+	UserRepository            repositories.UserRepository
 
 	ProductStoreService services.ProductStoreService
 }
@@ -48,8 +50,13 @@ func main() {
 	// App system initialization
 	LoadConfig()
 	db := models.InitDB()
-	models.AutoMigrate(db)
-	utils.LoadTaxRates(db)
+	if err := migrations.Migrate(context.Background(), db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	taxRateImportService := services.NewTaxRateImportService(repositories.NewTaxRateRepository(db), repositories.NewAuditLogRepository(db), repositories.NewTransactor(db))
+	if _, err := taxRateImportService.ImportDir(context.Background(), viper.GetString("taxRatesFileDir")); err != nil {
+		log.Fatalf("Failed to import tax rates: %v", err)
+	}
 	utils.InitStripe(viper.GetString("stripeKey"))
 	firebaseApp := utils.FirebaseAppProvider()
 
@@ -61,13 +68,15 @@ func main() {
 	}
 
 	testEnvSetup := &TestEnvSetup{
-		ConfigRepository:       repositories.NewConfigRepository(db),
-		OrderRepository:        repositories.NewOrderRepository(db),
-		OrderItemRepository:    repositories.NewOrderItemRepository(db),
-		ProductRepository:      repositories.NewProductRepository(db),
-		ProductStoreService:    services.NewProductStoreService(repositories.NewProductRepository(db), repositories.NewProductStoreRepository(db)),
-		ManagerStoreRepository: repositories.NewManagerStoreRepository(db),
-		UserRepository:         repositories.NewUserRepository(db),
+		ConfigRepository:    repositories.NewConfigRepository(db),
+		OrderRepository:     repositories.NewOrderRepository(db),
+		OrderItemRepository: repositories.NewOrderItemRepository(db),
+		ProductRepository:   repositories.NewProductRepository(db),
+		ProductStoreService: services.NewProductStoreService(repositories.NewProductRepository(db), repositories.NewProductStoreRepository(db),
+			repositories.NewStoreRepository(db)),
+		ManagerStoreRepository:    repositories.NewManagerStoreRepository(db),
+		StoreMembershipRepository: repositories.NewStoreMembershipRepository(db),
+		UserRepository:            repositories.NewUserRepository(db),
 	}
 	testEnvSetup.run(authClient)
 }
@@ -100,17 +109,17 @@ func (t *TestEnvSetup) run(authClient *auth.Client) {
 		State:   "TX",
 		Phone:   "5103490222",
 	}
-	t.ManagerStoreRepository.Save(store1)
-	t.ManagerStoreRepository.Save(store2)
+	t.ManagerStoreRepository.Save(context.Background(), store1)
+	t.ManagerStoreRepository.Save(context.Background(), store2)
 	log.Infof("store1 = %v, store2 = %v", store1, store2)
-	err1 := t.ManagerStoreRepository.AssignStoreToUser(store1.ID, manager.ID)
-	err2 := t.ManagerStoreRepository.AssignStoreToUser(store2.ID, manager.ID)
+	err1 := t.StoreMembershipRepository.SetStaffRelationship(context.Background(), store1.ID, manager.ID, models.StoreRelationshipOwner)
+	err2 := t.StoreMembershipRepository.SetStaffRelationship(context.Background(), store2.ID, manager.ID, models.StoreRelationshipOwner)
 	if err1 != nil || err2 != nil {
 		panic(fmt.Sprintf("Errors in assign store to manager, %v, %v", err1, err2))
 	}
 
 	// 4. Connect products and stores
-	t.ProductStoreService.ConnectStoreAndProducts(store1, products)
+	t.ProductStoreService.ConnectStoreAndProducts(context.Background(), store1, products)
 
 	// 5. Add orders for testing
 	t.addOrders(store1, products, user)
@@ -118,7 +127,7 @@ func (t *TestEnvSetup) run(authClient *auth.Client) {
 	// 6. Set testenv_status to "initialized"
 	// 如果您有一个类似于Java代码中的ConfigRepository，请在此处将 testenv_status 设置为 "initialized"
 	// 如果没有，请根据您的具体实现进行修改。
-	t.ConfigRepository.Save(&models.Config{Key: "testenv_status", Value: "initialized"})
+	t.ConfigRepository.Save(context.Background(), &models.Config{Key: "testenv_status", Value: "initialized"})
 	fmt.Println("Finished initializing the test environment.")
 }
 
@@ -139,14 +148,14 @@ func (t *TestEnvSetup) checkOrCreateUserInFirebase(authClient *auth.Client, emai
 	}
 
 	// 在数据库中查找用户
-	user, err := t.UserRepository.FindByEmail(email)
+	user, err := t.UserRepository.FindByEmail(context.Background(), email)
 	if err != nil {
 		// 如果找不到用户，创建一个新的
 		user = &models.User{
 			Email: userRecord.Email,
 			Role:  role,
 		}
-		_, err = t.UserRepository.Save(user)
+		_, err = t.UserRepository.Save(context.Background(), user)
 		if err != nil {
 			panic(fmt.Sprintf("Error saving user to database: %v", err))
 		}
@@ -160,70 +169,70 @@ func (t *TestEnvSetup) addProducts(admin *models.User) []*models.Product {
 			Creator:  admin,
 			Name:     "Hamburger",
 			ImageURL: "https://atomidrone.blob.core.windows.net/images/3.png",
-			Price:    25,
-			Discount: 10,
+			Price:    models.MoneyFromFloat(25, models.DefaultCurrency),
+			Discount: models.MoneyFromFloat(10, models.DefaultCurrency),
 			Category: models.ProductCategoryFood,
 		},
 		{
 			Creator:  admin,
 			Name:     "Pasta",
 			ImageURL: "https://atomidrone.blob.core.windows.net/images/5.png",
-			Price:    150,
-			Discount: 7.8,
+			Price:    models.MoneyFromFloat(150, models.DefaultCurrency),
+			Discount: models.MoneyFromFloat(7.8, models.DefaultCurrency),
 			Category: models.ProductCategoryFood,
 		},
 		{
 			Creator:  admin,
 			Name:     "Akara",
 			ImageURL: "https://atomidrone.blob.core.windows.net/images/2.png",
-			Price:    10.99,
-			Discount: 0,
+			Price:    models.MoneyFromFloat(10.99, models.DefaultCurrency),
+			Discount: models.MoneyFromFloat(0, models.DefaultCurrency),
 			Category: models.ProductCategoryFood,
 		},
 		{
 			Creator:  admin,
 			Name:     "Strawberry",
 			ImageURL: "https://atomidrone.blob.core.windows.net/images/1.png",
-			Price:    50,
-			Discount: 14,
+			Price:    models.MoneyFromFloat(50, models.DefaultCurrency),
+			Discount: models.MoneyFromFloat(14, models.DefaultCurrency),
 			Category: models.ProductCategoryFood,
 		},
 		{
 			Creator:  admin,
 			Name:     "Coca-Cola",
 			ImageURL: "https://atomidrone.blob.core.windows.net/images/6.png",
-			Price:    45.12,
-			Discount: 2,
+			Price:    models.MoneyFromFloat(45.12, models.DefaultCurrency),
+			Discount: models.MoneyFromFloat(2, models.DefaultCurrency),
 			Category: models.ProductCategoryDrink,
 		},
 		{
 			Creator:  admin,
 			Name:     "Lemonade",
 			ImageURL: "https://atomidrone.blob.core.windows.net/images/7.png",
-			Price:    28,
-			Discount: 5.2,
+			Price:    models.MoneyFromFloat(28, models.DefaultCurrency),
+			Discount: models.MoneyFromFloat(5.2, models.DefaultCurrency),
 			Category: models.ProductCategoryDrink,
 		},
 		{
 			Creator:  admin,
 			Name:     "Vodka",
 			ImageURL: "https://atomidrone.blob.core.windows.net/images/8.png",
-			Price:    78.99,
-			Discount: 0,
+			Price:    models.MoneyFromFloat(78.99, models.DefaultCurrency),
+			Discount: models.MoneyFromFloat(0, models.DefaultCurrency),
 			Category: models.ProductCategoryDrink,
 		},
 		{
 			Creator:  admin,
 			Name:     "Tequila",
 			ImageURL: "https://atomidrone.blob.core.windows.net/images/9.png",
-			Price:    1234567,
-			Discount: 3.4,
+			Price:    models.MoneyFromFloat(1234567, models.DefaultCurrency),
+			Discount: models.MoneyFromFloat(3.4, models.DefaultCurrency),
 			Category: models.ProductCategoryDrink,
 		},
 	}
 
 	for _, product := range products {
-		err := t.ProductRepository.Save(product)
+		err := t.ProductRepository.Save(context.Background(), product)
 		if err != nil {
 			fmt.Printf("Error saving product to database: %v\n", err)
 		}
@@ -233,14 +242,14 @@ func (t *TestEnvSetup) addProducts(admin *models.User) []*models.Product {
 }
 
 func (t *TestEnvSetup) saveOrder(order *models.Order) error {
-	if err := t.OrderRepository.Save(order); err != nil {
+	if err := t.OrderRepository.Save(context.Background(), order); err != nil {
 		return err
 	}
 
 	for i := range order.OrderItems {
 		orderItem := &order.OrderItems[i]
 		orderItem.OrderID = order.ID
-		if err := t.OrderItemRepository.Save(orderItem); err != nil {
+		if err := t.OrderItemRepository.Save(context.Background(), orderItem); err != nil {
 			return err
 		}
 	}
@@ -1,59 +1,180 @@
 package middlewares
 
 import (
-	"context"
+	"errors"
 	"strings"
 
-	"github.com/atomi-ai/atomi/repositories"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
 	"github.com/atomi-ai/atomi/utils"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
+// AuthMiddleware 按照路由需要的登录程度分成三档。
+// 带了凭证但是验证不通过的请求在哪一档都返回401。
 type AuthMiddleware interface {
-	Handler() gin.HandlerFunc
+	// Public 不要求登录。带了凭证的话也会设置principal，已经注册过的用户还会设置user。
+	Public() gin.HandlerFunc
+	// Authenticated 要求有效的凭证，只保证有principal，用户不一定注册过（比如 /api/login）。
+	Authenticated() gin.HandlerFunc
+	// Registered 要求有效的凭证，第一次来的用户会自动注册，handler里一定能拿到user。
+	Registered() gin.HandlerFunc
 }
 
 type authMiddlewareImpl struct {
-	UserRepository repositories.UserRepository
-	AuthWrapper    utils.AuthAppWrapper
+	Authenticator       utils.Authenticator
+	APIKeyService       services.APIKeyService
+	ProvisioningService services.UserProvisioningService
 }
 
-func NewAuthMiddleware(userRepository repositories.UserRepository, authWrapper utils.AuthAppWrapper) AuthMiddleware {
+func NewAuthMiddleware(
+	authenticator utils.Authenticator,
+	apiKeyService services.APIKeyService,
+	provisioningService services.UserProvisioningService) AuthMiddleware {
 	return &authMiddlewareImpl{
-		UserRepository: userRepository,
-		AuthWrapper:    authWrapper,
+		Authenticator:       authenticator,
+		APIKeyService:       apiKeyService,
+		ProvisioningService: provisioningService,
 	}
 }
 
-func (a authMiddlewareImpl) Handler() gin.HandlerFunc {
+func (a authMiddlewareImpl) Public() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		log.Debugf("Auth: 0")
-		authHeader := c.Request.Header.Get("Authorization")
-		if authHeader == "" {
+		principal, user, ok := a.authenticate(c)
+		if !ok {
+			return
+		}
+		setIdentity(c, principal, user)
+		c.Next()
+	}
+}
+
+func (a authMiddlewareImpl) Authenticated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, user, ok := a.authenticate(c)
+		if !ok {
+			return
+		}
+		if principal == nil {
 			c.AbortWithStatusJSON(401, gin.H{"error": "Authorization header is required"})
 			return
 		}
+		setIdentity(c, principal, user)
+		c.Next()
+	}
+}
 
-		idToken := strings.TrimPrefix(authHeader, "Bearer ")
-		log.Debugf("Auth: token: %v", idToken)
-		ctx := context.Background()
-		decodedToken, err := a.AuthWrapper.AuthAndDecode(ctx, idToken)
-		if err != nil {
-			log.Errorf("Errors in authenticating/decoding the context, %v", err)
-			c.AbortWithStatusJSON(500, gin.H{"error": "Errors in authenticating/decoding the context"})
+func (a authMiddlewareImpl) Registered() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, user, ok := a.authenticate(c)
+		if !ok {
+			return
+		}
+		if principal == nil {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Authorization header is required"})
 			return
 		}
+		if user == nil {
+			var err error
+			if user, err = a.ProvisioningService.Provision(c.Request.Context(), principal); err != nil {
+				if errors.Is(err, services.ErrEmailInUse) {
+					c.AbortWithStatusJSON(409, gin.H{"error": err.Error()})
+					return
+				}
+				log.WithContext(c.Request.Context()).Errorf("Errors in provisioning user for %v, err: \n%v", principal.Subject, err)
+				c.AbortWithStatusJSON(500, gin.H{"error": "Errors in provisioning user"})
+				return
+			}
+			log.WithContext(c.Request.Context()).Infof("Auth: provisioned user %v for %v/%v", user.ID, principal.Provider, principal.Subject)
+		}
+		setIdentity(c, principal, user)
+		c.Next()
+	}
+}
+
+// authenticate 验证请求里的凭证。没带凭证的时候返回的principal为nil；ok为false表示已经返回了错误。
+func (a authMiddlewareImpl) authenticate(c *gin.Context) (*utils.Principal, *models.User, bool) {
+	if apiKey := c.Request.Header.Get("X-API-Key"); apiKey != "" {
+		return a.authenticateAPIKey(c, apiKey)
+	}
+
+	authHeader := c.Request.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, nil, true
+	}
+
+	idToken := strings.TrimPrefix(authHeader, "Bearer ")
+	principal, err := a.Authenticator.Authenticate(c.Request.Context(), idToken)
+	if err != nil {
+		log.WithContext(c.Request.Context()).Errorf("Errors in authenticating the token, %v", err)
+		c.AbortWithStatusJSON(401, gin.H{"error": "Invalid or expired token"})
+		return nil, nil, false
+	}
+	log.WithContext(c.Request.Context()).Debugf("Auth: principal: %v/%v", principal.Provider, principal.Subject)
+
+	user, err := a.ProvisioningService.Lookup(c.Request.Context(), principal)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return principal, nil, true
+	}
+	if err != nil {
+		log.WithContext(c.Request.Context()).Errorf("Errors in fetching user for %v, err: \n%v", principal.Subject, err)
+		c.AbortWithStatusJSON(500, gin.H{"error": "Error fetching user"})
+		return nil, nil, false
+	}
+	if user.SuspendedAt != nil {
+		c.AbortWithStatusJSON(403, gin.H{"error": "Account suspended"})
+		return nil, nil, false
+	}
+	if user.ServiceAccount {
+		c.AbortWithStatusJSON(403, gin.H{"error": "Service accounts must use an API key"})
+		return nil, nil, false
+	}
+	// 以前的用户只记录了email，第一次带着subject来的时候关联上。
+	if user.AuthSubject == nil && principal.Subject != "" {
+		linked, err := a.ProvisioningService.Provision(c.Request.Context(), principal)
+		if err != nil {
+			log.WithContext(c.Request.Context()).Errorf("Errors in linking user %v to %v/%v, err: \n%v", principal.Email, principal.Provider, principal.Subject, err)
+			c.AbortWithStatusJSON(500, gin.H{"error": "Error fetching user"})
+			return nil, nil, false
+		}
+		user = linked
+	}
+	return principal, user, true
+}
 
-		log.Debugf("Auth: decodedToken: %v", decodedToken)
-		email := decodedToken.Claims["email"].(string)
-		user, err := a.UserRepository.FindByEmail(email)
-		if err == nil {
-			c.Set("user", user)
+func (a authMiddlewareImpl) authenticateAPIKey(c *gin.Context, apiKey string) (*utils.Principal, *models.User, bool) {
+	user, key, err := a.APIKeyService.Authenticate(c.Request.Context(), apiKey)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Invalid API key"})
+			return nil, nil, false
 		}
-		log.Debugf("Auth: user: %v", user)
+		log.WithContext(c.Request.Context()).Errorf("Errors in authenticating the api key, %v", err)
+		c.AbortWithStatusJSON(500, gin.H{"error": "Errors in authenticating the api key"})
+		return nil, nil, false
+	}
+	if user.SuspendedAt != nil {
+		c.AbortWithStatusJSON(403, gin.H{"error": "Account suspended"})
+		return nil, nil, false
+	}
 
-		c.Set("decodedToken", decodedToken)
-		c.Next()
+	log.WithContext(c.Request.Context()).Debugf("Auth: service account %v with api key %v", user.ID, key.Prefix)
+	c.Set("apiKey", key)
+	return &utils.Principal{
+		Subject:       key.Prefix,
+		Email:         user.Email,
+		EmailVerified: true,
+		Provider:      utils.AuthProviderAPIKey,
+	}, user, true
+}
+
+func setIdentity(c *gin.Context, principal *utils.Principal, user *models.User) {
+	if principal != nil {
+		c.Set("principal", principal)
+	}
+	if user != nil {
+		c.Set("user", user)
 	}
 }
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics 按照路由模板（譬如 /api/store/:store_id）统计请求数和延迟，没有匹配到路由的请求归到unmatched。
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		utils.HTTPRequestsTotal.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		utils.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,112 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// 各个路由组默认的限流，可以用 rateLimits.<group>.perMinute / rateLimits.<group>.burst 覆盖，perMinute配成负数表示不限流。
+var defaultRateLimits = map[string]utils.RateLimit{
+	"public": {PerMinute: 300, Burst: 100},
+	"api":    {PerMinute: 600, Burst: 200},
+	// Uber的报价和下单会消耗Uber API的配额。
+	"uber": {PerMinute: 10, Burst: 5},
+	"pay":  {PerMinute: 10, Burst: 5},
+}
+
+// RateLimiter 按路由组限流，用法：
+//
+//	router.POST("/api/uber/quote", rateLimiter.Limit("uber"), handler)
+//
+// 登录过的请求按用户计数，否则按IP计数。admin和service account不受限制。
+// 需要放在AuthMiddleware后面，才能拿到user和principal。
+type RateLimiter interface {
+	Limit(group string) gin.HandlerFunc
+}
+
+type rateLimiterImpl struct {
+	Backend utils.RateLimitBackend
+}
+
+func NewRateLimiter(backend utils.RateLimitBackend) RateLimiter {
+	return &rateLimiterImpl{
+		Backend: backend,
+	}
+}
+
+func (r *rateLimiterImpl) Limit(group string) gin.HandlerFunc {
+	limit, enabled := rateLimitFor(group)
+	return func(c *gin.Context) {
+		if !enabled || rateLimitExempt(c) {
+			c.Next()
+			return
+		}
+
+		result, err := r.Backend.Take(c.Request.Context(), group+":"+rateLimitIdentity(c), limit)
+		if err != nil {
+			// 限流的存储出问题的时候不影响正常请求。
+			log.WithContext(c.Request.Context()).Errorf("Errors in checking rate limit for group %v, err: \n%v", group, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func rateLimitFor(group string) (utils.RateLimit, bool) {
+	limit := defaultRateLimits[group]
+	key := "rateLimits." + group
+	if viper.IsSet(key + ".perMinute") {
+		limit.PerMinute = viper.GetInt(key + ".perMinute")
+	}
+	if viper.IsSet(key + ".burst") {
+		limit.Burst = viper.GetInt(key + ".burst")
+	}
+	if limit.PerMinute == 0 {
+		log.Warnf("No rate limit configured for group %v", group)
+	}
+	return limit, limit.PerMinute > 0
+}
+
+func rateLimitExempt(c *gin.Context) bool {
+	u, _ := c.Get("user")
+	user, ok := u.(*models.User)
+	return ok && user != nil && (user.Role == models.RoleAdmin || user.ServiceAccount)
+}
+
+// rateLimitIdentity 优先用用户ID，还没注册的用principal，匿名请求用IP。
+func rateLimitIdentity(c *gin.Context) string {
+	if u, ok := c.Get("user"); ok {
+		if user, ok := u.(*models.User); ok && user != nil {
+			return fmt.Sprintf("user:%d", user.ID)
+		}
+	}
+	if p, ok := c.Get("principal"); ok {
+		if principal, ok := p.(*utils.Principal); ok && principal.Subject != "" {
+			return "principal:" + principal.Provider + "/" + principal.Subject
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// StoreScope 从请求里解析出权限检查针对的store ID。
+type StoreScope func(c *gin.Context) (int64, error)
+
+// StoreParam 从路径参数里读取store ID，譬如 StoreParam("storeId")。
+func StoreParam(name string) StoreScope {
+	return func(c *gin.Context) (int64, error) {
+		return strconv.ParseInt(c.Param(name), 10, 64)
+	}
+}
+
+// Authorizer 统一做权限检查，用法：
+//
+//	router.PUT("/orders/:order_id/status", authorizer.Require(models.PermissionOrderUpdate, authorizer.OrderParam("order_id")), handler)
+//
+// 不带scope的时候检查用户的全局角色；带scope的时候检查用户在那个店里的角色（admin总是通过）。
+// 用API key访问的时候只检查key上授予的权限和店铺范围，限定了店的key只能访问带scope的接口。
+type Authorizer interface {
+	Require(permission models.Permission, scopes ...StoreScope) gin.HandlerFunc
+	// OrderParam 从路径参数里读取order ID，并用order所属的店作为scope。
+	OrderParam(name string) StoreScope
+}
+
+type authorizerImpl struct {
+	StoreRepository repositories.StoreRepository
+	OrderRepository repositories.OrderRepository
+}
+
+func NewAuthorizer(storeRepository repositories.StoreRepository, orderRepository repositories.OrderRepository) Authorizer {
+	return &authorizerImpl{
+		StoreRepository: storeRepository,
+		OrderRepository: orderRepository,
+	}
+}
+
+func (a *authorizerImpl) Require(permission models.Permission, scopes ...StoreScope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, exists := c.Get("user")
+		user, _ := u.(*models.User)
+		if !exists || user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		// 用API key访问的时候只看key自己的权限和店铺范围。
+		if k, ok := c.Get("apiKey"); ok {
+			key := k.(*models.APIKey)
+			// 只能访问一个店的key不能用在不分店的接口上
+			if !key.HasPermission(permission) || (key.StoreID != nil && len(scopes) == 0) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+				return
+			}
+			for _, scope := range scopes {
+				storeID, ok := resolveScope(c, scope)
+				if !ok {
+					return
+				}
+				if !key.AllowsStore(storeID) {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have access to manage this store"})
+					return
+				}
+			}
+			c.Next()
+			return
+		}
+
+		if len(scopes) == 0 || user.Role == models.RoleAdmin {
+			if !user.Role.HasPermission(permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		for _, scope := range scopes {
+			storeID, ok := resolveScope(c, scope)
+			if !ok {
+				return
+			}
+
+			relationship, err := a.StoreRepository.FindStaffRelationship(c.Request.Context(), user.ID, storeID)
+			if err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					log.WithContext(c.Request.Context()).Errorf("Errors in finding store relationship for user %v, store %v, err: \n%v", user.ID, storeID, err)
+					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Errors in checking permissions"})
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have access to manage this store"})
+				return
+			}
+			if !relationship.HasPermission(permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// resolveScope 解析scope，出错的时候直接写好响应并返回false。
+func resolveScope(c *gin.Context, scope StoreScope) (int64, bool) {
+	storeID, err := scope(c)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+			return 0, false
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid resource ID"})
+		return 0, false
+	}
+	return storeID, true
+}
+
+func (a *authorizerImpl) OrderParam(name string) StoreScope {
+	return func(c *gin.Context) (int64, error) {
+		orderID, err := strconv.ParseInt(c.Param(name), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		order, err := a.OrderRepository.GetByID(c.Request.Context(), orderID)
+		if err != nil {
+			return 0, err
+		}
+		return order.StoreID, nil
+	}
+}
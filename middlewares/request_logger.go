@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	redactedValue   = "[REDACTED]"
+	// 出错的时候最多记录这么多字节的body，可以用 logBodyMaxBytes 覆盖。
+	defaultLogBodyMaxBytes = 2048
+)
+
+// 日志里不能出现的字段（不区分大小写），可以用 logRedactFields 追加。
+var defaultRedactFields = []string{
+	"password", "token", "id_token", "access_token", "refresh_token", "secret", "key", "api_key",
+	"authorization", "client_secret", "payment_method_id", "card", "cvc",
+	"email", "phone", "name", "line1", "line2", "street", "address",
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID 沿用客户端传过来的 X-Request-ID（格式不对的时候重新生成），
+// 写回响应头，并放进request的context里，之后 log.WithContext(c.Request.Context()) 打的日志都会带上。
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set("requestId", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(utils.WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
+
+// RequestLogger 每个请求打一条JSON访问日志。只有出错（状态码>=400）的时候才记录body，
+// 并且JSON里denylist上的字段会被替换掉，其他格式的body不记录。请求头一律不记录。
+// 要放在AuthMiddleware前面，这样认证失败的请求也会有日志；user等信息在c.Next()之后读取。
+func RequestLogger() gin.HandlerFunc {
+	redactFields := map[string]bool{}
+	for _, field := range append(defaultRedactFields, viper.GetStringSlice("logRedactFields")...) {
+		redactFields[strings.ToLower(field)] = true
+	}
+	maxBytes := viper.GetInt("logBodyMaxBytes")
+	if maxBytes <= 0 {
+		maxBytes = defaultLogBodyMaxBytes
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		// 只读前maxBytes个字节，剩下的原样留给handler。
+		var reqBody []byte
+		if c.Request.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(c.Request.Body, int64(maxBytes)))
+			c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(reqBody), c.Request.Body), c.Request.Body}
+		}
+		writer := &bodyLogWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}, maxBytes: maxBytes}
+		c.Writer = writer
+
+		c.Next()
+
+		status := c.Writer.Status()
+		fields := log.Fields{
+			"method":     c.Request.Method,
+			"route":      c.FullPath(),
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  c.ClientIP(),
+			"bytes":      c.Writer.Size(),
+		}
+		if u, ok := c.Get("user"); ok {
+			if user, ok := u.(*models.User); ok && user != nil {
+				fields["user_id"] = user.ID
+			}
+		}
+		if p, ok := c.Get("principal"); ok {
+			if principal, ok := p.(*utils.Principal); ok && principal != nil {
+				fields["principal"] = principal.Provider + "/" + principal.Subject
+			}
+		}
+		for _, param := range []string{"store_id", "storeId"} {
+			if storeID := c.Param(param); storeID != "" {
+				fields["store_id"] = storeID
+			}
+		}
+		if len(c.Errors) > 0 {
+			fields["errors"] = c.Errors.String()
+		}
+
+		entry := log.WithContext(c.Request.Context()).WithFields(fields)
+		switch {
+		case status >= 500:
+			entry.WithFields(logBodies(reqBody, writer.body.Bytes(), redactFields)).Error("request")
+		case status >= 400:
+			entry.WithFields(logBodies(reqBody, writer.body.Bytes(), redactFields)).Warn("request")
+		default:
+			entry.Info("request")
+		}
+	}
+}
+
+func logBodies(reqBody, respBody []byte, redactFields map[string]bool) log.Fields {
+	fields := log.Fields{}
+	if body, ok := redactJSON(reqBody, redactFields); ok {
+		fields["request_body"] = body
+	}
+	if body, ok := redactJSON(respBody, redactFields); ok {
+		fields["response_body"] = body
+	}
+	return fields
+}
+
+// redactJSON 把JSON里denylist上的字段替换成[REDACTED]。不是完整JSON的（包括被截断的）不记录。
+func redactJSON(body []byte, redactFields map[string]bool) (interface{}, bool) {
+	if len(body) == 0 {
+		return nil, false
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, false
+	}
+	return redactValue(value, redactFields), true
+}
+
+func redactValue(value interface{}, redactFields map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redactFields[strings.ToLower(key)] {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactValue(field, redactFields)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i], redactFields)
+		}
+	}
+	return value
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyLogWriter 把响应的前maxBytes个字节留下来，出错的时候写日志用。
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body     *bytes.Buffer
+	maxBytes int
+}
+
+func (w *bodyLogWriter) Write(b []byte) (int, error) {
+	if remaining := w.maxBytes - w.body.Len(); remaining > 0 {
+		if len(b) < remaining {
+			remaining = len(b)
+		}
+		w.body.Write(b[:remaining])
+	}
+	return w.ResponseWriter.Write(b)
+}
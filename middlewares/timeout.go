@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// 默认每个请求最多处理这么久，可以用 requestTimeout（譬如 "15s"）覆盖，配成0表示不设置。
+const defaultRequestTimeout = 30 * time.Second
+
+// RequestTimeout 给c.Request的context加上deadline。controller把这个context一路传给service、
+// repository和Stripe/Uber等外部调用，超时或者客户端断开的时候它们都会被取消。
+// handler因为超时还没写响应的话，这里返回504。
+func RequestTimeout() gin.HandlerFunc {
+	timeout := defaultRequestTimeout
+	if viper.IsSet("requestTimeout") {
+		timeout = viper.GetDuration("requestTimeout")
+	}
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.WithContext(ctx).Warnf("Request exceeded the deadline of %v", timeout)
+			if !c.Writer.Written() {
+				c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out"})
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"fmt"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing 给每个请求创建一个server span，沿用请求头里的traceparent。
+// span放在c.Request的context里，controller往下传这个context就能串起DB和外部调用的span。
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := utils.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.HTTPTarget(c.Request.URL.Path),
+				semconv.NetSockPeerAddr(c.ClientIP()),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if u, ok := c.Get("user"); ok {
+			if user, ok := u.(*models.User); ok && user != nil {
+				span.SetAttributes(attribute.Int64("enduser.id", user.ID))
+			}
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+		}
+	}
+}
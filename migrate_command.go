@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atomi-ai/atomi/migrations"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const migrateUsage = `usage: atomi migrate <command>
+
+  status          列出所有迁移和执行情况
+  up [version]    执行所有（或者版本号不超过version的）没执行的迁移
+  down [steps]    回滚最新的steps个迁移，默认1个
+  create <name>   在migrations/sql下给每个dialect新建空的迁移文件
+`
+
+// runMigrateCommand 处理 atomi migrate ...，返回进程的退出码。
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	// create 只写文件，不需要配置和数据库
+	if args[0] == "create" {
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+		files, err := migrations.Create("migrations/sql", args[1], time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create migration: %v\n", err)
+			return 1
+		}
+		for _, file := range files {
+			fmt.Println(file)
+		}
+		return 0
+	}
+
+	utils.LoadConfig()
+	initLogrus()
+	migrator, err := migrations.NewMigrator(models.InitDB())
+	if err != nil {
+		log.Errorf("Failed to load migrations: %v", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Errorf("Failed to get migration status: %v", err)
+			return 1
+		}
+		printMigrationStatus(statuses)
+	case "up":
+		var target int64
+		if len(args) > 1 {
+			if target, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid version %q\n", args[1])
+				return 2
+			}
+		}
+		count, err := migrator.Up(ctx, target)
+		fmt.Printf("Applied %d migrations\n", count)
+		if err != nil {
+			log.Errorf("Failed to apply migrations: %v", err)
+			return 1
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				fmt.Fprintf(os.Stderr, "Invalid steps %q\n", args[1])
+				return 2
+			}
+		}
+		count, err := migrator.Down(ctx, steps)
+		fmt.Printf("Reverted %d migrations\n", count)
+		if err != nil {
+			log.Errorf("Failed to revert migrations: %v", err)
+			return 1
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+func printMigrationStatus(statuses []migrations.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT\t")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied != nil {
+			appliedAt = status.Applied.AppliedAt.Format(time.RFC3339)
+		}
+		note := ""
+		if status.Modified {
+			note = "MODIFIED"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Migration.Version, status.Migration.Name, appliedAt, note)
+	}
+	w.Flush()
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Dialects 是需要提供SQL的数据库，新建迁移的时候每个都会生成一对文件。
+var Dialects = []string{"mysql", "postgres", "sqlite"}
+
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Create 在dir（一般是migrations/sql）下给每个dialect创建空的up/down文件，版本号是当前的UTC时间。
+func Create(dir, name string, now time.Time) ([]string, error) {
+	name = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "-", "_"))
+	if !migrationNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid migration name %q, use lower case letters, digits and underscores", name)
+	}
+
+	version := now.UTC().Format("20060102150405")
+	var files []string
+	for _, dialect := range Dialects {
+		for _, direction := range []string{"up", "down"} {
+			file := filepath.Join(dir, dialect, fmt.Sprintf("%s_%s.%s.sql", version, name, direction))
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				return nil, err
+			}
+			content := fmt.Sprintf("-- %s %s (%s)\n", name, direction, dialect)
+			if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
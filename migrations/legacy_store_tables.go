@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/atomi-ai/atomi/models"
+	"gorm.io/gorm"
+)
+
+func init() {
+	// 以前启动的时候每次都会检查manager_stores/user_stores，现在作为一次性的数据迁移，
+	// 在access_control建好store_memberships之后执行。
+	registerGoMigration(&Migration{
+		Version: 20261019000002,
+		Name:    "merge_legacy_store_tables",
+		Up: func(ctx context.Context, tx *gorm.DB) error {
+			return models.MigrateLegacyStoreTables(tx)
+		},
+	})
+}
@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const migrationLockName = "atomi_schema_migrations"
+
+// migrationLock 是跨进程的锁，Lock返回释放锁的函数。
+type migrationLock interface {
+	Lock(ctx context.Context, timeout time.Duration) (func(), error)
+}
+
+func newMigrationLock(db *gorm.DB) (migrationLock, error) {
+	switch dialect := db.Dialector.Name(); dialect {
+	case "mysql":
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		return &mysqlMigrationLock{db: sqlDB}, nil
+	case "postgres":
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		return &postgresMigrationLock{db: sqlDB}, nil
+	case "sqlite":
+		// SQLite只在本地和测试里用，同一时间只会有一个进程；每个迁移都在事务里，并发的时候后来的会因为主键冲突失败。
+		return noopMigrationLock{}, nil
+	default:
+		return nil, fmt.Errorf("migrations are not supported for dialect %v", dialect)
+	}
+}
+
+// mysqlMigrationLock 用GET_LOCK拿advisory lock。锁跟着连接走，所以要单独占用一个连接直到释放。
+type mysqlMigrationLock struct {
+	db *sql.DB
+}
+
+func (l *mysqlMigrationLock) Lock(ctx context.Context, timeout time.Duration) (func(), error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, int(timeout.Seconds())).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("timed out after %v waiting for migration lock %v", timeout, migrationLockName)
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName); err != nil {
+			log.Errorf("Errors in releasing migration lock, err: \n%v", err)
+		}
+		conn.Close()
+	}, nil
+}
+
+// postgresMigrationLock 用session级别的pg_advisory_lock，和MySQL一样要单独占用一个连接。
+// pg_advisory_lock没有超时参数，用lock_timeout控制等待时间。
+type postgresMigrationLock struct {
+	db *sql.DB
+}
+
+func (l *postgresMigrationLock) Lock(ctx context.Context, timeout time.Duration) (func(), error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET lock_timeout = %d", timeout.Milliseconds())); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", migrationLockName); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to get migration lock %v within %v: %w", migrationLockName, timeout, err)
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", migrationLockName); err != nil {
+			log.Errorf("Errors in releasing migration lock, err: \n%v", err)
+		}
+		// 连接会回到连接池里，恢复lock_timeout
+		if _, err := conn.ExecContext(context.Background(), "RESET lock_timeout"); err != nil {
+			log.Errorf("Errors in resetting lock_timeout, err: \n%v", err)
+		}
+		conn.Close()
+	}, nil
+}
+
+type noopMigrationLock struct{}
+
+func (noopMigrationLock) Lock(context.Context, time.Duration) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,200 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// sql/<dialect>/<version>_<name>.up.sql 和 .down.sql，每个版本在每个dialect下都要有。
+//
+// PostgreSQL和SQLite上一个迁移在一个事务里执行，失败了整个回滚。MySQL的DDL会隐式提交，迁移只能逐条执行：
+// 每条语句成功之后记下进度，中间失败的时候前面的语句已经生效，改好失败的那条之后重新启动会从它接着执行。
+// 所以MySQL的迁移里每条语句要自己是完整的（一个ALTER TABLE是原子的），失败的那条以及后面的可以修改，
+// 前面已经执行过的不要再改。进程正好在一条DDL执行完、进度还没记下的时候退出，这条会被再执行一次，要手工处理。
+// 回滚（down）没有记录进度。
+//
+//go:embed sql
+var sqlFiles embed.FS
+
+// BaselineVersion 是引入迁移之前AutoMigrate建的表结构。结构和它一样的已有的库会直接把它记为已执行。
+const BaselineVersion int64 = 20261019000000
+
+var (
+	ErrIrreversible     = errors.New("migration can not be reverted")
+	ErrChecksumMismatch = errors.New("applied migration has been modified")
+	ErrUnknownMigration = errors.New("applied migration is unknown to this build")
+	ErrSchemaMismatch   = errors.New("existing schema does not match the baseline")
+)
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration 是一个版本的迁移，要么是SQL（UpSQL/DownSQL），要么是Go代码（Up/Down）。
+// Go迁移用来做SQL写不了的数据迁移，没有checksum。
+type Migration struct {
+	Version int64
+	Name    string
+	UpSQL   string
+	DownSQL string
+	Up      func(ctx context.Context, tx *gorm.DB) error
+	Down    func(ctx context.Context, tx *gorm.DB) error
+}
+
+// Checksum 是UpSQL的sha256，已经执行过的迁移被修改的时候用来报错。
+func (m *Migration) Checksum() string {
+	if m.Up != nil {
+		return "go"
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(m.UpSQL)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+func (m *Migration) runUp(ctx context.Context, tx *gorm.DB) error {
+	if m.Up != nil {
+		return m.Up(ctx, tx)
+	}
+	return execSQL(tx, m.UpSQL)
+}
+
+func (m *Migration) runDown(ctx context.Context, tx *gorm.DB) error {
+	if m.Down != nil {
+		return m.Down(ctx, tx)
+	}
+	if m.Up != nil || strings.TrimSpace(stripComments(m.DownSQL)) == "" {
+		return fmt.Errorf("%v: %w", m, ErrIrreversible)
+	}
+	return execSQL(tx, m.DownSQL)
+}
+
+// goMigrations 是用Go写的迁移，和SQL迁移按版本号排在一起执行。
+var goMigrations []*Migration
+
+func registerGoMigration(m *Migration) {
+	goMigrations = append(goMigrations, m)
+}
+
+// Load 返回dialect（mysql、postgres、sqlite）下所有的迁移，按版本号排序。
+func Load(dialect string) ([]*Migration, error) {
+	byVersion := map[int64]*Migration{}
+	dialects := map[int64]map[string]bool{}
+	allDialects := map[string]bool{}
+
+	err := fs.WalkDir(sqlFiles, "sql", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		fileDialect := path.Base(path.Dir(filePath))
+		allDialects[fileDialect] = true
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return fmt.Errorf("invalid migration file name %v", filePath)
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		if dialects[version] == nil {
+			dialects[version] = map[string]bool{}
+		}
+		dialects[version][fileDialect] = true
+		if fileDialect != dialect {
+			return nil
+		}
+
+		content, err := sqlFiles.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if match[3] == "up" {
+			m.UpSQL = string(content)
+		} else {
+			m.DownSQL = string(content)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !allDialects[dialect] {
+		return nil, fmt.Errorf("no migrations for dialect %v", dialect)
+	}
+	for version, fileDialects := range dialects {
+		if !fileDialects[dialect] {
+			return nil, fmt.Errorf("migration %d has no SQL for dialect %v", version, dialect)
+		}
+		if m := byVersion[version]; m.UpSQL == "" {
+			return nil, fmt.Errorf("migration %v has no up SQL for dialect %v", m, dialect)
+		}
+	}
+
+	for _, m := range goMigrations {
+		if _, ok := byVersion[m.Version]; ok {
+			return nil, fmt.Errorf("duplicated migration version %d", m.Version)
+		}
+		byVersion[m.Version] = m
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// execSQL 逐条执行SQL，语句以行尾的分号分隔（MySQL驱动默认不支持一次执行多条）。
+func execSQL(tx *gorm.DB, sql string) error {
+	for _, statement := range splitStatements(sql) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return fmt.Errorf("%w\n%v", err, statement)
+		}
+	}
+	return nil
+}
+
+func splitStatements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(stripComments(sql), "\n") {
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			if statement := strings.TrimSpace(current.String()); statement != ";" {
+				statements = append(statements, strings.TrimSuffix(statement, ";"))
+			}
+			current.Reset()
+		}
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// stripComments 去掉整行的 -- 注释。
+func stripComments(sql string) string {
+	var lines []string
+	for _, line := range strings.Split(sql, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
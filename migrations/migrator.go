@@ -0,0 +1,336 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// SchemaMigration 是schema_migrations表里的一行，记录已经执行过的迁移。
+type SchemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255;not null"`
+	Checksum  string `gorm:"size:64;not null"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// schemaMigrationProgress 记录MySQL上执行到一半失败的迁移已经执行了几条语句，迁移成功之后删掉。
+type schemaMigrationProgress struct {
+	Version    int64 `gorm:"primaryKey;autoIncrement:false"`
+	Statements int   `gorm:"not null"`
+}
+
+func (schemaMigrationProgress) TableName() string {
+	return "schema_migration_progress"
+}
+
+type MigrationStatus struct {
+	Migration *Migration
+	// 没执行过的时候为nil
+	Applied *SchemaMigration
+	// 执行过之后SQL被改过
+	Modified bool
+}
+
+type Migrator interface {
+	Status(ctx context.Context) ([]MigrationStatus, error)
+	// Up 执行所有版本号不超过target的迁移，target为0表示执行全部，返回执行了几个。
+	Up(ctx context.Context, target int64) (int, error)
+	// Down 从最新的开始回滚steps个迁移。
+	Down(ctx context.Context, steps int) (int, error)
+}
+
+type migratorImpl struct {
+	db         *gorm.DB
+	migrations []*Migration
+	lock       migrationLock
+}
+
+// NewMigrator 按照db的dialect加载迁移。
+func NewMigrator(db *gorm.DB) (Migrator, error) {
+	migrations, err := Load(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return NewMigratorWithMigrations(db, migrations)
+}
+
+// NewMigratorWithMigrations 用指定的迁移创建Migrator，测试用。
+func NewMigratorWithMigrations(db *gorm.DB, migrations []*Migration) (Migrator, error) {
+	lock, err := newMigrationLock(db)
+	if err != nil {
+		return nil, err
+	}
+	return &migratorImpl{db: db, migrations: migrations, lock: lock}, nil
+}
+
+func (m *migratorImpl) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	return m.status(ctx)
+}
+
+func (m *migratorImpl) Up(ctx context.Context, target int64) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func() error {
+		if err := m.adoptBaseline(ctx); err != nil {
+			return err
+		}
+		statuses, err := m.verifiedStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if status.Applied != nil || (target > 0 && status.Migration.Version > target) {
+				continue
+			}
+			if err := m.apply(ctx, status.Migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (m *migratorImpl) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func() error {
+		statuses, err := m.verifiedStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(statuses) - 1; i >= 0 && count < steps; i-- {
+			if statuses[i].Applied == nil {
+				continue
+			}
+			if err := m.revert(ctx, statuses[i].Migration); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (m *migratorImpl) apply(ctx context.Context, migration *Migration) error {
+	log.Infof("Applying migration %v", migration)
+	start := time.Now()
+	var err error
+	if migration.Up == nil && m.db.Dialector.Name() == "mysql" {
+		err = m.applyStatements(ctx, migration)
+	} else {
+		err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := migration.runUp(ctx, tx); err != nil {
+				return err
+			}
+			return m.record(tx, migration)
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply migration %v: %w", migration, err)
+	}
+	log.Infof("Applied migration %v in %v", migration, time.Since(start))
+	return nil
+}
+
+// applyStatements 逐条执行SQL迁移，每条语句执行完记下进度。MySQL的DDL会隐式提交，一个迁移没法整个回滚，
+// 中间一条语句失败的时候前面的已经生效了，下次启动从失败的那条接着执行，不会把前面的再执行一遍。
+func (m *migratorImpl) applyStatements(ctx context.Context, migration *Migration) error {
+	db := m.db.WithContext(ctx)
+	progress := schemaMigrationProgress{Version: migration.Version}
+	if err := db.Where("version = ?", migration.Version).Limit(1).Find(&progress).Error; err != nil {
+		return err
+	}
+	statements := splitStatements(migration.UpSQL)
+	if progress.Statements > 0 {
+		log.Warnf("Resuming migration %v from statement %d of %d", migration, progress.Statements+1, len(statements))
+	}
+
+	for i := progress.Statements; i < len(statements); i++ {
+		progress.Statements = i + 1
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(statements[i]).Error; err != nil {
+				return err
+			}
+			return tx.Save(&progress).Error
+		})
+		if err != nil {
+			return fmt.Errorf("statement %d: %w\n%v", i+1, err, statements[i])
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := m.record(tx, migration); err != nil {
+			return err
+		}
+		return tx.Delete(&schemaMigrationProgress{}, migration.Version).Error
+	})
+}
+
+func (m *migratorImpl) record(tx *gorm.DB, migration *Migration) error {
+	return tx.Create(&SchemaMigration{
+		Version:   migration.Version,
+		Name:      migration.Name,
+		Checksum:  migration.Checksum(),
+		AppliedAt: time.Now().UTC(),
+	}).Error
+}
+
+func (m *migratorImpl) revert(ctx context.Context, migration *Migration) error {
+	log.Infof("Reverting migration %v", migration)
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := migration.runDown(ctx, tx); err != nil {
+			return err
+		}
+		return tx.Delete(&SchemaMigration{}, migration.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revert migration %v: %w", migration, err)
+	}
+	return nil
+}
+
+// baselineTables 是基线建的表，也就是引入迁移之前AutoMigrate建的表。
+var baselineTables = []string{
+	"configs", "users", "products", "stores", "product_stores", "user_stores", "addresses", "user_addresses",
+	"orders", "order_items", "manager_stores", "delete_user_requests", "tax_rates",
+}
+
+// adoptBaseline 处理引入版本化迁移之前由AutoMigrate建好的库：基线的表已经都在了，只记录基线，不再执行，
+// 之后的迁移照常执行。结构和基线对不上的库拒绝迁移，要手工处理。
+func (m *migratorImpl) adoptBaseline(ctx context.Context) error {
+	var count int64
+	if err := m.db.WithContext(ctx).Model(&SchemaMigration{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 || !m.db.Migrator().HasTable("users") {
+		return nil
+	}
+	for _, migration := range m.migrations {
+		if migration.Version != BaselineVersion {
+			continue
+		}
+		if err := m.matchBaseline(); err != nil {
+			return err
+		}
+		log.Infof("Existing schema found, marking %v as applied", migration)
+		return m.db.WithContext(ctx).Create(&SchemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Checksum:  migration.Checksum(),
+			AppliedAt: time.Now().UTC(),
+		}).Error
+	}
+	return nil
+}
+
+func (m *migratorImpl) matchBaseline() error {
+	migrator := m.db.Migrator()
+	var missing []string
+	for _, table := range baselineTables {
+		if !migrator.HasTable(table) {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing tables %v", ErrSchemaMismatch, missing)
+	}
+	// 有基线之后的迁移才加的表或字段，说明是别的版本的代码建的库，不知道执行到了哪一步
+	if migrator.HasTable("store_memberships") || migrator.HasColumn("users", "suspended_at") {
+		return fmt.Errorf("%w: found tables or columns added after the baseline", ErrSchemaMismatch)
+	}
+	return nil
+}
+
+func (m *migratorImpl) ensureTable(ctx context.Context) error {
+	return m.db.WithContext(ctx).AutoMigrate(&SchemaMigration{}, &schemaMigrationProgress{})
+}
+
+func (m *migratorImpl) status(ctx context.Context) ([]MigrationStatus, error) {
+	var applied []SchemaMigration
+	if err := m.db.WithContext(ctx).Order("version").Find(&applied).Error; err != nil {
+		return nil, err
+	}
+	appliedByVersion := map[int64]*SchemaMigration{}
+	for i := range applied {
+		appliedByVersion[applied[i].Version] = &applied[i]
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration, Applied: appliedByVersion[migration.Version]}
+		if status.Applied != nil {
+			status.Modified = status.Applied.Checksum != migration.Checksum()
+			delete(appliedByVersion, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	// 库里有代码里没有的迁移（比如回滚到了旧版本的代码），不知道schema是什么样的
+	for version, row := range appliedByVersion {
+		statuses = append(statuses, MigrationStatus{Migration: &Migration{Version: version, Name: row.Name}, Applied: row})
+	}
+	return statuses, nil
+}
+
+// verifiedStatus 在有迁移被改过，或者库里有不认识的迁移的时候拒绝执行。
+func (m *migratorImpl) verifiedStatus(ctx context.Context) ([]MigrationStatus, error) {
+	statuses, err := m.status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := map[int64]bool{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+	}
+	for _, status := range statuses {
+		if status.Modified {
+			return nil, fmt.Errorf("%v: %w", status.Migration, ErrChecksumMismatch)
+		}
+		if !known[status.Migration.Version] {
+			return nil, fmt.Errorf("%v: %w", status.Migration, ErrUnknownMigration)
+		}
+	}
+	return statuses, nil
+}
+
+// withLock 拿到迁移锁之后再执行，保证多个副本同时启动的时候只有一个在做迁移，其他的等它做完。
+func (m *migratorImpl) withLock(ctx context.Context, run func() error) error {
+	timeout := time.Minute
+	if viper.IsSet("migrationLockTimeout") {
+		timeout = viper.GetDuration("migrationLockTimeout")
+	}
+	unlock, err := m.lock.Lock(ctx, timeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+	return run()
+}
+
+// Migrate 执行所有还没执行的迁移，启动的时候用。
+func Migrate(ctx context.Context, db *gorm.DB) error {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	count, err := migrator.Up(ctx, 0)
+	if count > 0 {
+		log.Infof("Applied %d migrations", count)
+	}
+	return err
+}
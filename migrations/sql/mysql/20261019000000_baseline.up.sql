@@ -0,0 +1,14 @@
+-- 基线：引入版本化迁移之前AutoMigrate建的表（GORM CreateTable），已有的库和它一样，直接记为已执行。
+CREATE TABLE `configs` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`config_key` varchar(191) UNIQUE,`config_value` longtext,PRIMARY KEY (`id`));
+CREATE TABLE `users` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`email` varchar(191) UNIQUE,`role` longtext,`phone` longtext,`name` longtext,`default_shipping_address_id` bigint,`default_billing_address_id` bigint,`stripe_customer_id` longtext,`payment_method_id` longtext,PRIMARY KEY (`id`));
+CREATE TABLE `products` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`name` varchar(191) UNIQUE,`creator_id` bigint,`description` longtext,`price` double,`discount` double,`category` longtext,`image_url` longtext,PRIMARY KEY (`id`),CONSTRAINT `fk_products_creator` FOREIGN KEY (`creator_id`) REFERENCES `users`(`id`));
+CREATE TABLE `stores` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`name` varchar(191) UNIQUE,`address` longtext,`city` longtext,`state` longtext,`zip_code` longtext,`phone` longtext,PRIMARY KEY (`id`));
+CREATE TABLE `product_stores` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`store_id` bigint,`product_id` bigint,`is_enable` boolean,PRIMARY KEY (`id`),UNIQUE INDEX `idx_store_product` (`store_id`,`product_id`),CONSTRAINT `fk_product_stores_store` FOREIGN KEY (`store_id`) REFERENCES `stores`(`id`),CONSTRAINT `fk_product_stores_product` FOREIGN KEY (`product_id`) REFERENCES `products`(`id`));
+CREATE TABLE `user_stores` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`user_id` bigint,`store_id` bigint,`is_enable` boolean,PRIMARY KEY (`id`),CONSTRAINT `fk_user_stores_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_user_stores_store` FOREIGN KEY (`store_id`) REFERENCES `stores`(`id`));
+CREATE TABLE `addresses` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`line1` longtext,`line2` longtext,`city` longtext,`state` longtext,`country` longtext,`postal_code` longtext,PRIMARY KEY (`id`));
+CREATE TABLE `user_addresses` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`user_id` bigint,`address_id` bigint,PRIMARY KEY (`id`),CONSTRAINT `fk_user_addresses_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_user_addresses_address` FOREIGN KEY (`address_id`) REFERENCES `addresses`(`id`));
+CREATE TABLE `orders` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`user_id` bigint,`store_id` bigint,`payment_intent_id` varchar(191) UNIQUE,`delivery_id` varchar(191) UNIQUE,`status` longtext,PRIMARY KEY (`id`));
+CREATE TABLE `order_items` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`order_id` bigint,`product_id` bigint,`quantity` bigint,PRIMARY KEY (`id`),CONSTRAINT `fk_order_items_product` FOREIGN KEY (`product_id`) REFERENCES `products`(`id`),CONSTRAINT `fk_orders_order_items` FOREIGN KEY (`order_id`) REFERENCES `orders`(`id`));
+CREATE TABLE `manager_stores` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`user_id` bigint,`store_id` bigint,PRIMARY KEY (`id`),UNIQUE INDEX `idx_manager_stores` (`user_id`,`store_id`));
+CREATE TABLE `delete_user_requests` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`user_id` bigint UNIQUE,PRIMARY KEY (`id`));
+CREATE TABLE `tax_rates` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`csv` longtext,`tax_state` longtext,`zip_code` longtext,`estimated_combined_rate` double,PRIMARY KEY (`id`));
@@ -0,0 +1,7 @@
+DROP TABLE `api_keys`;
+DROP TABLE `store_invitations`;
+DROP TABLE `audit_logs`;
+DROP TABLE `user_export_requests`;
+DROP TABLE `store_memberships`;
+DROP INDEX `idx_users_auth_subject` ON `users`;
+ALTER TABLE `users` DROP COLUMN `suspended_at`, DROP COLUMN `service_account`, DROP COLUMN `auth_provider`, DROP COLUMN `auth_subject`;
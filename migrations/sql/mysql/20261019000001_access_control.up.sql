@@ -0,0 +1,9 @@
+-- 门店成员、门店邀请、API key、审计日志和数据导出的表，以及users上停用、服务账号和登录身份的字段。
+ALTER TABLE `users` ADD `suspended_at` datetime(3) NULL, ADD `service_account` boolean DEFAULT false, ADD `auth_provider` varchar(191), ADD `auth_subject` varchar(191);
+UPDATE `users` SET `auth_provider` = '';
+CREATE UNIQUE INDEX `idx_users_auth_subject` ON `users`(`auth_provider`,`auth_subject`);
+CREATE TABLE `store_memberships` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`user_id` bigint,`store_id` bigint,`relationship` varchar(16),PRIMARY KEY (`id`),UNIQUE INDEX `idx_store_membership` (`user_id`,`store_id`,`relationship`),INDEX `idx_store_memberships_store_id` (`store_id`),CONSTRAINT `fk_store_memberships_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_store_memberships_store` FOREIGN KEY (`store_id`) REFERENCES `stores`(`id`));
+CREATE TABLE `user_export_requests` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`user_id` bigint,`format` longtext,`status` longtext,`download_url` longtext,`expires_at` datetime(3) NULL,`error` longtext,PRIMARY KEY (`id`),INDEX `idx_user_export_requests_user_id` (`user_id`));
+CREATE TABLE `audit_logs` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`actor_id` bigint,`action` longtext,`target_type` varchar(191),`target_id` bigint,`details` longtext,PRIMARY KEY (`id`),INDEX `idx_audit_logs_actor_id` (`actor_id`),INDEX `idx_audit_target` (`target_type`,`target_id`));
+CREATE TABLE `store_invitations` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`store_id` bigint,`email` varchar(191),`relationship` varchar(16),`token` varchar(64),`status` varchar(16),`invited_by` bigint,`accepted_by` bigint,`accepted_at` datetime(3) NULL,`expires_at` datetime(3) NULL,PRIMARY KEY (`id`),INDEX `idx_store_invitations_email` (`email`),UNIQUE INDEX `idx_store_invitations_token` (`token`),INDEX `idx_store_invitations_store_id` (`store_id`));
+CREATE TABLE `api_keys` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`user_id` bigint,`name` longtext,`prefix` varchar(32),`hash` varchar(64),`permissions` longtext,`store_id` bigint,`expires_at` datetime(3) NULL,`revoked_at` datetime(3) NULL,`last_used_at` datetime(3) NULL,`created_by` bigint,PRIMARY KEY (`id`),INDEX `idx_api_keys_user_id` (`user_id`),UNIQUE INDEX `idx_api_keys_prefix` (`prefix`));
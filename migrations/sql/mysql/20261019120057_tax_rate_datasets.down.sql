@@ -0,0 +1,4 @@
+DROP INDEX `idx_tax_rates_dataset_zip` ON `tax_rates`;
+DELETE FROM `tax_rates` WHERE `dataset_id` NOT IN (SELECT `id` FROM `tax_rate_datasets` WHERE `active` = TRUE);
+ALTER TABLE `tax_rates` DROP COLUMN `dataset_id`, DROP COLUMN `effective_date`, MODIFY `zip_code` longtext;
+DROP TABLE `tax_rate_datasets`;
@@ -0,0 +1,8 @@
+-- tax_rates按版本导入，查询的时候只看当前生效的版本。
+CREATE TABLE `tax_rate_datasets` (`id` bigint AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`source_files` longtext,`effective_date` datetime(3) NULL,`checksum` varchar(64),`row_count` bigint,`active` boolean,`activated_at` datetime(3) NULL,`imported_by` bigint,PRIMARY KEY (`id`),INDEX `idx_tax_rate_datasets_checksum` (`checksum`),INDEX `idx_tax_rate_datasets_active` (`active`));
+ALTER TABLE `tax_rates` ADD `dataset_id` bigint, ADD `effective_date` datetime(3) NULL, MODIFY `zip_code` varchar(16);
+CREATE INDEX `idx_tax_rates_dataset_zip` ON `tax_rates`(`dataset_id`,`zip_code`);
+-- 已经导入的数据作为第一个版本，checksum为空，下次启动的时候会从taxRatesFileDir重新导入
+INSERT INTO `tax_rate_datasets` (`created_at`,`updated_at`,`source_files`,`checksum`,`row_count`,`active`,`activated_at`,`imported_by`)
+SELECT CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'legacy', '', t.c, TRUE, CURRENT_TIMESTAMP, 0 FROM (SELECT COUNT(*) AS c FROM `tax_rates`) t WHERE t.c > 0;
+UPDATE `tax_rates` SET `dataset_id` = (SELECT MAX(`id`) FROM `tax_rate_datasets`);
@@ -0,0 +1,2 @@
+DROP INDEX `idx_orders_paid_at` ON `orders`;
+ALTER TABLE `orders` DROP COLUMN `tax_rate_dataset_id`, DROP COLUMN `taxable_amount`, DROP COLUMN `exempt_amount`, DROP COLUMN `paid_at`, DROP COLUMN `refunded_amount`, DROP COLUMN `refunded_at`;
@@ -0,0 +1 @@
+ALTER TABLE `stores` DROP COLUMN `currency`, DROP COLUMN `locale`;
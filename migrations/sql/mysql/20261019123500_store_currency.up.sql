@@ -0,0 +1,3 @@
+-- 每个店有自己的币种和显示金额用的locale，已有的店都是美元。
+ALTER TABLE `stores` ADD `currency` varchar(3), ADD `locale` varchar(35);
+UPDATE `stores` SET `currency` = 'USD', `locale` = 'en-US';
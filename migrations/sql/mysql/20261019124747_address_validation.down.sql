@@ -0,0 +1 @@
+ALTER TABLE `addresses` DROP COLUMN `latitude`, DROP COLUMN `longitude`, DROP COLUMN `validated_at`;
@@ -0,0 +1,2 @@
+-- 地址校验之后保存规范化的字段和地理编码的坐标，已有的地址没有校验过，都是NULL。
+ALTER TABLE `addresses` ADD `latitude` double, ADD `longitude` double, ADD `validated_at` datetime(3) NULL;
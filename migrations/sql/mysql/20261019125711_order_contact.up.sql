@@ -0,0 +1,3 @@
+-- 订单保存结账时的送货方式、地址和收货人，以前的订单没有快照（contact_captured_at是NULL）。
+ALTER TABLE `orders` ADD `fulfillment` varchar(16), ADD `contact_line1` longtext, ADD `contact_line2` longtext, ADD `contact_city` longtext, ADD `contact_state` longtext, ADD `contact_country` longtext, ADD `contact_postal_code` longtext, ADD `contact_name` longtext, ADD `contact_phone` longtext, ADD `contact_notes` longtext, ADD `contact_latitude` double, ADD `contact_longitude` double, ADD `contact_captured_at` datetime(3) NULL;
+UPDATE `orders` SET `fulfillment` = '', `contact_line1` = '', `contact_line2` = '', `contact_city` = '', `contact_state` = '', `contact_country` = '', `contact_postal_code` = '', `contact_name` = '', `contact_phone` = '', `contact_notes` = '';
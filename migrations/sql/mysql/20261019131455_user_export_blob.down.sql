@@ -0,0 +1 @@
+ALTER TABLE `user_export_requests` DROP COLUMN `blob_name`;
@@ -0,0 +1 @@
+ALTER TABLE `store_invitations` RENAME COLUMN `token_hash` TO `token`, RENAME INDEX `idx_store_invitations_token_hash` TO `idx_store_invitations_token`;
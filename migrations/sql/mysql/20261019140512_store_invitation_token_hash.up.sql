@@ -0,0 +1,3 @@
+-- 邀请只保存token的sha256。以前明文保存的token可能已经进了日志，全部作废，发给验证过的email的邀请登录之后仍然会自动接受。
+UPDATE `store_invitations` SET `token` = SHA2(UUID(), 256);
+ALTER TABLE `store_invitations` RENAME COLUMN `token` TO `token_hash`, RENAME INDEX `idx_store_invitations_token` TO `idx_store_invitations_token_hash`;
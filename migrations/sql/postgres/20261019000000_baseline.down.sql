@@ -0,0 +1,14 @@
+-- 基线：引入版本化迁移之前AutoMigrate建的表（GORM CreateTable），已有的库和它一样，直接记为已执行。
+DROP TABLE "tax_rates";
+DROP TABLE "delete_user_requests";
+DROP TABLE "manager_stores";
+DROP TABLE "order_items";
+DROP TABLE "orders";
+DROP TABLE "user_addresses";
+DROP TABLE "addresses";
+DROP TABLE "user_stores";
+DROP TABLE "product_stores";
+DROP TABLE "stores";
+DROP TABLE "products";
+DROP TABLE "users";
+DROP TABLE "configs";
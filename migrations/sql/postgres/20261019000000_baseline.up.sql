@@ -0,0 +1,16 @@
+-- 基线：引入版本化迁移之前AutoMigrate建的表（GORM CreateTable），已有的库和它一样，直接记为已执行。
+CREATE TABLE "configs" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"config_key" text UNIQUE,"config_value" text,PRIMARY KEY ("id"));
+CREATE TABLE "users" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"email" text UNIQUE,"role" text,"phone" text,"name" text,"default_shipping_address_id" bigint,"default_billing_address_id" bigint,"stripe_customer_id" text,"payment_method_id" text,PRIMARY KEY ("id"));
+CREATE TABLE "products" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"name" text UNIQUE,"creator_id" bigint,"description" text,"price" decimal,"discount" decimal,"category" text,"image_url" text,PRIMARY KEY ("id"),CONSTRAINT "fk_products_creator" FOREIGN KEY ("creator_id") REFERENCES "users"("id"));
+CREATE TABLE "stores" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"name" text UNIQUE,"address" text,"city" text,"state" text,"zip_code" text,"phone" text,PRIMARY KEY ("id"));
+CREATE TABLE "product_stores" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"store_id" bigint,"product_id" bigint,"is_enable" boolean,PRIMARY KEY ("id"),CONSTRAINT "fk_product_stores_store" FOREIGN KEY ("store_id") REFERENCES "stores"("id"),CONSTRAINT "fk_product_stores_product" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_store_product" ON "product_stores" ("store_id","product_id");
+CREATE TABLE "user_stores" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint,"store_id" bigint,"is_enable" boolean,PRIMARY KEY ("id"),CONSTRAINT "fk_user_stores_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),CONSTRAINT "fk_user_stores_store" FOREIGN KEY ("store_id") REFERENCES "stores"("id"));
+CREATE TABLE "addresses" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"line1" text,"line2" text,"city" text,"state" text,"country" text,"postal_code" text,PRIMARY KEY ("id"));
+CREATE TABLE "user_addresses" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint,"address_id" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_user_addresses_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),CONSTRAINT "fk_user_addresses_address" FOREIGN KEY ("address_id") REFERENCES "addresses"("id"));
+CREATE TABLE "orders" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint,"store_id" bigint,"payment_intent_id" text UNIQUE,"delivery_id" text UNIQUE,"status" text,PRIMARY KEY ("id"));
+CREATE TABLE "order_items" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"order_id" bigint,"product_id" bigint,"quantity" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_order_items_product" FOREIGN KEY ("product_id") REFERENCES "products"("id"),CONSTRAINT "fk_orders_order_items" FOREIGN KEY ("order_id") REFERENCES "orders"("id"));
+CREATE TABLE "manager_stores" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint,"store_id" bigint,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_manager_stores" ON "manager_stores" ("user_id","store_id");
+CREATE TABLE "delete_user_requests" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint UNIQUE,PRIMARY KEY ("id"));
+CREATE TABLE "tax_rates" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"csv" text,"tax_state" text,"zip_code" text,"estimated_combined_rate" decimal,PRIMARY KEY ("id"));
@@ -0,0 +1,19 @@
+-- 门店成员、门店邀请、API key、审计日志和数据导出的表，以及users上停用、服务账号和登录身份的字段。
+ALTER TABLE "users" ADD "suspended_at" timestamptz, ADD "service_account" boolean DEFAULT false, ADD "auth_provider" text, ADD "auth_subject" text;
+UPDATE "users" SET "auth_provider" = '';
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_auth_subject" ON "users" ("auth_provider","auth_subject");
+CREATE TABLE "store_memberships" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint,"store_id" bigint,"relationship" varchar(16),PRIMARY KEY ("id"),CONSTRAINT "fk_store_memberships_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),CONSTRAINT "fk_store_memberships_store" FOREIGN KEY ("store_id") REFERENCES "stores"("id"));
+CREATE INDEX IF NOT EXISTS "idx_store_memberships_store_id" ON "store_memberships" ("store_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_store_membership" ON "store_memberships" ("user_id","store_id","relationship");
+CREATE TABLE "user_export_requests" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint,"format" text,"status" text,"download_url" text,"expires_at" timestamptz,"error" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_user_export_requests_user_id" ON "user_export_requests" ("user_id");
+CREATE TABLE "audit_logs" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"actor_id" bigint,"action" text,"target_type" text,"target_id" bigint,"details" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_audit_target" ON "audit_logs" ("target_type","target_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_actor_id" ON "audit_logs" ("actor_id");
+CREATE TABLE "store_invitations" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"store_id" bigint,"email" text,"relationship" varchar(16),"token" varchar(64),"status" varchar(16),"invited_by" bigint,"accepted_by" bigint,"accepted_at" timestamptz,"expires_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_store_invitations_token" ON "store_invitations" ("token");
+CREATE INDEX IF NOT EXISTS "idx_store_invitations_email" ON "store_invitations" ("email");
+CREATE INDEX IF NOT EXISTS "idx_store_invitations_store_id" ON "store_invitations" ("store_id");
+CREATE TABLE "api_keys" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"user_id" bigint,"name" text,"prefix" varchar(32),"hash" varchar(64),"permissions" text,"store_id" bigint,"expires_at" timestamptz,"revoked_at" timestamptz,"last_used_at" timestamptz,"created_by" bigint,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_prefix" ON "api_keys" ("prefix");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_user_id" ON "api_keys" ("user_id");
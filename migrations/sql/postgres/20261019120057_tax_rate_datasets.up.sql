@@ -0,0 +1,10 @@
+-- tax_rates按版本导入，查询的时候只看当前生效的版本。
+CREATE TABLE "tax_rate_datasets" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"source_files" text,"effective_date" timestamptz,"checksum" varchar(64),"row_count" bigint,"active" boolean,"activated_at" timestamptz,"imported_by" bigint,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_tax_rate_datasets_checksum" ON "tax_rate_datasets" ("checksum");
+CREATE INDEX IF NOT EXISTS "idx_tax_rate_datasets_active" ON "tax_rate_datasets" ("active");
+ALTER TABLE "tax_rates" ADD "dataset_id" bigint, ADD "effective_date" timestamptz, ALTER COLUMN "zip_code" TYPE varchar(16);
+CREATE INDEX IF NOT EXISTS "idx_tax_rates_dataset_zip" ON "tax_rates" ("dataset_id","zip_code");
+-- 已经导入的数据作为第一个版本，checksum为空，下次启动的时候会从taxRatesFileDir重新导入
+INSERT INTO "tax_rate_datasets" ("created_at","updated_at","source_files","checksum","row_count","active","activated_at","imported_by")
+SELECT CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'legacy', '', t.c, TRUE, CURRENT_TIMESTAMP, 0 FROM (SELECT COUNT(*) AS c FROM "tax_rates") t WHERE t.c > 0;
+UPDATE "tax_rates" SET "dataset_id" = (SELECT MAX("id") FROM "tax_rate_datasets");
@@ -0,0 +1,3 @@
+ALTER TABLE "users" DROP COLUMN "tax_exempt";
+ALTER TABLE "orders" DROP COLUMN "delivery_fee", DROP COLUMN "subtotal", DROP COLUMN "tax_state", DROP COLUMN "tax_zip_code", DROP COLUMN "tax_rate", DROP COLUMN "tax_exempt", DROP COLUMN "delivery_fee_tax", DROP COLUMN "tax_amount", DROP COLUMN "total", DROP COLUMN "tax_calculated_at";
+ALTER TABLE "order_items" DROP COLUMN "unit_price", DROP COLUMN "tax_category", DROP COLUMN "taxable", DROP COLUMN "tax_amount";
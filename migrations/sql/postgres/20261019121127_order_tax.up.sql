@@ -0,0 +1,4 @@
+-- 按订单项算税：订单上保存运费、税额明细和总额，订单项保存单价、分类和税额；用户增加免税标记。
+ALTER TABLE "orders" ADD "delivery_fee" bigint, ADD "subtotal" bigint, ADD "tax_state" text, ADD "tax_zip_code" text, ADD "tax_rate" decimal, ADD "tax_exempt" boolean, ADD "delivery_fee_tax" bigint, ADD "tax_amount" bigint, ADD "total" bigint, ADD "tax_calculated_at" timestamptz;
+ALTER TABLE "order_items" ADD "unit_price" bigint, ADD "tax_category" text, ADD "taxable" boolean, ADD "tax_amount" bigint;
+ALTER TABLE "users" ADD "tax_exempt" boolean DEFAULT false;
@@ -0,0 +1,3 @@
+-- 报税报表：订单记录算税时的税率版本、收税和免税的销售额、付款时间和退款金额。
+ALTER TABLE "orders" ADD "tax_rate_dataset_id" bigint, ADD "taxable_amount" bigint, ADD "exempt_amount" bigint, ADD "paid_at" timestamptz, ADD "refunded_amount" bigint, ADD "refunded_at" timestamptz;
+CREATE INDEX "idx_orders_paid_at" ON "orders"("paid_at");
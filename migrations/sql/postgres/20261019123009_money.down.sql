@@ -0,0 +1,12 @@
+ALTER TABLE "products" ADD "price" decimal, ADD "discount" decimal;
+UPDATE "products" SET "price" = "price_amount"/100.0, "discount" = "discount_amount"/100.0;
+ALTER TABLE "products" DROP COLUMN "price_amount", DROP COLUMN "price_currency", DROP COLUMN "discount_amount", DROP COLUMN "discount_currency";
+ALTER TABLE "order_items" DROP COLUMN "unit_price_currency", DROP COLUMN "tax_currency";
+ALTER TABLE "order_items" RENAME COLUMN "unit_price_amount" TO "unit_price";
+ALTER TABLE "orders" DROP COLUMN "delivery_fee_currency", DROP COLUMN "subtotal_currency", DROP COLUMN "delivery_fee_tax_currency", DROP COLUMN "tax_currency", DROP COLUMN "total_currency", DROP COLUMN "taxable_sales_currency", DROP COLUMN "exempt_sales_currency", DROP COLUMN "refunded_currency";
+ALTER TABLE "orders" RENAME COLUMN "delivery_fee_amount" TO "delivery_fee";
+ALTER TABLE "orders" RENAME COLUMN "subtotal_amount" TO "subtotal";
+ALTER TABLE "orders" RENAME COLUMN "delivery_fee_tax_amount" TO "delivery_fee_tax";
+ALTER TABLE "orders" RENAME COLUMN "total_amount" TO "total";
+ALTER TABLE "orders" RENAME COLUMN "taxable_sales_amount" TO "taxable_amount";
+ALTER TABLE "orders" RENAME COLUMN "exempt_sales_amount" TO "exempt_amount";
@@ -0,0 +1,15 @@
+-- 金额改成Money：最小货币单位的整数加币种。商品价格从浮点数的美元换算成分，已有的订单金额都是美元。
+ALTER TABLE "products" ADD "price_amount" bigint, ADD "price_currency" varchar(3), ADD "discount_amount" bigint, ADD "discount_currency" varchar(3);
+UPDATE "products" SET "price_amount" = ROUND(CAST("price" AS numeric)*100), "price_currency" = 'USD', "discount_amount" = ROUND(CAST("discount" AS numeric)*100), "discount_currency" = 'USD';
+ALTER TABLE "products" DROP COLUMN "price", DROP COLUMN "discount";
+ALTER TABLE "orders" RENAME COLUMN "delivery_fee" TO "delivery_fee_amount";
+ALTER TABLE "orders" RENAME COLUMN "subtotal" TO "subtotal_amount";
+ALTER TABLE "orders" RENAME COLUMN "delivery_fee_tax" TO "delivery_fee_tax_amount";
+ALTER TABLE "orders" RENAME COLUMN "total" TO "total_amount";
+ALTER TABLE "orders" RENAME COLUMN "taxable_amount" TO "taxable_sales_amount";
+ALTER TABLE "orders" RENAME COLUMN "exempt_amount" TO "exempt_sales_amount";
+ALTER TABLE "orders" ADD "delivery_fee_currency" varchar(3), ADD "subtotal_currency" varchar(3), ADD "delivery_fee_tax_currency" varchar(3), ADD "tax_currency" varchar(3), ADD "total_currency" varchar(3), ADD "taxable_sales_currency" varchar(3), ADD "exempt_sales_currency" varchar(3), ADD "refunded_currency" varchar(3);
+UPDATE "orders" SET "delivery_fee_currency" = 'USD', "subtotal_currency" = 'USD', "delivery_fee_tax_currency" = 'USD', "tax_currency" = 'USD', "total_currency" = 'USD', "taxable_sales_currency" = 'USD', "exempt_sales_currency" = 'USD', "refunded_currency" = 'USD';
+ALTER TABLE "order_items" RENAME COLUMN "unit_price" TO "unit_price_amount";
+ALTER TABLE "order_items" ADD "unit_price_currency" varchar(3), ADD "tax_currency" varchar(3);
+UPDATE "order_items" SET "unit_price_currency" = 'USD', "tax_currency" = 'USD';
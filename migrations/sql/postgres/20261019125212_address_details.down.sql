@@ -0,0 +1 @@
+ALTER TABLE "addresses" DROP COLUMN "label", DROP COLUMN "phone", DROP COLUMN "delivery_instructions";
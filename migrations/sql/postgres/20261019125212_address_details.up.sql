@@ -0,0 +1,3 @@
+-- 地址的名字（Home、Work）、收货人电话和送货说明，已有的地址都是空的。
+ALTER TABLE "addresses" ADD "label" varchar(32), ADD "phone" varchar(20), ADD "delivery_instructions" varchar(500);
+UPDATE "addresses" SET "label" = '', "phone" = '', "delivery_instructions" = '';
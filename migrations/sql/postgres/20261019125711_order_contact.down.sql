@@ -0,0 +1 @@
+ALTER TABLE "orders" DROP COLUMN "fulfillment", DROP COLUMN "contact_line1", DROP COLUMN "contact_line2", DROP COLUMN "contact_city", DROP COLUMN "contact_state", DROP COLUMN "contact_country", DROP COLUMN "contact_postal_code", DROP COLUMN "contact_name", DROP COLUMN "contact_phone", DROP COLUMN "contact_notes", DROP COLUMN "contact_latitude", DROP COLUMN "contact_longitude", DROP COLUMN "contact_captured_at";
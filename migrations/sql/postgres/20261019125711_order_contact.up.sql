@@ -0,0 +1,3 @@
+-- 订单保存结账时的送货方式、地址和收货人，以前的订单没有快照（contact_captured_at是NULL）。
+ALTER TABLE "orders" ADD "fulfillment" varchar(16), ADD "contact_line1" text, ADD "contact_line2" text, ADD "contact_city" text, ADD "contact_state" text, ADD "contact_country" text, ADD "contact_postal_code" text, ADD "contact_name" text, ADD "contact_phone" text, ADD "contact_notes" text, ADD "contact_latitude" decimal, ADD "contact_longitude" decimal, ADD "contact_captured_at" timestamptz;
+UPDATE "orders" SET "fulfillment" = '', "contact_line1" = '', "contact_line2" = '', "contact_city" = '', "contact_state" = '', "contact_country" = '', "contact_postal_code" = '', "contact_name" = '', "contact_phone" = '', "contact_notes" = '';
@@ -0,0 +1,2 @@
+ALTER INDEX "idx_store_invitations_token_hash" RENAME TO "idx_store_invitations_token";
+ALTER TABLE "store_invitations" RENAME COLUMN "token_hash" TO "token";
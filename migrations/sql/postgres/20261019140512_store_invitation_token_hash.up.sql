@@ -0,0 +1,4 @@
+-- 邀请只保存token的sha256。以前明文保存的token可能已经进了日志，全部作废，发给验证过的email的邀请登录之后仍然会自动接受。
+UPDATE "store_invitations" SET "token" = md5(random()::text) || md5(random()::text);
+ALTER TABLE "store_invitations" RENAME COLUMN "token" TO "token_hash";
+ALTER INDEX "idx_store_invitations_token" RENAME TO "idx_store_invitations_token_hash";
@@ -0,0 +1,10 @@
+DROP TABLE `api_keys`;
+DROP TABLE `store_invitations`;
+DROP TABLE `audit_logs`;
+DROP TABLE `user_export_requests`;
+DROP TABLE `store_memberships`;
+DROP INDEX `idx_users_auth_subject`;
+ALTER TABLE `users` DROP COLUMN `suspended_at`;
+ALTER TABLE `users` DROP COLUMN `service_account`;
+ALTER TABLE `users` DROP COLUMN `auth_provider`;
+ALTER TABLE `users` DROP COLUMN `auth_subject`;
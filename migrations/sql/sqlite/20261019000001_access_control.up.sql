@@ -0,0 +1,22 @@
+-- 门店成员、门店邀请、API key、审计日志和数据导出的表，以及users上停用、服务账号和登录身份的字段。
+ALTER TABLE `users` ADD `suspended_at` datetime;
+ALTER TABLE `users` ADD `service_account` numeric DEFAULT false;
+ALTER TABLE `users` ADD `auth_provider` text;
+ALTER TABLE `users` ADD `auth_subject` text;
+UPDATE `users` SET `auth_provider` = '';
+CREATE UNIQUE INDEX `idx_users_auth_subject` ON `users`(`auth_provider`,`auth_subject`);
+CREATE TABLE `store_memberships` (`id` integer,`created_at` datetime,`updated_at` datetime,`user_id` integer,`store_id` integer,`relationship` varchar(16),PRIMARY KEY (`id`),CONSTRAINT `fk_store_memberships_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_store_memberships_store` FOREIGN KEY (`store_id`) REFERENCES `stores`(`id`));
+CREATE INDEX `idx_store_memberships_store_id` ON `store_memberships`(`store_id`);
+CREATE UNIQUE INDEX `idx_store_membership` ON `store_memberships`(`user_id`,`store_id`,`relationship`);
+CREATE TABLE `user_export_requests` (`id` integer,`created_at` datetime,`updated_at` datetime,`user_id` integer,`format` text,`status` text,`download_url` text,`expires_at` datetime,`error` text,PRIMARY KEY (`id`));
+CREATE INDEX `idx_user_export_requests_user_id` ON `user_export_requests`(`user_id`);
+CREATE TABLE `audit_logs` (`id` integer,`created_at` datetime,`updated_at` datetime,`actor_id` integer,`action` text,`target_type` text,`target_id` integer,`details` text,PRIMARY KEY (`id`));
+CREATE INDEX `idx_audit_target` ON `audit_logs`(`target_type`,`target_id`);
+CREATE INDEX `idx_audit_logs_actor_id` ON `audit_logs`(`actor_id`);
+CREATE TABLE `store_invitations` (`id` integer,`created_at` datetime,`updated_at` datetime,`store_id` integer,`email` text,`relationship` varchar(16),`token` varchar(64),`status` varchar(16),`invited_by` integer,`accepted_by` integer,`accepted_at` datetime,`expires_at` datetime,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX `idx_store_invitations_token` ON `store_invitations`(`token`);
+CREATE INDEX `idx_store_invitations_email` ON `store_invitations`(`email`);
+CREATE INDEX `idx_store_invitations_store_id` ON `store_invitations`(`store_id`);
+CREATE TABLE `api_keys` (`id` integer,`created_at` datetime,`updated_at` datetime,`user_id` integer,`name` text,`prefix` varchar(32),`hash` varchar(64),`permissions` text,`store_id` integer,`expires_at` datetime,`revoked_at` datetime,`last_used_at` datetime,`created_by` integer,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX `idx_api_keys_prefix` ON `api_keys`(`prefix`);
+CREATE INDEX `idx_api_keys_user_id` ON `api_keys`(`user_id`);
@@ -0,0 +1,5 @@
+DROP INDEX `idx_tax_rates_dataset_zip`;
+DELETE FROM `tax_rates` WHERE `dataset_id` NOT IN (SELECT `id` FROM `tax_rate_datasets` WHERE `active` = TRUE);
+ALTER TABLE `tax_rates` DROP COLUMN `dataset_id`;
+ALTER TABLE `tax_rates` DROP COLUMN `effective_date`;
+DROP TABLE `tax_rate_datasets`;
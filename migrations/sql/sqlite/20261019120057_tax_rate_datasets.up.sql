@@ -0,0 +1,11 @@
+-- tax_rates按版本导入，查询的时候只看当前生效的版本。
+CREATE TABLE `tax_rate_datasets` (`id` integer,`created_at` datetime,`updated_at` datetime,`source_files` text,`effective_date` datetime,`checksum` text,`row_count` integer,`active` numeric,`activated_at` datetime,`imported_by` integer,PRIMARY KEY (`id`));
+CREATE INDEX `idx_tax_rate_datasets_active` ON `tax_rate_datasets`(`active`);
+CREATE INDEX `idx_tax_rate_datasets_checksum` ON `tax_rate_datasets`(`checksum`);
+ALTER TABLE `tax_rates` ADD `dataset_id` integer;
+ALTER TABLE `tax_rates` ADD `effective_date` datetime;
+CREATE INDEX `idx_tax_rates_dataset_zip` ON `tax_rates`(`dataset_id`,`zip_code`);
+-- 已经导入的数据作为第一个版本，checksum为空，下次启动的时候会从taxRatesFileDir重新导入
+INSERT INTO `tax_rate_datasets` (`created_at`,`updated_at`,`source_files`,`checksum`,`row_count`,`active`,`activated_at`,`imported_by`)
+SELECT CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'legacy', '', t.c, TRUE, CURRENT_TIMESTAMP, 0 FROM (SELECT COUNT(*) AS c FROM `tax_rates`) t WHERE t.c > 0;
+UPDATE `tax_rates` SET `dataset_id` = (SELECT MAX(`id`) FROM `tax_rate_datasets`);
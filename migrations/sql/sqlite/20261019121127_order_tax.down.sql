@@ -0,0 +1,15 @@
+ALTER TABLE `users` DROP COLUMN `tax_exempt`;
+ALTER TABLE `orders` DROP COLUMN `delivery_fee`;
+ALTER TABLE `orders` DROP COLUMN `subtotal`;
+ALTER TABLE `orders` DROP COLUMN `tax_state`;
+ALTER TABLE `orders` DROP COLUMN `tax_zip_code`;
+ALTER TABLE `orders` DROP COLUMN `tax_rate`;
+ALTER TABLE `orders` DROP COLUMN `tax_exempt`;
+ALTER TABLE `orders` DROP COLUMN `delivery_fee_tax`;
+ALTER TABLE `orders` DROP COLUMN `tax_amount`;
+ALTER TABLE `orders` DROP COLUMN `total`;
+ALTER TABLE `orders` DROP COLUMN `tax_calculated_at`;
+ALTER TABLE `order_items` DROP COLUMN `unit_price`;
+ALTER TABLE `order_items` DROP COLUMN `tax_category`;
+ALTER TABLE `order_items` DROP COLUMN `taxable`;
+ALTER TABLE `order_items` DROP COLUMN `tax_amount`;
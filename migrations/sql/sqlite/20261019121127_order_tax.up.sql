@@ -0,0 +1,16 @@
+-- 按订单项算税：订单上保存运费、税额明细和总额，订单项保存单价、分类和税额；用户增加免税标记。
+ALTER TABLE `orders` ADD `delivery_fee` integer;
+ALTER TABLE `orders` ADD `subtotal` integer;
+ALTER TABLE `orders` ADD `tax_state` text;
+ALTER TABLE `orders` ADD `tax_zip_code` text;
+ALTER TABLE `orders` ADD `tax_rate` real;
+ALTER TABLE `orders` ADD `tax_exempt` numeric;
+ALTER TABLE `orders` ADD `delivery_fee_tax` integer;
+ALTER TABLE `orders` ADD `tax_amount` integer;
+ALTER TABLE `orders` ADD `total` integer;
+ALTER TABLE `orders` ADD `tax_calculated_at` datetime;
+ALTER TABLE `order_items` ADD `unit_price` integer;
+ALTER TABLE `order_items` ADD `tax_category` text;
+ALTER TABLE `order_items` ADD `taxable` numeric;
+ALTER TABLE `order_items` ADD `tax_amount` integer;
+ALTER TABLE `users` ADD `tax_exempt` numeric DEFAULT false;
@@ -0,0 +1,7 @@
+DROP INDEX `idx_orders_paid_at`;
+ALTER TABLE `orders` DROP COLUMN `tax_rate_dataset_id`;
+ALTER TABLE `orders` DROP COLUMN `taxable_amount`;
+ALTER TABLE `orders` DROP COLUMN `exempt_amount`;
+ALTER TABLE `orders` DROP COLUMN `paid_at`;
+ALTER TABLE `orders` DROP COLUMN `refunded_amount`;
+ALTER TABLE `orders` DROP COLUMN `refunded_at`;
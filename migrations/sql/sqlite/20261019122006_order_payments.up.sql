@@ -0,0 +1,8 @@
+-- 报税报表：订单记录算税时的税率版本、收税和免税的销售额、付款时间和退款金额。
+ALTER TABLE `orders` ADD `tax_rate_dataset_id` integer;
+ALTER TABLE `orders` ADD `taxable_amount` integer;
+ALTER TABLE `orders` ADD `exempt_amount` integer;
+ALTER TABLE `orders` ADD `paid_at` datetime;
+ALTER TABLE `orders` ADD `refunded_amount` integer;
+ALTER TABLE `orders` ADD `refunded_at` datetime;
+CREATE INDEX `idx_orders_paid_at` ON `orders`(`paid_at`);
@@ -0,0 +1,24 @@
+ALTER TABLE `products` ADD `price` real;
+ALTER TABLE `products` ADD `discount` real;
+UPDATE `products` SET `price` = `price_amount`/100.0, `discount` = `discount_amount`/100.0;
+ALTER TABLE `products` DROP COLUMN `price_amount`;
+ALTER TABLE `products` DROP COLUMN `price_currency`;
+ALTER TABLE `products` DROP COLUMN `discount_amount`;
+ALTER TABLE `products` DROP COLUMN `discount_currency`;
+ALTER TABLE `order_items` DROP COLUMN `unit_price_currency`;
+ALTER TABLE `order_items` DROP COLUMN `tax_currency`;
+ALTER TABLE `order_items` RENAME COLUMN `unit_price_amount` TO `unit_price`;
+ALTER TABLE `orders` DROP COLUMN `delivery_fee_currency`;
+ALTER TABLE `orders` DROP COLUMN `subtotal_currency`;
+ALTER TABLE `orders` DROP COLUMN `delivery_fee_tax_currency`;
+ALTER TABLE `orders` DROP COLUMN `tax_currency`;
+ALTER TABLE `orders` DROP COLUMN `total_currency`;
+ALTER TABLE `orders` DROP COLUMN `taxable_sales_currency`;
+ALTER TABLE `orders` DROP COLUMN `exempt_sales_currency`;
+ALTER TABLE `orders` DROP COLUMN `refunded_currency`;
+ALTER TABLE `orders` RENAME COLUMN `delivery_fee_amount` TO `delivery_fee`;
+ALTER TABLE `orders` RENAME COLUMN `subtotal_amount` TO `subtotal`;
+ALTER TABLE `orders` RENAME COLUMN `delivery_fee_tax_amount` TO `delivery_fee_tax`;
+ALTER TABLE `orders` RENAME COLUMN `total_amount` TO `total`;
+ALTER TABLE `orders` RENAME COLUMN `taxable_sales_amount` TO `taxable_amount`;
+ALTER TABLE `orders` RENAME COLUMN `exempt_sales_amount` TO `exempt_amount`;
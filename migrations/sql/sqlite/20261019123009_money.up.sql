@@ -0,0 +1,27 @@
+-- 金额改成Money：最小货币单位的整数加币种。商品价格从浮点数的美元换算成分，已有的订单金额都是美元。
+ALTER TABLE `products` ADD `price_amount` integer;
+ALTER TABLE `products` ADD `price_currency` text;
+ALTER TABLE `products` ADD `discount_amount` integer;
+ALTER TABLE `products` ADD `discount_currency` text;
+UPDATE `products` SET `price_amount` = CAST(ROUND(ROUND(`price`*100, 6)) AS INTEGER), `price_currency` = 'USD', `discount_amount` = CAST(ROUND(ROUND(`discount`*100, 6)) AS INTEGER), `discount_currency` = 'USD';
+ALTER TABLE `products` DROP COLUMN `price`;
+ALTER TABLE `products` DROP COLUMN `discount`;
+ALTER TABLE `orders` RENAME COLUMN `delivery_fee` TO `delivery_fee_amount`;
+ALTER TABLE `orders` RENAME COLUMN `subtotal` TO `subtotal_amount`;
+ALTER TABLE `orders` RENAME COLUMN `delivery_fee_tax` TO `delivery_fee_tax_amount`;
+ALTER TABLE `orders` RENAME COLUMN `total` TO `total_amount`;
+ALTER TABLE `orders` RENAME COLUMN `taxable_amount` TO `taxable_sales_amount`;
+ALTER TABLE `orders` RENAME COLUMN `exempt_amount` TO `exempt_sales_amount`;
+ALTER TABLE `orders` ADD `delivery_fee_currency` text;
+ALTER TABLE `orders` ADD `subtotal_currency` text;
+ALTER TABLE `orders` ADD `delivery_fee_tax_currency` text;
+ALTER TABLE `orders` ADD `tax_currency` text;
+ALTER TABLE `orders` ADD `total_currency` text;
+ALTER TABLE `orders` ADD `taxable_sales_currency` text;
+ALTER TABLE `orders` ADD `exempt_sales_currency` text;
+ALTER TABLE `orders` ADD `refunded_currency` text;
+UPDATE `orders` SET `delivery_fee_currency` = 'USD', `subtotal_currency` = 'USD', `delivery_fee_tax_currency` = 'USD', `tax_currency` = 'USD', `total_currency` = 'USD', `taxable_sales_currency` = 'USD', `exempt_sales_currency` = 'USD', `refunded_currency` = 'USD';
+ALTER TABLE `order_items` RENAME COLUMN `unit_price` TO `unit_price_amount`;
+ALTER TABLE `order_items` ADD `unit_price_currency` text;
+ALTER TABLE `order_items` ADD `tax_currency` text;
+UPDATE `order_items` SET `unit_price_currency` = 'USD', `tax_currency` = 'USD';
@@ -0,0 +1,2 @@
+ALTER TABLE `stores` DROP COLUMN `currency`;
+ALTER TABLE `stores` DROP COLUMN `locale`;
@@ -0,0 +1,4 @@
+-- 每个店有自己的币种和显示金额用的locale，已有的店都是美元。
+ALTER TABLE `stores` ADD `currency` text;
+ALTER TABLE `stores` ADD `locale` text;
+UPDATE `stores` SET `currency` = 'USD', `locale` = 'en-US';
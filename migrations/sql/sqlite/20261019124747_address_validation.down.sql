@@ -0,0 +1,3 @@
+ALTER TABLE `addresses` DROP COLUMN `latitude`;
+ALTER TABLE `addresses` DROP COLUMN `longitude`;
+ALTER TABLE `addresses` DROP COLUMN `validated_at`;
@@ -0,0 +1,4 @@
+-- 地址校验之后保存规范化的字段和地理编码的坐标，已有的地址没有校验过，都是NULL。
+ALTER TABLE `addresses` ADD `latitude` real;
+ALTER TABLE `addresses` ADD `longitude` real;
+ALTER TABLE `addresses` ADD `validated_at` datetime;
@@ -0,0 +1,3 @@
+ALTER TABLE `addresses` DROP COLUMN `label`;
+ALTER TABLE `addresses` DROP COLUMN `phone`;
+ALTER TABLE `addresses` DROP COLUMN `delivery_instructions`;
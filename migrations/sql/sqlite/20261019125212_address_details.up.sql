@@ -0,0 +1,5 @@
+-- 地址的名字（Home、Work）、收货人电话和送货说明，已有的地址都是空的。
+ALTER TABLE `addresses` ADD `label` text;
+ALTER TABLE `addresses` ADD `phone` text;
+ALTER TABLE `addresses` ADD `delivery_instructions` text;
+UPDATE `addresses` SET `label` = '', `phone` = '', `delivery_instructions` = '';
@@ -0,0 +1,13 @@
+ALTER TABLE `orders` DROP COLUMN `fulfillment`;
+ALTER TABLE `orders` DROP COLUMN `contact_line1`;
+ALTER TABLE `orders` DROP COLUMN `contact_line2`;
+ALTER TABLE `orders` DROP COLUMN `contact_city`;
+ALTER TABLE `orders` DROP COLUMN `contact_state`;
+ALTER TABLE `orders` DROP COLUMN `contact_country`;
+ALTER TABLE `orders` DROP COLUMN `contact_postal_code`;
+ALTER TABLE `orders` DROP COLUMN `contact_name`;
+ALTER TABLE `orders` DROP COLUMN `contact_phone`;
+ALTER TABLE `orders` DROP COLUMN `contact_notes`;
+ALTER TABLE `orders` DROP COLUMN `contact_latitude`;
+ALTER TABLE `orders` DROP COLUMN `contact_longitude`;
+ALTER TABLE `orders` DROP COLUMN `contact_captured_at`;
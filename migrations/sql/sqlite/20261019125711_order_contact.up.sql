@@ -0,0 +1,15 @@
+-- 订单保存结账时的送货方式、地址和收货人，以前的订单没有快照（contact_captured_at是NULL）。
+ALTER TABLE `orders` ADD `fulfillment` text;
+ALTER TABLE `orders` ADD `contact_line1` text;
+ALTER TABLE `orders` ADD `contact_line2` text;
+ALTER TABLE `orders` ADD `contact_city` text;
+ALTER TABLE `orders` ADD `contact_state` text;
+ALTER TABLE `orders` ADD `contact_country` text;
+ALTER TABLE `orders` ADD `contact_postal_code` text;
+ALTER TABLE `orders` ADD `contact_name` text;
+ALTER TABLE `orders` ADD `contact_phone` text;
+ALTER TABLE `orders` ADD `contact_notes` text;
+ALTER TABLE `orders` ADD `contact_latitude` real;
+ALTER TABLE `orders` ADD `contact_longitude` real;
+ALTER TABLE `orders` ADD `contact_captured_at` datetime;
+UPDATE `orders` SET `fulfillment` = '', `contact_line1` = '', `contact_line2` = '', `contact_city` = '', `contact_state` = '', `contact_country` = '', `contact_postal_code` = '', `contact_name` = '', `contact_phone` = '', `contact_notes` = '';
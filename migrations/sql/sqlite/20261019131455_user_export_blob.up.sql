@@ -0,0 +1,3 @@
+-- 记录导出文件在private container里的名字，过期之后按它删除文件。以前的导出没有记录，需要手工清理。
+ALTER TABLE `user_export_requests` ADD `blob_name` text;
+UPDATE `user_export_requests` SET `blob_name` = '';
@@ -0,0 +1,3 @@
+DROP INDEX `idx_store_invitations_token_hash`;
+ALTER TABLE `store_invitations` RENAME COLUMN `token_hash` TO `token`;
+CREATE UNIQUE INDEX `idx_store_invitations_token` ON `store_invitations`(`token`);
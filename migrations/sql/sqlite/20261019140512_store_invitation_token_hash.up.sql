@@ -0,0 +1,5 @@
+-- 邀请只保存token的sha256。以前明文保存的token可能已经进了日志，全部作废，发给验证过的email的邀请登录之后仍然会自动接受。
+DROP INDEX `idx_store_invitations_token`;
+ALTER TABLE `store_invitations` RENAME COLUMN `token` TO `token_hash`;
+UPDATE `store_invitations` SET `token_hash` = lower(hex(randomblob(32)));
+CREATE UNIQUE INDEX `idx_store_invitations_token_hash` ON `store_invitations`(`token_hash`);
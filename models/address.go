@@ -1,5 +1,10 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
 type Address struct {
 	BaseModel
 	Line1      string `json:"line1"`
@@ -8,4 +13,35 @@ type Address struct {
 	State      string `json:"state"`
 	Country    string `json:"country"`
 	PostalCode string `gorm:"column:postal_code" json:"postal_code"`
+	// 用户给地址起的名字，比如Home、Work
+	Label string `gorm:"size:32" json:"label"`
+	// 收货人电话（E.164，比如+14155550123）和给骑手的送货说明，建Uber Delivery的时候带上
+	Phone                string `gorm:"size:20" json:"phone"`
+	DeliveryInstructions string `gorm:"size:500" json:"delivery_instructions"`
+	// 地理编码的坐标，没有配置geocoder或者没有查到的时候是nil
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// 通过校验并规范化的时间，校验上线之前保存的地址是nil
+	ValidatedAt *time.Time `json:"validated_at,omitempty"`
+}
+
+// OneLine 是 "1 Main St, Apt 2, San Francisco, CA 94016" 这样的一行地址，给Uber这类只收字符串地址的接口用。
+func (a *Address) OneLine() string {
+	parts := []string{}
+	for _, part := range []string{a.Line1, a.Line2, a.City, strings.TrimSpace(a.State + " " + a.PostalCode)} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ZIP5 是邮编的前5位，税率表按5位的ZIP查，ZIP+4的地址也一样。
+func (a *Address) ZIP5() string {
+	zip, _, _ := strings.Cut(strings.TrimSpace(a.PostalCode), "-")
+	return zip
+}
+
+func (a *Address) HasCoordinates() bool {
+	return a.Latitude != nil && a.Longitude != nil
 }
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// APIKey 是service account用来调用API的key。明文只在创建的时候返回一次，数据库里只存SHA-256。
+// Prefix 是明文key里公开的一段，用来查找key和在日志/界面上辨认key。
+type APIKey struct {
+	BaseModel
+	UserID      int64        `gorm:"index" json:"user_id"`
+	Name        string       `json:"name"`
+	Prefix      string       `gorm:"uniqueIndex;type:varchar(32)" json:"prefix"`
+	Hash        string       `gorm:"type:varchar(64)" json:"-"`
+	Permissions []Permission `gorm:"serializer:json" json:"permissions"`
+	// StoreID 不为空的时候，这个key只能访问这一个店。
+	StoreID    *int64     `json:"store_id,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedBy  int64      `json:"created_by"`
+}
+
+func (k *APIKey) IsActive() bool {
+	now := time.Now()
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+func (k *APIKey) HasPermission(p Permission) bool {
+	return containsPermission(k.Permissions, p)
+}
+
+// AllowsStore 检查key的店铺范围。
+func (k *APIKey) AllowsStore(storeID int64) bool {
+	return k.StoreID == nil || *k.StoreID == storeID
+}
@@ -0,0 +1,18 @@
+package models
+
+// AuditLog 记录管理员做的每一个修改，Details是JSON格式的修改内容。
+type AuditLog struct {
+	BaseModel
+	ActorID    int64  `gorm:"index" json:"actor_id"`
+	Action     string `json:"action"`
+	TargetType string `gorm:"index:idx_audit_target" json:"target_type"`
+	TargetID   int64  `gorm:"index:idx_audit_target" json:"target_id"`
+	Details    string `json:"details"`
+}
+
+const (
+	AuditTargetUser   = "user"
+	AuditTargetAPIKey = "api_key"
+	// 税率数据的版本
+	AuditTargetTaxRateDataset = "tax_rate_dataset"
+)
@@ -5,64 +5,121 @@ import (
 	"crypto/x509"
 	"database/sql"
 	"fmt"
-	"log"
 	"os"
+	"time"
 
 	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-func autoMigrateTables(db *gorm.DB, entities ...interface{}) {
-	for _, entity := range entities {
-		if err := db.AutoMigrate(entity); err != nil {
-			panic("AutoMigrate error:" + err.Error())
-		}
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// InitDB 按 dbDriver（mysql、postgres、sqlite，默认mysql）连接 dsn。
+// enableCustomTLS 打开的时候用 pemPath 里的CA验证服务器证书，MySQL和PostgreSQL都支持。
+func InitDB() *gorm.DB {
+	dialector, err := NewDialector(viper.GetString("dbDriver"), viper.GetString("dsn"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: NewGormLogger()})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err = db.Use(MetricsPlugin{}); err != nil {
+		log.Fatal("Failed to register metrics plugin", err)
 	}
+	if err = db.Use(TracingPlugin{}); err != nil {
+		log.Fatal("Failed to register tracing plugin", err)
+	}
+
+	return db
 }
 
-func AutoMigrate(db *gorm.DB) {
-	autoMigrateTables(db, &Config{}, &User{}, &Product{}, &Store{}, &ProductStore{}, &UserStore{}, &UserAddress{}, &Order{}, &OrderItem{}, &ManagerStores{}, &DeleteUserRequest{}, &TaxRate{})
+// NewGormLogger 把gorm的日志写到logrus里，只记错误和慢查询。SQL里的参数不写日志，里面会有email、token这些数据。
+func NewGormLogger() logger.Interface {
+	return logger.New(gormLogWriter{}, logger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  logger.Warn,
+		IgnoreRecordNotFoundError: true,
+		ParameterizedQueries:      true,
+	})
 }
 
-func InitDB() *gorm.DB {
-	enableCustomTLS := viper.GetBool("enableCustomTLS")
-	if enableCustomTLS {
-		// Initialize connection string.
-		rootCertPool := x509.NewCertPool()
-		pem, err := os.ReadFile(viper.GetString("pemPath"))
+type gormLogWriter struct{}
+
+func (gormLogWriter) Printf(format string, args ...interface{}) {
+	log.WithField("component", "gorm").Warnf(format, args...)
+}
+
+// NewDialector 返回driver对应的gorm dialector，driver为空的时候用MySQL。
+func NewDialector(driver, dsn string) (gorm.Dialector, error) {
+	var tlsConfig *tls.Config
+	if viper.GetBool("enableCustomTLS") {
+		var err error
+		if tlsConfig, err = customTLSConfig(viper.GetString("pemPath")); err != nil {
+			return nil, err
+		}
+	}
+
+	switch driver {
+	case "", DriverMySQL:
+		if tlsConfig != nil {
+			// dsn里用 tls=custom 引用
+			if err := mysqlDriver.RegisterTLSConfig("custom", tlsConfig); err != nil {
+				return nil, fmt.Errorf("failed to register TLS config: %w", err)
+			}
+		}
+		// Open database with standard MySQL driver
+		sqlDb, err := sql.Open("mysql", dsn)
 		if err != nil {
-			log.Fatal("Failed to read pem file", err)
+			return nil, err
 		}
-		if ok := rootCertPool.AppendCertsFromPEM(pem); !ok {
-			log.Fatal("Failed to append PEM.")
+		return mysql.New(mysql.Config{Conn: sqlDb}), nil
+	case DriverPostgres:
+		config, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid postgres dsn: %w", err)
 		}
-		if err = mysqlDriver.RegisterTLSConfig("custom", &tls.Config{
-			RootCAs:    rootCertPool,
-			MinVersion: tls.VersionTLS12,
-		}); err != nil {
-			log.Fatal("Failed to register TLS config", err)
+		if tlsConfig != nil {
+			tlsConfig.ServerName = config.Host
+			config.TLSConfig = tlsConfig
+			// 不允许退回到不加密的连接
+			config.Fallbacks = nil
 		}
+		return postgres.New(postgres.Config{Conn: stdlib.OpenDB(*config)}), nil
+	case DriverSQLite:
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported dbDriver %q", driver)
 	}
-	dsn := viper.GetString("dsn")
+}
 
-	// Open database with standard MySQL driver
-	sqlDb, err := sql.Open("mysql", dsn)
+func customTLSConfig(pemPath string) (*tls.Config, error) {
+	rootCertPool := x509.NewCertPool()
+	pem, err := os.ReadFile(pemPath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to read pem file: %w", err)
 	}
-
-	// Pass sql.DB instance to GORM
-	db, err := gorm.Open(mysql.New(mysql.Config{
-		Conn: sqlDb,
-	}), &gorm.Config{Logger: logger.Default.LogMode(logger.Info)}) // Can set LogLevel here
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	if ok := rootCertPool.AppendCertsFromPEM(pem); !ok {
+		return nil, fmt.Errorf("failed to append PEM")
 	}
-
-	return db
+	return &tls.Config{
+		RootCAs:    rootCertPool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
 }
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
 // ProductCategory represents the product category
 type ProductCategory string
 
@@ -7,6 +13,10 @@ const (
 	ProductCategoryFood  ProductCategory = "FOOD"
 	ProductCategoryDrink ProductCategory = "DRINK"
 	ProductCategoryOther ProductCategory = "OTHER"
+	// 食品杂货（没有加工的食材、包装食品），大部分州免销售税
+	ProductCategoryGrocery ProductCategory = "GROCERY"
+	// 做好的熟食，和FOOD一样要交税
+	ProductCategoryPreparedFood ProductCategory = "PREPARED_FOOD"
 )
 
 // Product represents the product entity
@@ -16,12 +26,41 @@ type Product struct {
 	Creator     *User           `gorm:"foreignKey:CreatorID" json:"-"`
 	CreatorID   int64           `json:"creator_id"`
 	Description string          `json:"description"`
-	Price       float64         `json:"price"`
-	Discount    float64         `json:"discount"`
+	Price       Money           `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	Discount    Money           `gorm:"embedded;embeddedPrefix:discount_" json:"discount"` // 在Price上直接减掉的金额
 	Category    ProductCategory `json:"category"`
 	ImageURL    string          `gorm:"column:image_url" json:"image_url"`
 }
 
+// BeforeSave 没有币种的价格用DefaultCurrency，Discount和Price是同一个币种。
+func (p *Product) BeforeSave(*gorm.DB) error {
+	if p.Price.Currency == "" {
+		p.Price.Currency = DefaultCurrency
+	}
+	if p.Discount.Currency == "" {
+		p.Discount.Currency = p.Price.Currency
+	}
+	if _, err := ParseCurrency(p.Price.Currency); err != nil {
+		return err
+	}
+	if p.Price.Amount < 0 || p.Discount.Amount < 0 || !p.Price.SameCurrency(p.Discount) {
+		return fmt.Errorf("%w: price %v with discount %v", ErrInvalidMoney, p.Price, p.Discount)
+	}
+	return nil
+}
+
+// UnitPrice 是减掉Discount之后的单价，最低是0。
+func (p *Product) UnitPrice() (Money, error) {
+	price, err := p.Price.Sub(p.Discount)
+	if err != nil {
+		return Money{}, err
+	}
+	if price.Amount < 0 {
+		price.Amount = 0
+	}
+	return price, nil
+}
+
 // Store represents the store entity
 type Store struct {
 	BaseModel
@@ -31,6 +70,25 @@ type Store struct {
 	State   string `json:"state"`
 	ZipCode string `gorm:"column:zip_code" json:"zip_code"`
 	Phone   string `json:"phone"`
+	// 店里的商品都用这个币种定价，结账也用这个币种
+	Currency string `gorm:"size:3" json:"currency"`
+	// 显示金额用的locale，比如 "en-US"、"fr-CA"
+	Locale string `gorm:"size:35" json:"locale"`
+}
+
+// BeforeSave 没有设置的时候是DefaultCurrency和DefaultLocale，都会被规范成标准写法。
+func (s *Store) BeforeSave(*gorm.DB) (err error) {
+	if s.Currency == "" {
+		s.Currency = DefaultCurrency
+	}
+	if s.Locale == "" {
+		s.Locale = DefaultLocale
+	}
+	if s.Currency, err = ParseCurrency(s.Currency); err != nil {
+		return err
+	}
+	s.Locale, err = ParseLocale(s.Locale)
+	return err
 }
 
 // ProductStore represents the product store entity
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const DefaultLocale = "en-US"
+
+var (
+	ErrInvalidCurrency = errors.New("invalid currency")
+	ErrInvalidLocale   = errors.New("unsupported locale")
+)
+
+// 数字格式只按语言区分：千分位、小数点，货币符号在前面还是后面（后面的时候用不换行空格隔开）
+type numberFormat struct {
+	group       string
+	decimal     string
+	symbolAfter bool
+}
+
+var (
+	formatSymbolBefore   = numberFormat{group: ",", decimal: "."}
+	formatSymbolAfter    = numberFormat{group: ".", decimal: ",", symbolAfter: true}
+	formatSpaceSeparated = numberFormat{group: "\u00a0", decimal: ",", symbolAfter: true}
+)
+
+var localeFormats = map[string]numberFormat{
+	"en": formatSymbolBefore, "ja": formatSymbolBefore, "zh": formatSymbolBefore, "ko": formatSymbolBefore,
+	"de": formatSymbolAfter, "es": formatSymbolAfter, "it": formatSymbolAfter, "nl": formatSymbolAfter, "pt": formatSymbolAfter,
+	"fr": {group: "\u202f", decimal: ",", symbolAfter: true},
+	"sv": formatSpaceSeparated, "nb": formatSpaceSeparated, "fi": formatSpaceSeparated, "pl": formatSpaceSeparated,
+	"cs": formatSpaceSeparated, "ru": formatSpaceSeparated,
+}
+
+// 货币符号，没有的直接用代码。美元、加元这些在本国的locale里只写 "$"
+var (
+	currencySymbols = map[string]string{
+		"USD": "US$", "CAD": "CA$", "AUD": "A$", "NZD": "NZ$", "HKD": "HK$", "MXN": "MX$", "SGD": "SGD",
+		"EUR": "€", "GBP": "£", "JPY": "¥", "CNY": "CN¥", "KRW": "₩", "INR": "₹",
+	}
+	narrowCurrencySymbols = map[string]string{
+		"USD": "$", "CAD": "$", "AUD": "$", "NZD": "$", "HKD": "$", "MXN": "$", "SGD": "$", "CNY": "¥",
+	}
+)
+
+// 没有指定locale的时候（比如API返回的formatted）用货币所在国家的locale
+var currencyLocales = map[string]string{
+	"USD": "en-US", "CAD": "en-CA", "AUD": "en-AU", "NZD": "en-NZ", "GBP": "en-GB", "SGD": "en-SG", "HKD": "zh-HK",
+	"EUR": "de-DE", "JPY": "ja-JP", "CNY": "zh-CN", "KRW": "ko-KR", "MXN": "es-MX", "INR": "en-IN",
+}
+
+// ParseCurrency 检查currency是3个字母的ISO 4217代码，返回大写。
+func ParseCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, currency)
+	}
+	return currency, nil
+}
+
+// ParseLocale 把 "en_us"、"fr-ca" 这样的locale规范成 "en-US"、"fr-CA"，不支持的语言返回ErrInvalidLocale。
+func ParseLocale(locale string) (string, error) {
+	language, region, hasRegion := strings.Cut(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	language = strings.ToLower(language)
+	if _, ok := localeFormats[language]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidLocale, locale)
+	}
+	if !hasRegion {
+		return language, nil
+	}
+	region = strings.ToUpper(region)
+	if len(region) != 2 || strings.Trim(region, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidLocale, locale)
+	}
+	return language + "-" + region, nil
+}
+
+// Format 按locale格式化金额，比如en-US的 "$1,234.50"、de-DE的 "1.234,50 €"。不支持的locale按en-US。
+func (m Money) Format(locale string) string {
+	locale, err := ParseLocale(locale)
+	if err != nil {
+		locale = DefaultLocale
+	}
+	language, region, _ := strings.Cut(locale, "-")
+	format := localeFormats[language]
+
+	symbol, ok := currencySymbols[m.Currency]
+	if narrow, hasNarrow := narrowCurrencySymbols[m.Currency]; hasNarrow && len(m.Currency) == 3 && m.Currency[:2] == region {
+		symbol, ok = narrow, true
+	}
+	if !ok {
+		symbol = m.Currency
+	}
+
+	decimal := m.Decimal()
+	sign := ""
+	if strings.HasPrefix(decimal, "-") {
+		sign, decimal = "-", decimal[1:]
+	}
+	whole, fraction, hasFraction := strings.Cut(decimal, ".")
+	var number strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			number.WriteString(format.group)
+		}
+		number.WriteRune(digit)
+	}
+	if hasFraction {
+		number.WriteString(format.decimal + fraction)
+	}
+
+	switch {
+	case format.symbolAfter:
+		return sign + number.String() + "\u00a0" + symbol
+	case !ok:
+		// 货币代码和数字之间要空开
+		return sign + symbol + "\u00a0" + number.String()
+	default:
+		return sign + symbol + number.String()
+	}
+}
+
+// CurrencyLocale 是currency所在国家的locale，不认识的货币是DefaultLocale。
+func CurrencyLocale(currency string) string {
+	if locale, ok := currencyLocales[strings.ToUpper(currency)]; ok {
+		return locale
+	}
+	return DefaultLocale
+}
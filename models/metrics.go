@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/atomi-ai/atomi/utils"
+	"gorm.io/gorm"
+)
+
+const metricsStartKey = "atomi:metrics_start"
+
+// MetricsPlugin 记录每条SQL的耗时到 atomi_db_query_duration_seconds，用 db.Use(models.MetricsPlugin{}) 开启。
+type MetricsPlugin struct{}
+
+func (MetricsPlugin) Name() string {
+	return "atomi:metrics"
+}
+
+func (MetricsPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("atomi:metrics_before_create", startQueryTimer),
+		cb.Create().After("gorm:create").Register("atomi:metrics_after_create", observeQuery("create")),
+		cb.Query().Before("gorm:query").Register("atomi:metrics_before_query", startQueryTimer),
+		cb.Query().After("gorm:query").Register("atomi:metrics_after_query", observeQuery("query")),
+		cb.Update().Before("gorm:update").Register("atomi:metrics_before_update", startQueryTimer),
+		cb.Update().After("gorm:update").Register("atomi:metrics_after_update", observeQuery("update")),
+		cb.Delete().Before("gorm:delete").Register("atomi:metrics_before_delete", startQueryTimer),
+		cb.Delete().After("gorm:delete").Register("atomi:metrics_after_delete", observeQuery("delete")),
+		cb.Row().Before("gorm:row").Register("atomi:metrics_before_row", startQueryTimer),
+		cb.Row().After("gorm:row").Register("atomi:metrics_after_row", observeQuery("row")),
+		cb.Raw().Before("gorm:raw").Register("atomi:metrics_before_raw", startQueryTimer),
+		cb.Raw().After("gorm:raw").Register("atomi:metrics_after_raw", observeQuery("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startQueryTimer(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func observeQuery(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		utils.DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(v.(time.Time)).Seconds())
+	}
+}
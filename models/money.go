@@ -0,0 +1,224 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const DefaultCurrency = "USD"
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidMoney     = errors.New("invalid money amount")
+)
+
+// 最小货币单位的小数位数，不在这里的都是2位
+var currencyMinorUnits = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+	"BHD": 3, "KWD": 3, "JOD": 3, "OMR": 3, "TND": 3,
+}
+
+// 比例（税率等）按百万分之一取整之后用整数计算
+const rateScale = 1000000
+
+// Money 是一个金额，Amount是最小货币单位（美元是分），Currency是ISO 4217大写代码。
+// 数据库里用embedded存成两列，比如 `gorm:"embedded;embeddedPrefix:price_"` 是price_amount和price_currency；
+// JSON是 {"amount": 999, "currency": "USD", "formatted": "$9.99"}，formatted按货币所在国家的locale格式化，只是给客户端显示的，解析的时候忽略。
+//
+// 所有的舍入都是四舍五入到最小货币单位，0.5远离0（-0.5变成-1）。
+type Money struct {
+	Amount   int64  `gorm:"column:amount" json:"amount"`
+	Currency string `gorm:"column:currency;size:3" json:"currency"`
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// MinorUnits 返回currency最小单位的小数位数。
+func MinorUnits(currency string) int {
+	if units, ok := currencyMinorUnits[strings.ToUpper(currency)]; ok {
+		return units
+	}
+	return 2
+}
+
+// ParseMoney 把 "9.99"、"-0.005" 这样的十进制字符串换算成最小单位，多出来的小数四舍五入。
+func ParseMoney(value, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	s := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative, s = s[0] == '-', s[1:]
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, value)
+	}
+
+	units := MinorUnits(currency)
+	roundUp := len(fraction) > units && fraction[units] >= '5'
+	fraction = (fraction + strings.Repeat("0", units))[:units]
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if whole+fraction == "" {
+		amount, err = 0, nil
+	}
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, value)
+	}
+	if roundUp {
+		amount++
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MoneyFromFloat 把以主单位表示的金额（比如9.99美元）换算成最小单位。按float64最短的十进制表示来舍入，
+// 所以1.005是1.01，而不是 1.005*100=100.49999... 的1.00。
+func MoneyFromFloat(value float64, currency string) Money {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return Money{Currency: strings.ToUpper(currency)}
+	}
+	m, err := ParseMoney(strconv.FormatFloat(value, 'f', -1, 64), currency)
+	if err != nil {
+		return Money{Currency: strings.ToUpper(currency)}
+	}
+	return m
+}
+
+// Decimal 返回主单位的十进制字符串，比如 "9.99"、"-0.05"、"100"（JPY）。
+func (m Money) Decimal() string {
+	units := MinorUnits(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	digits := strconv.FormatUint(absInt64(amount), 10)
+	if units == 0 {
+		return sign + digits
+	}
+	if len(digits) <= units {
+		digits = strings.Repeat("0", units-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-units] + "." + digits[len(digits)-units:]
+}
+
+type moneyJSON struct {
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Formatted string `json:"formatted,omitempty"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	data := moneyJSON{Amount: m.Amount, Currency: m.Currency}
+	if m.Currency != "" {
+		data.Formatted = m.Format(CurrencyLocale(m.Currency))
+	}
+	return json.Marshal(data)
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var decoded moneyJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*m = NewMoney(decoded.Amount, decoded.Currency)
+	return nil
+}
+
+func (m Money) String() string {
+	return strings.TrimSpace(m.Decimal() + " " + m.Currency)
+}
+
+// Float 只用来显示，不要拿来计算。
+func (m Money) Float() float64 {
+	return float64(m.Amount) / math.Pow10(MinorUnits(m.Currency))
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// SameCurrency 判断两个金额能不能加减，没有币种的0（Money{}）和任何币种都可以。
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == other.Currency || m.Currency == "" && m.Amount == 0 || other.Currency == "" && other.Amount == 0
+}
+
+func (m Money) currencyWith(other Money) string {
+	if m.Currency == "" {
+		return other.Currency
+	}
+	return m.Currency
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("%w: %v and %v", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currencyWith(other)}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("%w: %v and %v", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.currencyWith(other)}, nil
+}
+
+// Mul 乘以数量。
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount * quantity, Currency: m.Currency}
+}
+
+// MulRate 乘以一个比例（比如税率），rate取到百万分之一，结果四舍五入到最小单位。
+func (m Money) MulRate(rate float64) Money {
+	return Money{Amount: RoundDiv(m.Amount*RateMicros(rate), rateScale), Currency: m.Currency}
+}
+
+// Convert 按汇率rate（1个m.Currency换多少个currency）换算成currency，两个币种最小单位的小数位数可以不一样。
+func (m Money) Convert(rate float64, currency string) Money {
+	currency = strings.ToUpper(currency)
+	n, d := m.Amount*RateMicros(rate), int64(rateScale)
+	if shift := MinorUnits(currency) - MinorUnits(m.Currency); shift > 0 {
+		n *= int64(math.Pow10(shift))
+	} else if shift < 0 {
+		d *= int64(math.Pow10(-shift))
+	}
+	return Money{Amount: RoundDiv(n, d), Currency: currency}
+}
+
+// RateMicros 是rate的百万分之一的整数，比如0.0925是92500。
+func RateMicros(rate float64) int64 {
+	return int64(math.Round(rate * rateScale))
+}
+
+// RoundDiv 是 n/d 四舍五入（0.5远离0），d要大于0。
+func RoundDiv(n, d int64) int64 {
+	if n < 0 {
+		return -((-n + d/2) / d)
+	}
+	return (n + d/2) / d
+}
+
+func absInt64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Order struct {
 	BaseModel
 	UserID          int64       `gorm:"column:user_id" json:"user_id"`
@@ -8,6 +10,78 @@ type Order struct {
 	DeliveryID      *string     `gorm:"column:delivery_id;unique" json:"delivery_id"`
 	OrderItems      []OrderItem `gorm:"foreignKey:OrderID" json:"order_items"`
 	DisplayStatus   OrderStatus `gorm:"column:status" json:"display_status"`
+	// 下单时Uber报价的运费，到店自取为0
+	DeliveryFee Money `gorm:"embedded;embeddedPrefix:delivery_fee_" json:"delivery_fee"`
+
+	// 以下是服务端算税的结果，TaxCalculatedAt为空表示还没有算过
+	Subtotal        Money      `gorm:"embedded;embeddedPrefix:subtotal_" json:"subtotal"`
+	TaxState        string     `gorm:"column:tax_state" json:"tax_state"`
+	TaxZipCode      string     `gorm:"column:tax_zip_code" json:"tax_zip_code"`
+	TaxRate         float64    `gorm:"column:tax_rate" json:"tax_rate"`
+	TaxExempt       bool       `gorm:"column:tax_exempt" json:"tax_exempt"`
+	DeliveryFeeTax  Money      `gorm:"embedded;embeddedPrefix:delivery_fee_tax_" json:"delivery_fee_tax"`
+	Tax             Money      `gorm:"embedded;embeddedPrefix:tax_" json:"tax"`
+	Total           Money      `gorm:"embedded;embeddedPrefix:total_" json:"total"`
+	TaxCalculatedAt *time.Time `gorm:"column:tax_calculated_at" json:"tax_calculated_at"`
+	// 算税时生效的税率版本，报表按这个版本的税率统计
+	TaxRateDatasetID int64 `gorm:"column:tax_rate_dataset_id" json:"tax_rate_dataset_id"`
+	// 收税和免税的销售额（包括运费），加起来等于Subtotal+DeliveryFee
+	TaxableSales Money `gorm:"embedded;embeddedPrefix:taxable_sales_" json:"taxable_sales"`
+	ExemptSales  Money `gorm:"embedded;embeddedPrefix:exempt_sales_" json:"exempt_sales"`
+
+	// 付款成功和退款的时间，由/api/pay和Stripe的webhook更新，Refunded是累计退款金额
+	PaidAt     *time.Time `gorm:"column:paid_at;index" json:"paid_at"`
+	Refunded   Money      `gorm:"embedded;embeddedPrefix:refunded_" json:"refunded"`
+	RefundedAt *time.Time `gorm:"column:refunded_at" json:"refunded_at"`
+
+	// 结账时的送货方式、地址和收货人，付款之后不再改变，Uber的Delivery也按它建。ContactCapturedAt为空表示还没有结账
+	Fulfillment       FulfillmentType `gorm:"column:fulfillment;size:16" json:"fulfillment"`
+	Contact           OrderContact    `gorm:"embedded;embeddedPrefix:contact_" json:"contact"`
+	ContactCapturedAt *time.Time      `gorm:"column:contact_captured_at" json:"contact_captured_at"`
+}
+
+type FulfillmentType string
+
+const (
+	FulfillmentDelivery = FulfillmentType("DELIVERY")
+	FulfillmentPickup   = FulfillmentType("PICKUP")
+)
+
+// OrderContact 是结账时地址和收货人的快照：送货是收货地址，到店自取是店的地址。之后地址修改或者删除都不影响订单。
+type OrderContact struct {
+	Line1      string   `json:"line1"`
+	Line2      string   `json:"line2"`
+	City       string   `json:"city"`
+	State      string   `json:"state"`
+	Country    string   `json:"country"`
+	PostalCode string   `json:"postal_code"`
+	Latitude   *float64 `json:"latitude,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+	Name       string   `json:"name"`
+	Phone      string   `json:"phone"`
+	// 给骑手或者店里的说明
+	Notes string `json:"notes"`
+}
+
+// Address 是快照里的地址部分。
+func (c *OrderContact) Address() *Address {
+	return &Address{Line1: c.Line1, Line2: c.Line2, City: c.City, State: c.State, Country: c.Country, PostalCode: c.PostalCode,
+		Latitude: c.Latitude, Longitude: c.Longitude, Phone: c.Phone, DeliveryInstructions: c.Notes}
+}
+
+// ClearTax 清掉算税的结果，客户端传上来的这些字段不可信。
+func (o *Order) ClearTax() {
+	o.Subtotal, o.TaxState, o.TaxZipCode, o.TaxRate, o.TaxExempt = Money{}, "", "", 0, false
+	o.DeliveryFeeTax, o.Tax, o.Total, o.TaxCalculatedAt = Money{}, Money{}, Money{}, nil
+	o.TaxRateDatasetID, o.TaxableSales, o.ExemptSales = 0, Money{}, Money{}
+	for i := range o.OrderItems {
+		o.OrderItems[i].UnitPrice, o.OrderItems[i].TaxCategory, o.OrderItems[i].Taxable, o.OrderItems[i].Tax = Money{}, "", false, Money{}
+	}
+}
+
+// ClearContact 清掉结账时的快照，只能由结账流程设置。
+func (o *Order) ClearContact() {
+	o.Fulfillment, o.Contact, o.ContactCapturedAt = "", OrderContact{}, nil
 }
 
 type OrderStatus string
@@ -40,4 +114,10 @@ type OrderItem struct {
 	Product   *Product `gorm:"foreignKey:ProductID" json:"product"`
 	ProductID int64    `gorm:"column:product_id" json:"product_id"`
 	Quantity  int64    `gorm:"column:quantity" json:"quantity"`
+
+	// 算税的时候的单价和商品分类，商品之后改价也不影响这个订单
+	UnitPrice   Money           `gorm:"embedded;embeddedPrefix:unit_price_" json:"unit_price"`
+	TaxCategory ProductCategory `gorm:"column:tax_category" json:"tax_category"`
+	Taxable     bool            `gorm:"column:taxable" json:"taxable"`
+	Tax         Money           `gorm:"embedded;embeddedPrefix:tax_" json:"tax"`
 }
@@ -5,12 +5,23 @@ import (
 )
 
 type PaymentIntentRequest struct {
-	Amount            int64         `json:"amount"`
-	Currency          string        `json:"currency"`
-	PaymentMethodID   string        `json:"payment_method_id"`
-	ShippingAddressID int64         `json:"shipping_address_id"`
-	OrderID           int64         `json:"order_id"`
-	DeliveryData      *DeliveryData `json:"delivery_data"`
+	Amount            int64  `json:"amount"`
+	Currency          string `json:"currency"`
+	PaymentMethodID   string `json:"payment_method_id"`
+	ShippingAddressID int64  `json:"shipping_address_id"`
+	OrderID           int64  `json:"order_id"`
+	// 送货方式，默认是DELIVERY；收货人、电话和说明不传的时候用用户和收货地址上的，都保存在订单的快照里
+	Fulfillment    FulfillmentType `json:"fulfillment"`
+	RecipientName  string          `json:"recipient_name"`
+	RecipientPhone string          `json:"recipient_phone"`
+	Notes          string          `json:"notes"`
+	// DeliveryData 不为空的时候付款之后马上建Uber Delivery。内容由服务端按订单的快照生成，只用这里的quote_id
+	DeliveryData *DeliveryData `json:"delivery_data"`
+}
+
+// Money 是要付的金额，Stripe的amount本来就是最小货币单位。
+func (r *PaymentIntentRequest) Money() Money {
+	return NewMoney(r.Amount, r.Currency)
 }
 
 // UnmarshalJSONPaymentIntentRequest 将JSON字符串转换为PaymentIntentRequest结构体
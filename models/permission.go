@@ -0,0 +1,131 @@
+package models
+
+// Permission 是一个可以被授权的操作，格式为 "<resource>:<action>"。
+type Permission string
+
+const (
+	PermissionStoreView   Permission = "store:view"
+	PermissionStoreManage Permission = "store:manage"
+	PermissionProductEdit Permission = "product:edit"
+	PermissionOrderView   Permission = "order:view"
+	PermissionOrderUpdate Permission = "order:update"
+	PermissionOrderRefund Permission = "order:refund"
+	PermissionImageUpload Permission = "image:upload"
+	PermissionUserManage  Permission = "user:manage"
+	// 查看税务等财务报表，只有admin和授权的service account有
+	PermissionReportView Permission = "report:view"
+)
+
+// StoreRelationship 是用户和某一个店之间的关系，只对那个店生效。
+// 顾客的关系（DEFAULT / FAVORITE）没有任何管理权限，店员的关系（OWNER / MANAGER / STAFF / CASHIER）
+// 的权限见 StoreRelationshipPermissions。
+type StoreRelationship string
+
+const (
+	StoreRelationshipDefault  StoreRelationship = "DEFAULT"
+	StoreRelationshipFavorite StoreRelationship = "FAVORITE"
+	StoreRelationshipOwner    StoreRelationship = "OWNER"
+	StoreRelationshipManager  StoreRelationship = "MANAGER"
+	StoreRelationshipStaff    StoreRelationship = "STAFF"
+	StoreRelationshipCashier  StoreRelationship = "CASHIER"
+)
+
+// RolePermissions 是全局角色的权限。RoleAdmin不在这里，因为admin拥有所有权限（包括只有admin才有的user:manage和report:view）。
+var RolePermissions = map[Role][]Permission{
+	RoleUser: {},
+	RoleMgr: {
+		PermissionStoreView,
+		PermissionStoreManage,
+		PermissionProductEdit,
+		PermissionOrderView,
+		PermissionOrderUpdate,
+		PermissionOrderRefund,
+		PermissionImageUpload,
+	},
+}
+
+// StoreRelationshipPermissions 只包含店员的关系。
+var StoreRelationshipPermissions = map[StoreRelationship][]Permission{
+	StoreRelationshipOwner: {
+		PermissionStoreView,
+		PermissionStoreManage,
+		PermissionProductEdit,
+		PermissionOrderView,
+		PermissionOrderUpdate,
+		PermissionOrderRefund,
+	},
+	StoreRelationshipManager: {
+		PermissionStoreView,
+		PermissionProductEdit,
+		PermissionOrderView,
+		PermissionOrderUpdate,
+		PermissionOrderRefund,
+	},
+	StoreRelationshipStaff: {
+		PermissionStoreView,
+		PermissionProductEdit,
+		PermissionOrderView,
+		PermissionOrderUpdate,
+	},
+	StoreRelationshipCashier: {
+		PermissionStoreView,
+		PermissionOrderView,
+		PermissionOrderUpdate,
+	},
+}
+
+// AllPermissions 是所有可以授权的操作，譬如用来检查API key的权限是不是合法。
+var AllPermissions = []Permission{
+	PermissionStoreView,
+	PermissionStoreManage,
+	PermissionProductEdit,
+	PermissionOrderView,
+	PermissionOrderUpdate,
+	PermissionOrderRefund,
+	PermissionImageUpload,
+	PermissionUserManage,
+	PermissionReportView,
+}
+
+func (p Permission) IsValid() bool {
+	return containsPermission(AllPermissions, p)
+}
+
+// IsStoreScoped 判断权限能不能只授予某一个店，也就是店员关系里有的权限。
+func (p Permission) IsStoreScoped() bool {
+	return containsPermission(StoreRelationshipPermissions[StoreRelationshipOwner], p)
+}
+
+func (r Role) HasPermission(p Permission) bool {
+	if r == RoleAdmin {
+		return true
+	}
+	return containsPermission(RolePermissions[r], p)
+}
+
+// StaffStoreRelationships 是所有店员的关系，一个用户在一个店里最多只有其中一个。
+var StaffStoreRelationships = []StoreRelationship{
+	StoreRelationshipOwner,
+	StoreRelationshipManager,
+	StoreRelationshipStaff,
+	StoreRelationshipCashier,
+}
+
+// IsStaff 表示这个关系是不是店员的关系。
+func (r StoreRelationship) IsStaff() bool {
+	_, ok := StoreRelationshipPermissions[r]
+	return ok
+}
+
+func (r StoreRelationship) HasPermission(p Permission) bool {
+	return containsPermission(StoreRelationshipPermissions[r], p)
+}
+
+func containsPermission(permissions []Permission, p Permission) bool {
+	for _, permission := range permissions {
+		if permission == p {
+			return true
+		}
+	}
+	return false
+}
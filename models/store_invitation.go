@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type StoreInvitationStatus string
+
+const (
+	StoreInvitationStatusPending  StoreInvitationStatus = "PENDING"
+	StoreInvitationStatusAccepted StoreInvitationStatus = "ACCEPTED"
+	StoreInvitationStatusRevoked  StoreInvitationStatus = "REVOKED"
+	StoreInvitationStatusExpired  StoreInvitationStatus = "EXPIRED"
+)
+
+// StoreInvitation 是店主邀请别人（按email）以某个店员关系加入店。
+// 被邀请的人登录之后（或者用Token主动接受）就会在 store_memberships 里建立关系。
+type StoreInvitation struct {
+	BaseModel
+	StoreID      int64                 `gorm:"index" json:"store_id"`
+	Email        string                `gorm:"index" json:"email"`
+	Relationship StoreRelationship     `gorm:"type:varchar(16)" json:"relationship"`
+	TokenHash    string                `gorm:"uniqueIndex;type:varchar(64)" json:"-"` // token的sha256，token本身不保存
+	Token        string                `gorm:"-" json:"-"`                            // 只在刚创建的时候有，发给被邀请的人
+	Status       StoreInvitationStatus `gorm:"type:varchar(16)" json:"status"`
+	InvitedBy    int64                 `json:"invited_by"`
+	AcceptedBy   *int64                `json:"accepted_by,omitempty"`
+	AcceptedAt   *time.Time            `json:"accepted_at,omitempty"`
+	ExpiresAt    time.Time             `json:"expires_at"`
+}
+
+// IsExpired 只对还没处理的邀请有意义。
+func (i *StoreInvitation) IsExpired() bool {
+	return i.Status == StoreInvitationStatusPending && time.Now().After(i.ExpiresAt)
+}
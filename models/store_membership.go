@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAlreadyStaff 是用户在这个店里已经有另一个店员的关系了，只有admin可以明确地改。
+var ErrAlreadyStaff = errors.New("user already has another staff role in this store")
+
+// StoreMembership 是用户和店之间唯一的关系表，取代了原来的 manager_stores 和 user_stores。
+// 同一个用户和同一个店之间可以有多条关系（譬如店主同时把自己的店设成默认店），
+// 但是每种关系只有一条。店员的关系（OWNER / MANAGER / STAFF / CASHIER）之间是互斥的，
+// 每个用户也只有一个DEFAULT的店，这两点由 StoreMembershipRepository 保证。
+type StoreMembership struct {
+	BaseModel
+	User         *User             `gorm:"foreignKey:UserID" json:"-"`
+	UserID       int64             `gorm:"uniqueIndex:idx_store_membership" json:"user_id"`
+	Store        *Store            `gorm:"foreignKey:StoreID" json:"store,omitempty"`
+	StoreID      int64             `gorm:"uniqueIndex:idx_store_membership;index" json:"store_id"`
+	Relationship StoreRelationship `gorm:"type:varchar(16);uniqueIndex:idx_store_membership" json:"relationship"`
+}
+
+// MigrateLegacyStoreTables 把 manager_stores 和 user_stores 里的数据搬到 store_memberships，然后删掉旧表。
+// user_stores 里 is_enable = false 的只是历史记录，直接丢掉。
+func MigrateLegacyStoreTables(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable("manager_stores") && !migrator.HasTable("user_stores") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		var memberships []StoreMembership
+
+		if migrator.HasTable("manager_stores") {
+			var rows []struct {
+				UserID  int64
+				StoreID int64
+				Role    string
+			}
+			query := tx.Table("manager_stores").Select("user_id, store_id")
+			if migrator.HasColumn("manager_stores", "role") {
+				query = tx.Table("manager_stores").Select("user_id, store_id, role")
+			}
+			if err := query.Find(&rows).Error; err != nil {
+				return err
+			}
+			for _, row := range rows {
+				relationship := StoreRelationship(row.Role)
+				if !relationship.IsStaff() {
+					relationship = StoreRelationshipOwner
+				}
+				memberships = append(memberships, StoreMembership{UserID: row.UserID, StoreID: row.StoreID, Relationship: relationship})
+			}
+		}
+
+		if migrator.HasTable("user_stores") {
+			var rows []struct {
+				UserID  int64
+				StoreID int64
+			}
+			// 按id排序，同一个用户有多条enable的记录时以最后一条为准。
+			if err := tx.Table("user_stores").Select("user_id, store_id").
+				Where("is_enable = ?", true).Order("id").Find(&rows).Error; err != nil {
+				return err
+			}
+			defaults := make(map[int64]int64)
+			for _, row := range rows {
+				defaults[row.UserID] = row.StoreID
+			}
+			for userID, storeID := range defaults {
+				memberships = append(memberships, StoreMembership{UserID: userID, StoreID: storeID, Relationship: StoreRelationshipDefault})
+			}
+		}
+
+		if len(memberships) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&memberships).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, table := range []string{"manager_stores", "user_stores"} {
+			if migrator.HasTable(table) {
+				if err := migrator.DropTable(table); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
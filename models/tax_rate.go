@@ -1,9 +1,30 @@
 package models
 
+import "time"
+
 type TaxRate struct {
 	BaseModel
-	Csv                   string  `gorm:"column:csv" json:"csv"`
-	State                 string  `gorm:"column:tax_state" json:"state"`
-	ZipCode               string  `gorm:"column:zip_code" json:"zip_code"`
-	EstimatedCombinedRate float64 `json:"estimated_combined_rate"`
+	// 属于哪个版本的数据，查询的时候只看当前生效的版本
+	DatasetID             int64     `gorm:"index:idx_tax_rates_dataset_zip,priority:1" json:"dataset_id"`
+	Csv                   string    `gorm:"column:csv" json:"csv"`
+	State                 string    `gorm:"column:tax_state" json:"state"`
+	ZipCode               string    `gorm:"column:zip_code;size:16;index:idx_tax_rates_dataset_zip,priority:2" json:"zip_code"`
+	EstimatedCombinedRate float64   `json:"estimated_combined_rate"`
+	EffectiveDate         time.Time `json:"effective_date"`
+}
+
+// TaxRateDataset 是一次导入的税率数据。同一时间只有一个Active，
+// 导入新的月度文件的时候先写入新的版本，写完之后在同一个事务里切换过去。
+type TaxRateDataset struct {
+	BaseModel
+	// 这个版本导入的csv文件名，逗号分隔；没有导入的州沿用上一个版本的数据
+	SourceFiles string `json:"source_files"`
+	// 导入的文件里最新的生效月份，比如 TAXRATES_ZIP5_CA202304.csv 是2023-04-01
+	EffectiveDate time.Time  `json:"effective_date"`
+	Checksum      string     `gorm:"size:64;index" json:"checksum"`
+	RowCount      int64      `json:"row_count"`
+	Active        bool       `gorm:"index" json:"active"`
+	ActivatedAt   *time.Time `json:"activated_at"`
+	// 0 表示启动或者命令行导入
+	ImportedBy int64 `json:"imported_by"`
 }
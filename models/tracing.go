@@ -0,0 +1,78 @@
+package models
+
+import (
+	"github.com/atomi-ai/atomi/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "atomi:tracing_span"
+
+// TracingPlugin 给每条SQL创建一个span，用 db.Use(models.TracingPlugin{}) 开启。
+// 只有context里已经有span（也就是用 db.WithContext(ctx) 传进来的请求）的时候才创建，避免产生没有父节点的span。
+type TracingPlugin struct{}
+
+func (TracingPlugin) Name() string {
+	return "atomi:tracing"
+}
+
+func (TracingPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("atomi:tracing_before_create", startQuerySpan("create")),
+		cb.Create().After("gorm:create").Register("atomi:tracing_after_create", endQuerySpan),
+		cb.Query().Before("gorm:query").Register("atomi:tracing_before_query", startQuerySpan("query")),
+		cb.Query().After("gorm:query").Register("atomi:tracing_after_query", endQuerySpan),
+		cb.Update().Before("gorm:update").Register("atomi:tracing_before_update", startQuerySpan("update")),
+		cb.Update().After("gorm:update").Register("atomi:tracing_after_update", endQuerySpan),
+		cb.Delete().Before("gorm:delete").Register("atomi:tracing_before_delete", startQuerySpan("delete")),
+		cb.Delete().After("gorm:delete").Register("atomi:tracing_after_delete", endQuerySpan),
+		cb.Row().Before("gorm:row").Register("atomi:tracing_before_row", startQuerySpan("row")),
+		cb.Row().After("gorm:row").Register("atomi:tracing_after_row", endQuerySpan),
+		cb.Raw().Before("gorm:raw").Register("atomi:tracing_before_raw", startQuerySpan("raw")),
+		cb.Raw().After("gorm:raw").Register("atomi:tracing_after_raw", endQuerySpan),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startQuerySpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := utils.Tracer().Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemKey.String(db.Dialector.Name()),
+				semconv.DBOperation(operation),
+				semconv.DBSQLTable(db.Statement.Table),
+			))
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func endQuerySpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	// SQL里的参数是占位符，不会带上用户数据。
+	span.SetAttributes(
+		semconv.DBStatement(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+	span.End()
+}
@@ -29,6 +29,19 @@ type QuoteRequest struct {
 	ExternalStoreID    *string    `json:"external_store_id,omitempty"`
 }
 
+// SetDropoff 用保存的地址填送货地址和电话，客户端已经传了的不覆盖。送的是这个地址并且有坐标的时候一起带上，Uber不用再解析地址。
+func (q *QuoteRequest) SetDropoff(address *Address) {
+	if q.DropoffAddress == "" {
+		q.DropoffAddress = address.OneLine()
+	}
+	if q.DropoffLatitude == nil && address.HasCoordinates() && q.DropoffAddress == address.OneLine() {
+		q.DropoffLatitude, q.DropoffLongitude = address.Latitude, address.Longitude
+	}
+	if q.DropoffPhoneNumber == nil && address.Phone != "" {
+		q.DropoffPhoneNumber = &address.Phone
+	}
+}
+
 type QuoteResponse struct {
 	Created         time.Time `json:"created"`
 	CurrencyType    string    `json:"currency_type"`
@@ -43,6 +56,11 @@ type QuoteResponse struct {
 	ExternalStoreID *string   `json:"external_store_id,omitempty"`
 }
 
+// FeeMoney 是报价的运费，Uber的fee是最小货币单位。
+func (q *QuoteResponse) FeeMoney() Money {
+	return NewMoney(q.Fee, q.CurrencyType)
+}
+
 type DeliveryData struct {
 	DropoffAddress      string                   `json:"dropoff_address"`
 	DropoffName         string                   `json:"dropoff_name"`
@@ -79,6 +97,22 @@ type DeliveryData struct {
 	TestSpecifications  *TestSpecifications      `json:"test_specifications,omitempty"`
 }
 
+// SetDropoff 和QuoteRequest.SetDropoff一样，另外把地址的送货说明填到DropoffNotes。
+func (d *DeliveryData) SetDropoff(address *Address) {
+	if d.DropoffAddress == "" {
+		d.DropoffAddress = address.OneLine()
+	}
+	if d.DropoffLatitude == nil && address.HasCoordinates() && d.DropoffAddress == address.OneLine() {
+		d.DropoffLatitude, d.DropoffLongitude = address.Latitude, address.Longitude
+	}
+	if d.DropoffPhoneNumber == "" {
+		d.DropoffPhoneNumber = address.Phone
+	}
+	if d.DropoffNotes == nil && address.DeliveryInstructions != "" {
+		d.DropoffNotes = &address.DeliveryInstructions
+	}
+}
+
 type Size string
 
 const (
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Role string
 
 const (
@@ -10,14 +12,26 @@ const (
 
 type User struct {
 	BaseModel
-	Email                    string  `gorm:"unique" json:"email"`
-	Role                     Role    `json:"role"`
-	Phone                    string  `json:"phone"`
-	Name                     string  `json:"name"`
-	DefaultShippingAddressID int64   `json:"default_shipping_address_id" gorm:"column:default_shipping_address_id"`
-	DefaultBillingAddressID  int64   `json:"default_billing_address_id" gorm:"column:default_billing_address_id"`
-	StripeCustomerID         string  `json:"stripe_customer_id" gorm:"column:stripe_customer_id"`
-	PaymentMethodID          *string `json:"payment_method_id" gorm:"column:payment_method_id"`
+	Email                    string     `gorm:"unique" json:"email"`
+	Role                     Role       `json:"role"`
+	Phone                    string     `json:"phone"`
+	Name                     string     `json:"name"`
+	DefaultShippingAddressID int64      `json:"default_shipping_address_id" gorm:"column:default_shipping_address_id"`
+	DefaultBillingAddressID  int64      `json:"default_billing_address_id" gorm:"column:default_billing_address_id"`
+	StripeCustomerID         string     `json:"stripe_customer_id" gorm:"column:stripe_customer_id"`
+	PaymentMethodID          *string    `json:"payment_method_id" gorm:"column:payment_method_id"`
+	SuspendedAt              *time.Time `json:"suspended_at" gorm:"column:suspended_at"`
+	// ServiceAccount 表示这是给机器（POS、内部脚本）用的账号，只能用API key登录。
+	ServiceAccount bool `json:"service_account" gorm:"column:service_account;default:false"`
+	// AuthProvider和AuthSubject是登录服务里的用户ID（比如Firebase UID），没有email的用户（手机号、匿名登录）靠它来识别。
+	AuthProvider string  `json:"-" gorm:"column:auth_provider;uniqueIndex:idx_users_auth_subject"`
+	AuthSubject  *string `json:"-" gorm:"column:auth_subject;uniqueIndex:idx_users_auth_subject"`
+	// TaxExempt 表示用户有免税资格（比如非营利组织），下单不收销售税，只能由管理员设置。
+	TaxExempt bool `json:"tax_exempt" gorm:"column:tax_exempt;default:false"`
+}
+
+func (r Role) IsValid() bool {
+	return r == RoleUser || r == RoleAdmin || r == RoleMgr
 }
 
 func (User) TableName() string {
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+type UserExportStatus string
+
+const (
+	UserExportStatusPending    UserExportStatus = "PENDING"
+	UserExportStatusProcessing UserExportStatus = "PROCESSING"
+	UserExportStatusReady      UserExportStatus = "READY"
+	UserExportStatusFailed     UserExportStatus = "FAILED"
+	// UserExportStatusExpired 链接过期，导出文件已经删掉了
+	UserExportStatusExpired UserExportStatus = "EXPIRED"
+)
+
+type UserExportFormat string
+
+const (
+	UserExportFormatJSON UserExportFormat = "json"
+	UserExportFormatZip  UserExportFormat = "zip"
+)
+
+// UserExportRequest 记录一次用户个人数据导出，导出在后台异步生成，完成后DownloadURL在ExpiresAt之前有效，
+// 过期之后BlobName指向的文件会被删掉。
+type UserExportRequest struct {
+	BaseModel
+	UserID      int64            `gorm:"index" json:"user_id"`
+	Format      UserExportFormat `json:"format"`
+	Status      UserExportStatus `json:"status"`
+	DownloadURL string           `gorm:"column:download_url" json:"download_url,omitempty"`
+	BlobName    string           `gorm:"column:blob_name" json:"-"`
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
@@ -1,13 +1,15 @@
 package repositories
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
 )
 
 type AddressRepository interface {
-	FindByID(id int64) (*models.Address, error)
-	Save(address *models.Address) (*models.Address, error)
+	FindByID(ctx context.Context, id int64) (*models.Address, error)
+	Save(ctx context.Context, address *models.Address) (*models.Address, error)
 }
 
 type addressRepository struct {
@@ -18,17 +20,17 @@ func NewAddressRepository(db *gorm.DB) AddressRepository {
 	return &addressRepository{db}
 }
 
-func (ar *addressRepository) FindByID(id int64) (*models.Address, error) {
+func (ar *addressRepository) FindByID(ctx context.Context, id int64) (*models.Address, error) {
 	var address models.Address
-	err := ar.db.First(&address, id).Error
+	err := dbFor(ctx, ar.db).First(&address, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &address, nil
 }
 
-func (ar *addressRepository) Save(address *models.Address) (*models.Address, error) {
-	err := ar.db.Save(address).Error
+func (ar *addressRepository) Save(ctx context.Context, address *models.Address) (*models.Address, error) {
+	err := dbFor(ctx, ar.db).Save(address).Error
 	if err != nil {
 		return nil, err
 	}
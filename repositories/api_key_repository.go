@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	Save(ctx context.Context, key *models.APIKey) error
+	FindByID(ctx context.Context, id int64) (*models.APIKey, error)
+	FindByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	FindByUserID(ctx context.Context, userID int64) ([]models.APIKey, error)
+	UpdateLastUsedAt(ctx context.Context, id int64, lastUsedAt time.Time) error
+}
+
+type apiKeyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepositoryImpl{db: db}
+}
+
+func (r *apiKeyRepositoryImpl) Save(ctx context.Context, key *models.APIKey) error {
+	return dbFor(ctx, r.db).Save(key).Error
+}
+
+func (r *apiKeyRepositoryImpl) FindByID(ctx context.Context, id int64) (*models.APIKey, error) {
+	var key models.APIKey
+	err := dbFor(ctx, r.db).First(&key, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepositoryImpl) FindByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := dbFor(ctx, r.db).Where("prefix = ?", prefix).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepositoryImpl) FindByUserID(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := dbFor(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// UpdateLastUsedAt 只更新这一列，不碰其他字段，避免和并发的撤销互相覆盖。
+func (r *apiKeyRepositoryImpl) UpdateLastUsedAt(ctx context.Context, id int64, lastUsedAt time.Time) error {
+	return dbFor(ctx, r.db).Model(&models.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", lastUsedAt).Error
+}
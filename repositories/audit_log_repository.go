@@ -0,0 +1,31 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/atomi-ai/atomi/models"
+	"gorm.io/gorm"
+)
+
+type AuditLogRepository interface {
+	Save(ctx context.Context, auditLog *models.AuditLog) error
+	FindByTarget(ctx context.Context, targetType string, targetID int64) ([]models.AuditLog, error)
+}
+
+type auditLogRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAuditLogRepository(db *gorm.DB) AuditLogRepository {
+	return &auditLogRepositoryImpl{db: db}
+}
+
+func (r *auditLogRepositoryImpl) Save(ctx context.Context, auditLog *models.AuditLog) error {
+	return dbFor(ctx, r.db).Create(auditLog).Error
+}
+
+func (r *auditLogRepositoryImpl) FindByTarget(ctx context.Context, targetType string, targetID int64) ([]models.AuditLog, error) {
+	var auditLogs []models.AuditLog
+	err := dbFor(ctx, r.db).Where("target_type = ? AND target_id = ?", targetType, targetID).Order("id desc").Find(&auditLogs).Error
+	return auditLogs, err
+}
@@ -1,15 +1,17 @@
 package repositories
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
 )
 
 // ConfigRepository interface
 type ConfigRepository interface {
-	Save(config *models.Config) error
-	FindAll() ([]*models.Config, error)
-	FindByKey(key string) (*models.Config, error)
+	Save(ctx context.Context, config *models.Config) error
+	FindAll(ctx context.Context) ([]*models.Config, error)
+	FindByKey(ctx context.Context, key string) (*models.Config, error)
 }
 
 // configRepositoryImpl represents the implementation of ConfigRepository
@@ -25,20 +27,20 @@ func NewConfigRepository(db *gorm.DB) ConfigRepository {
 }
 
 // Save saves a Config instance
-func (r *configRepositoryImpl) Save(config *models.Config) error {
-	return r.db.Save(config).Error
+func (r *configRepositoryImpl) Save(ctx context.Context, config *models.Config) error {
+	return dbFor(ctx, r.db).Save(config).Error
 }
 
 // FindAll finds all Config instances
-func (r *configRepositoryImpl) FindAll() ([]*models.Config, error) {
+func (r *configRepositoryImpl) FindAll(ctx context.Context) ([]*models.Config, error) {
 	var configs []*models.Config
-	err := r.db.Find(&configs).Error
+	err := dbFor(ctx, r.db).Find(&configs).Error
 	return configs, err
 }
 
 // FindByKey finds a Config instance by key
-func (r *configRepositoryImpl) FindByKey(key string) (*models.Config, error) {
+func (r *configRepositoryImpl) FindByKey(ctx context.Context, key string) (*models.Config, error) {
 	var config models.Config
-	err := r.db.First(&config, "config_key = ?", key).Error
+	err := dbFor(ctx, r.db).First(&config, "config_key = ?", key).Error
 	return &config, err
 }
@@ -1,12 +1,14 @@
 package repositories
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
 )
 
 type DeleteUserRequestRepository interface {
-	AddRequest(userID int64) error
+	AddRequest(ctx context.Context, userID int64) error
 }
 
 type deleteUserRequestRepositoryImpl struct {
@@ -17,6 +19,6 @@ func NewDeleteUserRequestRepository(db *gorm.DB) DeleteUserRequestRepository {
 	return &deleteUserRequestRepositoryImpl{db: db}
 }
 
-func (r *deleteUserRequestRepositoryImpl) AddRequest(userID int64) error {
-	return r.db.Create(&models.DeleteUserRequest{UserID: userID}).Error
+func (r *deleteUserRequestRepositoryImpl) AddRequest(ctx context.Context, userID int64) error {
+	return dbFor(ctx, r.db).Create(&models.DeleteUserRequest{UserID: userID}).Error
 }
@@ -1,20 +1,30 @@
 package repositories
 
 import (
+	"context"
+	"time"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
 )
 
 type OrderRepository interface {
-	FindByUserID(userID int64) ([]models.Order, error)
-	GetByID(orderID int64) (*models.Order, error)
-	GetOrdersByStoreID(storeID int64) ([]models.Order, error)
-	Save(order *models.Order) error
-	UpdateOrderStatus(orderID int64, status models.OrderStatus) error
+	FindByUserID(ctx context.Context, userID int64) ([]models.Order, error)
+	GetByID(ctx context.Context, orderID int64) (*models.Order, error)
+	FindByPaymentIntentID(ctx context.Context, paymentIntentID string) (*models.Order, error)
+	// FindPaidBetween 返回 from <= paid_at < to 的订单，不带OrderItems。
+	FindPaidBetween(ctx context.Context, from, to time.Time) ([]models.Order, error)
+	GetOrdersByStoreID(ctx context.Context, storeID int64) ([]models.Order, error)
+	Save(ctx context.Context, order *models.Order) error
+	// SaveWithItems 在一个事务里保存订单和所有的订单项（不包括Product）。
+	SaveWithItems(ctx context.Context, order *models.Order) error
+	UpdateOrderStatus(ctx context.Context, orderID int64, status models.OrderStatus) error
+	// SetPaidAt 只在订单还没有付款时间的时候记录，返回这次有没有更新。
+	SetPaidAt(ctx context.Context, orderID int64, paidAt time.Time) (bool, error)
 }
 
 type OrderItemRepository interface {
-	Save(orderItem *models.OrderItem) error
+	Save(ctx context.Context, orderItem *models.OrderItem) error
 }
 
 type orderRepositoryImpl struct {
@@ -33,34 +43,66 @@ func NewOrderItemRepository(db *gorm.DB) OrderItemRepository {
 	return &orderItemRepositoryImpl{db: db}
 }
 
-func (repo *orderRepositoryImpl) FindByUserID(userID int64) ([]models.Order, error) {
+func (repo *orderRepositoryImpl) FindByUserID(ctx context.Context, userID int64) ([]models.Order, error) {
 	var orders []models.Order
-	err := repo.db.Preload("OrderItems.Product").Where("user_id = ?", userID).Find(&orders).Error
+	err := dbFor(ctx, repo.db).Preload("OrderItems.Product").Where("user_id = ?", userID).Find(&orders).Error
 	return orders, err
 }
 
-func (repo *orderRepositoryImpl) GetOrdersByStoreID(storeID int64) ([]models.Order, error) {
+func (repo *orderRepositoryImpl) GetOrdersByStoreID(ctx context.Context, storeID int64) ([]models.Order, error) {
 	var orders []models.Order
-	if err := repo.db.Where("store_id = ?", storeID).Find(&orders).Error; err != nil {
+	if err := dbFor(ctx, repo.db).Where("store_id = ?", storeID).Find(&orders).Error; err != nil {
 		return nil, err
 	}
 	return orders, nil
 }
 
-func (repo *orderRepositoryImpl) GetByID(orderID int64) (*models.Order, error) {
+func (repo *orderRepositoryImpl) GetByID(ctx context.Context, orderID int64) (*models.Order, error) {
 	var order models.Order
-	err := repo.db.Preload("OrderItems.Product").First(&order, orderID).Error
+	err := dbFor(ctx, repo.db).Preload("OrderItems.Product").First(&order, orderID).Error
 	return &order, err
 }
 
-func (repo *orderRepositoryImpl) UpdateOrderStatus(orderID int64, status models.OrderStatus) error {
-	return repo.db.Model(&models.Order{}).Where("id = ?", orderID).Update("status", status).Error
+func (repo *orderRepositoryImpl) FindByPaymentIntentID(ctx context.Context, paymentIntentID string) (*models.Order, error) {
+	var order models.Order
+	err := dbFor(ctx, repo.db).Where("payment_intent_id = ?", paymentIntentID).First(&order).Error
+	return &order, err
+}
+
+func (repo *orderRepositoryImpl) FindPaidBetween(ctx context.Context, from, to time.Time) ([]models.Order, error) {
+	var orders []models.Order
+	err := dbFor(ctx, repo.db).Where("paid_at >= ? AND paid_at < ?", from, to).Order("id").Find(&orders).Error
+	return orders, err
+}
+
+func (repo *orderRepositoryImpl) UpdateOrderStatus(ctx context.Context, orderID int64, status models.OrderStatus) error {
+	return dbFor(ctx, repo.db).Model(&models.Order{}).Where("id = ?", orderID).Update("status", status).Error
+}
+
+func (repo *orderRepositoryImpl) SetPaidAt(ctx context.Context, orderID int64, paidAt time.Time) (bool, error) {
+	result := dbFor(ctx, repo.db).Model(&models.Order{}).Where("id = ? AND paid_at IS NULL", orderID).Update("paid_at", paidAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (repo *orderRepositoryImpl) Save(ctx context.Context, order *models.Order) error {
+	return dbFor(ctx, repo.db).Save(order).Error
 }
 
-func (repo *orderRepositoryImpl) Save(order *models.Order) error {
-	return repo.db.Save(order).Error
+func (repo *orderRepositoryImpl) SaveWithItems(ctx context.Context, order *models.Order) error {
+	return dbFor(ctx, repo.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("OrderItems").Save(order).Error; err != nil {
+			return err
+		}
+		for i := range order.OrderItems {
+			order.OrderItems[i].OrderID = order.ID
+			if err := tx.Omit("Product").Save(&order.OrderItems[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (repo *orderItemRepositoryImpl) Save(orderItem *models.OrderItem) error {
-	return repo.db.Save(orderItem).Error
+func (repo *orderItemRepositoryImpl) Save(ctx context.Context, orderItem *models.OrderItem) error {
+	return dbFor(ctx, repo.db).Save(orderItem).Error
 }
@@ -1,17 +1,19 @@
 package repositories
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
 )
 
 type ProductRepository interface {
-	Save(product *models.Product) error
-	FindByID(id int64) (*models.Product, error)
-	FindAll() ([]models.Product, error)
-	Update(product *models.Product) error
-	Delete(product *models.Product) error
-	FindAllProductsForMgr(mgrID int64) ([]*models.Product, error)
+	Save(ctx context.Context, product *models.Product) error
+	FindByID(ctx context.Context, id int64) (*models.Product, error)
+	FindAll(ctx context.Context) ([]models.Product, error)
+	Update(ctx context.Context, product *models.Product) error
+	Delete(ctx context.Context, product *models.Product) error
+	FindAllProductsForMgr(ctx context.Context, mgrID int64) ([]*models.Product, error)
 }
 
 type productRepositoryImpl struct {
@@ -23,14 +25,14 @@ func NewProductRepository(db *gorm.DB) ProductRepository {
 }
 
 // Save saves the given product in the database
-func (r *productRepositoryImpl) Save(product *models.Product) error {
-	return r.db.FirstOrCreate(product, "name = ?", product.Name).Error
+func (r *productRepositoryImpl) Save(ctx context.Context, product *models.Product) error {
+	return dbFor(ctx, r.db).FirstOrCreate(product, "name = ?", product.Name).Error
 }
 
 // FindByID finds a product by its ID
-func (r *productRepositoryImpl) FindByID(id int64) (*models.Product, error) {
+func (r *productRepositoryImpl) FindByID(ctx context.Context, id int64) (*models.Product, error) {
 	var product models.Product
-	err := r.db.First(&product, id).Error
+	err := dbFor(ctx, r.db).First(&product, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -38,9 +40,9 @@ func (r *productRepositoryImpl) FindByID(id int64) (*models.Product, error) {
 }
 
 // FindAll retrieves all products from the database
-func (r *productRepositoryImpl) FindAll() ([]models.Product, error) {
+func (r *productRepositoryImpl) FindAll(ctx context.Context) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Find(&products).Error
+	err := dbFor(ctx, r.db).Find(&products).Error
 	if err != nil {
 		return nil, err
 	}
@@ -48,21 +50,21 @@ func (r *productRepositoryImpl) FindAll() ([]models.Product, error) {
 }
 
 // Update updates the given product in the database
-func (r *productRepositoryImpl) Update(product *models.Product) error {
-	return r.db.Save(product).Error
+func (r *productRepositoryImpl) Update(ctx context.Context, product *models.Product) error {
+	return dbFor(ctx, r.db).Save(product).Error
 }
 
 // Delete deletes the given product from the database
-func (r *productRepositoryImpl) Delete(product *models.Product) error {
-	return r.db.Delete(product).Error
+func (r *productRepositoryImpl) Delete(ctx context.Context, product *models.Product) error {
+	return dbFor(ctx, r.db).Delete(product).Error
 }
 
-func (r *productRepositoryImpl) FindAllProductsForMgr(mgrID int64) ([]*models.Product, error) {
+func (r *productRepositoryImpl) FindAllProductsForMgr(ctx context.Context, mgrID int64) ([]*models.Product, error) {
 	var products []*models.Product
-	err := r.db.Table("users").
+	err := dbFor(ctx, r.db).Table("users").
 		Select("distinct products.*").
-		Joins("INNER JOIN manager_stores ms ON users.id = ms.user_id").
-		Joins("INNER JOIN stores ON stores.id = ms.store_id").
+		Joins("INNER JOIN store_memberships sm ON users.id = sm.user_id AND sm.relationship IN ?", models.StaffStoreRelationships).
+		Joins("INNER JOIN stores ON stores.id = sm.store_id").
 		Joins("INNER JOIN product_stores ps ON stores.id = ps.store_id").
 		Joins("INNER JOIN products ON ps.product_id = products.id").
 		Where("users.id = ?", mgrID).
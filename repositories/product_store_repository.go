@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -8,12 +10,12 @@ import (
 
 // ProductStoreRepository interface
 type ProductStoreRepository interface {
-	Save(productStore *models.ProductStore) error
-	FindAllByStoreID(storeID int64) ([]*models.ProductStore, error)
-	FindByStoreAndProduct(store *models.Store, product *models.Product) (*models.ProductStore, error)
-	SaveAll(productStores []*models.ProductStore) error
-	AddProductToStore(storeID, productID int64) error
-	RemoveProductFromStore(storeID, productID int64) error
+	Save(ctx context.Context, productStore *models.ProductStore) error
+	FindAllByStoreID(ctx context.Context, storeID int64) ([]*models.ProductStore, error)
+	FindByStoreAndProduct(ctx context.Context, store *models.Store, product *models.Product) (*models.ProductStore, error)
+	SaveAll(ctx context.Context, productStores []*models.ProductStore) error
+	AddProductToStore(ctx context.Context, storeID, productID int64) error
+	RemoveProductFromStore(ctx context.Context, storeID, productID int64) error
 }
 
 // productStoreRepositoryImpl represents the implementation of ProductStoreRepository
@@ -29,17 +31,14 @@ func NewProductStoreRepository(db *gorm.DB) ProductStoreRepository {
 }
 
 // Save saves the given product store in the database
-func (r *productStoreRepositoryImpl) Save(productStore *models.ProductStore) error {
-	return r.db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "store_id"}, {Name: "product_id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"is_enable", "updated_at"}),
-	}).Create(productStore).Error
+func (r *productStoreRepositoryImpl) Save(ctx context.Context, productStore *models.ProductStore) error {
+	return upsert(dbFor(ctx, r.db), productStore, []string{"store_id", "product_id"}, []string{"is_enable", "updated_at"})
 }
 
 // FindAllByStoreID retrieves all product stores by a given store ID
-func (r *productStoreRepositoryImpl) FindAllByStoreID(storeID int64) ([]*models.ProductStore, error) {
+func (r *productStoreRepositoryImpl) FindAllByStoreID(ctx context.Context, storeID int64) ([]*models.ProductStore, error) {
 	var productStores []*models.ProductStore
-	err := r.db.Preload("Product").Where("store_id = ?", storeID).Find(&productStores).Error
+	err := dbFor(ctx, r.db).Preload("Product").Where("store_id = ?", storeID).Find(&productStores).Error
 	if err != nil {
 		return nil, err
 	}
@@ -47,9 +46,9 @@ func (r *productStoreRepositoryImpl) FindAllByStoreID(storeID int64) ([]*models.
 }
 
 // FindByStoreAndProduct finds a product store by a given store and product
-func (r *productStoreRepositoryImpl) FindByStoreAndProduct(store *models.Store, product *models.Product) (*models.ProductStore, error) {
+func (r *productStoreRepositoryImpl) FindByStoreAndProduct(ctx context.Context, store *models.Store, product *models.Product) (*models.ProductStore, error) {
 	var productStore models.ProductStore
-	err := r.db.Where("store_id = ? AND product_id = ?", store.ID, product.ID).First(&productStore).Error
+	err := dbFor(ctx, r.db).Where("store_id = ? AND product_id = ?", store.ID, product.ID).First(&productStore).Error
 	if err != nil {
 		return nil, err
 	}
@@ -57,8 +56,8 @@ func (r *productStoreRepositoryImpl) FindByStoreAndProduct(store *models.Store,
 }
 
 // SaveAll saves a list of ProductStore instances
-func (r *productStoreRepositoryImpl) SaveAll(productStores []*models.ProductStore) error {
-	tx := r.db.Begin()
+func (r *productStoreRepositoryImpl) SaveAll(ctx context.Context, productStores []*models.ProductStore) error {
+	tx := dbFor(ctx, r.db).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -78,12 +77,12 @@ func (r *productStoreRepositoryImpl) SaveAll(productStores []*models.ProductStor
 	return tx.Commit().Error
 }
 
-func (r *productStoreRepositoryImpl) AddProductToStore(storeID, productID int64) error {
+func (r *productStoreRepositoryImpl) AddProductToStore(ctx context.Context, storeID, productID int64) error {
 	productStore := &models.ProductStore{StoreID: storeID, ProductID: productID}
-	return r.db.Create(productStore).Error
+	return dbFor(ctx, r.db).Create(productStore).Error
 }
 
-func (r *productStoreRepositoryImpl) RemoveProductFromStore(storeID, productID int64) error {
+func (r *productStoreRepositoryImpl) RemoveProductFromStore(ctx context.Context, storeID, productID int64) error {
 	productStore := &models.ProductStore{StoreID: storeID, ProductID: productID}
-	return r.db.Where("store_id = ? AND product_id = ?", storeID, productID).Delete(productStore).Error
+	return dbFor(ctx, r.db).Where("store_id = ? AND product_id = ?", storeID, productID).Delete(productStore).Error
 }
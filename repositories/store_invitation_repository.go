@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/atomi-ai/atomi/models"
+	"gorm.io/gorm"
+)
+
+type StoreInvitationRepository interface {
+	Save(ctx context.Context, invitation *models.StoreInvitation) error
+	FindByID(ctx context.Context, id int64) (*models.StoreInvitation, error)
+	FindByTokenHash(ctx context.Context, tokenHash string) (*models.StoreInvitation, error)
+	FindPendingByEmail(ctx context.Context, email string) ([]models.StoreInvitation, error)
+	FindByStoreID(ctx context.Context, storeID int64) ([]models.StoreInvitation, error)
+}
+
+type storeInvitationRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewStoreInvitationRepository(db *gorm.DB) StoreInvitationRepository {
+	return &storeInvitationRepositoryImpl{db: db}
+}
+
+func (r *storeInvitationRepositoryImpl) Save(ctx context.Context, invitation *models.StoreInvitation) error {
+	return dbFor(ctx, r.db).Save(invitation).Error
+}
+
+func (r *storeInvitationRepositoryImpl) FindByID(ctx context.Context, id int64) (*models.StoreInvitation, error) {
+	var invitation models.StoreInvitation
+	err := dbFor(ctx, r.db).First(&invitation, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *storeInvitationRepositoryImpl) FindByTokenHash(ctx context.Context, tokenHash string) (*models.StoreInvitation, error) {
+	var invitation models.StoreInvitation
+	err := dbFor(ctx, r.db).Where("token_hash = ?", tokenHash).First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *storeInvitationRepositoryImpl) FindPendingByEmail(ctx context.Context, email string) ([]models.StoreInvitation, error) {
+	var invitations []models.StoreInvitation
+	err := dbFor(ctx, r.db).Where("email = ? AND status = ?", email, models.StoreInvitationStatusPending).
+		Order("id").Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *storeInvitationRepositoryImpl) FindByStoreID(ctx context.Context, storeID int64) ([]models.StoreInvitation, error) {
+	var invitations []models.StoreInvitation
+	err := dbFor(ctx, r.db).Where("store_id = ?", storeID).Order("id DESC").Find(&invitations).Error
+	return invitations, err
+}
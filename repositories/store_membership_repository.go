@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/atomi-ai/atomi/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StoreMembershipRepository interface {
+	FindDefaultStore(ctx context.Context, userID int64) (*models.StoreMembership, error)
+	// SetDefaultStore 把storeID设成用户的默认店，原来的默认店会被替换掉。
+	SetDefaultStore(ctx context.Context, userID, storeID int64) error
+	DeleteDefaultStore(ctx context.Context, userID int64) error
+
+	FindFavoriteStores(ctx context.Context, userID int64) ([]models.Store, error)
+	AddFavoriteStore(ctx context.Context, userID, storeID int64) error
+	RemoveFavoriteStore(ctx context.Context, userID, storeID int64) error
+
+	// AddStaff 把用户加为店员。已经有同样的关系的时候什么都不做，有别的店员关系的时候返回models.ErrAlreadyStaff。
+	AddStaff(ctx context.Context, storeID, userID int64, relationship models.StoreRelationship) error
+	// SetStaffRelationship 给用户分配店，已经是店员的话替换原来的关系。只用于admin明确地改角色。
+	SetStaffRelationship(ctx context.Context, storeID, userID int64, relationship models.StoreRelationship) error
+	RemoveStaff(ctx context.Context, storeID, userID int64) error
+	FindStoresByStaff(ctx context.Context, userID int64) ([]models.Store, error)
+	FindStaffByStore(ctx context.Context, storeID int64) ([]models.StoreMembership, error)
+}
+
+type storeMembershipRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewStoreMembershipRepository(db *gorm.DB) StoreMembershipRepository {
+	return &storeMembershipRepositoryImpl{db: db}
+}
+
+func (r *storeMembershipRepositoryImpl) FindDefaultStore(ctx context.Context, userID int64) (*models.StoreMembership, error) {
+	var membership models.StoreMembership
+	err := dbFor(ctx, r.db).Preload("Store").
+		Where("user_id = ? AND relationship = ?", userID, models.StoreRelationshipDefault).
+		First(&membership).Error
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (r *storeMembershipRepositoryImpl) SetDefaultStore(ctx context.Context, userID, storeID int64) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND relationship = ?", userID, models.StoreRelationshipDefault).
+			Delete(&models.StoreMembership{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.StoreMembership{UserID: userID, StoreID: storeID, Relationship: models.StoreRelationshipDefault}).Error
+	})
+}
+
+func (r *storeMembershipRepositoryImpl) DeleteDefaultStore(ctx context.Context, userID int64) error {
+	return dbFor(ctx, r.db).Where("user_id = ? AND relationship = ?", userID, models.StoreRelationshipDefault).
+		Delete(&models.StoreMembership{}).Error
+}
+
+func (r *storeMembershipRepositoryImpl) FindFavoriteStores(ctx context.Context, userID int64) ([]models.Store, error) {
+	return r.findStores(ctx, userID, []models.StoreRelationship{models.StoreRelationshipFavorite})
+}
+
+func (r *storeMembershipRepositoryImpl) AddFavoriteStore(ctx context.Context, userID, storeID int64) error {
+	return dbFor(ctx, r.db).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.StoreMembership{UserID: userID, StoreID: storeID, Relationship: models.StoreRelationshipFavorite}).Error
+}
+
+func (r *storeMembershipRepositoryImpl) RemoveFavoriteStore(ctx context.Context, userID, storeID int64) error {
+	return dbFor(ctx, r.db).Where("user_id = ? AND store_id = ? AND relationship = ?", userID, storeID, models.StoreRelationshipFavorite).
+		Delete(&models.StoreMembership{}).Error
+}
+
+func (r *storeMembershipRepositoryImpl) AddStaff(ctx context.Context, storeID, userID int64, relationship models.StoreRelationship) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		var existing models.StoreMembership
+		err := tx.Where("user_id = ? AND store_id = ? AND relationship IN ?", userID, storeID, models.StaffStoreRelationships).
+			First(&existing).Error
+		if err == nil {
+			if existing.Relationship == relationship {
+				return nil
+			}
+			return models.ErrAlreadyStaff
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		// 两个请求同时加同一个关系的时候，后插入的撞上唯一索引，当作已经加过了
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.StoreMembership{UserID: userID, StoreID: storeID, Relationship: relationship}).Error
+	})
+}
+
+func (r *storeMembershipRepositoryImpl) SetStaffRelationship(ctx context.Context, storeID, userID int64, relationship models.StoreRelationship) error {
+	return dbFor(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND store_id = ? AND relationship IN ?", userID, storeID, models.StaffStoreRelationships).
+			Delete(&models.StoreMembership{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.StoreMembership{UserID: userID, StoreID: storeID, Relationship: relationship}).Error
+	})
+}
+
+func (r *storeMembershipRepositoryImpl) RemoveStaff(ctx context.Context, storeID, userID int64) error {
+	return dbFor(ctx, r.db).Where("user_id = ? AND store_id = ? AND relationship IN ?", userID, storeID, models.StaffStoreRelationships).
+		Delete(&models.StoreMembership{}).Error
+}
+
+func (r *storeMembershipRepositoryImpl) FindStoresByStaff(ctx context.Context, userID int64) ([]models.Store, error) {
+	return r.findStores(ctx, userID, models.StaffStoreRelationships)
+}
+
+func (r *storeMembershipRepositoryImpl) FindStaffByStore(ctx context.Context, storeID int64) ([]models.StoreMembership, error) {
+	var memberships []models.StoreMembership
+	err := dbFor(ctx, r.db).Preload("User").
+		Where("store_id = ? AND relationship IN ?", storeID, models.StaffStoreRelationships).
+		Order("id").Find(&memberships).Error
+	return memberships, err
+}
+
+func (r *storeMembershipRepositoryImpl) findStores(ctx context.Context, userID int64, relationships []models.StoreRelationship) ([]models.Store, error) {
+	var stores []models.Store
+	err := dbFor(ctx, r.db).Table("stores").
+		Select("DISTINCT stores.*").
+		Joins("INNER JOIN store_memberships sm ON sm.store_id = stores.id").
+		Where("sm.user_id = ? AND sm.relationship IN ?", userID, relationships).
+		Find(&stores).Error
+	return stores, err
+}
@@ -1,14 +1,17 @@
 package repositories
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
 )
 
 type StoreRepository interface {
-	FindAll() ([]*models.Store, error)
-	FindByID(id int64) (*models.Store, error)
-	CheckUserHasAccessToStore(mgr *models.User, storeID int64) bool
+	FindAll(ctx context.Context) ([]*models.Store, error)
+	FindByID(ctx context.Context, id int64) (*models.Store, error)
+	CheckUserHasAccessToStore(ctx context.Context, mgr *models.User, storeID int64) bool
+	FindStaffRelationship(ctx context.Context, userID, storeID int64) (models.StoreRelationship, error)
 }
 
 type storeRepositoryImpl struct {
@@ -21,27 +24,37 @@ func NewStoreRepository(db *gorm.DB) StoreRepository {
 	}
 }
 
-func (s *storeRepositoryImpl) FindAll() ([]*models.Store, error) {
+func (s *storeRepositoryImpl) FindAll(ctx context.Context) ([]*models.Store, error) {
 	var stores []*models.Store
-	err := s.db.Find(&stores).Error
+	err := dbFor(ctx, s.db).Find(&stores).Error
 	if err != nil {
 		return nil, err
 	}
 	return stores, nil
 }
 
-func (s *storeRepositoryImpl) FindByID(id int64) (*models.Store, error) {
+func (s *storeRepositoryImpl) FindByID(ctx context.Context, id int64) (*models.Store, error) {
 	var store models.Store
-	err := s.db.First(&store, id).Error
+	err := dbFor(ctx, s.db).First(&store, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &store, nil
 }
 
-// CheckUserHasAccessToStore 查找用户与商店之间的关联关系
-func (s *storeRepositoryImpl) CheckUserHasAccessToStore(mgr *models.User, storeID int64) bool {
-	var mgrStore models.ManagerStores
-	err := s.db.Where(&models.ManagerStores{UserID: mgr.ID, StoreID: storeID}).First(&mgrStore).Error
+// CheckUserHasAccessToStore 查找用户是不是这个店的店员，顾客的关系（默认店、收藏）不算。
+func (s *storeRepositoryImpl) CheckUserHasAccessToStore(ctx context.Context, mgr *models.User, storeID int64) bool {
+	_, err := s.FindStaffRelationship(ctx, mgr.ID, storeID)
 	return err == nil
 }
+
+// FindStaffRelationship 返回用户在店里的店员关系，不是店员的话返回gorm.ErrRecordNotFound。
+func (s *storeRepositoryImpl) FindStaffRelationship(ctx context.Context, userID, storeID int64) (models.StoreRelationship, error) {
+	var membership models.StoreMembership
+	err := dbFor(ctx, s.db).Where("user_id = ? AND store_id = ? AND relationship IN ?", userID, storeID, models.StaffStoreRelationships).
+		First(&membership).Error
+	if err != nil {
+		return "", err
+	}
+	return membership.Relationship, nil
+}
@@ -1,13 +1,29 @@
 package repositories
 
 import (
+	"context"
+	"time"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
 )
 
+const taxRateInsertBatchSize = 1000
+
 type TaxRateRepository interface {
-	FindByZipCode(zipCode string) (*models.TaxRate, error)
-	FindByZipCodeAndState(zipCode, state string) (*models.TaxRate, error)
+	// FindByZipCode 和 FindByZipCodeAndState 只查当前生效的版本。
+	FindByZipCode(ctx context.Context, zipCode string) (*models.TaxRate, error)
+	FindByZipCodeAndState(ctx context.Context, zipCode, state string) (*models.TaxRate, error)
+
+	FindActiveDataset(ctx context.Context) (*models.TaxRateDataset, error)
+	FindDatasetByID(ctx context.Context, datasetID int64) (*models.TaxRateDataset, error)
+	FindDatasetByChecksum(ctx context.Context, checksum string) (*models.TaxRateDataset, error)
+	ListDatasets(ctx context.Context) ([]*models.TaxRateDataset, error)
+	// CreateDataset 在一个事务里写入dataset和rates，把carryOverFrom里不在replacedStates中的州复制过来，然后切换成生效的版本。
+	CreateDataset(ctx context.Context, dataset *models.TaxRateDataset, rates []*models.TaxRate, carryOverFrom int64, replacedStates []string) error
+	ActivateDataset(ctx context.Context, datasetID int64) error
+	// DeleteDatasetsBefore 删除比datasetID旧的、不在生效的版本和它们的数据。
+	DeleteDatasetsBefore(ctx context.Context, datasetID int64) error
 }
 
 type taxRateRepositoryImpl struct {
@@ -18,14 +34,106 @@ func NewTaxRateRepository(db *gorm.DB) TaxRateRepository {
 	return &taxRateRepositoryImpl{db: db}
 }
 
-func (repo *taxRateRepositoryImpl) FindByZipCode(zipCode string) (*models.TaxRate, error) {
+func (repo *taxRateRepositoryImpl) activeDatasetIDs(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.TaxRateDataset{}).Select("id").Where("active = ?", true)
+}
+
+func (repo *taxRateRepositoryImpl) FindByZipCode(ctx context.Context, zipCode string) (*models.TaxRate, error) {
+	db := dbFor(ctx, repo.db)
 	var taxRate models.TaxRate
-	err := repo.db.Where("zip_code = ?", zipCode).First(&taxRate).Error
+	err := db.Where("dataset_id IN (?) AND zip_code = ?", repo.activeDatasetIDs(db), zipCode).First(&taxRate).Error
 	return &taxRate, err
 }
 
-func (repo *taxRateRepositoryImpl) FindByZipCodeAndState(zipCode, state string) (*models.TaxRate, error) {
+func (repo *taxRateRepositoryImpl) FindByZipCodeAndState(ctx context.Context, zipCode, state string) (*models.TaxRate, error) {
+	db := dbFor(ctx, repo.db)
 	var taxRate models.TaxRate
-	err := repo.db.Where("zip_code = ? AND tax_state = ?", zipCode, state).First(&taxRate).Error
+	err := db.Where("dataset_id IN (?) AND zip_code = ? AND tax_state = ?", repo.activeDatasetIDs(db), zipCode, state).First(&taxRate).Error
 	return &taxRate, err
 }
+
+func (repo *taxRateRepositoryImpl) FindActiveDataset(ctx context.Context) (*models.TaxRateDataset, error) {
+	var dataset models.TaxRateDataset
+	err := dbFor(ctx, repo.db).Where("active = ?", true).First(&dataset).Error
+	return &dataset, err
+}
+
+func (repo *taxRateRepositoryImpl) FindDatasetByID(ctx context.Context, datasetID int64) (*models.TaxRateDataset, error) {
+	var dataset models.TaxRateDataset
+	err := dbFor(ctx, repo.db).First(&dataset, datasetID).Error
+	return &dataset, err
+}
+
+func (repo *taxRateRepositoryImpl) FindDatasetByChecksum(ctx context.Context, checksum string) (*models.TaxRateDataset, error) {
+	var dataset models.TaxRateDataset
+	err := dbFor(ctx, repo.db).Where("checksum = ?", checksum).Order("id DESC").First(&dataset).Error
+	return &dataset, err
+}
+
+func (repo *taxRateRepositoryImpl) ListDatasets(ctx context.Context) ([]*models.TaxRateDataset, error) {
+	var datasets []*models.TaxRateDataset
+	err := dbFor(ctx, repo.db).Order("id DESC").Find(&datasets).Error
+	return datasets, err
+}
+
+func (repo *taxRateRepositoryImpl) CreateDataset(ctx context.Context, dataset *models.TaxRateDataset, rates []*models.TaxRate, carryOverFrom int64, replacedStates []string) error {
+	return dbFor(ctx, repo.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dataset).Error; err != nil {
+			return err
+		}
+		for _, rate := range rates {
+			rate.DatasetID = dataset.ID
+		}
+		if len(rates) > 0 {
+			if err := tx.CreateInBatches(rates, taxRateInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if carryOverFrom > 0 {
+			if err := tx.Exec(`INSERT INTO tax_rates (created_at, updated_at, dataset_id, csv, tax_state, zip_code, estimated_combined_rate, effective_date)
+				SELECT created_at, updated_at, ?, csv, tax_state, zip_code, estimated_combined_rate, effective_date
+				FROM tax_rates WHERE dataset_id = ? AND tax_state NOT IN ?`, dataset.ID, carryOverFrom, replacedStates).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.TaxRate{}).Where("dataset_id = ?", dataset.ID).Count(&dataset.RowCount).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(dataset).Update("row_count", dataset.RowCount).Error; err != nil {
+			return err
+		}
+		return activateDataset(tx, dataset)
+	})
+}
+
+func (repo *taxRateRepositoryImpl) ActivateDataset(ctx context.Context, datasetID int64) error {
+	return dbFor(ctx, repo.db).Transaction(func(tx *gorm.DB) error {
+		var dataset models.TaxRateDataset
+		if err := tx.First(&dataset, datasetID).Error; err != nil {
+			return err
+		}
+		return activateDataset(tx, &dataset)
+	})
+}
+
+// activateDataset 要在事务里调用，保证任何时候都只有一个生效的版本。
+func activateDataset(tx *gorm.DB, dataset *models.TaxRateDataset) error {
+	if err := tx.Model(&models.TaxRateDataset{}).Where("active = ? AND id <> ?", true, dataset.ID).
+		Update("active", false).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	dataset.Active = true
+	dataset.ActivatedAt = &now
+	return tx.Model(dataset).Updates(map[string]interface{}{"active": true, "activated_at": now}).Error
+}
+
+func (repo *taxRateRepositoryImpl) DeleteDatasetsBefore(ctx context.Context, datasetID int64) error {
+	return dbFor(ctx, repo.db).Transaction(func(tx *gorm.DB) error {
+		old := tx.Model(&models.TaxRateDataset{}).Select("id").Where("id < ? AND active = ?", datasetID, false)
+		if err := tx.Where("dataset_id IN (?)", old).Delete(&models.TaxRate{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id < ? AND active = ?", datasetID, false).Delete(&models.TaxRateDataset{}).Error
+	})
+}
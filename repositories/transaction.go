@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type txKey struct{}
+
+// Transactor 在一个事务里运行fn。fn里用它传进来的ctx调用的repository都在这个事务里，
+// 用于一个service里跨repository的修改，比如修改和它的审计日志要一起提交。
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type transactorImpl struct {
+	db *gorm.DB
+}
+
+func NewTransactor(db *gorm.DB) Transactor {
+	return &transactorImpl{db: db}
+}
+
+// Transaction 已经在事务里的时候用savepoint嵌套。
+func (t *transactorImpl) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return dbFor(ctx, t.db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// dbFor 返回ctx里的事务，不在事务里的时候返回db。repository都要通过它访问数据库。
+func dbFor(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// upsert 按conflictColumns（要有唯一索引）插入，冲突的时候更新updateColumns，MySQL、PostgreSQL、SQLite通用。
+// 主键已经有值的时候和Save一样直接更新。冲突更新之后各个数据库返回主键的方式不一样
+// （MySQL的LastInsertId不是已有的那行），所以插入之后按conflictColumns重新查一次主键。
+func upsert(db *gorm.DB, value interface{}, conflictColumns, updateColumns []string) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+	ctx := db.Statement.Context
+	reflectValue := reflect.Indirect(reflect.ValueOf(value))
+	primaryField := stmt.Schema.PrioritizedPrimaryField
+	if _, isZero := primaryField.ValueOf(ctx, reflectValue); !isZero {
+		return db.Save(value).Error
+	}
+
+	columns := make([]clause.Column, 0, len(conflictColumns))
+	query := db.Table(stmt.Schema.Table)
+	for _, column := range conflictColumns {
+		columns = append(columns, clause.Column{Name: column})
+		fieldValue, _ := stmt.Schema.LookUpField(column).ValueOf(ctx, reflectValue)
+		query = query.Where(clause.Eq{Column: clause.Column{Name: column}, Value: fieldValue})
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   columns,
+		DoUpdates: clause.AssignmentColumns(updateColumns),
+	}).Create(value).Error; err != nil {
+		return err
+	}
+
+	var ids []int64
+	if err := query.Pluck(primaryField.DBName, &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return primaryField.Set(ctx, reflectValue, ids[0])
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"errors"
 
 	"github.com/atomi-ai/atomi/models"
@@ -8,11 +9,14 @@ import (
 )
 
 type UserAddressRepository interface {
-	FindAddressesByUserID(userID int64) ([]*models.Address, error)
-	FindByUserIDAndAddressID(userID, addressID int64) (*models.UserAddress, error)
-	Save(userAddress *models.UserAddress) (*models.UserAddress, error)
-	Delete(userAddress *models.UserAddress) error
-	DeleteAllByUserID(userID int64) error
+	FindAddressesByUserID(ctx context.Context, userID int64) ([]*models.Address, error)
+	FindByUserIDAndAddressID(ctx context.Context, userID, addressID int64) (*models.UserAddress, error)
+	Save(ctx context.Context, userAddress *models.UserAddress) (*models.UserAddress, error)
+	Delete(ctx context.Context, userAddress *models.UserAddress) error
+	// ReplaceAddress 在一个事务里保存新的address，把用户关联的oldAddressID换成它，默认地址是oldAddressID的也一起换掉。
+	// 旧的address不删，历史订单还在用。
+	ReplaceAddress(ctx context.Context, userID, oldAddressID int64, address *models.Address) error
+	DeleteAllByUserID(ctx context.Context, userID int64) error
 }
 
 type userAddressRepository struct {
@@ -23,9 +27,9 @@ func NewUserAddressRepository(db *gorm.DB) UserAddressRepository {
 	return &userAddressRepository{db}
 }
 
-func (uar *userAddressRepository) FindAddressesByUserID(userID int64) ([]*models.Address, error) {
+func (uar *userAddressRepository) FindAddressesByUserID(ctx context.Context, userID int64) ([]*models.Address, error) {
 	var addresses []*models.Address
-	err := uar.db.Table("user_addresses").Select("addresses.*").
+	err := dbFor(ctx, uar.db).Table("user_addresses").Select("addresses.*").
 		Joins("JOIN addresses ON user_addresses.address_id = addresses.id").
 		Where("user_addresses.user_id = ?", userID).
 		Scan(&addresses).Error
@@ -35,9 +39,9 @@ func (uar *userAddressRepository) FindAddressesByUserID(userID int64) ([]*models
 	return addresses, nil
 }
 
-func (uar *userAddressRepository) FindByUserIDAndAddressID(userID, addressID int64) (*models.UserAddress, error) {
+func (uar *userAddressRepository) FindByUserIDAndAddressID(ctx context.Context, userID, addressID int64) (*models.UserAddress, error) {
 	var userAddress models.UserAddress
-	err := uar.db.Where("user_id = ? AND address_id = ?", userID, addressID).First(&userAddress).Error
+	err := dbFor(ctx, uar.db).Where("user_id = ? AND address_id = ?", userID, addressID).First(&userAddress).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -47,19 +51,38 @@ func (uar *userAddressRepository) FindByUserIDAndAddressID(userID, addressID int
 	return &userAddress, nil
 }
 
-func (uar *userAddressRepository) Save(userAddress *models.UserAddress) (*models.UserAddress, error) {
-	err := uar.db.Save(userAddress).Error
+func (uar *userAddressRepository) Save(ctx context.Context, userAddress *models.UserAddress) (*models.UserAddress, error) {
+	err := dbFor(ctx, uar.db).Save(userAddress).Error
 	if err != nil {
 		return nil, err
 	}
 	return userAddress, nil
 }
 
-func (uar *userAddressRepository) Delete(userAddress *models.UserAddress) error {
-	return uar.db.Delete(userAddress).Error
+func (uar *userAddressRepository) Delete(ctx context.Context, userAddress *models.UserAddress) error {
+	return dbFor(ctx, uar.db).Delete(userAddress).Error
 }
 
-func (uar *userAddressRepository) DeleteAllByUserID(userID int64) error {
-	err := uar.db.Where("user_id = ?", userID).Delete(models.UserAddress{}).Error
+func (uar *userAddressRepository) ReplaceAddress(ctx context.Context, userID, oldAddressID int64, address *models.Address) error {
+	return dbFor(ctx, uar.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(address).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.UserAddress{}).Where("user_id = ? AND address_id = ?", userID, oldAddressID).
+			Update("address_id", address.ID).Error; err != nil {
+			return err
+		}
+		for _, column := range []string{"default_shipping_address_id", "default_billing_address_id"} {
+			if err := tx.Model(&models.User{}).Where("id = ? AND "+column+" = ?", userID, oldAddressID).
+				Update(column, address.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (uar *userAddressRepository) DeleteAllByUserID(ctx context.Context, userID int64) error {
+	err := dbFor(ctx, uar.db).Where("user_id = ?", userID).Delete(models.UserAddress{}).Error
 	return err
 }
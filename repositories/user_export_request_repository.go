@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"gorm.io/gorm"
+)
+
+type UserExportRequestRepository interface {
+	Save(ctx context.Context, request *models.UserExportRequest) error
+	FindByIDAndUserID(ctx context.Context, id, userID int64) (*models.UserExportRequest, error)
+	// FindExpired 返回在before之前过期、文件还没删掉的导出。
+	FindExpired(ctx context.Context, before time.Time) ([]*models.UserExportRequest, error)
+}
+
+type userExportRequestRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewUserExportRequestRepository(db *gorm.DB) UserExportRequestRepository {
+	return &userExportRequestRepositoryImpl{db: db}
+}
+
+func (r *userExportRequestRepositoryImpl) Save(ctx context.Context, request *models.UserExportRequest) error {
+	return dbFor(ctx, r.db).Save(request).Error
+}
+
+func (r *userExportRequestRepositoryImpl) FindByIDAndUserID(ctx context.Context, id, userID int64) (*models.UserExportRequest, error) {
+	var request models.UserExportRequest
+	err := dbFor(ctx, r.db).Where("id = ? AND user_id = ?", id, userID).First(&request).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *userExportRequestRepositoryImpl) FindExpired(ctx context.Context, before time.Time) ([]*models.UserExportRequest, error) {
+	var requests []*models.UserExportRequest
+	err := dbFor(ctx, r.db).
+		Where("status = ? AND expires_at < ? AND blob_name <> ''", models.UserExportStatusReady, before).
+		Find(&requests).Error
+	return requests, err
+}
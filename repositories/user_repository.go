@@ -1,15 +1,19 @@
 package repositories
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/models"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
-	FindByEmail(email string) (*models.User, error)
-	GetByID(userID int64) (*models.User, error)
-	Save(user *models.User) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	FindByAuthSubject(ctx context.Context, provider, subject string) (*models.User, error)
+	GetByID(ctx context.Context, userID int64) (*models.User, error)
+	Save(ctx context.Context, user *models.User) (*models.User, error)
+	Search(ctx context.Context, query string, limit, offset int) ([]*models.User, error)
+	FindServiceAccounts(ctx context.Context) ([]*models.User, error)
 }
 
 type userRepositoryImpl struct {
@@ -20,22 +24,44 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &userRepositoryImpl{db: db}
 }
 
-func (repo *userRepositoryImpl) FindByEmail(email string) (*models.User, error) {
+func (repo *userRepositoryImpl) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := dbFor(ctx, repo.db).Where("email = ?", email).First(&user).Error
+	return &user, err
+}
+
+func (repo *userRepositoryImpl) FindByAuthSubject(ctx context.Context, provider, subject string) (*models.User, error) {
 	var user models.User
-	err := repo.db.Where("email = ?", email).First(&user).Error
+	err := dbFor(ctx, repo.db).Where("auth_provider = ? AND auth_subject = ?", provider, subject).First(&user).Error
 	return &user, err
 }
 
-func (repo *userRepositoryImpl) GetByID(userID int64) (*models.User, error) {
+func (repo *userRepositoryImpl) GetByID(ctx context.Context, userID int64) (*models.User, error) {
 	var user models.User
-	err := repo.db.First(&user, userID).Error
+	err := dbFor(ctx, repo.db).First(&user, userID).Error
 	return &user, err
 }
 
 // TODO(lamuguo): Review所有update操作.
-func (repo *userRepositoryImpl) Save(user *models.User) (*models.User, error) {
-	return user, repo.db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "email"}},
-		DoUpdates: clause.AssignmentColumns([]string{"id", "role", "phone", "name", "default_shipping_address_id", "default_billing_address_id", "stripe_customer_id", "payment_method_id"}),
-	}).Save(user).Error
+func (repo *userRepositoryImpl) Save(ctx context.Context, user *models.User) (*models.User, error) {
+	return user, upsert(dbFor(ctx, repo.db), user, []string{"email"},
+		[]string{"role", "phone", "name", "default_shipping_address_id", "default_billing_address_id", "stripe_customer_id", "payment_method_id", "suspended_at", "auth_provider", "auth_subject", "updated_at"})
+}
+
+// Search 按email/name/phone模糊查找用户，query为空的时候返回所有用户。
+func (repo *userRepositoryImpl) Search(ctx context.Context, query string, limit, offset int) ([]*models.User, error) {
+	var users []*models.User
+	db := dbFor(ctx, repo.db).Order("id").Limit(limit).Offset(offset)
+	if query != "" {
+		pattern := "%" + query + "%"
+		db = db.Where("email LIKE ? OR name LIKE ? OR phone LIKE ?", pattern, pattern, pattern)
+	}
+	err := db.Find(&users).Error
+	return users, err
+}
+
+func (repo *userRepositoryImpl) FindServiceAccounts(ctx context.Context) ([]*models.User, error) {
+	var users []*models.User
+	err := dbFor(ctx, repo.db).Where("service_account = ?", true).Order("id").Find(&users).Error
+	return users, err
 }
@@ -1,75 +1,195 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	application "github.com/atomi-ai/atomi/app"
 	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/migrations"
 	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
 	"github.com/atomi-ai/atomi/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
+// metricsAddr 没配置的时候 /metrics 监听的地址
+const defaultMetricsAddr = ":9090"
+
 func initLogrus() {
-	log.SetFormatter(&log.TextFormatter{
-		FullTimestamp: true, // 显示完整时间戳
-	})
+	// 默认输出JSON，本地开发可以配 logFormat: text
+	if viper.GetString("logFormat") == "text" {
+		log.SetFormatter(&log.TextFormatter{
+			FullTimestamp: true, // 显示完整时间戳
+		})
+	} else {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	log.AddHook(utils.RequestIDHook{})
 
-	// 设置日志级别为 Debug 级别
-	log.SetLevel(log.DebugLevel)
+	// 默认是 Debug 级别，可以用 logLevel 调整
+	level, err := log.ParseLevel(viper.GetString("logLevel"))
+	if err != nil {
+		level = log.DebugLevel
+	}
+	log.SetLevel(level)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrateCommand(os.Args[2:]))
+		case "tax-rates":
+			os.Exit(runTaxRatesCommand(os.Args[2:]))
+		}
+	}
+
 	// Backend initialization
 	utils.LoadConfig()
 	initLogrus()
 
+	shutdownTracing, err := utils.InitTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Errorf("Errors in flushing traces, err: \n%v", err)
+		}
+	}()
+
 	// DB / Stripe / Azure blob
 	db := models.InitDB()
-	models.AutoMigrate(db)
-	utils.LoadTaxRates(db)
+	// 多个副本一起启动的时候由迁移锁保证只有一个在迁移；也可以关掉，在发布流程里单独跑 migrate up
+	if !viper.IsSet("migrateOnStart") || viper.GetBool("migrateOnStart") {
+		if err = migrations.Migrate(context.Background(), db); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
 	utils.InitStripe(viper.GetString("stripeKey"))
 	blob, err := utils.NewAzureBlobStorage(viper.GetString("containerUrlWithSasToken"))
 	if err != nil {
 		log.Fatalf("Failed to initialize azure blob storage: %v", err)
 	}
+	// 用户数据导出放在单独的private container里，没配置的时候导出会失败
+	if accountKey := viper.GetString("azureStorageAccountKey"); accountKey != "" {
+		containerName := viper.GetString("privateContainerName")
+		if containerName == "" {
+			containerName = "private"
+		}
+		if err = blob.SetPrivateContainer(viper.GetString("azureStorageAccountName"), accountKey, containerName); err != nil {
+			log.Fatalf("Failed to initialize azure blob storage: %v", err)
+		}
+	}
+
+	authenticator, err := utils.NewAuthenticator()
+	if err != nil {
+		log.Fatalf("Failed to initialize authenticator: %v", err)
+	}
 
 	// Create application based on the initialization.
-	app, err := application.InitializeApplication(db, utils.NewFirebaseAppWrapper(utils.FirebaseAppProvider()), blob, utils.NewStripeWrapper())
+	app, err := application.InitializeApplication(db, authenticator, blob, utils.NewStripeWrapper())
 	if err != nil {
 		log.Fatalf("Failed to initialize application: %v", err)
 	}
+	// taxRatesFileDir里的文件变了才会导入新的版本，失败的时候继续用当前的版本
+	if _, err = app.TaxRateImportService.ImportDir(context.Background(), viper.GetString("taxRatesFileDir")); err != nil {
+		log.Errorf("Errors in importing tax rates, err: \n%v", err)
+	}
 
-	r := gin.Default()
+	serverConfig := utils.LoadHTTPServerConfig()
+	// 访问日志由RequestLogger输出，不用gin自带的Logger
+	r := gin.New()
+	if err = r.SetTrustedProxies(serverConfig.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trustedProxies: %v", err)
+	}
+	r.Use(gin.Recovery())
+	r.Use(middlewares.Metrics())
+	r.Use(middlewares.Tracing())
 
-	r.GET("/api/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "OK",
-		})
-	})
+	if sqlDB, err := db.DB(); err == nil {
+		prometheus.MustRegister(collectors.NewDBStatsCollector(sqlDB, "atomi"))
+	}
+	// /metrics 单独监听 metricsAddr（默认 :9090，只在内网暴露），不挂在公开的主服务上。
+	metricsAddr := viper.GetString("metricsAddr")
+	if metricsAddr == "" {
+		metricsAddr = defaultMetricsAddr
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	metricsServer := &http.Server{Addr: metricsAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Errors in running metrics server on %v, err: \n%v", metricsAddr, err)
+		}
+	}()
+
+	// 给Kubernetes的liveness/readiness探针用，/api/health 和 /api/ready 是以前的地址
+	r.GET("/healthz", app.HealthController.Liveness)
+	r.GET("/readyz", app.HealthController.Readiness)
+	r.GET("/api/health", app.HealthController.Liveness)
+	r.GET("/api/ready", app.HealthController.Readiness)
 
 	r.Use(middlewares.CorsMiddleware())
-	r.Use(app.AuthMiddleware.Handler())
-	r.Use(middlewares.RequestResponseLogger()) // 添加自定义的请求/响应日志中间件
+	r.Use(middlewares.RequestID())
+	r.Use(middlewares.RequestLogger())
+	r.Use(middlewares.RequestTimeout())
+
+	// 不需要登录的接口，带了token的话也会识别出用户
+	public := r.Group("/api", app.AuthMiddleware.Public(), app.RateLimiter.Limit("public"))
+	public.GET("/stores", app.StoreController.GetAllStores)
+	public.GET("/products/:store_id", app.StoreController.GetProductsByStoreID)
+	public.GET("/store/:store_id", app.StoreController.GetStoreInfo)
+
+	// Stripe的事件用签名验证，不需要登录
+	r.POST("/api/stripe/webhook", app.StripeController.Webhook)
 
-	r.GET("/api/login", app.LoginController.Login)
+	// 只要求token有效，第一次登录的用户在这里注册
+	r.GET("/api/login", app.AuthMiddleware.Authenticated(), app.RateLimiter.Limit("api"), app.LoginController.Login)
+
+	// 下面的接口都要求注册过的用户，第一次访问的时候会自动注册
+	r.Use(app.AuthMiddleware.Registered())
+	r.Use(app.RateLimiter.Limit("api"))
+
+	// Admin endpoints
+	app.AdminController.RegisterRoutes(r.Group("/api/admin"))
+	// 每个依赖的详细检查结果（包括错误信息）只给admin看
+	r.GET("/api/admin/health", app.Authorizer.Require(models.PermissionUserManage), app.HealthController.Report)
+	// 报表只要求report:view，可以给会计单独开一个service account
+	app.ReportController.RegisterRoutes(r.Group("/api/admin/reports"))
 
 	// Manager endpoints
 	app.ManagerStoreController.RegisterRoutes(r.Group("/api/mgr"))
-	r.POST("/api/mgr/upload-image", app.ImageController.UploadImage)
+	r.POST("/api/mgr/upload-image", app.Authorizer.Require(models.PermissionImageUpload), app.ImageController.UploadImage)
 	r.DELETE("/api/user/request", app.UserController.SubmitDeleteUserRequest)
+	r.POST("/api/user/export", app.UserController.RequestDataExport)
+	r.GET("/api/user/export/:exportId", app.UserController.GetDataExport)
 
 	// Add StoreController endpoints here
 	r.GET("/api/default-store", app.StoreController.GetDefaultStore)
 	r.PUT("/api/default-store/:store_id", app.StoreController.SetDefaultStore)
-	r.GET("/api/stores", app.StoreController.GetAllStores)
 	r.DELETE("/api/default-store", app.StoreController.DeleteDefaultStore)
-	r.GET("/api/products/:store_id", app.StoreController.GetProductsByStoreID)
-	r.GET("/api/store/:store_id", app.StoreController.GetStoreInfo)
+	r.GET("/api/favorite-stores", app.StoreController.GetFavoriteStores)
+	r.PUT("/api/favorite-stores/:store_id", app.StoreController.AddFavoriteStore)
+	r.DELETE("/api/favorite-stores/:store_id", app.StoreController.RemoveFavoriteStore)
+	r.POST("/api/store-invitations/:token/accept", app.StoreInvitationController.AcceptInvitation)
 
 	// Add AddressController endpoints here
 	r.GET("/api/addresses", app.AddressController.GetAllAddressesForUser)
 	r.POST("/api/addresses", app.AddressController.AddAddressForUser)
+	r.PUT("/api/addresses/:addressId", app.AddressController.UpdateAddressForUser)
 	r.DELETE("/api/addresses/:addressId", app.AddressController.DeleteAddressForUser)
 	r.POST("/api/addresses/shipping/:addressId", app.AddressController.SetDefaultShippingAddress)
 	r.POST("/api/addresses/billing/:addressId", app.AddressController.SetDefaultBillingAddress)
@@ -81,7 +201,7 @@ func main() {
 	r.PUT("/api/payment-methods/:paymentMethodId", app.StripeController.AttachPaymentMethodToCustomer)
 	r.GET("/api/payment-methods", app.StripeController.ListPaymentMethods)
 	r.DELETE("/api/payment-methods/:paymentMethodId", app.StripeController.DeletePaymentMethod)
-	r.POST("/api/pay", app.StripeController.Pay)
+	r.POST("/api/pay", app.RateLimiter.Limit("pay"), app.StripeController.Pay)
 	r.DELETE("/api/payment-methods", app.StripeController.DeleteAllPaymentMethods)
 	r.GET("/api/payment-intents", app.StripeController.ListPaymentIntents)
 	r.GET("/api/payment-intent/:paymentIntentId", app.StripeController.PaymentIntent)
@@ -93,8 +213,9 @@ func main() {
 	// Add order endpoints here
 	r.GET("/api/orders", app.OrderController.GetUserOrders)
 	r.POST("/api/order", app.OrderController.AddOrderForUser)
-	r.POST("/api/uber/quote", app.OrderController.UberQuote)
-	r.POST("/api/uber/delivery", app.OrderController.CreateDelivery)
+	r.POST("/api/orders/:order_id/tax", app.OrderController.CalculateTax)
+	r.POST("/api/uber/quote", app.RateLimiter.Limit("uber"), app.OrderController.UberQuote)
+	r.POST("/api/uber/delivery", app.RateLimiter.Limit("uber"), app.OrderController.CreateDelivery)
 	r.GET("/api/uber/delivery/:deliveryId", app.OrderController.GetDelivery)
 	r.POST("/api/tax-rate", app.OrderController.GetTaxRate)
 
@@ -102,7 +223,65 @@ func main() {
 	log.Infof("logrus: Info log enabled")
 
 	// APIs below are not tested by flutter tests yet.
-	if err = r.Run(":8081"); err != nil {
-		log.Fatal("Errors in running application on port 8081", err)
+	server := serverConfig.NewServer(r)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serverConfig.Serve(server)
+	}()
+
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	go purgeExpiredExports(stop, app.UserExportService)
+	select {
+	case err = <-serveErr:
+		if err != nil {
+			log.Errorf("Errors in running application on %v, err: \n%v", serverConfig.Addr, err)
+		}
+	case <-stop.Done():
+		log.Infof("Received shutdown signal, draining for at most %v", serverConfig.ShutdownTimeout)
+	}
+	shutdown(serverConfig, server, metricsServer, app, db)
+}
+
+// purgeExpiredExports 定期删除过期的用户数据导出文件，直到收到退出信号。
+func purgeExpiredExports(ctx context.Context, exportService services.UserExportService) {
+	ticker := time.NewTicker(services.UserExportPurgeInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if purged, err := exportService.PurgeExpired(ctx); err != nil {
+				log.Errorf("Errors in purging expired exports, err: \n%v", err)
+			} else if purged > 0 {
+				log.Infof("Purged %d expired exports", purged)
+			}
+		}
+	}
+}
+
+// shutdown 先让readiness失败，再停止接受新连接、等正在处理的请求和后台任务结束，最后关闭DB连接池。
+// 所有步骤共用 shutdownTimeout 这一个deadline。
+func shutdown(serverConfig utils.HTTPServerConfig, server, metricsServer *http.Server, app *application.Application, db *gorm.DB) {
+	utils.SetDraining(true)
+	time.Sleep(serverConfig.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("Errors in draining HTTP requests, err: \n%v", err)
+	}
+	if err := utils.WaitWithContext(ctx, app.UserExportService.Wait); err != nil {
+		log.Errorf("Errors in waiting for background exports, err: \n%v", err)
+	}
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		log.Errorf("Errors in stopping metrics server, err: \n%v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			log.Errorf("Errors in closing DB pool, err: \n%v", err)
+		}
 	}
+	log.Infof("Shutdown complete")
 }
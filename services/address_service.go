@@ -1,68 +1,116 @@
 package services
 
 import (
+	"context"
+	"errors"
+
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/repositories"
 )
 
+// ErrUserAddressNotFound 是地址不存在或者不是这个用户的，两种情况不区分
+var ErrUserAddressNotFound = errors.New("address not found")
+
 type AddressService interface {
-	GetAddressesByUserID(userID int64) ([]*models.Address, error)
-	AddAddressForUser(user *models.User, address *models.Address) (*models.Address, error)
-	DeleteAddressForUser(user *models.User, addressID int64) error
-	DeleteAllAddressesForUser(user *models.User) error
+	GetAddressesByUserID(ctx context.Context, userID int64) ([]*models.Address, error)
+	// GetAddressForUser 只返回用户自己的地址，客户端传上来的地址ID都要经过它。
+	GetAddressForUser(ctx context.Context, user *models.User, addressID int64) (*models.Address, error)
+	AddAddressForUser(ctx context.Context, user *models.User, address *models.Address) (*models.Address, error)
+	// UpdateAddressForUser 不改原来的地址，保存一个新的地址换掉它（包括默认地址），返回新的地址。
+	UpdateAddressForUser(ctx context.Context, user *models.User, addressID int64, address *models.Address) (*models.Address, error)
+	DeleteAddressForUser(ctx context.Context, user *models.User, addressID int64) error
+	DeleteAllAddressesForUser(ctx context.Context, user *models.User) error
 }
 
 type addressServiceImpl struct {
 	UserRepo        repositories.UserRepository
 	AddressRepo     repositories.AddressRepository
 	UserAddressRepo repositories.UserAddressRepository
+	Validator       AddressValidator
+	Transactor      repositories.Transactor
 }
 
 // TODO(lamuguo): 感觉没法忍下去了，这种一点一点传参的方式，实在是太需要dependency injection了。
-func NewAddressService(userRepo repositories.UserRepository, addressRepo repositories.AddressRepository, userAddressRepo repositories.UserAddressRepository) AddressService {
+func NewAddressService(userRepo repositories.UserRepository, addressRepo repositories.AddressRepository, userAddressRepo repositories.UserAddressRepository, validator AddressValidator,
+	transactor repositories.Transactor) AddressService {
 	return &addressServiceImpl{
 		UserRepo:        userRepo,
 		AddressRepo:     addressRepo,
 		UserAddressRepo: userAddressRepo,
+		Validator:       validator,
+		Transactor:      transactor,
 	}
 }
 
-func (as *addressServiceImpl) GetAddressesByUserID(userID int64) ([]*models.Address, error) {
-	return as.UserAddressRepo.FindAddressesByUserID(userID)
+func (as *addressServiceImpl) GetAddressesByUserID(ctx context.Context, userID int64) ([]*models.Address, error) {
+	return as.UserAddressRepo.FindAddressesByUserID(ctx, userID)
 }
 
-func (as *addressServiceImpl) AddAddressForUser(user *models.User, address *models.Address) (*models.Address, error) {
-	savedAddr, err := as.AddressRepo.Save(address)
+func (as *addressServiceImpl) GetAddressForUser(ctx context.Context, user *models.User, addressID int64) (*models.Address, error) {
+	userAddress, err := as.UserAddressRepo.FindByUserIDAndAddressID(ctx, user.ID, addressID)
 	if err != nil {
 		return nil, err
 	}
+	if userAddress == nil {
+		return nil, ErrUserAddressNotFound
+	}
+	return as.AddressRepo.FindByID(ctx, addressID)
+}
 
-	userAddress := &models.UserAddress{
-		Address:   savedAddr,
-		User:      user,
-		UserID:    user.ID,
-		AddressID: savedAddr.ID,
+func (as *addressServiceImpl) AddAddressForUser(ctx context.Context, user *models.User, address *models.Address) (*models.Address, error) {
+	if err := as.Validator.Validate(ctx, address); err != nil {
+		return nil, err
 	}
 
-	_, err = as.UserAddressRepo.Save(userAddress)
+	// 客户端传上来的ID不算数，不然Save会覆盖别人的地址
+	address.BaseModel = models.BaseModel{}
+	err := as.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := as.AddressRepo.Save(ctx, address); err != nil {
+			return err
+		}
+		_, err := as.UserAddressRepo.Save(ctx, &models.UserAddress{UserID: user.ID, AddressID: address.ID})
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
+	return address, nil
+}
+
+func (as *addressServiceImpl) UpdateAddressForUser(ctx context.Context, user *models.User, addressID int64, address *models.Address) (*models.Address, error) {
+	if _, err := as.GetAddressForUser(ctx, user, addressID); err != nil {
+		return nil, err
+	}
+	if err := as.Validator.Validate(ctx, address); err != nil {
+		return nil, err
+	}
 
-	return savedAddr, nil
+	// 历史订单和PaymentIntent还指向原来的地址，所以存成新的一行
+	address.BaseModel = models.BaseModel{}
+	if err := as.UserAddressRepo.ReplaceAddress(ctx, user.ID, addressID, address); err != nil {
+		return nil, err
+	}
+	if user.DefaultShippingAddressID == addressID {
+		user.DefaultShippingAddressID = address.ID
+	}
+	if user.DefaultBillingAddressID == addressID {
+		user.DefaultBillingAddressID = address.ID
+	}
+	return address, nil
 }
 
-func (as *addressServiceImpl) DeleteAddressForUser(user *models.User, addressID int64) error {
-	userAddress, err := as.UserAddressRepo.FindByUserIDAndAddressID(user.ID, addressID)
+func (as *addressServiceImpl) DeleteAddressForUser(ctx context.Context, user *models.User, addressID int64) error {
+	userAddress, err := as.UserAddressRepo.FindByUserIDAndAddressID(ctx, user.ID, addressID)
 	if err != nil {
 		return err
 	}
+	if userAddress == nil {
+		return ErrUserAddressNotFound
+	}
 
-	if userAddress != nil {
-		err = as.UserAddressRepo.Delete(userAddress)
-		if err != nil {
-			return err
-		}
+	err = as.UserAddressRepo.Delete(ctx, userAddress)
+	if err != nil {
+		return err
 	}
 
 	dirty := false
@@ -75,7 +123,7 @@ func (as *addressServiceImpl) DeleteAddressForUser(user *models.User, addressID
 		user.DefaultBillingAddressID = 0
 	}
 	if dirty {
-		_, err = as.UserRepo.Save(user)
+		_, err = as.UserRepo.Save(ctx, user)
 		if err != nil {
 			return err
 		}
@@ -88,9 +136,9 @@ func (as *addressServiceImpl) DeleteAddressForUser(user *models.User, addressID
 // Please don't use the function below, it is testing only. Please consider to rewrite it if you need the feature.
 //
 // 这个函数不会删跟用户相关的address，所以有可能造成很多不用了的address就留下来了。
-func (as *addressServiceImpl) DeleteAllAddressesForUser(user *models.User) error {
+func (as *addressServiceImpl) DeleteAllAddressesForUser(ctx context.Context, user *models.User) error {
 	// Remove all user x address relations.
-	err := as.UserAddressRepo.DeleteAllByUserID(user.ID)
+	err := as.UserAddressRepo.DeleteAllByUserID(ctx, user.ID)
 
 	// Update the user's default addresses.
 	dirty := false
@@ -103,7 +151,7 @@ func (as *addressServiceImpl) DeleteAllAddressesForUser(user *models.User) error
 		user.DefaultBillingAddressID = 0
 	}
 	if dirty {
-		_, err = as.UserRepo.Save(user)
+		_, err = as.UserRepo.Save(ctx, user)
 		if err != nil {
 			return err
 		}
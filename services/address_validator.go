@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAddress      = errors.New("invalid address")
+	ErrGeocoderUnavailable = errors.New("geocoder is not configured")
+	// ErrAddressNotFound 是geocoder找不到这个地址
+	ErrAddressNotFound = errors.New("address not found")
+)
+
+// AddressValidationError 是每个字段（JSON字段名）的问题，errors.Is(err, ErrInvalidAddress)。
+type AddressValidationError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+func (e *AddressValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for i, field := range fields {
+		fields[i] = field + ": " + e.Fields[field]
+	}
+	return ErrInvalidAddress.Error() + ": " + strings.Join(fields, "; ")
+}
+
+func (e *AddressValidationError) Unwrap() error {
+	return ErrInvalidAddress
+}
+
+type AddressValidator interface {
+	// Validate 校验address并就地规范化（去掉多余的空格，州代码大写，ZIP是12345或者12345-6789，国家是US，电话是E.164），
+	// 有geocoder的时候填上坐标。不合法的时候返回*AddressValidationError。
+	Validate(ctx context.Context, address *models.Address) error
+}
+
+// Geocoder 把地址换成坐标，接外部的地理编码服务（Google、Mapbox之类）。
+type Geocoder interface {
+	Geocode(ctx context.Context, address *models.Address) (latitude, longitude float64, err error)
+}
+
+// stubGeocoder 还没有接外部服务，地址只做离线的校验，没有坐标。
+type stubGeocoder struct{}
+
+func NewGeocoder() Geocoder {
+	return &stubGeocoder{}
+}
+
+func (g *stubGeocoder) Geocode(ctx context.Context, address *models.Address) (float64, float64, error) {
+	return 0, 0, ErrGeocoderUnavailable
+}
+
+type addressValidatorImpl struct {
+	TaxRateRepo repositories.TaxRateRepository
+	Geocoder    Geocoder
+}
+
+func NewAddressValidator(taxRateRepo repositories.TaxRateRepository, geocoder Geocoder) AddressValidator {
+	return &addressValidatorImpl{
+		TaxRateRepo: taxRateRepo,
+		Geocoder:    geocoder,
+	}
+}
+
+const (
+	maxAddressLabelLength         = 32
+	maxDeliveryInstructionsLength = 500
+)
+
+var (
+	phoneSeparators   = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+	postalCodePattern = regexp.MustCompile(`^(\d{5})(?:[- ]?(\d{4}))?$`)
+	spacesPattern     = regexp.MustCompile(`\s+`)
+)
+
+// 只送美国的地址
+var usCountryNames = map[string]bool{"US": true, "USA": true, "UNITED STATES": true, "UNITED STATES OF AMERICA": true}
+
+// 州、华盛顿特区、海外领地和军邮的代码，key是全名（大写）的可以直接写全名
+var usStates = map[string]string{
+	"ALABAMA": "AL", "ALASKA": "AK", "ARIZONA": "AZ", "ARKANSAS": "AR", "CALIFORNIA": "CA", "COLORADO": "CO", "CONNECTICUT": "CT",
+	"DELAWARE": "DE", "DISTRICT OF COLUMBIA": "DC", "FLORIDA": "FL", "GEORGIA": "GA", "HAWAII": "HI", "IDAHO": "ID", "ILLINOIS": "IL",
+	"INDIANA": "IN", "IOWA": "IA", "KANSAS": "KS", "KENTUCKY": "KY", "LOUISIANA": "LA", "MAINE": "ME", "MARYLAND": "MD",
+	"MASSACHUSETTS": "MA", "MICHIGAN": "MI", "MINNESOTA": "MN", "MISSISSIPPI": "MS", "MISSOURI": "MO", "MONTANA": "MT",
+	"NEBRASKA": "NE", "NEVADA": "NV", "NEW HAMPSHIRE": "NH", "NEW JERSEY": "NJ", "NEW MEXICO": "NM", "NEW YORK": "NY",
+	"NORTH CAROLINA": "NC", "NORTH DAKOTA": "ND", "OHIO": "OH", "OKLAHOMA": "OK", "OREGON": "OR", "PENNSYLVANIA": "PA",
+	"RHODE ISLAND": "RI", "SOUTH CAROLINA": "SC", "SOUTH DAKOTA": "SD", "TENNESSEE": "TN", "TEXAS": "TX", "UTAH": "UT",
+	"VERMONT": "VT", "VIRGINIA": "VA", "WASHINGTON": "WA", "WEST VIRGINIA": "WV", "WISCONSIN": "WI", "WYOMING": "WY",
+	"PUERTO RICO": "PR", "GUAM": "GU", "U.S. VIRGIN ISLANDS": "VI", "AMERICAN SAMOA": "AS", "NORTHERN MARIANA ISLANDS": "MP",
+	"AA": "AA", "AE": "AE", "AP": "AP",
+}
+
+var usStateCodes = func() map[string]bool {
+	codes := map[string]bool{}
+	for _, code := range usStates {
+		codes[code] = true
+	}
+	return codes
+}()
+
+func (v *addressValidatorImpl) Validate(ctx context.Context, address *models.Address) error {
+	fields := map[string]string{}
+	address.Line1 = normalizeSpaces(address.Line1)
+	address.Line2 = normalizeSpaces(address.Line2)
+	address.City = normalizeSpaces(address.City)
+	for field, value := range map[string]string{"line1": address.Line1, "city": address.City} {
+		if value == "" {
+			fields[field] = "is required"
+		}
+	}
+
+	address.Label = normalizeSpaces(address.Label)
+	if len([]rune(address.Label)) > maxAddressLabelLength {
+		fields["label"] = fmt.Sprintf("must be at most %d characters", maxAddressLabelLength)
+	}
+	address.DeliveryInstructions = strings.TrimSpace(address.DeliveryInstructions)
+	if len([]rune(address.DeliveryInstructions)) > maxDeliveryInstructionsLength {
+		fields["delivery_instructions"] = fmt.Sprintf("must be at most %d characters", maxDeliveryInstructionsLength)
+	}
+	if phone, ok := normalizePhone(address.Phone); ok {
+		address.Phone = phone
+	} else {
+		fields["phone"] = fmt.Sprintf("%q is not a US phone number", address.Phone)
+	}
+
+	country := strings.ToUpper(normalizeSpaces(address.Country))
+	if country == "" || usCountryNames[country] {
+		address.Country = "US"
+	} else {
+		fields["country"] = "only US addresses are supported"
+	}
+
+	state := strings.ToUpper(normalizeSpaces(address.State))
+	if code, ok := usStates[state]; ok {
+		state = code
+	}
+	switch {
+	case state == "":
+		fields["state"] = "is required"
+	case !usStateCodes[state]:
+		fields["state"] = fmt.Sprintf("%q is not a US state code", address.State)
+	default:
+		address.State = state
+	}
+
+	zip5 := ""
+	match := postalCodePattern.FindStringSubmatch(strings.TrimSpace(address.PostalCode))
+	switch {
+	case strings.TrimSpace(address.PostalCode) == "":
+		fields["postal_code"] = "is required"
+	case match == nil:
+		fields["postal_code"] = fmt.Sprintf("%q is not a ZIP or ZIP+4 code", address.PostalCode)
+	default:
+		zip5, address.PostalCode = match[1], match[1]
+		if match[2] != "" {
+			address.PostalCode = match[1] + "-" + match[2]
+		}
+	}
+
+	// 税率数据里有这个ZIP的时候，州要对得上
+	if zip5 != "" && fields["state"] == "" {
+		taxRate, err := v.TaxRateRepo.FindByZipCode(ctx, zip5)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && !strings.EqualFold(taxRate.State, address.State) {
+			fields["postal_code"] = fmt.Sprintf("%v is in %v, not %v", zip5, taxRate.State, address.State)
+		}
+	}
+	if len(fields) > 0 {
+		return &AddressValidationError{Fields: fields}
+	}
+
+	latitude, longitude, err := v.Geocoder.Geocode(ctx, address)
+	switch {
+	case err == nil:
+		address.Latitude, address.Longitude = &latitude, &longitude
+	case errors.Is(err, ErrAddressNotFound):
+		return &AddressValidationError{Fields: map[string]string{"line1": "address not found"}}
+	case !errors.Is(err, ErrGeocoderUnavailable):
+		// geocoder出问题的时候不挡住用户，地址没有坐标，Uber自己解析
+		log.WithContext(ctx).Warnf("Errors in geocoding address %q, err: \n%v", address.OneLine(), err)
+	}
+	now := time.Now()
+	address.ValidatedAt = &now
+	return nil
+}
+
+// normalizePhone 把 "(415) 555-0123"、"+1 415.555.0123" 这样的美国号码规范成E.164的 "+14155550123"，空的不检查。
+func normalizePhone(phone string) (string, bool) {
+	digits := phoneSeparators.Replace(strings.TrimSpace(phone))
+	if digits == "" {
+		return "", true
+	}
+	digits = strings.TrimPrefix(strings.TrimPrefix(digits, "+"), "1")
+	if len(digits) != 10 || strings.Trim(digits, "0123456789") != "" {
+		return "", false
+	}
+	return "+1" + digits, true
+}
+
+func normalizeSpaces(s string) string {
+	return spacesPattern.ReplaceAllString(strings.TrimSpace(s), " ")
+}
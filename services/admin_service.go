@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+)
+
+var (
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrSelfManagement   = errors.New("admins can not change their own role or suspend themselves")
+	ErrUserSuspended    = errors.New("user is already suspended")
+	ErrUserNotSuspended = errors.New("user is not suspended")
+)
+
+// AdminUserDetail 是管理员查看一个用户时返回的内容。
+type AdminUserDetail struct {
+	User   *models.User   `json:"user"`
+	Orders []models.Order `json:"orders"`
+	Stores []models.Store `json:"stores"`
+}
+
+// AdminService 是管理员管理用户的入口，所有的修改都会写一条AuditLog。
+type AdminService interface {
+	SearchUsers(ctx context.Context, query string, limit, offset int) ([]*models.User, error)
+	GetUserDetail(ctx context.Context, userID int64) (*AdminUserDetail, error)
+	ChangeRole(ctx context.Context, actor *models.User, userID int64, role models.Role) (*models.User, error)
+	AssignStore(ctx context.Context, actor *models.User, userID, storeID int64, relationship models.StoreRelationship) error
+	UnassignStore(ctx context.Context, actor *models.User, userID, storeID int64) error
+	SuspendUser(ctx context.Context, actor *models.User, userID int64, reason string) (*models.User, error)
+	ReactivateUser(ctx context.Context, actor *models.User, userID int64) (*models.User, error)
+	// SetTaxExempt 设置用户是否免销售税，之后算税的订单才生效。
+	SetTaxExempt(ctx context.Context, actor *models.User, userID int64, taxExempt bool) (*models.User, error)
+	GetAuditLogs(ctx context.Context, userID int64) ([]models.AuditLog, error)
+}
+
+type adminServiceImpl struct {
+	UserRepo       repositories.UserRepository
+	OrderRepo      repositories.OrderRepository
+	StoreRepo      repositories.StoreRepository
+	MembershipRepo repositories.StoreMembershipRepository
+	AuditLogRepo   repositories.AuditLogRepository
+	Transactor     repositories.Transactor
+}
+
+func NewAdminService(
+	userRepo repositories.UserRepository,
+	orderRepo repositories.OrderRepository,
+	storeRepo repositories.StoreRepository,
+	membershipRepo repositories.StoreMembershipRepository,
+	auditLogRepo repositories.AuditLogRepository,
+	transactor repositories.Transactor) AdminService {
+	return &adminServiceImpl{
+		UserRepo:       userRepo,
+		OrderRepo:      orderRepo,
+		StoreRepo:      storeRepo,
+		MembershipRepo: membershipRepo,
+		AuditLogRepo:   auditLogRepo,
+		Transactor:     transactor,
+	}
+}
+
+func (s *adminServiceImpl) SearchUsers(ctx context.Context, query string, limit, offset int) ([]*models.User, error) {
+	return s.UserRepo.Search(ctx, query, limit, offset)
+}
+
+func (s *adminServiceImpl) GetUserDetail(ctx context.Context, userID int64) (*AdminUserDetail, error) {
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := s.OrderRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stores, err := s.MembershipRepo.FindStoresByStaff(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AdminUserDetail{User: user, Orders: orders, Stores: stores}, nil
+}
+
+func (s *adminServiceImpl) ChangeRole(ctx context.Context, actor *models.User, userID int64, role models.Role) (*models.User, error) {
+	if !role.IsValid() {
+		return nil, ErrInvalidRole
+	}
+	if actor.ID == userID {
+		return nil, ErrSelfManagement
+	}
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldRole := user.Role
+	user.Role = role
+	return s.saveUser(ctx, actor, user, "user.change_role", map[string]interface{}{"from": oldRole, "to": role})
+}
+
+func (s *adminServiceImpl) AssignStore(ctx context.Context, actor *models.User, userID, storeID int64, relationship models.StoreRelationship) error {
+	if !relationship.IsStaff() {
+		return ErrInvalidRole
+	}
+	if _, err := s.UserRepo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+	if _, err := s.StoreRepo.FindByID(ctx, storeID); err != nil {
+		return err
+	}
+
+	return s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.MembershipRepo.SetStaffRelationship(ctx, storeID, userID, relationship); err != nil {
+			return err
+		}
+		return s.audit(ctx, actor, "user.assign_store", userID, map[string]interface{}{"store_id": storeID, "role": relationship})
+	})
+}
+
+func (s *adminServiceImpl) UnassignStore(ctx context.Context, actor *models.User, userID, storeID int64) error {
+	return s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.MembershipRepo.RemoveStaff(ctx, storeID, userID); err != nil {
+			return err
+		}
+		return s.audit(ctx, actor, "user.unassign_store", userID, map[string]interface{}{"store_id": storeID})
+	})
+}
+
+func (s *adminServiceImpl) SuspendUser(ctx context.Context, actor *models.User, userID int64, reason string) (*models.User, error) {
+	if actor.ID == userID {
+		return nil, ErrSelfManagement
+	}
+
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrUserSuspended
+	}
+
+	now := time.Now()
+	user.SuspendedAt = &now
+	return s.saveUser(ctx, actor, user, "user.suspend", map[string]interface{}{"reason": reason})
+}
+
+func (s *adminServiceImpl) ReactivateUser(ctx context.Context, actor *models.User, userID int64) (*models.User, error) {
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.SuspendedAt == nil {
+		return nil, ErrUserNotSuspended
+	}
+
+	user.SuspendedAt = nil
+	return s.saveUser(ctx, actor, user, "user.reactivate", nil)
+}
+
+func (s *adminServiceImpl) SetTaxExempt(ctx context.Context, actor *models.User, userID int64, taxExempt bool) (*models.User, error) {
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldTaxExempt := user.TaxExempt
+	user.TaxExempt = taxExempt
+	return s.saveUser(ctx, actor, user, "user.set_tax_exempt", map[string]interface{}{"from": oldTaxExempt, "to": taxExempt})
+}
+
+func (s *adminServiceImpl) GetAuditLogs(ctx context.Context, userID int64) ([]models.AuditLog, error) {
+	return s.AuditLogRepo.FindByTarget(ctx, models.AuditTargetUser, userID)
+}
+
+// saveUser 保存修改过的用户，和审计日志在同一个事务里。
+func (s *adminServiceImpl) saveUser(ctx context.Context, actor *models.User, user *models.User, action string, details map[string]interface{}) (*models.User, error) {
+	var saved *models.User
+	err := s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if saved, err = s.UserRepo.Save(ctx, user); err != nil {
+			return err
+		}
+		return s.audit(ctx, actor, action, user.ID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (s *adminServiceImpl) audit(ctx context.Context, actor *models.User, action string, userID int64, details map[string]interface{}) error {
+	return writeAuditLog(ctx, s.AuditLogRepo, actor, action, models.AuditTargetUser, userID, details)
+}
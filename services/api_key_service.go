@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyPrefix = "atomi"
+	// service account的email用保留的.invalid域名，保证不会和真实用户冲突，也没法用Firebase登录。
+	serviceAccountEmailDomain = "service-accounts.invalid"
+	// 每个key最多这么久写一次last_used_at，避免每个请求都写数据库。
+	apiKeyLastUsedResolution = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey             = errors.New("invalid api key")
+	ErrInvalidServiceAccountName = errors.New("service account name must be 3-40 lowercase letters, digits or dashes")
+	ErrServiceAccountExists      = errors.New("service account already exists")
+	ErrNotServiceAccount         = errors.New("user is not a service account")
+	ErrInvalidPermission         = errors.New("invalid permission")
+	ErrAPIKeyRevoked             = errors.New("api key is already revoked")
+	ErrStoreKeyPermission        = errors.New("api keys limited to a store can only have store permissions")
+)
+
+var serviceAccountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,38}[a-z0-9]$`)
+
+type CreateAPIKeyInput struct {
+	Name        string              `json:"name"`
+	Permissions []models.Permission `json:"permissions" binding:"required"`
+	StoreID     *int64              `json:"store_id"`
+	ExpiresAt   *time.Time          `json:"expires_at"`
+}
+
+// NewAPIKey 是刚创建出来的key，明文的Key只有这个时候能看到。
+type NewAPIKey struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyService interface {
+	CreateServiceAccount(ctx context.Context, actor *models.User, name, displayName string) (*models.User, error)
+	ListServiceAccounts(ctx context.Context) ([]*models.User, error)
+	CreateKey(ctx context.Context, actor *models.User, userID int64, input CreateAPIKeyInput) (*NewAPIKey, error)
+	ListKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	// RotateKey 用相同的权限创建一个新key，旧key在gracePeriod之后失效（为0的时候立即失效）。
+	RotateKey(ctx context.Context, actor *models.User, keyID int64, gracePeriod time.Duration) (*NewAPIKey, error)
+	RevokeKey(ctx context.Context, actor *models.User, keyID int64) (*models.APIKey, error)
+	// Authenticate 验证X-API-Key，返回key对应的service account。
+	Authenticate(ctx context.Context, rawKey string) (*models.User, *models.APIKey, error)
+}
+
+type apiKeyServiceImpl struct {
+	APIKeyRepo   repositories.APIKeyRepository
+	UserRepo     repositories.UserRepository
+	StoreRepo    repositories.StoreRepository
+	AuditLogRepo repositories.AuditLogRepository
+	Transactor   repositories.Transactor
+}
+
+func NewAPIKeyService(
+	apiKeyRepo repositories.APIKeyRepository,
+	userRepo repositories.UserRepository,
+	storeRepo repositories.StoreRepository,
+	auditLogRepo repositories.AuditLogRepository,
+	transactor repositories.Transactor) APIKeyService {
+	return &apiKeyServiceImpl{
+		APIKeyRepo:   apiKeyRepo,
+		UserRepo:     userRepo,
+		StoreRepo:    storeRepo,
+		AuditLogRepo: auditLogRepo,
+		Transactor:   transactor,
+	}
+}
+
+func (s *apiKeyServiceImpl) CreateServiceAccount(ctx context.Context, actor *models.User, name, displayName string) (*models.User, error) {
+	if !serviceAccountNamePattern.MatchString(name) {
+		return nil, ErrInvalidServiceAccountName
+	}
+
+	email := name + "@" + serviceAccountEmailDomain
+	if _, err := s.UserRepo.FindByEmail(ctx, email); err == nil {
+		return nil, ErrServiceAccountExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if displayName == "" {
+		displayName = name
+	}
+	var user *models.User
+	err := s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.UserRepo.Save(ctx, &models.User{
+			Email:          email,
+			Name:           displayName,
+			Role:           models.RoleUser,
+			ServiceAccount: true,
+		})
+		if err != nil {
+			return err
+		}
+		return writeAuditLog(ctx, s.AuditLogRepo, actor, "service_account.create", models.AuditTargetUser, user.ID, map[string]interface{}{"name": name})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *apiKeyServiceImpl) ListServiceAccounts(ctx context.Context) ([]*models.User, error) {
+	return s.UserRepo.FindServiceAccounts(ctx)
+}
+
+func (s *apiKeyServiceImpl) CreateKey(ctx context.Context, actor *models.User, userID int64, input CreateAPIKeyInput) (*NewAPIKey, error) {
+	user, err := s.UserRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.ServiceAccount {
+		return nil, ErrNotServiceAccount
+	}
+	if len(input.Permissions) == 0 {
+		return nil, ErrInvalidPermission
+	}
+	for _, p := range input.Permissions {
+		if !p.IsValid() {
+			return nil, ErrInvalidPermission
+		}
+	}
+	if input.StoreID != nil {
+		// 全局的权限（譬如user:manage）不受店铺范围限制，不能给只能访问一个店的key
+		for _, p := range input.Permissions {
+			if !p.IsStoreScoped() {
+				return nil, ErrStoreKeyPermission
+			}
+		}
+		if _, err := s.StoreRepo.FindByID(ctx, *input.StoreID); err != nil {
+			return nil, err
+		}
+	}
+
+	key := &models.APIKey{
+		UserID:      userID,
+		Name:        input.Name,
+		Permissions: input.Permissions,
+		StoreID:     input.StoreID,
+		ExpiresAt:   input.ExpiresAt,
+		CreatedBy:   actor.ID,
+	}
+	var newKey *NewAPIKey
+	err = s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		if newKey, err = s.issue(ctx, key); err != nil {
+			return err
+		}
+		return writeAuditLog(ctx, s.AuditLogRepo, actor, "api_key.create", models.AuditTargetAPIKey, key.ID, map[string]interface{}{
+			"user_id": userID, "prefix": key.Prefix, "permissions": key.Permissions, "store_id": key.StoreID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newKey, nil
+}
+
+func (s *apiKeyServiceImpl) ListKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	return s.APIKeyRepo.FindByUserID(ctx, userID)
+}
+
+func (s *apiKeyServiceImpl) RotateKey(ctx context.Context, actor *models.User, keyID int64, gracePeriod time.Duration) (*NewAPIKey, error) {
+	old, err := s.APIKeyRepo.FindByID(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if !old.IsActive() {
+		return nil, ErrAPIKeyRevoked
+	}
+
+	var newKey *NewAPIKey
+	err = s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		newKey, err = s.issue(ctx, &models.APIKey{
+			UserID:      old.UserID,
+			Name:        old.Name,
+			Permissions: old.Permissions,
+			StoreID:     old.StoreID,
+			ExpiresAt:   old.ExpiresAt,
+			CreatedBy:   actor.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if gracePeriod <= 0 {
+			old.RevokedAt = &now
+		} else if deadline := now.Add(gracePeriod); old.ExpiresAt == nil || deadline.Before(*old.ExpiresAt) {
+			old.ExpiresAt = &deadline
+		}
+		if err := s.APIKeyRepo.Save(ctx, old); err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, s.AuditLogRepo, actor, "api_key.rotate", models.AuditTargetAPIKey, old.ID, map[string]interface{}{
+			"new_key_id": newKey.ID, "grace_period": gracePeriod.String(),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newKey, nil
+}
+
+func (s *apiKeyServiceImpl) RevokeKey(ctx context.Context, actor *models.User, keyID int64) (*models.APIKey, error) {
+	key, err := s.APIKeyRepo.FindByID(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	err = s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.APIKeyRepo.Save(ctx, key); err != nil {
+			return err
+		}
+		return writeAuditLog(ctx, s.AuditLogRepo, actor, "api_key.revoke", models.AuditTargetAPIKey, key.ID, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *apiKeyServiceImpl) Authenticate(ctx context.Context, rawKey string) (*models.User, *models.APIKey, error) {
+	parts := strings.Split(rawKey, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.APIKeyRepo.FindByPrefix(ctx, parts[0]+"_"+parts[1])
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(rawKey)), []byte(key.Hash)) != 1 || !key.IsActive() {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.UserRepo.GetByID(ctx, key.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.ServiceAccount {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyLastUsedResolution {
+		if err := s.APIKeyRepo.UpdateLastUsedAt(ctx, key.ID, now); err != nil {
+			log.WithContext(ctx).Errorf("Errors in updating last used time of api key %v, err: \n%v", key.Prefix, err)
+		}
+		key.LastUsedAt = &now
+	}
+	return user, key, nil
+}
+
+// issue 生成明文key，保存它的hash。明文的格式是 atomi_<prefix>_<secret>。
+func (s *apiKeyServiceImpl) issue(ctx context.Context, key *models.APIKey) (*NewAPIKey, error) {
+	prefix := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	key.Prefix = apiKeyPrefix + "_" + hex.EncodeToString(prefix)
+	rawKey := key.Prefix + "_" + hex.EncodeToString(secret)
+	key.Hash = hashSecret(rawKey)
+	if err := s.APIKeyRepo.Save(ctx, key); err != nil {
+		return nil, err
+	}
+	return &NewAPIKey{APIKey: key, Key: rawKey}, nil
+}
+
+// hashSecret 是API key和邀请token保存在库里的形式，库里只有hash，泄露了也不能拿来用。
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+)
+
+// writeAuditLog 写审计日志。要在修改的同一个事务里调用（见repositories.Transactor），写失败的时候整个修改回滚。
+func writeAuditLog(ctx context.Context, repo repositories.AuditLogRepository, actor *models.User, action, targetType string, targetID int64, details map[string]interface{}) error {
+	detailsJSON := []byte("{}")
+	if details != nil {
+		var err error
+		if detailsJSON, err = json.Marshal(details); err != nil {
+			return err
+		}
+	}
+
+	return repo.Save(ctx, &models.AuditLog{
+		ActorID:    actor.ID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    string(detailsJSON),
+	})
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/spf13/viper"
+)
+
+var ErrFXRateNotFound = errors.New("no exchange rate for the currency")
+
+// FXRateProvider 提供汇率，只用在报表里把不同币种的金额换算成同一个币种，结账不换算。
+type FXRateProvider interface {
+	// Rate 返回at的时候1个from换多少个to。
+	Rate(ctx context.Context, from, to string, at time.Time) (float64, error)
+}
+
+// staticFXRateProvider 是配置文件里的固定汇率，接入真正的汇率服务之前先用着，忽略时间。
+// fxRates 是每个币种换成1个 reportingCurrency 的汇率，比如 {CAD: 0.73, EUR: 1.08}。
+type staticFXRateProvider struct{}
+
+func NewFXRateProvider() FXRateProvider {
+	return &staticFXRateProvider{}
+}
+
+func (p *staticFXRateProvider) Rate(ctx context.Context, from, to string, at time.Time) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return 1, nil
+	}
+	fromRate, err := baseRate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := baseRate(to)
+	if err != nil {
+		return 0, err
+	}
+	return fromRate / toRate, nil
+}
+
+func baseRate(currency string) (float64, error) {
+	if strings.EqualFold(currency, ReportingCurrency()) {
+		return 1, nil
+	}
+	// 配置文件里读出来的map key会被viper转成小写
+	for key, value := range viper.GetStringMap("fxRates") {
+		if !strings.EqualFold(key, currency) {
+			continue
+		}
+		if rate, ok := value.(float64); ok && rate > 0 {
+			return rate, nil
+		}
+		if rate, ok := value.(int); ok && rate > 0 {
+			return float64(rate), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %v", ErrFXRateNotFound, currency)
+}
+
+// ReportingCurrency 是报表合计用的币种，默认USD。
+func ReportingCurrency() string {
+	if currency := viper.GetString("reportingCurrency"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return models.DefaultCurrency
+}
+
+// ConvertMoney 按at的汇率把amount换算成currency。
+func ConvertMoney(ctx context.Context, provider FXRateProvider, amount models.Money, currency string, at time.Time) (models.Money, error) {
+	rate, err := provider.Rate(ctx, amount.Currency, currency, at)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return amount.Convert(rate, currency), nil
+}
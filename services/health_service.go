@@ -0,0 +1,60 @@
+package services
+
+import (
+	"time"
+
+	"github.com/atomi-ai/atomi/utils"
+	"gorm.io/gorm"
+)
+
+// NewHealthRegistry 注册所有依赖的健康检查。除了DB，其他组件只有实现了utils.HealthChecker才会被检查（测试里的mock没有实现）。
+// 外部服务默认不是critical的：Stripe或者Uber出问题的时候所有实例都一样，把实例摘掉也没用，只在报告里显示degraded。
+func NewHealthRegistry(
+	db *gorm.DB,
+	authenticator utils.Authenticator,
+	blobStorage utils.BlobStorage,
+	stripeWrapper utils.StripeWrapper,
+	uberService UberService,
+	userExportService UserExportService) utils.HealthRegistry {
+	registry := utils.NewHealthRegistry()
+	registry.Register(utils.HealthCheck{
+		Name:     "database",
+		Check:    utils.DBHealthCheck(db),
+		Timeout:  time.Second,
+		CacheTTL: 2 * time.Second,
+		Critical: true,
+	})
+
+	optional := []struct {
+		name      string
+		component interface{}
+		timeout   time.Duration
+		cacheTTL  time.Duration
+	}{
+		{"stripe", stripeWrapper, 3 * time.Second, time.Minute},
+		{"uber", uberService, 3 * time.Second, time.Minute},
+		// 每次检查都要上传下载一个文件，间隔长一点
+		{"blob_storage", blobStorage, 8 * time.Second, 5 * time.Minute},
+		{"firebase", authenticator, 3 * time.Second, 5 * time.Minute},
+	}
+	for _, o := range optional {
+		if checker, ok := o.component.(utils.HealthChecker); ok {
+			registry.Register(utils.HealthCheck{
+				Name:     o.name,
+				Check:    checker.CheckHealth,
+				Timeout:  o.timeout,
+				CacheTTL: o.cacheTTL,
+			})
+		}
+	}
+
+	// 导出卡住的时候只显示degraded：重启进程会丢掉正在生成的导出，摘掉实例也没有用
+	if checker, ok := userExportService.(utils.HealthChecker); ok {
+		registry.Register(utils.HealthCheck{
+			Name:     "user_export_worker",
+			Check:    checker.CheckHealth,
+			CacheTTL: -1,
+		})
+	}
+	return registry
+}
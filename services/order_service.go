@@ -1,19 +1,56 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/repositories"
+	"github.com/atomi-ai/atomi/utils"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrInvalidCheckout 是结账时的送货方式、收货人不对，或者订单不是送货的
+	ErrInvalidCheckout = errors.New("invalid checkout")
+	// ErrOrderAlreadyPaid 是订单已经有PaymentIntent了，不能再付一次
+	ErrOrderAlreadyPaid = errors.New("order has already been paid")
+)
+
+// CheckoutContact 是结账时选的送货方式和收货人。Address是用户自己的收货地址，送货的时候必须有；
+// 收货人、电话和说明没有传的时候用用户和地址上的。
+type CheckoutContact struct {
+	Fulfillment   models.FulfillmentType
+	Address       *models.Address
+	RecipientName string
+	Phone         string
+	Notes         string
+}
+
 type OrderService interface {
-	GetUserOrders(userID int64) ([]models.Order, error)
-	AddOrderForUser(user *models.User, order *models.Order) (*models.Order, error)
-	FindOrderByID(orderID int64) (*models.Order, error)
-	UpdatePaymentIntentID(orderID int64, paymentIntentID string) (*models.Order, error)
-	UpdateDeliveryID(orderID int64, deliveryID string) (*models.Order, error)
+	GetUserOrders(ctx context.Context, userID int64) ([]models.Order, error)
+	AddOrderForUser(ctx context.Context, user *models.User, order *models.Order) (*models.Order, error)
+	FindOrderByID(ctx context.Context, orderID int64) (*models.Order, error)
+	UpdatePaymentIntentID(ctx context.Context, orderID int64, paymentIntentID string) (*models.Order, error)
+	UpdateDeliveryID(ctx context.Context, orderID int64, deliveryID string) (*models.Order, error)
+	// CalculateTax 按收货地址计算用户自己的订单的税并保存，支付之前都可以重新算。
+	// 订单的商品和运费要用店的币种，不一样的时候返回ErrCurrencyMismatch。
+	CalculateTax(ctx context.Context, user *models.User, orderID int64, address *models.Address) (*models.Order, error)
+	// PriceDelivery 按店和收货地址向Uber要报价，把报价的运费保存到用户自己的订单上并返回报价。
+	// address是nil（自取）的时候运费是0，不要报价。运费只由服务端设置，已经付过款的订单返回ErrOrderAlreadyPaid。
+	PriceDelivery(ctx context.Context, user *models.User, orderID int64, address *models.Address) (*models.Order, *models.QuoteResponse, error)
+	// CaptureContact 把送货方式、地址和收货人的快照保存到用户自己的订单上，已经付过款的订单不再改变，直接返回。
+	CaptureContact(ctx context.Context, user *models.User, orderID int64, contact *CheckoutContact) (*models.Order, error)
+	// BuildDeliveryData 按订单的快照和店的信息生成Uber的DeliveryData，不用客户端传的。
+	BuildDeliveryData(ctx context.Context, order *models.Order) (*models.DeliveryData, error)
+	// MarkPaid 记录付款成功的时间，已经记录过的不再更新。
+	MarkPaid(ctx context.Context, paymentIntentID string, paidAt time.Time) error
+	// RecordRefund 记录PaymentIntent累计的退款金额，比已经记录的少的时候忽略。
+	RecordRefund(ctx context.Context, paymentIntentID string, refunded models.Money, refundedAt time.Time) error
 }
 
 type orderService struct {
@@ -21,19 +58,24 @@ type orderService struct {
 	OrderItemRepo repositories.OrderItemRepository
 	StripeService StripeService
 	UberService   UberService
+	TaxService    TaxCalculationService
+	StoreRepo     repositories.StoreRepository
 }
 
-func NewOrderService(orderRepo repositories.OrderRepository, orderItemRepo repositories.OrderItemRepository, stripeService StripeService, uberService UberService) OrderService {
+func NewOrderService(orderRepo repositories.OrderRepository, orderItemRepo repositories.OrderItemRepository, stripeService StripeService,
+	uberService UberService, taxService TaxCalculationService, storeRepo repositories.StoreRepository) OrderService {
 	return &orderService{
 		OrderRepo:     orderRepo,
 		OrderItemRepo: orderItemRepo,
 		StripeService: stripeService,
 		UberService:   uberService,
+		TaxService:    taxService,
+		StoreRepo:     storeRepo,
 	}
 }
 
-func (os *orderService) GetUserOrders(userID int64) ([]models.Order, error) {
-	orders, err := os.OrderRepo.FindByUserID(userID)
+func (os *orderService) GetUserOrders(ctx context.Context, userID int64) ([]models.Order, error) {
+	orders, err := os.OrderRepo.FindByUserID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +86,7 @@ func (os *orderService) GetUserOrders(userID int64) ([]models.Order, error) {
 			continue
 		}
 
-		paymentIntent, err := os.StripeService.RetrievePaymentIntent(*orders[i].PaymentIntentID)
+		paymentIntent, err := os.StripeService.RetrievePaymentIntent(ctx, *orders[i].PaymentIntentID)
 		if err != nil {
 			return nil, err
 		}
@@ -62,7 +104,7 @@ func (os *orderService) GetUserOrders(userID int64) ([]models.Order, error) {
 		}
 
 		deliveryID := *orders[i].DeliveryID
-		deliveryResponse, err := os.UberService.GetDelivery(deliveryID)
+		deliveryResponse, err := os.UberService.GetDelivery(ctx, deliveryID)
 		if err != nil {
 			return nil, err
 		}
@@ -81,30 +123,36 @@ func processOrderItems(orderItems []models.OrderItem) {
 	}
 }
 
-func (os *orderService) AddOrderForUser(user *models.User, order *models.Order) (*models.Order, error) {
+func (os *orderService) AddOrderForUser(ctx context.Context, user *models.User, order *models.Order) (*models.Order, error) {
 	if order.UserID == 0 {
 		order.UserID = user.ID
 	}
 
 	processOrderItems(order.OrderItems)
-	err := os.OrderRepo.Save(order)
+	// 税和运费由服务端在支付之前计算，付款和退款的状态由支付流程更新
+	order.DeliveryFee = models.Money{}
+	order.ClearTax()
+	order.ClearContact()
+	order.PaidAt, order.Refunded, order.RefundedAt = nil, models.Money{}, nil
+	err := os.OrderRepo.Save(ctx, order)
 	if err != nil {
 		return nil, err
 	}
 
 	for i := range order.OrderItems {
 		order.OrderItems[i].OrderID = order.ID
-		err := os.OrderItemRepo.Save(&order.OrderItems[i])
+		err := os.OrderItemRepo.Save(ctx, &order.OrderItems[i])
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	utils.OrdersCreatedTotal.Inc()
 	return order, nil
 }
 
-func (os *orderService) FindOrderByID(orderID int64) (*models.Order, error) {
-	order, err := os.OrderRepo.GetByID(orderID)
+func (os *orderService) FindOrderByID(ctx context.Context, orderID int64) (*models.Order, error) {
+	order, err := os.OrderRepo.GetByID(ctx, orderID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -114,8 +162,8 @@ func (os *orderService) FindOrderByID(orderID int64) (*models.Order, error) {
 	return order, nil
 }
 
-func (os *orderService) UpdatePaymentIntentID(orderID int64, paymentIntentID string) (*models.Order, error) {
-	order, err := os.OrderRepo.GetByID(orderID)
+func (os *orderService) UpdatePaymentIntentID(ctx context.Context, orderID int64, paymentIntentID string) (*models.Order, error) {
+	order, err := os.OrderRepo.GetByID(ctx, orderID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("ORDER NOT FOUND")
@@ -124,7 +172,7 @@ func (os *orderService) UpdatePaymentIntentID(orderID int64, paymentIntentID str
 	}
 
 	order.PaymentIntentID = &paymentIntentID
-	err = os.OrderRepo.Save(order)
+	err = os.OrderRepo.Save(ctx, order)
 	if err != nil {
 		return nil, err
 	}
@@ -132,8 +180,8 @@ func (os *orderService) UpdatePaymentIntentID(orderID int64, paymentIntentID str
 	return order, nil
 }
 
-func (os *orderService) UpdateDeliveryID(orderID int64, deliveryID string) (*models.Order, error) {
-	order, err := os.OrderRepo.GetByID(orderID)
+func (os *orderService) UpdateDeliveryID(ctx context.Context, orderID int64, deliveryID string) (*models.Order, error) {
+	order, err := os.OrderRepo.GetByID(ctx, orderID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("ORDER NOT FOUND")
@@ -142,10 +190,247 @@ func (os *orderService) UpdateDeliveryID(orderID int64, deliveryID string) (*mod
 	}
 
 	order.DeliveryID = &deliveryID
-	err = os.OrderRepo.Save(order)
+	err = os.OrderRepo.Save(ctx, order)
 	if err != nil {
 		return nil, err
 	}
 
 	return order, nil
 }
+
+func (os *orderService) CalculateTax(ctx context.Context, user *models.User, orderID int64, address *models.Address) (*models.Order, error) {
+	order, err := os.OrderRepo.GetByID(ctx, orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && order.UserID != user.ID) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if order.PaymentIntentID != nil && *order.PaymentIntentID != "" {
+		// 已经付过款的订单税额不能再变
+		return order, nil
+	}
+
+	if err = os.checkStoreCurrency(ctx, order); err != nil {
+		return nil, err
+	}
+	if err = os.TaxService.CalculateOrderTax(ctx, user, order, address); err != nil {
+		return nil, err
+	}
+	if err = os.OrderRepo.SaveWithItems(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (os *orderService) PriceDelivery(ctx context.Context, user *models.User, orderID int64, address *models.Address) (*models.Order, *models.QuoteResponse, error) {
+	order, err := os.OrderRepo.GetByID(ctx, orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && order.UserID != user.ID) {
+		return nil, nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.PaymentIntentID != nil && *order.PaymentIntentID != "" {
+		return nil, nil, ErrOrderAlreadyPaid
+	}
+
+	var quote *models.QuoteResponse
+	fee := models.Money{}
+	if address != nil {
+		store, err := os.StoreRepo.FindByID(ctx, order.StoreID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrStoreNotFound
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		pickup := &models.Address{Line1: store.Address, City: store.City, State: store.State, PostalCode: store.ZipCode}
+		request := &models.QuoteRequest{PickupAddress: pickup.OneLine()}
+		request.SetDropoff(address)
+		if quote, err = os.UberService.Quote(ctx, request); err != nil {
+			return nil, nil, err
+		}
+		fee = quote.FeeMoney()
+	}
+
+	order.DeliveryFee = fee
+	if err = os.OrderRepo.Save(ctx, order); err != nil {
+		return nil, nil, err
+	}
+	return order, quote, nil
+}
+
+// checkStoreCurrency 检查订单的商品和运费都是店的币种。没有指定店的订单（以前的订单）不检查。
+func (os *orderService) checkStoreCurrency(ctx context.Context, order *models.Order) error {
+	if order.StoreID == 0 {
+		return nil
+	}
+	store, err := os.StoreRepo.FindByID(ctx, order.StoreID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrStoreNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// 没有币种的运费就是店的币种
+	if order.DeliveryFee.Currency == "" {
+		order.DeliveryFee.Currency = store.Currency
+	}
+	if order.DeliveryFee.Currency != store.Currency {
+		return fmt.Errorf("%w: delivery fee in %v, store %d uses %v", models.ErrCurrencyMismatch, order.DeliveryFee.Currency, store.ID, store.Currency)
+	}
+	for _, item := range order.OrderItems {
+		if item.Product != nil && item.Product.Price.Currency != store.Currency {
+			return fmt.Errorf("%w: product %d is priced in %v, store %d uses %v", models.ErrCurrencyMismatch, item.ProductID,
+				item.Product.Price.Currency, store.ID, store.Currency)
+		}
+	}
+	return nil
+}
+
+func (os *orderService) CaptureContact(ctx context.Context, user *models.User, orderID int64, contact *CheckoutContact) (*models.Order, error) {
+	order, err := os.OrderRepo.GetByID(ctx, orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && order.UserID != user.ID) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if order.PaymentIntentID != nil && *order.PaymentIntentID != "" {
+		// 下单之后收货地址和收货人不能再变
+		return order, nil
+	}
+
+	var snapshot models.OrderContact
+	switch contact.Fulfillment {
+	case models.FulfillmentDelivery:
+		address := contact.Address
+		if address == nil {
+			return nil, fmt.Errorf("%w: delivery needs a shipping address", ErrInvalidCheckout)
+		}
+		snapshot = models.OrderContact{Line1: address.Line1, Line2: address.Line2, City: address.City, State: address.State,
+			Country: address.Country, PostalCode: address.PostalCode, Latitude: address.Latitude, Longitude: address.Longitude,
+			Phone: address.Phone, Notes: address.DeliveryInstructions}
+	case models.FulfillmentPickup:
+		store, err := os.StoreRepo.FindByID(ctx, order.StoreID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStoreNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		snapshot = models.OrderContact{Line1: store.Address, City: store.City, State: store.State, PostalCode: store.ZipCode}
+	default:
+		return nil, fmt.Errorf("%w: unknown fulfillment %q", ErrInvalidCheckout, contact.Fulfillment)
+	}
+
+	snapshot.Name = firstNonEmpty(normalizeSpaces(contact.RecipientName), user.Name)
+	phone, ok := normalizePhone(firstNonEmpty(contact.Phone, snapshot.Phone, user.Phone))
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is not a US phone number", ErrInvalidCheckout, contact.Phone)
+	}
+	snapshot.Phone = phone
+	snapshot.Notes = firstNonEmpty(strings.TrimSpace(contact.Notes), snapshot.Notes)
+	if len([]rune(snapshot.Notes)) > maxDeliveryInstructionsLength {
+		return nil, fmt.Errorf("%w: notes must be at most %d characters", ErrInvalidCheckout, maxDeliveryInstructionsLength)
+	}
+
+	now := time.Now()
+	order.Fulfillment, order.Contact, order.ContactCapturedAt = contact.Fulfillment, snapshot, &now
+	if err = os.OrderRepo.SaveWithItems(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (os *orderService) BuildDeliveryData(ctx context.Context, order *models.Order) (*models.DeliveryData, error) {
+	if order.ContactCapturedAt == nil || order.Fulfillment != models.FulfillmentDelivery {
+		return nil, fmt.Errorf("%w: order %d is not a delivery order", ErrInvalidCheckout, order.ID)
+	}
+	store, err := os.StoreRepo.FindByID(ctx, order.StoreID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrStoreNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pickup := &models.Address{Line1: store.Address, City: store.City, State: store.State, PostalCode: store.ZipCode}
+	reference := fmt.Sprintf("order-%d", order.ID)
+	total := int(order.Subtotal.Amount)
+	data := &models.DeliveryData{
+		PickupAddress:      pickup.OneLine(),
+		PickupName:         store.Name,
+		PickupPhoneNumber:  store.Phone,
+		DropoffName:        order.Contact.Name,
+		ManifestReference:  &reference,
+		ManifestTotalValue: &total,
+	}
+	data.SetDropoff(order.Contact.Address())
+
+	size := models.SizeSmall
+	for _, item := range order.OrderItems {
+		name := fmt.Sprintf("Product %d", item.ProductID)
+		if item.Product != nil {
+			name = item.Product.Name
+		}
+		price := int(item.UnitPrice.Amount)
+		data.ManifestItems = append(data.ManifestItems, models.ManifestItem{Name: name, Quantity: int(item.Quantity), Size: &size, Price: &price})
+	}
+	return data, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (os *orderService) MarkPaid(ctx context.Context, paymentIntentID string, paidAt time.Time) error {
+	order, err := os.OrderRepo.FindByPaymentIntentID(ctx, paymentIntentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOrderNotFound
+	}
+	if err != nil || order.PaidAt != nil {
+		return err
+	}
+
+	// 支付接口和webhook可能同时记录，只有真正改了的那次计数
+	updated, err := os.OrderRepo.SetPaidAt(ctx, order.ID, paidAt)
+	if err != nil {
+		return err
+	}
+	if updated {
+		utils.OrdersPaidTotal.Inc()
+	}
+	return nil
+}
+
+func (os *orderService) RecordRefund(ctx context.Context, paymentIntentID string, refunded models.Money, refundedAt time.Time) error {
+	order, err := os.OrderRepo.FindByPaymentIntentID(ctx, paymentIntentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// 累计退款只会增加，Stripe的事件可能乱序到达，晚到的旧事件不能把金额改小
+	if refunded.Amount <= order.Refunded.Amount {
+		return nil
+	}
+
+	firstRefund := order.Refunded.IsZero()
+	order.Refunded = refunded
+	order.RefundedAt = &refundedAt
+	if err := os.OrderRepo.Save(ctx, order); err != nil {
+		return err
+	}
+	if firstRefund {
+		utils.OrdersRefundedTotal.Inc()
+	}
+	return nil
+}
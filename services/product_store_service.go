@@ -1,34 +1,46 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/repositories"
+	"gorm.io/gorm"
 )
 
+var ErrStoreNotFound = errors.New("store not found")
+
 // ProductStoreService interface
 type ProductStoreService interface {
-	ConnectStoreAndProducts(store *models.Store, products []*models.Product) error
-	CreateProductInStore(user *models.User, storeID int64, product *models.Product) (*models.Product, error)
+	ConnectStoreAndProducts(ctx context.Context, store *models.Store, products []*models.Product) error
+	// CreateProductInStore 创建商品并上架，没有币种的价格用店的币种，和店的币种不一样的返回ErrCurrencyMismatch。
+	CreateProductInStore(ctx context.Context, user *models.User, storeID int64, product *models.Product) (*models.Product, error)
+	// AddProductToStore 把已有的商品上架，商品要用店的币种定价。
+	AddProductToStore(ctx context.Context, storeID, productID int64) error
 }
 
 // productStoreServiceImpl represents the implementation of ProductStoreService
 type productStoreServiceImpl struct {
 	productStoreRepository repositories.ProductStoreRepository
 	productRepository      repositories.ProductRepository
+	storeRepository        repositories.StoreRepository
 }
 
 // NewProductStoreService creates a new ProductStoreService instance
-func NewProductStoreService(productRepository repositories.ProductRepository, productStoreRepo repositories.ProductStoreRepository) ProductStoreService {
+func NewProductStoreService(productRepository repositories.ProductRepository, productStoreRepo repositories.ProductStoreRepository,
+	storeRepository repositories.StoreRepository) ProductStoreService {
 	return &productStoreServiceImpl{
 		productRepository:      productRepository,
 		productStoreRepository: productStoreRepo,
+		storeRepository:        storeRepository,
 	}
 }
 
 // ConnectStoreAndProducts connects a store with a list of products
-func (s *productStoreServiceImpl) ConnectStoreAndProducts(store *models.Store, products []*models.Product) error {
+func (s *productStoreServiceImpl) ConnectStoreAndProducts(ctx context.Context, store *models.Store, products []*models.Product) error {
 	productStores := make([]*models.ProductStore, len(products))
 
 	for i, product := range products {
@@ -41,18 +53,59 @@ func (s *productStoreServiceImpl) ConnectStoreAndProducts(store *models.Store, p
 		productStores[i] = productStore
 	}
 
-	return s.productStoreRepository.SaveAll(productStores)
+	return s.productStoreRepository.SaveAll(ctx, productStores)
 }
 
-func (s *productStoreServiceImpl) CreateProductInStore(user *models.User, storeID int64, product *models.Product) (*models.Product, error) {
+func (s *productStoreServiceImpl) CreateProductInStore(ctx context.Context, user *models.User, storeID int64, product *models.Product) (*models.Product, error) {
+	store, err := s.findStore(ctx, storeID)
+	if err != nil {
+		return nil, err
+	}
+	if product.Price.Currency == "" {
+		product.Price.Currency = store.Currency
+	}
+	if err = checkStoreCurrency(store, product); err != nil {
+		return nil, err
+	}
+
 	product.CreatorID = user.ID
-	if err := s.productRepository.Save(product); err != nil {
+	if err := s.productRepository.Save(ctx, product); err != nil {
 		return nil, err
 	}
 
-	if err := s.productStoreRepository.AddProductToStore(storeID, product.ID); err != nil {
+	if err := s.productStoreRepository.AddProductToStore(ctx, storeID, product.ID); err != nil {
 		return nil, err
 	}
 
 	return product, nil
 }
+
+func (s *productStoreServiceImpl) AddProductToStore(ctx context.Context, storeID, productID int64) error {
+	store, err := s.findStore(ctx, storeID)
+	if err != nil {
+		return err
+	}
+	product, err := s.productRepository.FindByID(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if err = checkStoreCurrency(store, product); err != nil {
+		return err
+	}
+	return s.productStoreRepository.AddProductToStore(ctx, storeID, productID)
+}
+
+func (s *productStoreServiceImpl) findStore(ctx context.Context, storeID int64) (*models.Store, error) {
+	store, err := s.storeRepository.FindByID(ctx, storeID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrStoreNotFound
+	}
+	return store, err
+}
+
+func checkStoreCurrency(store *models.Store, product *models.Product) error {
+	if product.Price.Currency != store.Currency {
+		return fmt.Errorf("%w: product is priced in %v, store %d uses %v", models.ErrCurrencyMismatch, product.Price.Currency, store.ID, store.Currency)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	"github.com/atomi-ai/atomi/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const defaultStoreInvitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidEmail            = errors.New("invalid email")
+	ErrInvitationNotPending    = errors.New("invitation is not pending")
+	ErrInvitationExpired       = errors.New("invitation has expired")
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email")
+)
+
+// StoreMember 是店员列表里的一项，已经加入的店员和还没接受的邀请都用它表示。
+type StoreMember struct {
+	UserID       *int64                       `json:"user_id,omitempty"`
+	InvitationID *int64                       `json:"invitation_id,omitempty"`
+	Email        string                       `json:"email"`
+	Name         string                       `json:"name,omitempty"`
+	Relationship models.StoreRelationship     `json:"relationship"`
+	Status       models.StoreInvitationStatus `json:"status"`
+	ExpiresAt    *time.Time                   `json:"expires_at,omitempty"`
+}
+
+type StoreInvitationService interface {
+	Invite(ctx context.Context, inviter *models.User, storeID int64, email string, relationship models.StoreRelationship) (*models.StoreInvitation, error)
+	// Accept 用邀请里的token接受邀请，邀请的email必须和当前用户一致。
+	Accept(ctx context.Context, user *models.User, token string) (*models.StoreInvitation, error)
+	// AcceptPending 接受所有发给这个用户email的邀请，在用户第一次注册和登录的时候调用。
+	// 只有principal里的email验证过并且就是用户的email的时候才自动接受，否则要用token调Accept。
+	AcceptPending(ctx context.Context, user *models.User, principal *utils.Principal) ([]models.StoreInvitation, error)
+	Revoke(ctx context.Context, storeID, invitationID int64) (*models.StoreInvitation, error)
+	// ListMembers 返回店里所有的店员和还没接受的邀请。
+	ListMembers(ctx context.Context, storeID int64) ([]StoreMember, error)
+}
+
+type storeInvitationServiceImpl struct {
+	InvitationRepo repositories.StoreInvitationRepository
+	MembershipRepo repositories.StoreMembershipRepository
+	StoreRepo      repositories.StoreRepository
+	Notifier       utils.Notifier
+}
+
+func NewStoreInvitationService(
+	invitationRepo repositories.StoreInvitationRepository,
+	membershipRepo repositories.StoreMembershipRepository,
+	storeRepo repositories.StoreRepository,
+	notifier utils.Notifier) StoreInvitationService {
+	return &storeInvitationServiceImpl{
+		InvitationRepo: invitationRepo,
+		MembershipRepo: membershipRepo,
+		StoreRepo:      storeRepo,
+		Notifier:       notifier,
+	}
+}
+
+func (s *storeInvitationServiceImpl) Invite(ctx context.Context, inviter *models.User, storeID int64, email string, relationship models.StoreRelationship) (*models.StoreInvitation, error) {
+	email = normalizeEmail(email)
+	if !strings.Contains(email, "@") {
+		return nil, ErrInvalidEmail
+	}
+	if !relationship.IsStaff() {
+		return nil, ErrInvalidRole
+	}
+	store, err := s.StoreRepo.FindByID(ctx, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一个店对同一个email只保留最新的一个邀请。
+	pending, err := s.InvitationRepo.FindPendingByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pending {
+		if pending[i].StoreID != storeID {
+			continue
+		}
+		pending[i].Status = models.StoreInvitationStatusRevoked
+		if err := s.InvitationRepo.Save(ctx, &pending[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	invitation := &models.StoreInvitation{
+		StoreID:      storeID,
+		Email:        email,
+		Relationship: relationship,
+		Token:        hex.EncodeToString(token),
+		TokenHash:    hashSecret(hex.EncodeToString(token)),
+		Status:       models.StoreInvitationStatusPending,
+		InvitedBy:    inviter.ID,
+		ExpiresAt:    time.Now().Add(storeInvitationTTL()),
+	}
+	if err := s.InvitationRepo.Save(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("You have been invited to join %v as %v. Sign in with this email once it is verified to accept, or use the invitation code %v before %v.",
+		store.Name, relationship, invitation.Token, invitation.ExpiresAt.Format(time.RFC3339))
+	if err := s.Notifier.Notify(ctx, email, "You have been invited to join "+store.Name, message); err != nil {
+		log.WithContext(ctx).Errorf("Errors in notifying invitation %v, err: \n%v", invitation.ID, err)
+	}
+	return invitation, nil
+}
+
+func (s *storeInvitationServiceImpl) Accept(ctx context.Context, user *models.User, token string) (*models.StoreInvitation, error) {
+	invitation, err := s.InvitationRepo.FindByTokenHash(ctx, hashSecret(token))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.accept(ctx, user, invitation); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (s *storeInvitationServiceImpl) AcceptPending(ctx context.Context, user *models.User, principal *utils.Principal) ([]models.StoreInvitation, error) {
+	if !principal.EmailVerified || !strings.EqualFold(normalizeEmail(principal.Email), normalizeEmail(user.Email)) {
+		return nil, nil
+	}
+	pending, err := s.InvitationRepo.FindPendingByEmail(ctx, normalizeEmail(user.Email))
+	if err != nil {
+		return nil, err
+	}
+
+	var accepted []models.StoreInvitation
+	for i := range pending {
+		err := s.accept(ctx, user, &pending[i])
+		// 已经是这个店的店员了，邀请留着等店主处理
+		if errors.Is(err, ErrInvitationExpired) || errors.Is(err, models.ErrAlreadyStaff) {
+			continue
+		}
+		if err != nil {
+			return accepted, err
+		}
+		accepted = append(accepted, pending[i])
+	}
+	return accepted, nil
+}
+
+func (s *storeInvitationServiceImpl) accept(ctx context.Context, user *models.User, invitation *models.StoreInvitation) error {
+	if invitation.Status != models.StoreInvitationStatusPending {
+		return ErrInvitationNotPending
+	}
+	if invitation.IsExpired() {
+		invitation.Status = models.StoreInvitationStatusExpired
+		if err := s.InvitationRepo.Save(ctx, invitation); err != nil {
+			log.WithContext(ctx).Errorf("Errors in expiring invitation %v, err: \n%v", invitation.ID, err)
+		}
+		return ErrInvitationExpired
+	}
+	if !strings.EqualFold(invitation.Email, normalizeEmail(user.Email)) {
+		return ErrInvitationEmailMismatch
+	}
+
+	if err := s.MembershipRepo.AddStaff(ctx, invitation.StoreID, user.ID, invitation.Relationship); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	invitation.Status = models.StoreInvitationStatusAccepted
+	invitation.AcceptedBy = &user.ID
+	invitation.AcceptedAt = &now
+	return s.InvitationRepo.Save(ctx, invitation)
+}
+
+func (s *storeInvitationServiceImpl) Revoke(ctx context.Context, storeID, invitationID int64) (*models.StoreInvitation, error) {
+	invitation, err := s.InvitationRepo.FindByID(ctx, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	// 不是这个店的邀请就当作不存在，不暴露别的店的信息。
+	if invitation.StoreID != storeID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if invitation.Status != models.StoreInvitationStatusPending {
+		return nil, ErrInvitationNotPending
+	}
+
+	invitation.Status = models.StoreInvitationStatusRevoked
+	if err := s.InvitationRepo.Save(ctx, invitation); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (s *storeInvitationServiceImpl) ListMembers(ctx context.Context, storeID int64) ([]StoreMember, error) {
+	memberships, err := s.MembershipRepo.FindStaffByStore(ctx, storeID)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := s.InvitationRepo.FindByStoreID(ctx, storeID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]StoreMember, 0, len(memberships)+len(invitations))
+	for i := range memberships {
+		m := &memberships[i]
+		member := StoreMember{
+			UserID:       &m.UserID,
+			Relationship: m.Relationship,
+			Status:       models.StoreInvitationStatusAccepted,
+		}
+		if m.User != nil {
+			member.Email = m.User.Email
+			member.Name = m.User.Name
+		}
+		members = append(members, member)
+	}
+	for i := range invitations {
+		invitation := &invitations[i]
+		if invitation.Status != models.StoreInvitationStatusPending {
+			continue
+		}
+		status := invitation.Status
+		if invitation.IsExpired() {
+			status = models.StoreInvitationStatusExpired
+		}
+		members = append(members, StoreMember{
+			InvitationID: &invitation.ID,
+			Email:        invitation.Email,
+			Relationship: invitation.Relationship,
+			Status:       status,
+			ExpiresAt:    &invitation.ExpiresAt,
+		})
+	}
+	return members, nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func storeInvitationTTL() time.Duration {
+	if ttl := viper.GetDuration("storeInvitationTTL"); ttl > 0 {
+		return ttl
+	}
+	return defaultStoreInvitationTTL
+}
@@ -1,7 +1,11 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/atomi-ai/atomi/models"
 	"github.com/stripe/stripe-go/v74"
@@ -12,14 +16,16 @@ import (
 )
 
 type StripeService interface {
-	CreateStripeCustomer(email string) (string, error)
-	AttachPaymentMethodToCustomer(stripeCustomerID, paymentMethodID string) (*stripe.PaymentMethod, error)
-	DeletePaymentMethod(paymentMethodID string) (*stripe.PaymentMethod, error)
-	ListPaymentMethods(stripeCustomerID string) (*paymentmethod.Iter, error)
-	CreatePaymentIntent(user *models.User, piRequest *models.PaymentIntentRequest, shippingAddr *models.Address) (*stripe.PaymentIntent, error)
-	GetLatestCustomerIDByEmail(email string) (string, error)
-	ListPaymentIntents(stripeCustomerID string) (*paymentintent.Iter, error)
-	RetrievePaymentIntent(intent string) (*stripe.PaymentIntent, error)
+	CreateStripeCustomer(ctx context.Context, email string) (string, error)
+	AttachPaymentMethodToCustomer(ctx context.Context, stripeCustomerID, paymentMethodID string) (*stripe.PaymentMethod, error)
+	DeletePaymentMethod(ctx context.Context, paymentMethodID string) (*stripe.PaymentMethod, error)
+	ListPaymentMethods(ctx context.Context, stripeCustomerID string) (*paymentmethod.Iter, error)
+	// CreatePaymentIntent 创建并确认支付，金额是算过税的order.Total，piRequest里只用payment method。
+	// order的税额明细写在PaymentIntent的metadata里。
+	CreatePaymentIntent(ctx context.Context, user *models.User, piRequest *models.PaymentIntentRequest, shippingAddr *models.Address, order *models.Order) (*stripe.PaymentIntent, error)
+	GetLatestCustomerIDByEmail(ctx context.Context, email string) (string, error)
+	ListPaymentIntents(ctx context.Context, stripeCustomerID string) (*paymentintent.Iter, error)
+	RetrievePaymentIntent(ctx context.Context, intent string) (*stripe.PaymentIntent, error)
 }
 
 type StripeServiceImpl struct {
@@ -32,10 +38,11 @@ func NewStripeService() StripeService {
 	}
 }
 
-func (s *StripeServiceImpl) CreateStripeCustomer(email string) (string, error) {
+func (s *StripeServiceImpl) CreateStripeCustomer(ctx context.Context, email string) (string, error) {
 	params := &stripe.CustomerParams{
 		Email: stripe.String(email),
 	}
+	params.Context = ctx
 	c, err := customer.New(params)
 	if err != nil {
 		return "", err
@@ -43,10 +50,11 @@ func (s *StripeServiceImpl) CreateStripeCustomer(email string) (string, error) {
 	return c.ID, nil
 }
 
-func (s *StripeServiceImpl) AttachPaymentMethodToCustomer(stripeCustomerID, paymentMethodID string) (*stripe.PaymentMethod, error) {
+func (s *StripeServiceImpl) AttachPaymentMethodToCustomer(ctx context.Context, stripeCustomerID, paymentMethodID string) (*stripe.PaymentMethod, error) {
 	params := &stripe.PaymentMethodAttachParams{
 		Customer: stripe.String(stripeCustomerID),
 	}
+	params.Context = ctx
 	updatedPaymentMethod, err := paymentmethod.Attach(paymentMethodID, params)
 	if err != nil {
 		return nil, err
@@ -54,27 +62,33 @@ func (s *StripeServiceImpl) AttachPaymentMethodToCustomer(stripeCustomerID, paym
 	return updatedPaymentMethod, nil
 }
 
-func (s *StripeServiceImpl) DeletePaymentMethod(paymentMethodID string) (*stripe.PaymentMethod, error) {
-	return paymentmethod.Detach(paymentMethodID, nil)
+func (s *StripeServiceImpl) DeletePaymentMethod(ctx context.Context, paymentMethodID string) (*stripe.PaymentMethod, error) {
+	params := &stripe.PaymentMethodDetachParams{}
+	params.Context = ctx
+	return paymentmethod.Detach(paymentMethodID, params)
 }
 
-func (s *StripeServiceImpl) ListPaymentMethods(stripeCustomerID string) (*paymentmethod.Iter, error) {
+func (s *StripeServiceImpl) ListPaymentMethods(ctx context.Context, stripeCustomerID string) (*paymentmethod.Iter, error) {
 	params := &stripe.PaymentMethodListParams{
 		Customer: stripe.String(stripeCustomerID),
 		Type:     stripe.String("card"),
 	}
+	params.Context = ctx
 	return paymentmethod.List(params), nil
 }
 
-func (s *StripeServiceImpl) CreatePaymentIntent(user *models.User, piRequest *models.PaymentIntentRequest, shippingAddr *models.Address) (*stripe.PaymentIntent, error) {
+func (s *StripeServiceImpl) CreatePaymentIntent(ctx context.Context, user *models.User, piRequest *models.PaymentIntentRequest, shippingAddr *models.Address, order *models.Order) (*stripe.PaymentIntent, error) {
 	params := &stripe.PaymentIntentParams{
-		Amount:             stripe.Int64(piRequest.Amount),
-		Currency:           stripe.String(piRequest.Currency),
+		Amount:             stripe.Int64(order.Total.Amount),
+		Currency:           stripe.String(strings.ToLower(order.Total.Currency)),
 		Customer:           stripe.String(user.StripeCustomerID),
 		PaymentMethod:      stripe.String(piRequest.PaymentMethodID),
 		ConfirmationMethod: stripe.String(string(stripe.PaymentIntentConfirmationMethodManual)),
 		Confirm:            stripe.Bool(true),
 	}
+	params.Context = ctx
+	// 同一个订单、同样的卡和金额同时付两次的时候Stripe返回同一个PaymentIntent，不会扣两次钱
+	params.SetIdempotencyKey(fmt.Sprintf("order-%d-%s-%d", order.ID, piRequest.PaymentMethodID, order.Total.Amount))
 
 	if shippingAddr != nil {
 		params.Shipping = &stripe.ShippingDetailsParams{
@@ -90,13 +104,36 @@ func (s *StripeServiceImpl) CreatePaymentIntent(user *models.User, piRequest *mo
 		}
 	}
 
+	for key, value := range OrderTaxMetadata(order) {
+		params.AddMetadata(key, value)
+	}
+
 	return paymentintent.New(params)
 }
 
-func (s *StripeServiceImpl) GetLatestCustomerIDByEmail(email string) (string, error) {
+// OrderTaxMetadata 是写到Stripe metadata里的订单税额明细，金额和Stripe的amount一样是最小货币单位。
+// 每一项的税保存在order_items里。
+func OrderTaxMetadata(order *models.Order) map[string]string {
+	return map[string]string{
+		"order_id":         strconv.FormatInt(order.ID, 10),
+		"currency":         order.Total.Currency,
+		"subtotal":         strconv.FormatInt(order.Subtotal.Amount, 10),
+		"delivery_fee":     strconv.FormatInt(order.DeliveryFee.Amount, 10),
+		"delivery_fee_tax": strconv.FormatInt(order.DeliveryFeeTax.Amount, 10),
+		"tax_amount":       strconv.FormatInt(order.Tax.Amount, 10),
+		"tax_rate":         strconv.FormatFloat(order.TaxRate, 'f', -1, 64),
+		"tax_state":        order.TaxState,
+		"tax_zip_code":     order.TaxZipCode,
+		"tax_exempt":       strconv.FormatBool(order.TaxExempt),
+		"total":            strconv.FormatInt(order.Total.Amount, 10),
+	}
+}
+
+func (s *StripeServiceImpl) GetLatestCustomerIDByEmail(ctx context.Context, email string) (string, error) {
 	params := &stripe.CustomerListParams{
 		Email: stripe.String(email),
 	}
+	params.Context = ctx
 	params.Filters.AddFilter("limit", "", "1")
 
 	i := s.sc.Customers.List(params)
@@ -112,17 +149,19 @@ func (s *StripeServiceImpl) GetLatestCustomerIDByEmail(email string) (string, er
 	return i.Customer().ID, nil
 }
 
-func (s *StripeServiceImpl) ListPaymentIntents(stripeCustomerID string) (*paymentintent.Iter, error) {
+func (s *StripeServiceImpl) ListPaymentIntents(ctx context.Context, stripeCustomerID string) (*paymentintent.Iter, error) {
 	params := &stripe.PaymentIntentListParams{
 		Customer: stripe.String(stripeCustomerID),
 	}
+	params.Context = ctx
 	params.AddExpand("data.latest_charge")
 
 	return paymentintent.List(params), nil
 }
 
-func (s *StripeServiceImpl) RetrievePaymentIntent(intent string) (*stripe.PaymentIntent, error) {
+func (s *StripeServiceImpl) RetrievePaymentIntent(ctx context.Context, intent string) (*stripe.PaymentIntent, error) {
 	params := &stripe.PaymentIntentParams{}
+	params.Context = ctx
 	params.AddExpand("latest_charge")
 
 	return paymentintent.Get(intent, params)
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTaxRateNotFound  = errors.New("no tax rate for the address")
+	ErrInvalidOrderItem = errors.New("invalid order item")
+)
+
+// 税率按百万分之一换成整数来算（见models.RateMicros），EstimatedCombinedRate最多6位小数
+const taxRateScale = 1000000
+
+type TaxCalculationService interface {
+	// CalculateOrderTax 按address的税率计算order每一项的税，结果写在order和order.OrderItems上，不保存。
+	// OrderItems要带着Product。
+	CalculateOrderTax(ctx context.Context, user *models.User, order *models.Order, address *models.Address) error
+}
+
+type taxCalculationServiceImpl struct {
+	TaxRateService TaxRateService
+}
+
+func NewTaxCalculationService(taxRateService TaxRateService) TaxCalculationService {
+	return &taxCalculationServiceImpl{
+		TaxRateService: taxRateService,
+	}
+}
+
+func (s *taxCalculationServiceImpl) CalculateOrderTax(ctx context.Context, user *models.User, order *models.Order, address *models.Address) error {
+	if order.DeliveryFee.Amount < 0 {
+		return fmt.Errorf("%w: negative delivery fee", ErrInvalidOrderItem)
+	}
+	taxRate, err := s.TaxRateService.GetTaxRateByZipCodeAndState(ctx, address)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %v %v", ErrTaxRateNotFound, address.State, address.PostalCode)
+	}
+	if err != nil {
+		return err
+	}
+
+	order.ClearTax()
+	order.TaxState = taxRate.State
+	order.TaxZipCode = taxRate.ZipCode
+	order.TaxRate = taxRate.EstimatedCombinedRate
+	order.TaxRateDatasetID = taxRate.DatasetID
+	order.TaxExempt = user.TaxExempt
+
+	// 所有的金额都要是同一个币种，运费没有币种的时候用商品的币种
+	currency := order.DeliveryFee.Currency
+	if len(order.OrderItems) > 0 && order.OrderItems[0].Product != nil {
+		currency = order.OrderItems[0].Product.Price.Currency
+	}
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+	deliveryFee := models.NewMoney(order.DeliveryFee.Amount, currency)
+	if !deliveryFee.SameCurrency(order.DeliveryFee) {
+		return fmt.Errorf("%w: delivery fee in %v, products in %v", ErrInvalidOrderItem, order.DeliveryFee.Currency, currency)
+	}
+	order.DeliveryFee = deliveryFee
+
+	// 每一项的应税金额（最小货币单位），最后一项是运费
+	exemptCategories := taxExemptCategories(taxRate.State)
+	amounts := make([]int64, len(order.OrderItems)+1)
+	var subtotal int64
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+		if item.Product == nil || item.Quantity <= 0 {
+			return fmt.Errorf("%w: product %v with quantity %v", ErrInvalidOrderItem, item.ProductID, item.Quantity)
+		}
+		unitPrice, err := item.Product.UnitPrice()
+		if err != nil || unitPrice.Currency != currency {
+			return fmt.Errorf("%w: product %v is not priced in %v", ErrInvalidOrderItem, item.ProductID, currency)
+		}
+		item.UnitPrice = unitPrice
+		item.TaxCategory = item.Product.Category
+		if item.TaxCategory == "" {
+			item.TaxCategory = models.ProductCategoryOther
+		}
+		item.Taxable = !user.TaxExempt && !exemptCategories[item.TaxCategory]
+		subtotal += unitPrice.Mul(item.Quantity).Amount
+		if item.Taxable {
+			amounts[i] = unitPrice.Mul(item.Quantity).Amount
+		}
+	}
+	if !user.TaxExempt && deliveryFeeTaxable(taxRate.State) {
+		amounts[len(order.OrderItems)] = deliveryFee.Amount
+	}
+
+	var taxable, tax int64
+	for _, amount := range amounts {
+		taxable += amount
+	}
+	taxes := allocateTax(amounts, models.RateMicros(taxRate.EstimatedCombinedRate))
+	for i := range order.OrderItems {
+		order.OrderItems[i].Tax = models.NewMoney(taxes[i], currency)
+	}
+	for _, itemTax := range taxes {
+		tax += itemTax
+	}
+	order.Subtotal = models.NewMoney(subtotal, currency)
+	order.TaxableSales = models.NewMoney(taxable, currency)
+	order.ExemptSales = models.NewMoney(subtotal+deliveryFee.Amount-taxable, currency)
+	order.DeliveryFeeTax = models.NewMoney(taxes[len(order.OrderItems)], currency)
+	order.Tax = models.NewMoney(tax, currency)
+	order.Total = models.NewMoney(subtotal+deliveryFee.Amount+tax, currency)
+	now := time.Now()
+	order.TaxCalculatedAt = &now
+	return nil
+}
+
+// allocateTax 先把整单的税四舍五入到最小货币单位，再按余数从大到小把零头分给每一项，
+// 这样每一项的税加起来正好等于整单的税，不会因为每项分别四舍五入多收或者少收。amounts都不是负数。
+func allocateTax(amounts []int64, rateMicros int64) []int64 {
+	taxes := make([]int64, len(amounts))
+	remainders := make([]int64, len(amounts))
+	var exact, allocated int64
+	for i, amount := range amounts {
+		exact += amount * rateMicros
+		taxes[i] = amount * rateMicros / taxRateScale
+		remainders[i] = amount * rateMicros % taxRateScale
+		allocated += taxes[i]
+	}
+	total := models.RoundDiv(exact, taxRateScale)
+
+	indexes := make([]int, len(amounts))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool { return remainders[indexes[i]] > remainders[indexes[j]] })
+	for k := 0; allocated < total; k++ {
+		taxes[indexes[k]]++
+		allocated++
+	}
+	return taxes
+}
+
+// taxExemptCategories 返回state免税的商品分类。stateTaxExemptCategories里配置了这个州就用州的，
+// 否则用taxExemptCategories，都没有配置的时候只有GROCERY免税。
+func taxExemptCategories(state string) map[models.ProductCategory]bool {
+	categories := []string{string(models.ProductCategoryGrocery)}
+	if viper.IsSet("taxExemptCategories") {
+		categories = viper.GetStringSlice("taxExemptCategories")
+	}
+	// 配置文件里读出来的map key会被viper转成小写
+	for stateKey, stateCategories := range viper.GetStringMapStringSlice("stateTaxExemptCategories") {
+		if strings.EqualFold(stateKey, state) {
+			categories = stateCategories
+		}
+	}
+	exempt := map[models.ProductCategory]bool{}
+	for _, category := range categories {
+		exempt[models.ProductCategory(strings.ToUpper(category))] = true
+	}
+	return exempt
+}
+
+// deliveryFeeTaxable 运费是否收税，deliveryFeeTaxableStates里的州收，默认都不收。
+func deliveryFeeTaxable(state string) bool {
+	for _, taxableState := range viper.GetStringSlice("deliveryFeeTaxableStates") {
+		if strings.EqualFold(taxableState, state) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidTaxRateFile = errors.New("invalid tax rate file")
+
+// TAXRATES_ZIP5_CA202304.csv：州和生效的年月
+var taxRateFileNamePattern = regexp.MustCompile(`([A-Z]{2})(\d{4})(\d{2})\.csv$`)
+
+var zipCodePattern = regexp.MustCompile(`^\d{5}$`)
+
+// 一个文件最多报告这么多行错误
+const maxTaxRateFileProblems = 20
+
+// TaxRateFile 是一个要导入的csv，Name是文件名（不含目录）。
+type TaxRateFile struct {
+	Name    string
+	Content []byte
+}
+
+type TaxRateImportService interface {
+	// Import 校验所有文件之后导入成一个新的版本并切换过去，没有导入的州沿用当前版本的数据。actor为nil表示启动或者命令行导入。
+	Import(ctx context.Context, actor *models.User, files []TaxRateFile) (*models.TaxRateDataset, error)
+	// ImportDir 导入dir下所有的csv。同样的文件已经导入过的时候什么都不做，返回nil。
+	ImportDir(ctx context.Context, dir string) (*models.TaxRateDataset, error)
+	ListDatasets(ctx context.Context) ([]*models.TaxRateDataset, error)
+	// Activate 切换回之前的某个版本。
+	Activate(ctx context.Context, actor *models.User, datasetID int64) (*models.TaxRateDataset, error)
+}
+
+type taxRateImportServiceImpl struct {
+	TaxRateRepo  repositories.TaxRateRepository
+	AuditLogRepo repositories.AuditLogRepository
+	Transactor   repositories.Transactor
+}
+
+func NewTaxRateImportService(taxRateRepo repositories.TaxRateRepository, auditLogRepo repositories.AuditLogRepository, transactor repositories.Transactor) TaxRateImportService {
+	return &taxRateImportServiceImpl{
+		TaxRateRepo:  taxRateRepo,
+		AuditLogRepo: auditLogRepo,
+		Transactor:   transactor,
+	}
+}
+
+func (s *taxRateImportServiceImpl) Import(ctx context.Context, actor *models.User, files []TaxRateFile) (*models.TaxRateDataset, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no files", ErrInvalidTaxRateFile)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	dataset := &models.TaxRateDataset{Checksum: taxRateFilesChecksum(files)}
+	var rates []*models.TaxRate
+	var states, names []string
+	seenStates := map[string]string{}
+	for _, file := range files {
+		fileRates, state, effectiveDate, err := parseTaxRateFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seenStates[state]; ok {
+			return nil, fmt.Errorf("%w: %v and %v are both for %v", ErrInvalidTaxRateFile, other, file.Name, state)
+		}
+		seenStates[state] = file.Name
+		states = append(states, state)
+		names = append(names, file.Name)
+		rates = append(rates, fileRates...)
+		if effectiveDate.After(dataset.EffectiveDate) {
+			dataset.EffectiveDate = effectiveDate
+		}
+	}
+	dataset.SourceFiles = strings.Join(names, ",")
+	if actor != nil {
+		dataset.ImportedBy = actor.ID
+	}
+
+	var carryOverFrom int64
+	active, err := s.TaxRateRepo.FindActiveDataset(ctx)
+	if err == nil {
+		carryOverFrom = active.ID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	start := time.Now()
+	err = s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.TaxRateRepo.CreateDataset(ctx, dataset, rates, carryOverFrom, states); err != nil {
+			return err
+		}
+		// 启动时从taxRatesFileDir导入的没有actor，不写审计日志
+		if actor == nil {
+			return nil
+		}
+		return writeAuditLog(ctx, s.AuditLogRepo, actor, "tax_rate_dataset.import", models.AuditTargetTaxRateDataset, dataset.ID,
+			map[string]interface{}{"source_files": dataset.SourceFiles, "row_count": dataset.RowCount})
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.WithContext(ctx).Infof("Imported tax rate dataset %v from %v (%d rows) in %v", dataset.ID, dataset.SourceFiles, dataset.RowCount, time.Since(start))
+	s.deleteOldDatasets(ctx)
+	return dataset, nil
+}
+
+func (s *taxRateImportServiceImpl) ImportDir(ctx context.Context, dir string) (*models.TaxRateDataset, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	files := make([]TaxRateFile, 0, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, TaxRateFile{Name: filepath.Base(path), Content: content})
+	}
+
+	// 每次启动都会调用，只有文件变了才导入，避免覆盖之后通过接口导入的新数据
+	checksum := taxRateFilesChecksum(files)
+	if dataset, err := s.TaxRateRepo.FindDatasetByChecksum(ctx, checksum); err == nil {
+		log.WithContext(ctx).Infof("Tax rate files in %v are already imported as dataset %v", dir, dataset.ID)
+		return nil, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return s.Import(ctx, nil, files)
+}
+
+func (s *taxRateImportServiceImpl) ListDatasets(ctx context.Context) ([]*models.TaxRateDataset, error) {
+	return s.TaxRateRepo.ListDatasets(ctx)
+}
+
+func (s *taxRateImportServiceImpl) Activate(ctx context.Context, actor *models.User, datasetID int64) (*models.TaxRateDataset, error) {
+	err := s.Transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.TaxRateRepo.ActivateDataset(ctx, datasetID); err != nil {
+			return err
+		}
+		if actor == nil {
+			return nil
+		}
+		return writeAuditLog(ctx, s.AuditLogRepo, actor, "tax_rate_dataset.activate", models.AuditTargetTaxRateDataset, datasetID, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.TaxRateRepo.FindDatasetByID(ctx, datasetID)
+}
+
+// deleteOldDatasets 只保留最新的 taxRateDatasetRetention（默认3）个版本，用来回滚。
+func (s *taxRateImportServiceImpl) deleteOldDatasets(ctx context.Context) {
+	retention := 3
+	if viper.IsSet("taxRateDatasetRetention") {
+		retention = viper.GetInt("taxRateDatasetRetention")
+	}
+	datasets, err := s.TaxRateRepo.ListDatasets(ctx)
+	if err != nil || retention <= 0 || len(datasets) <= retention {
+		return
+	}
+	if err = s.TaxRateRepo.DeleteDatasetsBefore(ctx, datasets[retention-1].ID); err != nil {
+		log.WithContext(ctx).Errorf("Errors in deleting old tax rate datasets, err: \n%v", err)
+	}
+}
+
+// parseTaxRateFile 按表头找 State、ZipCode、EstimatedCombinedRate 三列（网站下载的原始文件和裁剪过的都可以），
+// 校验所有行，有错误的时候整个文件都不导入。
+func parseTaxRateFile(file TaxRateFile) ([]*models.TaxRate, string, time.Time, error) {
+	match := taxRateFileNamePattern.FindStringSubmatch(file.Name)
+	if match == nil {
+		return nil, "", time.Time{}, fmt.Errorf("%w: %v should be named like TAXRATES_ZIP5_CA202304.csv", ErrInvalidTaxRateFile, file.Name)
+	}
+	state := match[1]
+	year, _ := strconv.Atoi(match[2])
+	month, _ := strconv.Atoi(match[3])
+	if month < 1 || month > 12 {
+		return nil, "", time.Time{}, fmt.Errorf("%w: %v has an invalid month", ErrInvalidTaxRateFile, file.Name)
+	}
+	effectiveDate := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(file.Content), "\ufeff")))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("%w: %v: %v", ErrInvalidTaxRateFile, file.Name, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"State", "ZipCode", "EstimatedCombinedRate"} {
+		if _, ok := columns[name]; !ok {
+			return nil, "", time.Time{}, fmt.Errorf("%w: %v has no %v column", ErrInvalidTaxRateFile, file.Name, name)
+		}
+	}
+
+	var rates []*models.TaxRate
+	var problems []string
+	zipCodes := map[string]int{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			problems = append(problems, err.Error())
+			break
+		}
+		if len(record) <= columns["State"] || len(record) <= columns["ZipCode"] || len(record) <= columns["EstimatedCombinedRate"] {
+			problems = append(problems, fmt.Sprintf("line %d: missing columns", line))
+			continue
+		}
+		rowState := strings.TrimSpace(record[columns["State"]])
+		zipCode := strings.TrimSpace(record[columns["ZipCode"]])
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[columns["EstimatedCombinedRate"]]), 64)
+		switch {
+		case rowState != state:
+			problems = append(problems, fmt.Sprintf("line %d: state %q does not match %v", line, rowState, state))
+		case !zipCodePattern.MatchString(zipCode):
+			problems = append(problems, fmt.Sprintf("line %d: invalid zip code %q", line, zipCode))
+		case err != nil || rate < 0 || rate >= 1:
+			problems = append(problems, fmt.Sprintf("line %d: invalid rate %q", line, record[columns["EstimatedCombinedRate"]]))
+		case zipCodes[zipCode] > 0:
+			problems = append(problems, fmt.Sprintf("line %d: zip code %v is already on line %d", line, zipCode, zipCodes[zipCode]))
+		default:
+			zipCodes[zipCode] = line
+			rates = append(rates, &models.TaxRate{
+				Csv:                   file.Name,
+				State:                 state,
+				ZipCode:               zipCode,
+				EstimatedCombinedRate: rate,
+				EffectiveDate:         effectiveDate,
+			})
+		}
+		if len(problems) >= maxTaxRateFileProblems {
+			break
+		}
+	}
+	if len(problems) > 0 {
+		return nil, "", time.Time{}, fmt.Errorf("%w: %v: %v", ErrInvalidTaxRateFile, file.Name, strings.Join(problems, "; "))
+	}
+	if len(rates) == 0 {
+		return nil, "", time.Time{}, fmt.Errorf("%w: %v has no rows", ErrInvalidTaxRateFile, file.Name)
+	}
+	return rates, state, effectiveDate, nil
+}
+
+// taxRateFilesChecksum 是按文件名排序之后所有文件名和内容的sha256。
+func taxRateFilesChecksum(files []TaxRateFile) string {
+	hash := sha256.New()
+	sorted := append([]TaxRateFile(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, file := range sorted {
+		fmt.Fprintf(hash, "%s\n%d\n", file.Name, len(file.Content))
+		hash.Write(file.Content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
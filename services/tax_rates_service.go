@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -10,7 +11,7 @@ import (
 )
 
 type TaxRateService interface {
-	GetTaxRateByZipCodeAndState(address *models.Address) (*models.TaxRate, error)
+	GetTaxRateByZipCodeAndState(ctx context.Context, address *models.Address) (*models.TaxRate, error)
 }
 
 type taxRateServiceImpl struct {
@@ -23,13 +24,13 @@ func NewTaxRateService(taxRateRepo repositories.TaxRateRepository) TaxRateServic
 	}
 }
 
-func (s *taxRateServiceImpl) GetTaxRateByZipCodeAndState(address *models.Address) (*models.TaxRate, error) {
+func (s *taxRateServiceImpl) GetTaxRateByZipCodeAndState(ctx context.Context, address *models.Address) (*models.TaxRate, error) {
 	state := strings.ToUpper(address.State)
 	if state == "" || len(state) != 2 {
-		return s.getTaxRateByZipCode(address.PostalCode)
+		return s.getTaxRateByZipCode(ctx, address.ZIP5())
 	}
 
-	taxRate, err := s.TaxRateRepo.FindByZipCodeAndState(address.PostalCode, state)
+	taxRate, err := s.TaxRateRepo.FindByZipCodeAndState(ctx, address.ZIP5(), state)
 	if err == nil {
 		return taxRate, nil
 	}
@@ -38,11 +39,11 @@ func (s *taxRateServiceImpl) GetTaxRateByZipCodeAndState(address *models.Address
 		return nil, err
 	}
 
-	return s.getTaxRateByZipCode(address.PostalCode)
+	return s.getTaxRateByZipCode(ctx, address.ZIP5())
 }
 
-func (s *taxRateServiceImpl) getTaxRateByZipCode(zipCode string) (*models.TaxRate, error) {
-	taxRate, err := s.TaxRateRepo.FindByZipCode(zipCode)
+func (s *taxRateServiceImpl) getTaxRateByZipCode(ctx context.Context, zipCode string) (*models.TaxRate, error) {
+	taxRate, err := s.TaxRateRepo.FindByZipCode(ctx, zipCode)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	log "github.com/sirupsen/logrus"
+)
+
+// TaxLiabilityRow 是一个州、ZIP、店、税率版本和币种的汇总，金额都已经按比例扣掉了退款。
+type TaxLiabilityRow struct {
+	State            string       `json:"state"`
+	ZipCode          string       `json:"zip_code"`
+	StoreID          int64        `json:"store_id"`
+	TaxRateDatasetID int64        `json:"tax_rate_dataset_id"`
+	TaxRate          float64      `json:"tax_rate"`
+	Currency         string       `json:"currency"`
+	OrderCount       int64        `json:"order_count"`
+	TaxableSales     models.Money `json:"taxable_sales"`
+	ExemptSales      models.Money `json:"exempt_sales"`
+	TaxCollected     models.Money `json:"tax_collected"`
+	// 退款总额（包括税），已经从上面的数字里扣掉了
+	Refunded models.Money `json:"refunded"`
+}
+
+// add 把other加进来，调用的地方保证是同一个币种。
+func (row *TaxLiabilityRow) add(other *TaxLiabilityRow) {
+	row.OrderCount += other.OrderCount
+	row.TaxableSales = models.NewMoney(row.TaxableSales.Amount+other.TaxableSales.Amount, row.Currency)
+	row.ExemptSales = models.NewMoney(row.ExemptSales.Amount+other.ExemptSales.Amount, row.Currency)
+	row.TaxCollected = models.NewMoney(row.TaxCollected.Amount+other.TaxCollected.Amount, row.Currency)
+	row.Refunded = models.NewMoney(row.Refunded.Amount+other.Refunded.Amount, row.Currency)
+}
+
+// TaxLiabilityReport 统计 From <= 付款时间 < To 的订单。退款算在付款的那个月，按订单现在的累计退款扣，
+// 所以以前月份的报表在之后有了退款的时候会变。
+type TaxLiabilityReport struct {
+	From time.Time          `json:"from"`
+	To   time.Time          `json:"to"`
+	Rows []*TaxLiabilityRow `json:"rows"`
+	// 每个币种一个合计
+	Totals []*TaxLiabilityRow `json:"totals"`
+	// 所有币种按To那天的汇率换算成ReportingCurrency的合计，缺汇率的时候没有
+	ReportingCurrency string           `json:"reporting_currency"`
+	ReportingTotal    *TaxLiabilityRow `json:"reporting_total,omitempty"`
+	// 付过款但是没有算过税的订单（算税上线之前的订单），不在统计里
+	UncalculatedOrders int64 `json:"uncalculated_orders"`
+}
+
+type TaxReportService interface {
+	TaxLiabilityReport(ctx context.Context, from, to time.Time) (*TaxLiabilityReport, error)
+}
+
+type taxReportServiceImpl struct {
+	OrderRepo      repositories.OrderRepository
+	FXRateProvider FXRateProvider
+}
+
+func NewTaxReportService(orderRepo repositories.OrderRepository, fxRateProvider FXRateProvider) TaxReportService {
+	return &taxReportServiceImpl{
+		OrderRepo:      orderRepo,
+		FXRateProvider: fxRateProvider,
+	}
+}
+
+type taxLiabilityKey struct {
+	state, zipCode     string
+	storeID, datasetID int64
+	taxRate            float64
+	currency           string
+}
+
+func (s *taxReportServiceImpl) TaxLiabilityReport(ctx context.Context, from, to time.Time) (*TaxLiabilityReport, error) {
+	orders, err := s.OrderRepo.FindPaidBetween(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TaxLiabilityReport{From: from, To: to, Rows: []*TaxLiabilityRow{}, Totals: []*TaxLiabilityRow{}, ReportingCurrency: ReportingCurrency()}
+	rows := map[taxLiabilityKey]*TaxLiabilityRow{}
+	for i := range orders {
+		order := &orders[i]
+		if order.TaxCalculatedAt == nil {
+			report.UncalculatedOrders++
+			continue
+		}
+		// 按算税时候的税率版本分组，同一个ZIP换了税率的前后两个月分开统计
+		key := taxLiabilityKey{order.TaxState, order.TaxZipCode, order.StoreID, order.TaxRateDatasetID, order.TaxRate, order.Total.Currency}
+		row, ok := rows[key]
+		if !ok {
+			row = &TaxLiabilityRow{State: key.state, ZipCode: key.zipCode, StoreID: key.storeID, TaxRateDatasetID: key.datasetID,
+				TaxRate: key.taxRate, Currency: key.currency}
+			rows[key] = row
+			report.Rows = append(report.Rows, row)
+		}
+		row.add(orderTaxLiability(order))
+	}
+
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.State != b.State {
+			return a.State < b.State
+		}
+		if a.ZipCode != b.ZipCode {
+			return a.ZipCode < b.ZipCode
+		}
+		if a.StoreID != b.StoreID {
+			return a.StoreID < b.StoreID
+		}
+		if a.TaxRateDatasetID != b.TaxRateDatasetID {
+			return a.TaxRateDatasetID < b.TaxRateDatasetID
+		}
+		return a.Currency < b.Currency
+	})
+	totals := map[string]*TaxLiabilityRow{}
+	for _, row := range report.Rows {
+		total, ok := totals[row.Currency]
+		if !ok {
+			total = &TaxLiabilityRow{Currency: row.Currency}
+			totals[row.Currency] = total
+			report.Totals = append(report.Totals, total)
+		}
+		total.add(row)
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Currency < report.Totals[j].Currency })
+
+	reportingTotal, err := s.reportingTotal(ctx, report)
+	if errors.Is(err, ErrFXRateNotFound) {
+		log.WithContext(ctx).Warnf("Tax liability report has no %v total: %v", report.ReportingCurrency, err)
+	} else if err != nil {
+		return nil, err
+	}
+	report.ReportingTotal = reportingTotal
+	return report, nil
+}
+
+// reportingTotal 把每个币种的合计按To那天的汇率换算成ReportingCurrency再加起来。
+func (s *taxReportServiceImpl) reportingTotal(ctx context.Context, report *TaxLiabilityReport) (*TaxLiabilityRow, error) {
+	currency := report.ReportingCurrency
+	total := &TaxLiabilityRow{Currency: currency, TaxableSales: models.NewMoney(0, currency), ExemptSales: models.NewMoney(0, currency),
+		TaxCollected: models.NewMoney(0, currency), Refunded: models.NewMoney(0, currency)}
+	for _, row := range report.Totals {
+		converted := &TaxLiabilityRow{Currency: currency, OrderCount: row.OrderCount}
+		for _, amount := range []struct{ from, to *models.Money }{
+			{&row.TaxableSales, &converted.TaxableSales}, {&row.ExemptSales, &converted.ExemptSales},
+			{&row.TaxCollected, &converted.TaxCollected}, {&row.Refunded, &converted.Refunded},
+		} {
+			money, err := ConvertMoney(ctx, s.FXRateProvider, *amount.from, currency, report.To)
+			if err != nil {
+				return nil, err
+			}
+			*amount.to = money
+		}
+		total.add(converted)
+	}
+	return total, nil
+}
+
+// orderTaxLiability 是一个订单扣掉退款之后的销售额和税。部分退款按退款占订单总额的比例扣。
+func orderTaxLiability(order *models.Order) *TaxLiabilityRow {
+	total := order.Total.Amount
+	refunded := order.Refunded.Amount
+	if refunded > total {
+		refunded = total
+	}
+	net := func(amount models.Money) models.Money {
+		if total <= 0 {
+			return amount
+		}
+		return models.NewMoney(amount.Amount-models.RoundDiv(amount.Amount*refunded, total), order.Total.Currency)
+	}
+	return &TaxLiabilityRow{
+		Currency:     order.Total.Currency,
+		OrderCount:   1,
+		TaxableSales: net(order.TaxableSales),
+		ExemptSales:  net(order.ExemptSales),
+		TaxCollected: net(order.Tax),
+		Refunded:     models.NewMoney(refunded, order.Total.Currency),
+	}
+}
+
+var taxLiabilityCSVHeader = []string{"state", "zip_code", "store_id", "tax_rate_dataset_id", "tax_rate", "currency", "order_count",
+	"taxable_sales", "exempt_sales", "tax_collected", "refunded"}
+
+// WriteTaxLiabilityCSV 把报表写成CSV，金额是主货币单位，最后是每个币种的合计和换算成ReportingCurrency的合计。
+func WriteTaxLiabilityCSV(w io.Writer, report *TaxLiabilityReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(taxLiabilityCSVHeader); err != nil {
+		return err
+	}
+	for _, row := range report.Rows {
+		if err := writer.Write(taxLiabilityCSVRecord(row, row.State, row.ZipCode, strconv.FormatInt(row.StoreID, 10),
+			strconv.FormatInt(row.TaxRateDatasetID, 10), strconv.FormatFloat(row.TaxRate, 'f', -1, 64))); err != nil {
+			return err
+		}
+	}
+	for _, total := range report.Totals {
+		if err := writer.Write(taxLiabilityCSVRecord(total, "TOTAL", "", "", "", "")); err != nil {
+			return err
+		}
+	}
+	// 只有一个币种的时候和上面的TOTAL一样，不用再写
+	if report.ReportingTotal != nil && len(report.Totals) > 1 {
+		if err := writer.Write(taxLiabilityCSVRecord(report.ReportingTotal, "REPORTING_TOTAL", "", "", "", "")); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func taxLiabilityCSVRecord(row *TaxLiabilityRow, columns ...string) []string {
+	return append(columns, row.Currency, strconv.FormatInt(row.OrderCount, 10), row.TaxableSales.Decimal(), row.ExemptSales.Decimal(),
+		row.TaxCollected.Decimal(), row.Refunded.Decimal())
+}
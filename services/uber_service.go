@@ -1,12 +1,14 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
 	"github.com/go-resty/resty/v2"
 	"github.com/spf13/viper"
 )
@@ -17,9 +19,9 @@ const (
 )
 
 type UberService interface {
-	Quote(requestBody *models.QuoteRequest) (*models.QuoteResponse, error)
-	CreateDelivery(requestBody *models.DeliveryData) (*models.DeliveryResponse, error)
-	GetDelivery(deliveryID string) (*models.DeliveryResponse, error)
+	Quote(ctx context.Context, requestBody *models.QuoteRequest) (*models.QuoteResponse, error)
+	CreateDelivery(ctx context.Context, requestBody *models.DeliveryData) (*models.DeliveryResponse, error)
+	GetDelivery(ctx context.Context, deliveryID string) (*models.DeliveryResponse, error)
 }
 
 type UberServiceImpl struct {
@@ -32,7 +34,7 @@ type UberServiceImpl struct {
 }
 
 func NewUberService() UberService {
-	httpClient := resty.New()
+	httpClient := resty.New().SetTransport(utils.NewTracingTransport("uber", utils.NewInstrumentedTransport("uber", http.DefaultTransport)))
 	return &UberServiceImpl{
 		HTTPClient:   httpClient,
 		ClientID:     viper.GetString("uberClientId"),
@@ -41,11 +43,12 @@ func NewUberService() UberService {
 	}
 }
 
-func (u *UberServiceImpl) getAuthorization() (string, error) {
+func (u *UberServiceImpl) getAuthorization(ctx context.Context) (string, error) {
 	if u.Accessauthorization == "" || (u.authorizationExpirationTime != 0 && time.Now().Unix() >= u.authorizationExpirationTime) {
 		response := &models.TokenResponse{}
 		errorResponse := &models.ErrorResponse{}
 		resp, err := u.HTTPClient.R().
+			SetContext(ctx).
 			SetFormData(map[string]string{
 				"grant_type":    "client_credentials",
 				"client_id":     u.ClientID,
@@ -71,8 +74,8 @@ func (u *UberServiceImpl) getAuthorization() (string, error) {
 	return u.Accessauthorization, nil
 }
 
-func (u *UberServiceImpl) Quote(requestBody *models.QuoteRequest) (*models.QuoteResponse, error) {
-	authorization, err := u.getAuthorization()
+func (u *UberServiceImpl) Quote(ctx context.Context, requestBody *models.QuoteRequest) (*models.QuoteResponse, error) {
+	authorization, err := u.getAuthorization(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -80,6 +83,7 @@ func (u *UberServiceImpl) Quote(requestBody *models.QuoteRequest) (*models.Quote
 	response := &models.QuoteResponse{}
 	errorResponse := &models.ErrorResponse{}
 	resp, err := u.HTTPClient.R().
+		SetContext(ctx).
 		SetHeader("Authorization", authorization).
 		SetBody(requestBody).
 		SetResult(response).
@@ -97,8 +101,8 @@ func (u *UberServiceImpl) Quote(requestBody *models.QuoteRequest) (*models.Quote
 	return response, nil
 }
 
-func (u *UberServiceImpl) CreateDelivery(requestBody *models.DeliveryData) (*models.DeliveryResponse, error) {
-	authorization, err := u.getAuthorization()
+func (u *UberServiceImpl) CreateDelivery(ctx context.Context, requestBody *models.DeliveryData) (*models.DeliveryResponse, error) {
+	authorization, err := u.getAuthorization(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -107,6 +111,7 @@ func (u *UberServiceImpl) CreateDelivery(requestBody *models.DeliveryData) (*mod
 	response := &models.DeliveryResponse{}
 	errorResponse := &models.ErrorResponse{}
 	resp, err := u.HTTPClient.R().
+		SetContext(ctx).
 		SetHeader("Authorization", authorization).
 		SetBody(requestBody).
 		SetResult(response).
@@ -121,11 +126,12 @@ func (u *UberServiceImpl) CreateDelivery(requestBody *models.DeliveryData) (*mod
 		return nil, errors.New(errorResponse.ToString())
 	}
 
+	utils.DeliveriesCreatedTotal.Inc()
 	return response, nil
 }
 
-func (u *UberServiceImpl) GetDelivery(deliveryID string) (*models.DeliveryResponse, error) {
-	authorization, err := u.getAuthorization()
+func (u *UberServiceImpl) GetDelivery(ctx context.Context, deliveryID string) (*models.DeliveryResponse, error) {
+	authorization, err := u.getAuthorization(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +140,7 @@ func (u *UberServiceImpl) GetDelivery(deliveryID string) (*models.DeliveryRespon
 	response := &models.DeliveryResponse{}
 	errorResponse := &models.ErrorResponse{}
 	resp, err := u.HTTPClient.R().
+		SetContext(ctx).
 		SetHeader("Authorization", authorization).
 		SetResult(response).
 		SetError(errorResponse).
@@ -149,3 +156,9 @@ func (u *UberServiceImpl) GetDelivery(deliveryID string) (*models.DeliveryRespon
 
 	return response, nil
 }
+
+// CheckHealth 确认能拿到Uber的access token（有没过期的token时直接复用）。
+func (u *UberServiceImpl) CheckHealth(ctx context.Context) error {
+	_, err := u.getAuthorization(ctx)
+	return err
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	"github.com/atomi-ai/atomi/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUserExportLinkTTL = 24 * time.Hour
+	// 导出任务超过这么久没有进展的时候健康检查失败
+	defaultUserExportStallTimeout = 10 * time.Minute
+	// 过期的导出文件多久清理一次
+	defaultUserExportPurgeInterval = time.Hour
+)
+
+type UserExportService interface {
+	// RequestExport 创建一个导出请求并在后台生成导出文件，立即返回PENDING状态的请求。
+	RequestExport(ctx context.Context, user *models.User, format models.UserExportFormat) (*models.UserExportRequest, error)
+	GetExport(ctx context.Context, user *models.User, exportID int64) (*models.UserExportRequest, error)
+	// PurgeExpired 删除已经过期的导出文件，把请求标成EXPIRED，返回删掉的个数。
+	PurgeExpired(ctx context.Context) (int, error)
+	// Wait 等待所有正在生成的导出完成。
+	Wait()
+}
+
+type userExportServiceImpl struct {
+	ExportRepo      repositories.UserExportRequestRepository
+	UserAddressRepo repositories.UserAddressRepository
+	MembershipRepo  repositories.StoreMembershipRepository
+	OrderRepo       repositories.OrderRepository
+	StripeService   StripeService
+	BlobStorage     utils.BlobStorage
+	Notifier        utils.Notifier
+
+	wg        sync.WaitGroup
+	heartbeat *utils.WorkerHeartbeat
+}
+
+func NewUserExportService(
+	exportRepo repositories.UserExportRequestRepository,
+	userAddressRepo repositories.UserAddressRepository,
+	membershipRepo repositories.StoreMembershipRepository,
+	orderRepo repositories.OrderRepository,
+	stripeService StripeService,
+	blobStorage utils.BlobStorage,
+	notifier utils.Notifier) UserExportService {
+	return &userExportServiceImpl{
+		ExportRepo:      exportRepo,
+		UserAddressRepo: userAddressRepo,
+		MembershipRepo:  membershipRepo,
+		OrderRepo:       orderRepo,
+		StripeService:   stripeService,
+		BlobStorage:     blobStorage,
+		Notifier:        notifier,
+		heartbeat:       utils.NewWorkerHeartbeat(userExportStallTimeout()),
+	}
+}
+
+type paymentMethodSummary struct {
+	ID       string `json:"id"`
+	Brand    string `json:"brand"`
+	Last4    string `json:"last4"`
+	ExpMonth int64  `json:"exp_month"`
+	ExpYear  int64  `json:"exp_year"`
+}
+
+type userExportDocument struct {
+	ExportedAt     time.Time              `json:"exported_at"`
+	User           *models.User           `json:"user"`
+	Addresses      []*models.Address      `json:"addresses"`
+	DefaultStore   *models.Store          `json:"default_store"`
+	Orders         []models.Order         `json:"orders"`
+	PaymentMethods []paymentMethodSummary `json:"payment_methods"`
+	// NotIncluded 列出导出里没有的数据，让用户知道不是漏了
+	NotIncluded []string `json:"not_included"`
+}
+
+// 系统里还没有积分和储值（loyalty/credit），有了之后再加到导出里
+var userExportNotIncluded = []string{"loyalty_credit_history"}
+
+func (s *userExportServiceImpl) RequestExport(ctx context.Context, user *models.User, format models.UserExportFormat) (*models.UserExportRequest, error) {
+	if format == "" {
+		format = models.UserExportFormatJSON
+	}
+	if format != models.UserExportFormatJSON && format != models.UserExportFormatZip {
+		return nil, fmt.Errorf("unsupported export format: %v", format)
+	}
+
+	request := &models.UserExportRequest{
+		UserID: user.ID,
+		Format: format,
+		Status: models.UserExportStatusPending,
+	}
+	if err := s.ExportRepo.Save(ctx, request); err != nil {
+		return nil, err
+	}
+
+	// 导出在后台进行，不能跟着请求一起被取消，只沿用request id方便查日志。
+	exportCtx := utils.WithRequestID(context.Background(), utils.RequestIDFromContext(ctx))
+	s.wg.Add(1)
+	go func(request models.UserExportRequest) {
+		defer s.wg.Done()
+		s.processExport(exportCtx, user, &request)
+	}(*request)
+
+	return request, nil
+}
+
+func (s *userExportServiceImpl) GetExport(ctx context.Context, user *models.User, exportID int64) (*models.UserExportRequest, error) {
+	request, err := s.ExportRepo.FindByIDAndUserID(ctx, exportID, user.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// 链接过期之后就不再返回了，用户需要重新申请导出。
+	if request.ExpiresAt != nil && time.Now().After(*request.ExpiresAt) {
+		request.DownloadURL = ""
+	}
+	return request, nil
+}
+
+func (s *userExportServiceImpl) PurgeExpired(ctx context.Context) (int, error) {
+	requests, err := s.ExportRepo.FindExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, request := range requests {
+		// 删不掉的留到下一次再试
+		if err := s.BlobStorage.DeletePrivateFile(ctx, request.BlobName); err != nil {
+			log.WithContext(ctx).Errorf("Errors in deleting export file %v, err: \n%v", request.BlobName, err)
+			continue
+		}
+		request.Status = models.UserExportStatusExpired
+		request.DownloadURL = ""
+		request.BlobName = ""
+		if err := s.ExportRepo.Save(ctx, request); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *userExportServiceImpl) Wait() {
+	s.wg.Wait()
+}
+
+// CheckHealth 在有导出任务卡住（超过userExportStallTimeout没有进展）的时候返回错误。
+func (s *userExportServiceImpl) CheckHealth(ctx context.Context) error {
+	return s.heartbeat.CheckHealth(ctx)
+}
+
+func (s *userExportServiceImpl) processExport(ctx context.Context, user *models.User, request *models.UserExportRequest) {
+	s.heartbeat.Beat(request.ID)
+	defer s.heartbeat.Done(request.ID)
+
+	request.Status = models.UserExportStatusProcessing
+	if err := s.ExportRepo.Save(ctx, request); err != nil {
+		log.WithContext(ctx).Errorf("Errors in updating export request %v, err: \n%v", request.ID, err)
+	}
+
+	blobName, url, err := s.buildAndUpload(ctx, user, request)
+	s.heartbeat.Beat(request.ID)
+	if err != nil {
+		log.WithContext(ctx).Errorf("Errors in exporting data for user %v, err: \n%v", user.ID, err)
+		request.Status = models.UserExportStatusFailed
+		request.Error = err.Error()
+		if err := s.ExportRepo.Save(ctx, request); err != nil {
+			log.WithContext(ctx).Errorf("Errors in updating export request %v, err: \n%v", request.ID, err)
+		}
+		return
+	}
+
+	expiresAt := time.Now().Add(userExportLinkTTL())
+	request.Status = models.UserExportStatusReady
+	request.DownloadURL = url
+	request.BlobName = blobName
+	request.ExpiresAt = &expiresAt
+	if err := s.ExportRepo.Save(ctx, request); err != nil {
+		log.WithContext(ctx).Errorf("Errors in updating export request %v, err: \n%v", request.ID, err)
+		return
+	}
+
+	message := fmt.Sprintf("Your data export is ready, download it before %v: %v", expiresAt.Format(time.RFC3339), url)
+	if err := s.Notifier.Notify(ctx, user.Email, "Your data export is ready", message); err != nil {
+		log.WithContext(ctx).Errorf("Errors in notifying user %v, err: \n%v", user.ID, err)
+	}
+}
+
+// buildAndUpload 返回blob的名字和下载链接。
+func (s *userExportServiceImpl) buildAndUpload(ctx context.Context, user *models.User, request *models.UserExportRequest) (string, string, error) {
+	doc, err := s.collect(ctx, user)
+	if err != nil {
+		return "", "", err
+	}
+	s.heartbeat.Beat(request.ID)
+
+	// 文件名里加上随机串，这样blob的路径没法被猜出来。
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", "", err
+	}
+	fileName := fmt.Sprintf("user-export-%d-%d-%s.%s", user.ID, request.ID, hex.EncodeToString(token), request.Format)
+	filePath := filepath.Join(os.TempDir(), fileName)
+	defer os.Remove(filePath)
+
+	if err := writeExportFile(filePath, request.Format, doc); err != nil {
+		return "", "", err
+	}
+	return s.BlobStorage.UploadPrivateFile(ctx, filePath, userExportLinkTTL())
+}
+
+func (s *userExportServiceImpl) collect(ctx context.Context, user *models.User) (*userExportDocument, error) {
+	doc := &userExportDocument{
+		ExportedAt:     time.Now(),
+		User:           user,
+		PaymentMethods: []paymentMethodSummary{},
+		NotIncluded:    userExportNotIncluded,
+	}
+
+	addresses, err := s.UserAddressRepo.FindAddressesByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	doc.Addresses = addresses
+
+	defaultStore, err := s.MembershipRepo.FindDefaultStore(ctx, user.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if defaultStore != nil {
+		doc.DefaultStore = defaultStore.Store
+	}
+
+	orders, err := s.OrderRepo.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	doc.Orders = orders
+
+	if user.StripeCustomerID != "" {
+		iter, err := s.StripeService.ListPaymentMethods(ctx, user.StripeCustomerID)
+		if err != nil {
+			return nil, err
+		}
+		for iter.Next() {
+			pm := iter.PaymentMethod()
+			summary := paymentMethodSummary{ID: pm.ID}
+			if pm.Card != nil {
+				summary.Brand = string(pm.Card.Brand)
+				summary.Last4 = pm.Card.Last4
+				summary.ExpMonth = pm.Card.ExpMonth
+				summary.ExpYear = pm.Card.ExpYear
+			}
+			doc.PaymentMethods = append(doc.PaymentMethods, summary)
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+func writeExportFile(filePath string, format models.UserExportFormat, doc *userExportDocument) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if format == models.UserExportFormatJSON {
+		return writeExportJSON(file, doc)
+	}
+
+	zw := zip.NewWriter(file)
+	w, err := zw.Create("export.json")
+	if err != nil {
+		return err
+	}
+	if err := writeExportJSON(w, doc); err != nil {
+		return err
+	}
+	if w, err = zw.Create("addresses.csv"); err != nil {
+		return err
+	}
+	if err := writeAddressesCSV(w, doc.Addresses); err != nil {
+		return err
+	}
+	if w, err = zw.Create("orders.csv"); err != nil {
+		return err
+	}
+	if err := writeOrdersCSV(w, doc.Orders); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeExportJSON(w io.Writer, doc *userExportDocument) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+func writeAddressesCSV(w io.Writer, addresses []*models.Address) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "line1", "line2", "city", "state", "country", "postal_code", "label", "phone", "delivery_instructions"})
+	for _, a := range addresses {
+		_ = cw.Write([]string{strconv.FormatInt(a.ID, 10), a.Line1, a.Line2, a.City, a.State, a.Country, a.PostalCode, a.Label, a.Phone, a.DeliveryInstructions})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeOrdersCSV 每个order item一行。
+func writeOrdersCSV(w io.Writer, orders []models.Order) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"order_id", "created_at", "store_id", "payment_intent_id", "delivery_id", "product_id", "product_name", "quantity"})
+	for _, o := range orders {
+		for _, item := range o.OrderItems {
+			productName := ""
+			if item.Product != nil {
+				productName = item.Product.Name
+			}
+			_ = cw.Write([]string{
+				strconv.FormatInt(o.ID, 10),
+				o.CreatedAt.Format(time.RFC3339),
+				strconv.FormatInt(o.StoreID, 10),
+				stringOrEmpty(o.PaymentIntentID),
+				stringOrEmpty(o.DeliveryID),
+				strconv.FormatInt(item.ProductID, 10),
+				productName,
+				strconv.FormatInt(item.Quantity, 10),
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func userExportStallTimeout() time.Duration {
+	if timeout := viper.GetDuration("userExportStallTimeout"); timeout > 0 {
+		return timeout
+	}
+	return defaultUserExportStallTimeout
+}
+
+// UserExportPurgeInterval 是清理过期导出文件的间隔。
+func UserExportPurgeInterval() time.Duration {
+	if interval := viper.GetDuration("userExportPurgeInterval"); interval > 0 {
+		return interval
+	}
+	return defaultUserExportPurgeInterval
+}
+
+func userExportLinkTTL() time.Duration {
+	if ttl := viper.GetDuration("userExportLinkTTL"); ttl > 0 {
+		return ttl
+	}
+	return defaultUserExportLinkTTL
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	"github.com/atomi-ai/atomi/utils"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 没有email或者email没验证过的用户（手机号、匿名登录）用这个域名生成一个占位的email，保证users.email唯一。
+const placeholderEmailDomain = "users.invalid"
+
+var ErrEmailInUse = errors.New("email is already used by another account")
+
+type UserProvisioningService interface {
+	// Lookup 找到principal对应的用户，还没注册过的时候返回gorm.ErrRecordNotFound。
+	Lookup(ctx context.Context, principal *utils.Principal) (*models.User, error)
+	// Provision 找到或者创建principal对应的用户，第一次来的用户会创建Stripe customer，并接受发给他的店员邀请。
+	Provision(ctx context.Context, principal *utils.Principal) (*models.User, error)
+}
+
+type userProvisioningServiceImpl struct {
+	UserRepo          repositories.UserRepository
+	StripeWrapper     utils.StripeWrapper
+	InvitationService StoreInvitationService
+}
+
+func NewUserProvisioningService(
+	userRepo repositories.UserRepository,
+	stripeWrapper utils.StripeWrapper,
+	invitationService StoreInvitationService) UserProvisioningService {
+	return &userProvisioningServiceImpl{
+		UserRepo:          userRepo,
+		StripeWrapper:     stripeWrapper,
+		InvitationService: invitationService,
+	}
+}
+
+func (s *userProvisioningServiceImpl) Lookup(ctx context.Context, principal *utils.Principal) (*models.User, error) {
+	if principal.Subject != "" {
+		user, err := s.UserRepo.FindByAuthSubject(ctx, principal.Provider, principal.Subject)
+		if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+			return user, err
+		}
+	}
+	if principal.Email == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	// 以前的用户只有email，没有记录subject。
+	user, err := s.UserRepo.FindByEmail(ctx, principal.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user.AuthSubject != nil && principal.Subject != "" {
+		// email已经属于另一个登录身份了。
+		return nil, gorm.ErrRecordNotFound
+	}
+	if !emailTrusted(principal) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (s *userProvisioningServiceImpl) Provision(ctx context.Context, principal *utils.Principal) (*models.User, error) {
+	user, err := s.Lookup(ctx, principal)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	isNew := err != nil
+	if isNew {
+		// 没有被验证过的email不能拿来认领已经存在的账号。
+		if principal.Email != "" {
+			if _, err := s.UserRepo.FindByEmail(ctx, principal.Email); err == nil {
+				return nil, ErrEmailInUse
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+		}
+		// 没验证过的email也不存，不然别人验证了这个email之后就注册不了了，先用占位的email。
+		email := placeholderEmail(principal)
+		if emailTrusted(principal) {
+			email = principal.Email
+		}
+		user = &models.User{
+			Email: email,
+			Role:  models.RoleUser,
+			Phone: principal.Phone,
+		}
+	}
+
+	dirty := isNew
+	// email验证过之后换掉占位的email，被别人先用了就还留着占位的。
+	if !isNew && emailTrusted(principal) && user.Email == placeholderEmail(principal) {
+		if _, err := s.UserRepo.FindByEmail(ctx, principal.Email); errors.Is(err, gorm.ErrRecordNotFound) {
+			user.Email = principal.Email
+			dirty = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if principal.Subject != "" && user.AuthSubject == nil {
+		subject := principal.Subject
+		user.AuthProvider = principal.Provider
+		user.AuthSubject = &subject
+		dirty = true
+	}
+	if user.StripeCustomerID == "" {
+		stripeEmail := ""
+		if emailTrusted(principal) {
+			stripeEmail = principal.Email
+		}
+		stripeCustomer, err := s.StripeWrapper.CreateCustomer(ctx, stripeEmail)
+		if err != nil {
+			log.WithContext(ctx).Errorf("Error creating Stripe customer(%v), err: \n%v", user.Email, err)
+			return nil, err
+		}
+		user.StripeCustomerID = stripeCustomer.ID
+		dirty = true
+	}
+	if dirty {
+		saved, err := s.UserRepo.Save(ctx, user)
+		if err != nil {
+			log.WithContext(ctx).Errorf("Errors in saving user %v, err: \n%v", user.Email, err)
+			return nil, err
+		}
+		user = saved
+	}
+
+	// 把发给这个email的店员邀请关联到用户上，email没验证过的时候什么都不做。失败了也不影响登录，下次再试。
+	if _, err := s.InvitationService.AcceptPending(ctx, user, principal); err != nil {
+		log.WithContext(ctx).Errorf("Errors in accepting store invitations for user %v, err: \n%v", user.ID, err)
+	}
+	return user, nil
+}
+
+// emailTrusted 判断token里的email能不能用来识别用户。不管是哪个登录服务，email都要验证过，
+// 否则谁都可以用别人的email注册一个账号来认领已有的用户和店员邀请。
+func emailTrusted(principal *utils.Principal) bool {
+	return principal.Email != "" && principal.EmailVerified
+}
+
+func placeholderEmail(principal *utils.Principal) string {
+	return principal.Subject + "@" + principal.Provider + "." + placeholderEmailDomain
+}
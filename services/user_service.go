@@ -1,37 +1,59 @@
 package services
 
 import (
+	"context"
+
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/repositories"
 )
 
 type UserService interface {
-	SetDefaultShippingAddress(user *models.User, addressID int64) (*models.User, error)
-	SetDefaultBillingAddress(user *models.User, addressID int64) (*models.User, error)
-	SetCurrentPaymentMethod(user *models.User, paymentMethodID *string) (*models.User, error)
+	SetDefaultShippingAddress(ctx context.Context, user *models.User, addressID int64) (*models.User, error)
+	SetDefaultBillingAddress(ctx context.Context, user *models.User, addressID int64) (*models.User, error)
+	SetCurrentPaymentMethod(ctx context.Context, user *models.User, paymentMethodID *string) (*models.User, error)
 }
 
 type userService struct {
-	UserRepo repositories.UserRepository
+	UserRepo        repositories.UserRepository
+	UserAddressRepo repositories.UserAddressRepository
 }
 
-func NewUserService(userRepo repositories.UserRepository) UserService {
+func NewUserService(userRepo repositories.UserRepository, userAddressRepo repositories.UserAddressRepository) UserService {
 	return &userService{
-		UserRepo: userRepo,
+		UserRepo:        userRepo,
+		UserAddressRepo: userAddressRepo,
 	}
 }
 
-func (us *userService) SetDefaultShippingAddress(user *models.User, addressID int64) (*models.User, error) {
+// 默认地址只能是用户自己的地址
+func (us *userService) checkAddressOwner(ctx context.Context, user *models.User, addressID int64) error {
+	userAddress, err := us.UserAddressRepo.FindByUserIDAndAddressID(ctx, user.ID, addressID)
+	if err != nil {
+		return err
+	}
+	if userAddress == nil {
+		return ErrUserAddressNotFound
+	}
+	return nil
+}
+
+func (us *userService) SetDefaultShippingAddress(ctx context.Context, user *models.User, addressID int64) (*models.User, error) {
+	if err := us.checkAddressOwner(ctx, user, addressID); err != nil {
+		return nil, err
+	}
 	user.DefaultShippingAddressID = addressID
-	return us.UserRepo.Save(user)
+	return us.UserRepo.Save(ctx, user)
 }
 
-func (us *userService) SetDefaultBillingAddress(user *models.User, addressID int64) (*models.User, error) {
+func (us *userService) SetDefaultBillingAddress(ctx context.Context, user *models.User, addressID int64) (*models.User, error) {
+	if err := us.checkAddressOwner(ctx, user, addressID); err != nil {
+		return nil, err
+	}
 	user.DefaultBillingAddressID = addressID
-	return us.UserRepo.Save(user)
+	return us.UserRepo.Save(ctx, user)
 }
 
-func (us *userService) SetCurrentPaymentMethod(user *models.User, paymentMethodID *string) (*models.User, error) {
+func (us *userService) SetCurrentPaymentMethod(ctx context.Context, user *models.User, paymentMethodID *string) (*models.User, error) {
 	user.PaymentMethodID = paymentMethodID
-	return us.UserRepo.Save(user)
+	return us.UserRepo.Save(ctx, user)
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const taxRatesUsage = `usage: atomi tax-rates <command>
+
+  import <dir|file>...  校验并导入csv，成为新的生效版本（没有导入的州沿用当前版本）
+  list                  列出所有版本
+  activate <id>         切换回之前的某个版本
+`
+
+// runTaxRatesCommand 处理 atomi tax-rates ...，不用重启服务就能导入新的月度税率文件。
+func runTaxRatesCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, taxRatesUsage)
+		return 2
+	}
+
+	utils.LoadConfig()
+	initLogrus()
+	db := models.InitDB()
+	service := services.NewTaxRateImportService(repositories.NewTaxRateRepository(db), repositories.NewAuditLogRepository(db), repositories.NewTransactor(db))
+
+	ctx := context.Background()
+	switch args[0] {
+	case "import":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, taxRatesUsage)
+			return 2
+		}
+		files, err := readTaxRateFiles(args[1:])
+		if err != nil {
+			log.Errorf("Failed to read tax rate files: %v", err)
+			return 1
+		}
+		dataset, err := service.Import(ctx, nil, files)
+		if err != nil {
+			log.Errorf("Failed to import tax rates: %v", err)
+			return 1
+		}
+		printTaxRateDatasets([]*models.TaxRateDataset{dataset})
+	case "list":
+		datasets, err := service.ListDatasets(ctx)
+		if err != nil {
+			log.Errorf("Failed to list tax rate datasets: %v", err)
+			return 1
+		}
+		printTaxRateDatasets(datasets)
+	case "activate":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, taxRatesUsage)
+			return 2
+		}
+		datasetID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid dataset id %q\n", args[1])
+			return 2
+		}
+		dataset, err := service.Activate(ctx, nil, datasetID)
+		if err != nil {
+			log.Errorf("Failed to activate tax rate dataset: %v", err)
+			return 1
+		}
+		printTaxRateDatasets([]*models.TaxRateDataset{dataset})
+	default:
+		fmt.Fprint(os.Stderr, taxRatesUsage)
+		return 2
+	}
+	return 0
+}
+
+// readTaxRateFiles 读取参数里的csv文件，目录的话读取下面所有的csv。
+func readTaxRateFiles(paths []string) ([]services.TaxRateFile, error) {
+	var files []services.TaxRateFile
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		filePaths := []string{path}
+		if info.IsDir() {
+			if filePaths, err = filepath.Glob(filepath.Join(path, "*.csv")); err != nil {
+				return nil, err
+			}
+		}
+		for _, filePath := range filePaths {
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, services.TaxRateFile{Name: filepath.Base(filePath), Content: content})
+		}
+	}
+	return files, nil
+}
+
+func printTaxRateDatasets(datasets []*models.TaxRateDataset) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEFFECTIVE\tROWS\tACTIVE\tCREATED AT\tSOURCE FILES")
+	for _, dataset := range datasets {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%v\t%s\t%s\n", dataset.ID, dataset.EffectiveDate.Format("2006-01"), dataset.RowCount,
+			dataset.Active, dataset.CreatedAt.Format(time.RFC3339), dataset.SourceFiles)
+	}
+	w.Flush()
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/tests"
@@ -21,7 +22,7 @@ func TestAddressGetAllAddressesForUser(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
@@ -45,7 +46,7 @@ func TestAddressGetAllAddressesForUser(t *testing.T) {
 
 	// 使用 AddressService 为用户添加地址
 	for _, address := range addresses {
-		_, err := app.AddressService.AddAddressForUser(user, address)
+		_, err := app.AddressService.AddAddressForUser(context.Background(), user, address)
 		if err != nil {
 			t.Fatalf("Failed to add address for user: %v", err)
 		}
@@ -54,6 +55,7 @@ func TestAddressGetAllAddressesForUser(t *testing.T) {
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/addresses", nil)
 	c.Set("user", user)
 
 	// 调用 GetAllAddressesForUser
@@ -90,7 +92,7 @@ func TestAddressAddAddressForUser(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
@@ -132,12 +134,17 @@ func TestAddressAddAddressForUser(t *testing.T) {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
+	// 国家规范成ISO代码
+	address.Country = "US"
+	if respAddress.ValidatedAt == nil {
+		t.Errorf("Expected validated_at to be set, got nil")
+	}
 	if respAddress.Line1 != address.Line1 || respAddress.City != address.City || respAddress.State != address.State || respAddress.Country != address.Country || respAddress.PostalCode != address.PostalCode {
 		t.Errorf("Expected address %v, got %v", address, respAddress)
 	}
 
 	// 确保地址已保存在数据库中
-	dbAddresses, err := app.AddressService.GetAddressesByUserID(user.ID)
+	dbAddresses, err := app.AddressService.GetAddressesByUserID(context.Background(), user.ID)
 	if err != nil {
 		t.Fatalf("Failed to get addresses from database: %v", err)
 	}
@@ -151,6 +158,170 @@ func TestAddressAddAddressForUser(t *testing.T) {
 	}
 }
 
+func TestAddressAddInvalidAddressForUser(t *testing.T) {
+	app, err := tests.Setup("address")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set("user", user)
+	reqBody := `{"line1": "123 Main St", "city": "", "state": "XX", "country": "US", "postal_code": "1234"}`
+	c.Request = httptest.NewRequest("POST", "/addresses", bytes.NewBufferString(reqBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	app.AddressController.AddAddressForUser(c)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	for _, field := range []string{"city", "state", "postal_code"} {
+		if resp.Fields[field] == "" {
+			t.Errorf("Expected an error for %v, got %v", field, resp.Fields)
+		}
+	}
+	if _, ok := resp.Fields["line1"]; ok {
+		t.Errorf("Expected no error for line1, got %v", resp.Fields)
+	}
+
+	addresses, err := app.AddressService.GetAddressesByUserID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get addresses: %v", err)
+	}
+	if len(addresses) != 0 {
+		t.Errorf("Expected invalid address not to be saved, got %d addresses", len(addresses))
+	}
+}
+
+func TestAddressUpdateAddressForUser(t *testing.T) {
+	app, err := tests.Setup("address")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
+	if user, err = app.UserRepository.Save(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	address, err := app.AddressService.AddAddressForUser(ctx, user, &models.Address{Line1: "123 Main St", City: "San Francisco", State: "CA", PostalCode: "12345"})
+	if err != nil {
+		t.Fatalf("Failed to add address for user: %v", err)
+	}
+	if user, err = app.UserService.SetDefaultShippingAddress(ctx, user, address.ID); err != nil {
+		t.Fatalf("Failed to set default shipping address: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	reqBody := `{"line1": "456 Market St", "city": "San Francisco", "state": "CA", "postal_code": "12345", "label": " Work ", "phone": "(415) 555-0123", "delivery_instructions": "Leave at the front desk"}`
+	c.Request = httptest.NewRequest("PUT", "/api/addresses/"+strconv.FormatInt(address.ID, 10), bytes.NewBufferString(reqBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = []gin.Param{{Key: "addressId", Value: strconv.FormatInt(address.ID, 10)}}
+	c.Set("user", user)
+
+	app.AddressController.UpdateAddressForUser(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+	var updated models.Address
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if updated.ID == address.ID || updated.Line1 != "456 Market St" || updated.Label != "Work" || updated.Phone != "+14155550123" || updated.DeliveryInstructions != "Leave at the front desk" {
+		t.Errorf("Expected a new normalized address, got %+v", updated)
+	}
+
+	// 原来的地址不变，用户的地址和默认地址换成新的
+	if old, err := app.AddressRepository.FindByID(ctx, address.ID); err != nil || old.Line1 != "123 Main St" {
+		t.Errorf("Expected the old address to be kept, got %+v, err: %v", old, err)
+	}
+	addresses, err := app.AddressService.GetAddressesByUserID(ctx, user.ID)
+	if err != nil || len(addresses) != 1 || addresses[0].ID != updated.ID {
+		t.Errorf("Expected the user to have only the new address, got %+v, err: %v", addresses, err)
+	}
+	saved, err := app.UserRepository.GetByID(ctx, user.ID)
+	if err != nil || saved.DefaultShippingAddressID != updated.ID || user.DefaultShippingAddressID != updated.ID {
+		t.Errorf("Expected default shipping address %d, got %+v, err: %v", updated.ID, saved, err)
+	}
+}
+
+func TestAddressOwnership(t *testing.T) {
+	app, err := tests.Setup("address")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	owner := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
+	other := &models.User{Name: "Jane Doe", Email: "jane.doe@example.com"}
+	for _, u := range []*models.User{owner, other} {
+		if _, err = app.UserRepository.Save(ctx, u); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	address, err := app.AddressService.AddAddressForUser(ctx, owner, &models.Address{Line1: "123 Main St", City: "San Francisco", State: "CA", PostalCode: "12345"})
+	if err != nil {
+		t.Fatalf("Failed to add address for user: %v", err)
+	}
+	addressID := strconv.FormatInt(address.ID, 10)
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		body    string
+		handler func(c *gin.Context)
+	}{
+		{name: "update", method: "PUT", body: `{"line1": "1 Main St", "city": "San Francisco", "state": "CA", "postal_code": "12345"}`, handler: app.AddressController.UpdateAddressForUser},
+		{name: "delete", method: "DELETE", handler: app.AddressController.DeleteAddressForUser},
+		{name: "default shipping", method: "POST", handler: app.AddressController.SetDefaultShippingAddress},
+		{name: "default billing", method: "POST", handler: app.AddressController.SetDefaultBillingAddress},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(tc.method, "/api/addresses/"+addressID, bytes.NewBufferString(tc.body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "addressId", Value: addressID}}
+		c.Set("user", other)
+
+		tc.handler(c)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%v: expected status 404 for another user's address, got %d: %s", tc.name, w.Code, w.Body.String())
+		}
+	}
+
+	// 新建地址的时候传别人的地址ID也只会建一个新的地址
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/addresses", bytes.NewBufferString(`{"id": `+addressID+`, "line1": "1 Main St", "city": "San Francisco", "state": "CA", "postal_code": "12345"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user", other)
+	app.AddressController.AddAddressForUser(c)
+	var created models.Address
+	if err = json.Unmarshal(w.Body.Bytes(), &created); w.Code != http.StatusOK || err != nil || created.ID == address.ID {
+		t.Errorf("Expected a new address, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if saved, err := app.UserRepository.GetByID(ctx, other.ID); err != nil || saved.DefaultShippingAddressID != 0 || saved.DefaultBillingAddressID != 0 {
+		t.Errorf("Expected no default addresses, got %+v, err: %v", saved, err)
+	}
+	if addresses, err := app.AddressService.GetAddressesByUserID(ctx, owner.ID); err != nil || len(addresses) != 1 || addresses[0].Line1 != "123 Main St" {
+		t.Errorf("Expected the owner's address to be unchanged, got %+v, err: %v", addresses, err)
+	}
+}
+
 func TestAddressDeleteAddressForUser(t *testing.T) {
 	// 初始化测试应用
 	app, err := tests.Setup("address")
@@ -160,7 +331,7 @@ func TestAddressDeleteAddressForUser(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
@@ -174,7 +345,7 @@ func TestAddressDeleteAddressForUser(t *testing.T) {
 	}
 
 	// 使用 AddressService 为用户添加地址
-	address, err = app.AddressService.AddAddressForUser(user, address)
+	address, err = app.AddressService.AddAddressForUser(context.Background(), user, address)
 	if err != nil {
 		t.Fatalf("Failed to add address for user: %v", err)
 	}
@@ -182,6 +353,7 @@ func TestAddressDeleteAddressForUser(t *testing.T) {
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("DELETE", "/api/addresses/1", nil)
 	c.Set("user", user)
 
 	// 设置请求参数
@@ -208,7 +380,7 @@ func TestAddressDeleteAddressForUser(t *testing.T) {
 	}
 
 	// 确保地址已从数据库中删除
-	dbAddresses, err := app.AddressService.GetAddressesByUserID(user.ID)
+	dbAddresses, err := app.AddressService.GetAddressesByUserID(context.Background(), user.ID)
 	if err != nil {
 		t.Fatalf("Failed to get addresses from database: %v", err)
 	}
@@ -227,7 +399,7 @@ func TestAddressSetDefaultShippingAddress(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
@@ -241,7 +413,7 @@ func TestAddressSetDefaultShippingAddress(t *testing.T) {
 	}
 
 	// 使用 AddressService 为用户添加地址
-	address, err = app.AddressService.AddAddressForUser(user, address)
+	address, err = app.AddressService.AddAddressForUser(context.Background(), user, address)
 	if err != nil {
 		t.Fatalf("Failed to add address for user: %v", err)
 	}
@@ -249,6 +421,7 @@ func TestAddressSetDefaultShippingAddress(t *testing.T) {
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/addresses/shipping/1", nil)
 	c.Set("user", user)
 
 	// 设置请求参数
@@ -284,7 +457,7 @@ func TestAddressSetDefaultBillingAddress(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
@@ -298,7 +471,7 @@ func TestAddressSetDefaultBillingAddress(t *testing.T) {
 	}
 
 	// 使用 AddressService 为用户添加地址
-	address, err = app.AddressService.AddAddressForUser(user, address)
+	address, err = app.AddressService.AddAddressForUser(context.Background(), user, address)
 	if err != nil {
 		t.Fatalf("Failed to add address for user: %v", err)
 	}
@@ -306,6 +479,7 @@ func TestAddressSetDefaultBillingAddress(t *testing.T) {
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/addresses/billing/1", nil)
 	c.Set("user", user)
 
 	// 设置请求参数
@@ -341,7 +515,7 @@ func TestAddressGetDefaultShippingAddress(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
@@ -355,13 +529,13 @@ func TestAddressGetDefaultShippingAddress(t *testing.T) {
 	}
 
 	// 使用 AddressService 为用户添加地址
-	address, err = app.AddressService.AddAddressForUser(user, address)
+	address, err = app.AddressService.AddAddressForUser(context.Background(), user, address)
 	if err != nil {
 		t.Fatalf("Failed to add address for user: %v", err)
 	}
 
 	// 使用 UserService 为用户设置默认收货地址
-	user, err = app.UserService.SetDefaultShippingAddress(user, address.ID)
+	user, err = app.UserService.SetDefaultShippingAddress(context.Background(), user, address.ID)
 	if err != nil {
 		t.Fatalf("Failed to set default shipping address for user: %v", err)
 	}
@@ -369,6 +543,7 @@ func TestAddressGetDefaultShippingAddress(t *testing.T) {
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/addresses/shipping", nil)
 	c.Set("user", user)
 
 	// 调用 GetDefaultShippingAddress
@@ -399,7 +574,7 @@ func TestAddressGetDefaultBillingAddress(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
@@ -413,13 +588,13 @@ func TestAddressGetDefaultBillingAddress(t *testing.T) {
 	}
 
 	// 使用 AddressService 为用户添加地址
-	address, err = app.AddressService.AddAddressForUser(user, address)
+	address, err = app.AddressService.AddAddressForUser(context.Background(), user, address)
 	if err != nil {
 		t.Fatalf("Failed to add address for user: %v", err)
 	}
 
 	// 使用 UserService 为用户设置默认账单地址
-	user, err = app.UserService.SetDefaultBillingAddress(user, address.ID)
+	user, err = app.UserService.SetDefaultBillingAddress(context.Background(), user, address.ID)
 	if err != nil {
 		t.Fatalf("Failed to set default billing address for user: %v", err)
 	}
@@ -427,6 +602,7 @@ func TestAddressGetDefaultBillingAddress(t *testing.T) {
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/addresses/billing", nil)
 	c.Set("user", user)
 
 	// 调用 GetDefaultBillingAddress
@@ -457,7 +633,7 @@ func TestAddressDeleteAllAddressesForUser(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
@@ -481,7 +657,7 @@ func TestAddressDeleteAllAddressesForUser(t *testing.T) {
 
 	// 使用 AddressService 为用户添加地址
 	for _, address := range addresses {
-		_, err := app.AddressService.AddAddressForUser(user, address)
+		_, err := app.AddressService.AddAddressForUser(context.Background(), user, address)
 		if err != nil {
 			t.Fatalf("Failed to add address for user: %v", err)
 		}
@@ -490,6 +666,7 @@ func TestAddressDeleteAllAddressesForUser(t *testing.T) {
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("DELETE", "/api/addresses", nil)
 	c.Set("user", user)
 
 	// 调用 DeleteAllAddressesForUser
@@ -501,7 +678,7 @@ func TestAddressDeleteAllAddressesForUser(t *testing.T) {
 	}
 
 	// 确保所有地址都已删除
-	respAddresses, err := app.AddressService.GetAddressesByUserID(user.ID)
+	respAddresses, err := app.AddressService.GetAddressesByUserID(context.Background(), user.ID)
 	if err != nil {
 		t.Fatalf("Failed to get addresses for user: %v", err)
 	}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/tests"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminChangeRoleAndSuspendUser(t *testing.T) {
+	// 初始化测试应用
+	app, err := tests.Setup("admin")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+
+	admin := &models.User{Email: "admin@example.com", Role: models.RoleAdmin}
+	if admin, err = app.UserRepository.Save(context.Background(), admin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	user := &models.User{Email: "promote.me@example.com", Role: models.RoleUser}
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// 用admin的身份注册admin路由
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user", admin) })
+	app.AdminController.RegisterRoutes(r.Group("/api/admin"))
+
+	// 提升为manager
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/admin/users/%d/role", user.ID), strings.NewReader(`{"role":"MANAGER"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	updated, err := app.UserRepository.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("Failed to reload user: %v", err)
+	}
+	if updated.Role != models.RoleMgr {
+		t.Errorf("Expected role %v, got %v", models.RoleMgr, updated.Role)
+	}
+
+	// 停用账号
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/admin/users/%d/suspend", user.ID), strings.NewReader(`{"reason":"fraud"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 检查审计日志
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/admin/users/%d/audit-logs", user.ID), nil)
+	r.ServeHTTP(w, req)
+	var auditLogs []models.AuditLog
+	if err := json.Unmarshal(w.Body.Bytes(), &auditLogs); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(auditLogs) != 2 || auditLogs[0].Action != "user.suspend" || auditLogs[1].Action != "user.change_role" {
+		t.Errorf("Unexpected audit logs: %+v", auditLogs)
+	}
+	for _, auditLog := range auditLogs {
+		if auditLog.ActorID != admin.ID {
+			t.Errorf("Expected actor %d, got %d", admin.ID, auditLog.ActorID)
+		}
+	}
+
+	// 管理员不能停用自己
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/admin/users/%d/suspend", admin.ID), nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 Forbidden, got %d", w.Code)
+	}
+}
+
+func TestAdminSetTaxExempt(t *testing.T) {
+	app, err := tests.Setup("admin_tax_exempt")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+
+	admin := &models.User{Email: "admin@example.com", Role: models.RoleAdmin}
+	if admin, err = app.UserRepository.Save(context.Background(), admin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	user := &models.User{Email: "charity@example.com", Role: models.RoleUser}
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user", admin) })
+	app.AdminController.RegisterRoutes(r.Group("/api/admin"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/admin/users/%d/tax-exempt", user.ID), strings.NewReader(`{"tax_exempt":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+	if updated, err := app.UserRepository.GetByID(context.Background(), user.ID); err != nil || !updated.TaxExempt {
+		t.Errorf("Expected user to be tax exempt, got %+v, err: %v", updated, err)
+	}
+
+	// 没有tax_exempt字段
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/api/admin/users/%d/tax-exempt", user.ID), strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 Bad Request, got %d", w.Code)
+	}
+}
+
+func uploadTaxRates(t *testing.T, r *gin.Engine, files map[string]string) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		part.Write([]byte(content))
+	}
+	writer.Close()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/admin/tax-rates/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminImportTaxRates(t *testing.T) {
+	app, err := tests.Setup("admin_tax_rates")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	admin := &models.User{Email: "admin@example.com", Role: models.RoleAdmin}
+	if admin, err = app.UserRepository.Save(ctx, admin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user", admin) })
+	app.AdminController.RegisterRoutes(r.Group("/api/admin"))
+
+	// 第一次导入两个州
+	w := uploadTaxRates(t, r, map[string]string{
+		"TAXRATES_ZIP5_CA202304.csv": "State,ZipCode,TaxRegionName,EstimatedCombinedRate\nCA,94016,SAN FRANCISCO,0.086250\nCA,94017,SAN FRANCISCO,0.086250\n",
+		"TAXRATES_ZIP5_WA202304.csv": "State,ZipCode,EstimatedCombinedRate\nWA,98004,0.101000\n",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var first models.TaxRateDataset
+	json.Unmarshal(w.Body.Bytes(), &first)
+	if first.RowCount != 3 || !first.Active || first.EffectiveDate.Format("2006-01") != "2023-04" {
+		t.Errorf("Unexpected dataset %+v", first)
+	}
+
+	// 有错误的文件整个不导入，原来的数据不受影响
+	w = uploadTaxRates(t, r, map[string]string{
+		"TAXRATES_ZIP5_CA202305.csv": "State,ZipCode,EstimatedCombinedRate\nCA,94016,0.090000\nCA,9401,abc\n",
+	})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "line 3") {
+		t.Errorf("Expected validation error for line 3, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 只导入新的CA文件，WA沿用上一个版本
+	w = uploadTaxRates(t, r, map[string]string{
+		"TAXRATES_ZIP5_CA202305.csv": "State,ZipCode,EstimatedCombinedRate\nCA,94016,0.090000\n",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var second models.TaxRateDataset
+	json.Unmarshal(w.Body.Bytes(), &second)
+	if second.RowCount != 2 || second.EffectiveDate.Format("2006-01") != "2023-05" {
+		t.Errorf("Unexpected dataset %+v", second)
+	}
+	rate, err := app.TaxRateService.GetTaxRateByZipCodeAndState(ctx, &models.Address{PostalCode: "94016", State: "CA"})
+	if err != nil || rate.EstimatedCombinedRate != 0.09 {
+		t.Errorf("Expected new CA rate, got %+v, err: %v", rate, err)
+	}
+	if _, err = app.TaxRateService.GetTaxRateByZipCodeAndState(ctx, &models.Address{PostalCode: "94017", State: "CA"}); err == nil {
+		t.Errorf("Expected 94017 to be gone after the CA file was replaced")
+	}
+	if rate, err = app.TaxRateService.GetTaxRateByZipCodeAndState(ctx, &models.Address{PostalCode: "98004", State: "WA"}); err != nil || rate.EstimatedCombinedRate != 0.101 {
+		t.Errorf("Expected WA rate to be carried over, got %+v, err: %v", rate, err)
+	}
+
+	// 切换回第一个版本
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/admin/tax-rates/datasets/%d/activate", first.ID), nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+	rate, err = app.TaxRateService.GetTaxRateByZipCodeAndState(ctx, &models.Address{PostalCode: "94016", State: "CA"})
+	if err != nil || rate.EstimatedCombinedRate != 0.08625 {
+		t.Errorf("Expected old CA rate after rollback, got %+v, err: %v", rate, err)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/admin/tax-rates/datasets", nil)
+	r.ServeHTTP(w, req)
+	var datasets []models.TaxRateDataset
+	json.Unmarshal(w.Body.Bytes(), &datasets)
+	if len(datasets) != 2 || datasets[0].ID != second.ID || datasets[0].Active || !datasets[1].Active {
+		t.Errorf("Unexpected datasets %+v", datasets)
+	}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atomi-ai/atomi/controllers"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthController(t *testing.T) {
+	var dbErr error
+	registry := utils.NewHealthRegistry()
+	registry.Register(utils.HealthCheck{
+		Name:     "database",
+		Check:    func(ctx context.Context) error { return dbErr },
+		CacheTTL: -1,
+		Critical: true,
+	})
+	registry.Register(utils.HealthCheck{
+		Name:  "user_export_worker",
+		Check: func(ctx context.Context) error { return nil },
+	})
+
+	r := gin.New()
+	healthController := controllers.NewHealthController(registry)
+	r.GET("/healthz", healthController.Liveness)
+	r.GET("/readyz", healthController.Readiness)
+	r.GET("/api/admin/health", healthController.Report)
+	call := func(path string) (int, *utils.HealthReport) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var report utils.HealthReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return w.Code, &report
+	}
+
+	if code, report := call("/readyz"); code != http.StatusOK || report.Status != utils.HealthStatusOK || len(report.Checks) != 0 {
+		t.Errorf("Expected ready without details, got %d %+v", code, report)
+	}
+	if code, report := call("/api/admin/health"); code != http.StatusOK || report.Status != utils.HealthStatusOK || len(report.Checks) != 2 {
+		t.Errorf("Expected a detailed report, got %d %+v", code, report)
+	}
+
+	// DB挂了的时候不再ready，但是进程本身还是活的；错误信息只在admin的报告里
+	dbErr = errors.New("connection refused")
+	if code, report := call("/readyz"); code != http.StatusServiceUnavailable || report.Status != utils.HealthStatusFailing || report.Checks != nil {
+		t.Errorf("Expected not ready without details, got %d %+v", code, report)
+	}
+	if code, report := call("/api/admin/health"); code != http.StatusServiceUnavailable || report.Checks["database"].Error != "connection refused" {
+		t.Errorf("Expected the database error in the report, got %d %+v", code, report)
+	}
+	if code, report := call("/healthz"); code != http.StatusOK || report.Status != utils.HealthStatusOK {
+		t.Errorf("Expected alive, got %d %+v", code, report)
+	}
+
+	dbErr = nil
+	utils.SetDraining(true)
+	defer utils.SetDraining(false)
+	if code, report := call("/readyz"); code != http.StatusServiceUnavailable || report.Status != utils.HealthStatusDraining {
+		t.Errorf("Expected draining, got %d %+v", code, report)
+	}
+}
@@ -2,12 +2,12 @@ package controllers
 
 import (
 	"github.com/atomi-ai/atomi/tests"
+	"github.com/atomi-ai/atomi/utils"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
-	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,13 +22,8 @@ func TestLoginController_Login(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest("POST", "/login", nil)
 
-	// 为模拟的 gin.Context 设置 decodedToken
-	mockToken := &auth.Token{
-		Claims: map[string]interface{}{
-			"email": "test@example.com",
-		},
-	}
-	c.Set("decodedToken", mockToken)
+	// 为模拟的 gin.Context 设置 principal
+	c.Set("principal", &utils.Principal{Email: "test@example.com", EmailVerified: true, Provider: "mock"})
 
 	// 调用 LoginController 的 Login 方法
 	app.LoginController.Login(c)
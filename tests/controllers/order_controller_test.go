@@ -2,12 +2,16 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
 	"github.com/atomi-ai/atomi/tests"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 )
 
@@ -20,39 +24,40 @@ func TestGetUserOrders(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
 	// 创建一个产品
-	product := &models.Product{Name: "Test Product", Price: 9.99, Description: "Test product description"}
-	if err = app.ProductRepository.Save(product); err != nil {
+	product := &models.Product{Name: "Test Product", Price: models.MoneyFromFloat(9.99, "USD"), Description: "Test product description"}
+	if err = app.ProductRepository.Save(context.Background(), product); err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
 	// 创建两个订单
 	order1 := &models.Order{UserID: user.ID}
 	order2 := &models.Order{UserID: user.ID}
-	if err = app.OrderRepository.Save(order1); err != nil {
+	if err = app.OrderRepository.Save(context.Background(), order1); err != nil {
 		t.Fatalf("Failed to create order1: %v", err)
 	}
-	if err = app.OrderRepository.Save(order2); err != nil {
+	if err = app.OrderRepository.Save(context.Background(), order2); err != nil {
 		t.Fatalf("Failed to create order2: %v", err)
 	}
 
 	// 创建订单项
 	orderItem1 := &models.OrderItem{OrderID: order1.ID, ProductID: product.ID, Quantity: 1}
 	orderItem2 := &models.OrderItem{OrderID: order2.ID, ProductID: product.ID, Quantity: 2}
-	if err = app.OrderItemRepository.Save(orderItem1); err != nil {
+	if err = app.OrderItemRepository.Save(context.Background(), orderItem1); err != nil {
 		t.Fatalf("Failed to create orderItem1: %v", err)
 	}
-	if err = app.OrderItemRepository.Save(orderItem2); err != nil {
+	if err = app.OrderItemRepository.Save(context.Background(), orderItem2); err != nil {
 		t.Fatalf("Failed to create orderItem2: %v", err)
 	}
 
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/orders", nil)
 	c.Set("user", user)
 
 	// 调用 GetUserOrders
@@ -112,13 +117,13 @@ func TestAddOrderForUser(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
 	// 创建一个产品
-	product := &models.Product{Name: "Test Product", Price: 9.99, Description: "Test product description"}
-	if err = app.ProductRepository.Save(product); err != nil {
+	product := &models.Product{Name: "Test Product", Price: models.MoneyFromFloat(9.99, "USD"), Description: "Test product description"}
+	if err = app.ProductRepository.Save(context.Background(), product); err != nil {
 		t.Fatalf("Failed to create product: %v", err)
 	}
 
@@ -179,3 +184,98 @@ func TestAddOrderForUser(t *testing.T) {
 		t.Errorf("Expected quantity 2, got %d", orderItem.Quantity)
 	}
 }
+
+func TestCalculateOrderTax(t *testing.T) {
+	app, err := tests.Setup("order_tax")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	if _, err = app.TaxRateImportService.Import(ctx, nil, []services.TaxRateFile{
+		{Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.086250\n")},
+	}); err != nil {
+		t.Fatalf("Failed to import tax rates: %v", err)
+	}
+
+	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
+	other := &models.User{Name: "Jane Doe", Email: "jane.doe@example.com"}
+	for _, u := range []*models.User{user, other} {
+		if _, err = app.UserRepository.Save(ctx, u); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		address, err := app.AddressService.AddAddressForUser(ctx, u, &models.Address{Line1: "1 Main St", City: "San Francisco", State: "CA", PostalCode: "94016"})
+		if err != nil {
+			t.Fatalf("Failed to create address: %v", err)
+		}
+		if _, err = app.UserService.SetDefaultShippingAddress(ctx, u, address.ID); err != nil {
+			t.Fatalf("Failed to set default shipping address: %v", err)
+		}
+	}
+	burger := &models.Product{Name: "Burger", Price: models.MoneyFromFloat(12.5, "USD"), Category: models.ProductCategoryPreparedFood}
+	apples := &models.Product{Name: "Apples", Price: models.MoneyFromFloat(3.2, "USD"), Category: models.ProductCategoryGrocery}
+	for _, product := range []*models.Product{burger, apples} {
+		if err = app.ProductRepository.Save(ctx, product); err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+	}
+
+	// 客户端传上来的税额和运费会被忽略
+	order := &models.Order{DeliveryFee: models.NewMoney(1, "USD"), Tax: models.NewMoney(1, "USD"), OrderItems: []models.OrderItem{
+		{ProductID: burger.ID, Quantity: 2}, {ProductID: apples.ID, Quantity: 1},
+	}}
+	if order, err = app.OrderService.AddOrderForUser(ctx, user, order); err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if !order.DeliveryFee.IsZero() {
+		t.Errorf("Expected the client-supplied delivery fee to be cleared, got %v", order.DeliveryFee)
+	}
+	// 运费本来是支付时按Uber报价填的，这里直接写进去
+	order.DeliveryFee = models.NewMoney(499, "USD")
+	if err = app.OrderRepository.Save(ctx, order); err != nil {
+		t.Fatalf("Failed to save delivery fee: %v", err)
+	}
+
+	calculateTax := func(user *models.User, orderID int64) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", fmt.Sprintf("/api/orders/%d/tax", orderID), nil)
+		c.Params = []gin.Param{{Key: "order_id", Value: strconv.FormatInt(orderID, 10)}}
+		c.Set("user", user)
+		app.OrderController.CalculateTax(c)
+		return w
+	}
+
+	w := calculateTax(user, order.ID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %v", w.Code, w.Body.String())
+	}
+	var respOrder models.Order
+	if err = json.Unmarshal(w.Body.Bytes(), &respOrder); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	// 25.00*8.625%=2.15625，苹果和运费不收税
+	if respOrder.Subtotal.Amount != 2820 || respOrder.Tax.Amount != 216 || respOrder.Total != models.NewMoney(2820+499+216, "USD") || respOrder.TaxState != "CA" {
+		t.Errorf("Unexpected tax breakdown %+v", respOrder)
+	}
+
+	saved, err := app.OrderRepository.GetByID(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("Failed to load order: %v", err)
+	}
+	if saved.Tax.Amount != 216 || saved.TaxCalculatedAt == nil {
+		t.Errorf("Expected tax breakdown to be saved, got %+v", saved)
+	}
+	for _, item := range saved.OrderItems {
+		expected := map[int64]int64{burger.ID: 216, apples.ID: 0}[item.ProductID]
+		if item.Tax.Amount != expected || item.UnitPrice.IsZero() {
+			t.Errorf("Unexpected tax for order item %+v", item)
+		}
+	}
+	if metadata := services.OrderTaxMetadata(saved); metadata["tax_amount"] != "216" || metadata["total"] != "3535" {
+		t.Errorf("Unexpected Stripe metadata %v", metadata)
+	}
+
+	if w := calculateTax(other, order.ID); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for another user's order, got %d", w.Code)
+	}
+}
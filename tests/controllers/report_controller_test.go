@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/tests"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTaxLiabilityReportCSV(t *testing.T) {
+	app, err := tests.Setup("report")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+
+	admin := &models.User{Email: "admin@example.com", Role: models.RoleAdmin}
+	if admin, err = app.UserRepository.Save(ctx, admin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	manager := &models.User{Email: "manager@example.com", Role: models.RoleMgr}
+	if manager, err = app.UserRepository.Save(ctx, manager); err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	paidAt := time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC)
+	order := &models.Order{StoreID: 1, PaidAt: &paidAt, TaxCalculatedAt: &paidAt, TaxState: "CA", TaxZipCode: "94016", TaxRateDatasetID: 1,
+		TaxRate: 0.0925, Subtotal: models.NewMoney(1000, "USD"),
+		TaxableSales: models.NewMoney(1000, "USD"), Tax: models.NewMoney(93, "USD"), Total: models.NewMoney(1093, "USD")}
+	if err = app.OrderRepository.Save(ctx, order); err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	get := func(user *models.User, url string) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.Use(func(c *gin.Context) { c.Set("user", user) })
+		app.ReportController.RegisterRoutes(r.Group("/api/admin/reports"))
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// to那一天整天都算在内
+	w := get(admin, "/api/admin/reports/tax-liability?from=2026-09-01&to=2026-09-30&format=csv")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("Expected a CSV, got %d %v: %s", w.Code, w.Header(), w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "CA,94016,1,1,0.0925,USD,1,10.00,0.00,0.93,0.00") {
+		t.Errorf("Unexpected CSV:\n%s", w.Body.String())
+	}
+
+	if w := get(admin, "/api/admin/reports/tax-liability?from=2026-09-30&to=2026-09-01"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid range, got %d", w.Code)
+	}
+	// 店长没有report:view
+	if w := get(manager, "/api/admin/reports/tax-liability?from=2026-09-01&to=2026-09-30"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 Forbidden, got %d", w.Code)
+	}
+}
@@ -1,13 +1,16 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/atomi-ai/atomi/models"
 	"github.com/atomi-ai/atomi/tests"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -20,25 +23,25 @@ func TestStoreGetDefaultStore(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
 	// 创建一个商店
 	store := &models.Store{Name: "Test Store", Address: "123 Main St", City: "New York", State: "NY", ZipCode: "10001", Phone: "555-1234"}
-	if err = app.ManagerStoreRepository.Save(store); err != nil {
+	if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
 		t.Fatalf("Failed to create store: %v", err)
 	}
 
 	// 为用户设置默认商店
-	userStore := &models.UserStore{UserID: user.ID, StoreID: store.ID, IsEnable: true}
-	if err = app.UserStoreRepository.Save(userStore); err != nil {
+	if err = app.StoreMembershipRepository.SetDefaultStore(context.Background(), user.ID, store.ID); err != nil {
 		t.Fatalf("Failed to set default store for user: %v", err)
 	}
 
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/default-store", nil)
 	c.Set("user", user)
 
 	// 调用 GetDefaultStore
@@ -69,30 +72,30 @@ func TestStoreSetDefaultStore(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "Jane Doe", Email: "jane.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
 	// 创建两个商店
 	store1 := &models.Store{Name: "Test Store 1", Address: "123 Main St", City: "New York", State: "NY", ZipCode: "10001", Phone: "555-1234"}
-	if err = app.ManagerStoreRepository.Save(store1); err != nil {
+	if err = app.ManagerStoreRepository.Save(context.Background(), store1); err != nil {
 		t.Fatalf("Failed to create store1: %v", err)
 	}
 
 	store2 := &models.Store{Name: "Test Store 2", Address: "456 Main St", City: "New York", State: "NY", ZipCode: "10002", Phone: "555-5678"}
-	if err = app.ManagerStoreRepository.Save(store2); err != nil {
+	if err = app.ManagerStoreRepository.Save(context.Background(), store2); err != nil {
 		t.Fatalf("Failed to create store2: %v", err)
 	}
 
 	// 为用户设置默认商店
-	userStore := &models.UserStore{UserID: user.ID, StoreID: store1.ID, IsEnable: true}
-	if err = app.UserStoreRepository.Save(userStore); err != nil {
+	if err = app.StoreMembershipRepository.SetDefaultStore(context.Background(), user.ID, store1.ID); err != nil {
 		t.Fatalf("Failed to set default store for user: %v", err)
 	}
 
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("PUT", "/api/default-store/1", nil)
 	c.Set("user", user)
 
 	// 设置请求参数
@@ -122,13 +125,13 @@ func TestStoreSetDefaultStore(t *testing.T) {
 	}
 
 	// 验证用户的默认商店已更改
-	newUserStore, err := app.UserStoreRepository.FindDefaultUserStore(user.ID)
+	newDefaultStore, err := app.StoreMembershipRepository.FindDefaultStore(context.Background(), user.ID)
 	if err != nil {
 		t.Fatalf("Failed to find default user store: %v", err)
 	}
 
-	if newUserStore.StoreID != store2.ID {
-		t.Errorf("Expected default store ID to be %d, got %d", store2.ID, newUserStore.StoreID)
+	if newDefaultStore.StoreID != store2.ID {
+		t.Errorf("Expected default store ID to be %d, got %d", store2.ID, newDefaultStore.StoreID)
 	}
 }
 
@@ -141,18 +144,19 @@ func TestStoreGetAllStores(t *testing.T) {
 
 	// 创建两个商店
 	store1 := &models.Store{Name: "Test Store 1", Address: "123 Main St", City: "New York", State: "NY", ZipCode: "10001", Phone: "555-1234"}
-	if err = app.ManagerStoreRepository.Save(store1); err != nil {
+	if err = app.ManagerStoreRepository.Save(context.Background(), store1); err != nil {
 		t.Fatalf("Failed to create store1: %v", err)
 	}
 
 	store2 := &models.Store{Name: "Test Store 2", Address: "456 Main St", City: "New York", State: "NY", ZipCode: "10002", Phone: "555-5678"}
-	if err = app.ManagerStoreRepository.Save(store2); err != nil {
+	if err = app.ManagerStoreRepository.Save(context.Background(), store2); err != nil {
 		t.Fatalf("Failed to create store2: %v", err)
 	}
 
 	// 准备一个测试上下文
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/stores", nil)
 
 	// 调用 GetAllStores
 	app.StoreController.GetAllStores(c)
@@ -189,25 +193,25 @@ func TestStoreDeleteDefaultStore(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
 	// 创建一个商店
 	store := &models.Store{Name: "Test Store", Address: "123 Main St", City: "New York", State: "NY", ZipCode: "10001", Phone: "555-1234"}
-	if err = app.ManagerStoreRepository.Save(store); err != nil {
+	if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
 		t.Fatalf("Failed to create store: %v", err)
 	}
 
 	// 为用户设置默认商店
-	userStore := &models.UserStore{UserID: user.ID, StoreID: store.ID, IsEnable: true}
-	if err = app.UserStoreRepository.Save(userStore); err != nil {
+	if err = app.StoreMembershipRepository.SetDefaultStore(context.Background(), user.ID, store.ID); err != nil {
 		t.Fatalf("Failed to set default store for user: %v", err)
 	}
 
 	// 准备一个测试上下文并设置用户
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("DELETE", "/api/default-store", nil)
 	c.Set("user", user)
 
 	// 调用 DeleteDefaultStore
@@ -229,9 +233,9 @@ func TestStoreDeleteDefaultStore(t *testing.T) {
 	}
 
 	// 确保默认商店已被删除
-	deletedUserStore, err := app.UserStoreRepository.FindDefaultUserStore(user.ID)
+	deletedDefaultStore, err := app.StoreMembershipRepository.FindDefaultStore(context.Background(), user.ID)
 	if err == nil {
-		t.Errorf("Expected default store to be deleted, got %+v", deletedUserStore)
+		t.Errorf("Expected default store to be deleted, got %+v", deletedDefaultStore)
 	}
 }
 
@@ -244,33 +248,34 @@ func TestGetProductsByStoreID(t *testing.T) {
 
 	// 创建一个商店
 	store := &models.Store{Name: "Test Store", Address: "123 Main St", City: "New York", State: "NY", ZipCode: "10001", Phone: "555-1234"}
-	if err = app.ManagerStoreRepository.Save(store); err != nil {
+	if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
 		t.Fatalf("Failed to create store: %v", err)
 	}
 
 	// 创建两个产品
-	product1 := &models.Product{Name: "Product 1", Description: "Product 1 description", Price: 10.00, Category: models.ProductCategoryFood}
-	product2 := &models.Product{Name: "Product 2", Description: "Product 2 description", Price: 5.00, Category: models.ProductCategoryDrink}
-	if err = app.ProductRepository.Save(product1); err != nil {
+	product1 := &models.Product{Name: "Product 1", Description: "Product 1 description", Price: models.MoneyFromFloat(10.00, "USD"), Category: models.ProductCategoryFood}
+	product2 := &models.Product{Name: "Product 2", Description: "Product 2 description", Price: models.MoneyFromFloat(5.00, "USD"), Category: models.ProductCategoryDrink}
+	if err = app.ProductRepository.Save(context.Background(), product1); err != nil {
 		t.Fatalf("Failed to create product1: %v", err)
 	}
-	if err = app.ProductRepository.Save(product2); err != nil {
+	if err = app.ProductRepository.Save(context.Background(), product2); err != nil {
 		t.Fatalf("Failed to create product2: %v", err)
 	}
 
 	// 将产品添加到商店
 	productStore1 := &models.ProductStore{StoreID: store.ID, ProductID: product1.ID, IsEnable: true}
 	productStore2 := &models.ProductStore{StoreID: store.ID, ProductID: product2.ID, IsEnable: true}
-	if err = app.ProductStoreRepository.Save(productStore1); err != nil {
+	if err = app.ProductStoreRepository.Save(context.Background(), productStore1); err != nil {
 		t.Fatalf("Failed to add product1 to store: %v", err)
 	}
-	if err = app.ProductStoreRepository.Save(productStore2); err != nil {
+	if err = app.ProductStoreRepository.Save(context.Background(), productStore2); err != nil {
 		t.Fatalf("Failed to add product2 to store: %v", err)
 	}
 
 	// 准备一个测试上下文
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/products/1", nil)
 
 	// 设置路由参数
 	c.Params = []gin.Param{
@@ -311,3 +316,206 @@ func contains(s []int64, e int64) bool {
 	}
 	return false
 }
+
+func TestStoreFavoriteStores(t *testing.T) {
+	// 初始化测试应用
+	app, err := tests.Setup("store3")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+
+	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	store := &models.Store{Name: "Favorite Store", Address: "123 Main St", City: "New York", State: "NY", ZipCode: "10001", Phone: "555-1234"}
+	if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	// 同一个店既是默认店又是收藏的店
+	if err = app.StoreMembershipRepository.SetDefaultStore(context.Background(), user.ID, store.ID); err != nil {
+		t.Fatalf("Failed to set default store for user: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("PUT", "/api/favorite-stores/1", nil)
+		c.Set("user", user)
+		c.Params = append(c.Params, gin.Param{Key: "store_id", Value: strconv.FormatInt(store.ID, 10)})
+		app.StoreController.AddFavoriteStore(c)
+		if c.Writer.Status() != http.StatusNoContent {
+			t.Fatalf("Expected status 204 No Content, got %d", c.Writer.Status())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/favorite-stores", nil)
+	c.Set("user", user)
+	app.StoreController.GetFavoriteStores(c)
+	var stores []models.Store
+	if err = json.Unmarshal(w.Body.Bytes(), &stores); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(stores) != 1 || stores[0].ID != store.ID {
+		t.Errorf("Expected favorite stores to be [%d], got %+v", store.ID, stores)
+	}
+
+	// 顾客的关系不能用来管理店
+	if app.StoreRepository.CheckUserHasAccessToStore(context.Background(), user, store.ID) {
+		t.Errorf("Expected customer to have no staff access to store %d", store.ID)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("DELETE", "/api/favorite-stores/1", nil)
+	c.Set("user", user)
+	c.Params = append(c.Params, gin.Param{Key: "store_id", Value: strconv.FormatInt(store.ID, 10)})
+	app.StoreController.RemoveFavoriteStore(c)
+	if c.Writer.Status() != http.StatusNoContent {
+		t.Fatalf("Expected status 204 No Content, got %d", c.Writer.Status())
+	}
+	if stores, err = app.StoreMembershipRepository.FindFavoriteStores(context.Background(), user.ID); err != nil || len(stores) != 0 {
+		t.Errorf("Expected no favorite stores, got %+v, err: %v", stores, err)
+	}
+	if _, err = app.StoreMembershipRepository.FindDefaultStore(context.Background(), user.ID); err != nil {
+		t.Errorf("Expected default store to be kept, got err: %v", err)
+	}
+}
+
+func TestStoreCurrency(t *testing.T) {
+	app, err := tests.Setup("store_currency")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	manager := &models.User{Email: "manager@example.com", Role: models.RoleMgr}
+	if manager, err = app.UserRepository.Save(context.Background(), manager); err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	usdProduct := &models.Product{Name: "Imported", Price: models.NewMoney(999, "USD")}
+	if err = app.ProductRepository.Save(context.Background(), usdProduct); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user", manager) })
+	app.ManagerStoreController.RegisterRoutes(r.Group("/api/mgr"))
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("POST", "/api/mgr/store", `{"name":"Bad Store","currency":"dollars"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid currency, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("POST", "/api/mgr/store", `{"name":"Bad Store","locale":"xx-YY"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unsupported locale, got %d: %s", w.Code, w.Body.String())
+	}
+	w := send("POST", "/api/mgr/store", `{"name":"Toronto Store","currency":"cad","locale":"fr_ca"}`)
+	var store models.Store
+	if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &store) != nil || store.Currency != "CAD" || store.Locale != "fr-CA" {
+		t.Fatalf("Expected a CAD store, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// 没有币种的价格用店的币种
+	w = send("POST", fmt.Sprintf("/api/mgr/store/%d/product", store.ID), `{"name":"Poutine","price":{"amount":1250}}`)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"price":{"amount":1250,"currency":"CAD","formatted":"$12.50"}`) {
+		t.Errorf("Expected a product priced in CAD, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("POST", fmt.Sprintf("/api/mgr/store/%d/product", store.ID), `{"name":"Bagel","price":{"amount":300,"currency":"USD"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a product priced in another currency, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("PUT", fmt.Sprintf("/api/mgr/store/add/%d/product/%d", store.ID, usdProduct.ID), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for adding a USD product to a CAD store, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAssignStoreRequiresAdmin(t *testing.T) {
+	app, err := tests.Setup("store_assign")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	manager := &models.User{Email: "manager@example.com", Role: models.RoleMgr}
+	admin := &models.User{Email: "admin@example.com", Role: models.RoleAdmin}
+	for _, user := range []*models.User{manager, admin} {
+		if _, err = app.UserRepository.Save(context.Background(), user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	store := &models.Store{Name: "Someone Else's Store"}
+	if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	assign := func(user *models.User) int {
+		r := gin.New()
+		r.Use(func(c *gin.Context) { c.Set("user", user) })
+		app.ManagerStoreController.RegisterRoutes(r.Group("/api/mgr"))
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/mgr/store/%d", store.ID), nil)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 店长不能把别人的店认领成自己的
+	if code := assign(manager); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 Forbidden, got %d", code)
+	}
+	if app.StoreRepository.CheckUserHasAccessToStore(context.Background(), manager, store.ID) {
+		t.Errorf("Expected manager not to have access to store %d", store.ID)
+	}
+	if code := assign(admin); code != http.StatusNoContent {
+		t.Errorf("Expected status 204 No Content, got %d", code)
+	}
+	if relationship, err := app.StoreRepository.FindStaffRelationship(context.Background(), admin.ID, store.ID); err != nil || relationship != models.StoreRelationshipOwner {
+		t.Errorf("Expected admin to own store %d, got %v, err: %v", store.ID, relationship, err)
+	}
+}
+
+func TestAssignStoreKeepsExistingStaffRole(t *testing.T) {
+	app, err := tests.Setup("store_assign2")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	admin := &models.User{Email: "admin@example.com", Role: models.RoleAdmin}
+	if admin, err = app.UserRepository.Save(ctx, admin); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	store := &models.Store{Name: "Staffed Store"}
+	if err = app.ManagerStoreRepository.Save(ctx, store); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err = app.StoreMembershipRepository.AddStaff(ctx, store.ID, admin.ID, models.StoreRelationshipCashier); err != nil {
+		t.Fatalf("Failed to add staff: %v", err)
+	}
+
+	// 已经是收银员的时候不会被悄悄换成店主
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user", admin) })
+	app.ManagerStoreController.RegisterRoutes(r.Group("/api/mgr"))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/mgr/store/%d", store.ID), nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 Conflict, got %d: %s", w.Code, w.Body.String())
+	}
+	if relationship, err := app.StoreRepository.FindStaffRelationship(ctx, admin.ID, store.ID); err != nil || relationship != models.StoreRelationshipCashier {
+		t.Errorf("Expected relationship %v, got %v, err: %v", models.StoreRelationshipCashier, relationship, err)
+	}
+
+	// 同样的关系再加一次什么都不做，admin可以明确地改
+	if err = app.StoreMembershipRepository.AddStaff(ctx, store.ID, admin.ID, models.StoreRelationshipCashier); err != nil {
+		t.Errorf("Expected adding the same relationship to succeed, got %v", err)
+	}
+	if err = app.AdminService.AssignStore(ctx, admin, admin.ID, store.ID, models.StoreRelationshipOwner); err != nil {
+		t.Fatalf("Failed to assign store: %v", err)
+	}
+	if relationship, err := app.StoreRepository.FindStaffRelationship(ctx, admin.ID, store.ID); err != nil || relationship != models.StoreRelationshipOwner {
+		t.Errorf("Expected relationship %v, got %v, err: %v", models.StoreRelationshipOwner, relationship, err)
+	}
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+)
+
+func TestStoreInvitationFlow(t *testing.T) {
+	// 初始化测试应用
+	app, err := tests.Setup("invitation")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+
+	owner := &models.User{Email: "owner@example.com", Role: models.RoleMgr}
+	if owner, err = app.UserRepository.Save(context.Background(), owner); err != nil {
+		t.Fatalf("Failed to create owner: %v", err)
+	}
+	store := &models.Store{Name: "Invitation Store"}
+	if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err = app.StoreMembershipRepository.SetStaffRelationship(context.Background(), store.ID, owner.ID, models.StoreRelationshipOwner); err != nil {
+		t.Fatalf("Failed to assign store: %v", err)
+	}
+
+	// 用店主的身份注册manager路由
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user", owner) })
+	app.ManagerStoreController.RegisterRoutes(r.Group("/api/mgr"))
+
+	invite := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/api/mgr/store/%d/invitations", store.ID), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 顾客的关系不能用来邀请
+	if w := invite(`{"email":"bad@example.com","relationship":"FAVORITE"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 Bad Request, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := invite(`{"email":" New.Staff@Example.com ","relationship":"STAFF"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 Created, got %d: %s", w.Code, w.Body.String())
+	}
+	w = invite(`{"email":"cashier@example.com","relationship":"CASHIER"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 Created, got %d: %s", w.Code, w.Body.String())
+	}
+	var cashierInvitation models.StoreInvitation
+	if err := json.Unmarshal(w.Body.Bytes(), &cashierInvitation); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	// 撤销收银员的邀请，重复撤销会冲突
+	for _, status := range []int{http.StatusOK, http.StatusConflict} {
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/mgr/store/%d/invitations/%d", store.ID, cashierInvitation.ID), nil)
+		r.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("Expected status %d, got %d: %s", status, w.Code, w.Body.String())
+		}
+	}
+
+	// 被邀请的人第一次登录，邀请自动被接受
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/login", nil)
+	c.Set("principal", &utils.Principal{Email: "new.staff@example.com", EmailVerified: true, Provider: "mock"})
+	app.LoginController.Login(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+	staff, err := app.UserRepository.FindByEmail(context.Background(), "new.staff@example.com")
+	if err != nil {
+		t.Fatalf("Failed to find staff: %v", err)
+	}
+	if relationship, err := app.StoreRepository.FindStaffRelationship(context.Background(), staff.ID, store.ID); err != nil || relationship != models.StoreRelationshipStaff {
+		t.Errorf("Expected relationship %v, got %v, err: %v", models.StoreRelationshipStaff, relationship, err)
+	}
+
+	// 店员列表里只剩两个已经加入的人
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/mgr/store/%d/members", store.ID), nil)
+	r.ServeHTTP(w, req)
+	var members []services.StoreMember
+	if err := json.Unmarshal(w.Body.Bytes(), &members); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("Expected 2 members, got %+v", members)
+	}
+	for _, member := range members {
+		if member.Status != models.StoreInvitationStatusAccepted {
+			t.Errorf("Expected member %v to be accepted, got %v", member.Email, member.Status)
+		}
+	}
+}
+
+func TestStoreInvitationAcceptByToken(t *testing.T) {
+	// 初始化测试应用
+	app, err := tests.Setup("invitation2")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+
+	owner := &models.User{Email: "owner@example.com", Role: models.RoleMgr}
+	if owner, err = app.UserRepository.Save(context.Background(), owner); err != nil {
+		t.Fatalf("Failed to create owner: %v", err)
+	}
+	store := &models.Store{Name: "Token Store"}
+	if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	invitation, err := app.StoreInvitationService.Invite(context.Background(), owner, store.ID, "john.doe@example.com", models.StoreRelationshipManager)
+	if err != nil {
+		t.Fatalf("Failed to invite: %v", err)
+	}
+	// 库里只有token的hash
+	if saved, err := app.StoreInvitationRepository.FindByID(context.Background(), invitation.ID); err != nil || saved.Token != "" || saved.TokenHash == "" || saved.TokenHash == invitation.Token {
+		t.Errorf("Expected only the token hash to be stored, got %+v, err: %v", saved, err)
+	}
+
+	accept := func(user *models.User) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/store-invitations/token/accept", nil)
+		c.Set("user", user)
+		c.Params = append(c.Params, gin.Param{Key: "token", Value: invitation.Token})
+		app.StoreInvitationController.AcceptInvitation(c)
+		return w.Code
+	}
+
+	// 别人拿到token也不能接受
+	other := &models.User{Email: "other@example.com"}
+	if other, err = app.UserRepository.Save(context.Background(), other); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if code := accept(other); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 Forbidden, got %d", code)
+	}
+
+	user := &models.User{Email: "john.doe@example.com"}
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	// email没验证过的时候不会自动接受，只能用token
+	principal := &utils.Principal{Email: "john.doe@example.com", Provider: "mock"}
+	if accepted, err := app.StoreInvitationService.AcceptPending(context.Background(), user, principal); err != nil || len(accepted) != 0 {
+		t.Errorf("Expected no invitations accepted for an unverified email, got %v, err: %v", accepted, err)
+	}
+	if app.StoreRepository.CheckUserHasAccessToStore(context.Background(), user, store.ID) {
+		t.Errorf("Expected user not to have access to store %d before accepting", store.ID)
+	}
+	if code := accept(user); code != http.StatusOK {
+		t.Errorf("Expected status 200 OK, got %d", code)
+	}
+	if code := accept(user); code != http.StatusConflict {
+		t.Errorf("Expected status 409 Conflict, got %d", code)
+	}
+	if !app.StoreRepository.CheckUserHasAccessToStore(context.Background(), user, store.ID) {
+		t.Errorf("Expected user to have access to store %d", store.ID)
+	}
+}
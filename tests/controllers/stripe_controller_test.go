@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stripe/stripe-go/v74"
+	"github.com/stripe/stripe-go/v74/webhook"
+)
+
+func TestStripeWebhookRecordsPaymentsAndRefunds(t *testing.T) {
+	app, err := tests.Setup("stripe_webhook")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	viper.Set("stripeWebhookSecret", "whsec_test")
+	defer viper.Set("stripeWebhookSecret", nil)
+
+	paymentIntentID := "pi_webhook_test"
+	order := &models.Order{PaymentIntentID: &paymentIntentID, Total: models.NewMoney(1093, "USD")}
+	if err = app.OrderRepository.Save(context.Background(), order); err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	send := func(eventType, object, secret string) int {
+		payload := []byte(fmt.Sprintf(`{"id":"evt_test","object":"event","api_version":%q,"created":1790000000,"type":%q,"data":{"object":%s}}`,
+			stripe.APIVersion, eventType, object))
+		signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: secret})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/stripe/webhook", bytes.NewReader(payload))
+		c.Request.Header.Set("Stripe-Signature", signed.Header)
+		app.StripeController.Webhook(c)
+		return c.Writer.Status()
+	}
+
+	paid, refunded := testutil.ToFloat64(utils.OrdersPaidTotal), testutil.ToFloat64(utils.OrdersRefundedTotal)
+	if status := send("payment_intent.succeeded", `{"id":"pi_webhook_test","object":"payment_intent"}`, "whsec_wrong"); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a bad signature, got %d", status)
+	}
+	if status := send("payment_intent.succeeded", `{"id":"pi_webhook_test","object":"payment_intent"}`, "whsec_test"); status != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d", status)
+	}
+	// 重复的事件不再计数
+	if status := send("payment_intent.succeeded", `{"id":"pi_webhook_test","object":"payment_intent"}`, "whsec_test"); status != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d", status)
+	}
+	if status := send("charge.refunded", `{"id":"ch_test","object":"charge","amount_refunded":300,"currency":"usd","payment_intent":"pi_webhook_test"}`, "whsec_test"); status != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d", status)
+	}
+	if status := send("charge.refunded", `{"id":"ch_test","object":"charge","amount_refunded":500,"currency":"usd","payment_intent":"pi_webhook_test"}`, "whsec_test"); status != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d", status)
+	}
+	// 晚到的旧事件不会把退款改小
+	if status := send("charge.refunded", `{"id":"ch_test","object":"charge","amount_refunded":200,"currency":"usd","payment_intent":"pi_webhook_test"}`, "whsec_test"); status != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d", status)
+	}
+	// 别的系统的PaymentIntent直接忽略
+	if status := send("charge.refunded", `{"id":"ch_other","object":"charge","amount_refunded":500,"currency":"usd","payment_intent":"pi_other"}`, "whsec_test"); status != http.StatusOK {
+		t.Errorf("Expected status 200 OK for an unknown payment intent, got %d", status)
+	}
+
+	saved, err := app.OrderRepository.GetByID(context.Background(), order.ID)
+	if err != nil {
+		t.Fatalf("Failed to load order: %v", err)
+	}
+	if saved.PaidAt == nil || saved.PaidAt.Unix() != 1790000000 || saved.Refunded != models.NewMoney(500, "USD") || saved.RefundedAt == nil {
+		t.Errorf("Expected payment and refund to be recorded, got %+v", saved)
+	}
+	if testutil.ToFloat64(utils.OrdersPaidTotal) != paid+1 || testutil.ToFloat64(utils.OrdersRefundedTotal) != refunded+1 {
+		t.Errorf("Expected the order to be counted once as paid and once as refunded, got %v paid, %v refunded",
+			testutil.ToFloat64(utils.OrdersPaidTotal)-paid, testutil.ToFloat64(utils.OrdersRefundedTotal)-refunded)
+	}
+}
+
+func TestPayRejectsCurrencyMismatch(t *testing.T) {
+	app, err := tests.Setup("stripe_pay_currency")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	if _, err = app.TaxRateImportService.Import(ctx, nil, []services.TaxRateFile{
+		{Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.086250\n")},
+	}); err != nil {
+		t.Fatalf("Failed to import tax rates: %v", err)
+	}
+	user := &models.User{Email: "john.doe@example.com"}
+	if user, err = app.UserRepository.Save(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	address, err := app.AddressService.AddAddressForUser(ctx, user, &models.Address{Line1: "1 Main St", City: "San Francisco", State: "CA", PostalCode: "94016"})
+	if err != nil {
+		t.Fatalf("Failed to create address: %v", err)
+	}
+	if user, err = app.UserService.SetDefaultShippingAddress(ctx, user, address.ID); err != nil {
+		t.Fatalf("Failed to set default shipping address: %v", err)
+	}
+	store := &models.Store{Name: "Toronto Store", Currency: "CAD"}
+	if err = app.ManagerStoreRepository.Save(ctx, store); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	poutine := &models.Product{Name: "Poutine", Price: models.NewMoney(1250, "CAD")}
+	imported := &models.Product{Name: "Imported", Price: models.NewMoney(999, "USD")}
+	for _, product := range []*models.Product{poutine, imported} {
+		if err = app.ProductRepository.Save(ctx, product); err != nil {
+			t.Fatalf("Failed to create product: %v", err)
+		}
+	}
+
+	pay := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/pay", bytes.NewBufferString(body))
+		c.Set("user", user)
+		app.StripeController.Pay(c)
+		return w
+	}
+	newOrder := func(product *models.Product) *models.Order {
+		order := &models.Order{StoreID: store.ID, OrderItems: []models.OrderItem{{ProductID: product.ID, Quantity: 1}}}
+		if order, err = app.OrderService.AddOrderForUser(ctx, user, order); err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		return order
+	}
+
+	// 结账的币种和店的不一样
+	order := newOrder(poutine)
+	if w := pay(fmt.Sprintf(`{"order_id":%d,"amount":1250,"currency":"usd"}`, order.ID)); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "store currency CAD") {
+		t.Errorf("Expected status 400 for paying a CAD order in USD, got %d: %s", w.Code, w.Body.String())
+	}
+	// 商品的币种和店的不一样
+	order = newOrder(imported)
+	if w := pay(fmt.Sprintf(`{"order_id":%d,"amount":999,"currency":"cad"}`, order.ID)); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), models.ErrCurrencyMismatch.Error()) {
+		t.Errorf("Expected status 400 for an order with a USD product in a CAD store, got %d: %s", w.Code, w.Body.String())
+	}
+	// 金额和服务端算的不一样（1250加上8.625%的税）
+	order = newOrder(poutine)
+	if w := pay(fmt.Sprintf(`{"order_id":%d,"amount":1250,"currency":"cad"}`, order.ID)); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "does not match the order total 13.58 CAD") {
+		t.Errorf("Expected status 400 for a payment amount that differs from the order total, got %d: %s", w.Code, w.Body.String())
+	}
+	// 已经有PaymentIntent的订单不能再付一次
+	order = newOrder(poutine)
+	if _, err = app.OrderService.UpdatePaymentIntentID(ctx, order.ID, "pi_paid"); err != nil {
+		t.Fatalf("Failed to update payment intent: %v", err)
+	}
+	if w := pay(fmt.Sprintf(`{"order_id":%d,"amount":1358,"currency":"cad"}`, order.ID)); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for paying an order twice, got %d: %s", w.Code, w.Body.String())
+	}
+	// 别人的地址
+	other := &models.User{Email: "jane.doe@example.com"}
+	if other, err = app.UserRepository.Save(ctx, other); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	otherAddress, err := app.AddressService.AddAddressForUser(ctx, other, &models.Address{Line1: "2 Main St", City: "San Francisco", State: "CA", PostalCode: "94016"})
+	if err != nil {
+		t.Fatalf("Failed to create address: %v", err)
+	}
+	order = newOrder(poutine)
+	if w := pay(fmt.Sprintf(`{"order_id":%d,"amount":1250,"currency":"cad","shipping_address_id":%d}`, order.ID, otherAddress.ID)); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "Shipping address not found") {
+		t.Errorf("Expected status 400 for another user's shipping address, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -1,9 +1,12 @@
 package controllers
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/atomi-ai/atomi/tests"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -19,7 +22,7 @@ func TestUserController_GetUser(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	//c.Request = httptest.NewRequest("GET", "/user", nil)
+	c.Request = httptest.NewRequest("GET", "/user", nil)
 
 	mockUser := &models.User{
 		BaseModel: models.BaseModel{ID: 1},
@@ -53,7 +56,7 @@ func TestUserController_SetCurrentPaymentMethod(t *testing.T) {
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
-	//c.Request = httptest.NewRequest("PUT", "/user/current-payment-method/123", nil)
+	c.Request = httptest.NewRequest("PUT", "/user/current-payment-method/123", nil)
 	// 添加路径参数
 	c.Params = []gin.Param{
 		{
@@ -86,3 +89,56 @@ func TestUserController_SetCurrentPaymentMethod(t *testing.T) {
 		}
 	}
 }
+
+func TestUserController_RequestDataExport(t *testing.T) {
+	app, err := tests.Setup("user")
+	if err != nil {
+		t.Fatalf("Failed to setup test environment: %v", err)
+	}
+
+	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/user/export", strings.NewReader(`{"format":"zip"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user", user)
+
+	app.UserController.RequestDataExport(c)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, got %d", http.StatusAccepted, w.Code)
+	}
+
+	var request models.UserExportRequest
+	if err := json.Unmarshal(w.Body.Bytes(), &request); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if request.Status != models.UserExportStatusPending || request.Format != models.UserExportFormatZip {
+		t.Errorf("Unexpected export request: %+v", request)
+	}
+
+	// 等后台导出完成之后再查询状态
+	app.UserExportService.Wait()
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/user/export/1", nil)
+	c.Params = []gin.Param{{Key: "exportId", Value: strconv.FormatInt(request.ID, 10)}}
+	c.Set("user", user)
+
+	app.UserController.GetDataExport(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &request); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if request.Status != models.UserExportStatusReady || request.DownloadURL == "" || request.ExpiresAt == nil {
+		t.Errorf("Expected export to be ready with a download link, got %+v", request)
+	}
+}
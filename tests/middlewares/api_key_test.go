@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/atomi-ai/atomi/app"
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	// 初始化测试应用
+	app, err := app.InitializeTestingApplication("apikey")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+
+	store1 := &models.Store{Name: "API Key Store 1"}
+	store2 := &models.Store{Name: "API Key Store 2"}
+	for _, store := range []*models.Store{store1, store2} {
+		if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+	}
+
+	admin := &models.User{Email: "apikey.admin@example.com", Role: models.RoleAdmin}
+	if admin, err = app.UserRepository.Save(context.Background(), admin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	serviceAccount, err := app.APIKeyService.CreateServiceAccount(context.Background(), admin, "pos-store-1", "POS")
+	if err != nil {
+		t.Fatalf("Failed to create service account: %v", err)
+	}
+	if _, err := app.APIKeyService.CreateServiceAccount(context.Background(), admin, "pos-store-1", ""); err != services.ErrServiceAccountExists {
+		t.Errorf("Expected ErrServiceAccountExists, got %v", err)
+	}
+	key, err := app.APIKeyService.CreateKey(context.Background(), admin, serviceAccount.ID, services.CreateAPIKeyInput{
+		Name:        "pos",
+		Permissions: []models.Permission{models.PermissionProductEdit},
+		StoreID:     &store1.ID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create api key: %v", err)
+	}
+	// 限定了店的key不能有全局的权限
+	if _, err := app.APIKeyService.CreateKey(context.Background(), admin, serviceAccount.ID, services.CreateAPIKeyInput{
+		Name:        "pos-admin",
+		Permissions: []models.Permission{models.PermissionProductEdit, models.PermissionUserManage},
+		StoreID:     &store1.ID,
+	}); err != services.ErrStoreKeyPermission {
+		t.Errorf("Expected ErrStoreKeyPermission, got %v", err)
+	}
+
+	r := gin.New()
+	r.Use(app.AuthMiddleware.Registered())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/images", app.Authorizer.Require(models.PermissionImageUpload), ok)
+	r.GET("/products", app.Authorizer.Require(models.PermissionProductEdit), ok)
+	r.PUT("/store/:storeId/product", app.Authorizer.Require(models.PermissionProductEdit, middlewares.StoreParam("storeId")), ok)
+
+	call := func(method, path, apiKey string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", apiKey)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	store1Path := fmt.Sprintf("/store/%d/product", store1.ID)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		apiKey string
+		status int
+	}{
+		{"scoped store", "PUT", store1Path, key.Key, http.StatusOK},
+		{"another store", "PUT", fmt.Sprintf("/store/%d/product", store2.ID), key.Key, http.StatusForbidden},
+		{"permission not granted", "GET", "/images", key.Key, http.StatusForbidden},
+		{"route without store scope", "GET", "/products", key.Key, http.StatusForbidden},
+		{"unknown key", "PUT", store1Path, key.Prefix + "_deadbeef", http.StatusUnauthorized},
+		{"malformed key", "PUT", store1Path, "not-a-key", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		if code := call(tc.method, tc.path, tc.apiKey); code != tc.status {
+			t.Errorf("%v: expected status %d, got %d", tc.name, tc.status, code)
+		}
+	}
+
+	keys, err := app.APIKeyService.ListKeys(context.Background(), serviceAccount.ID)
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("Expected last used time to be recorded, got %+v, err: %v", keys, err)
+	}
+
+	// 轮换之后旧key在宽限期内仍然可用，撤销之后立即失效
+	rotated, err := app.APIKeyService.RotateKey(context.Background(), admin, key.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to rotate api key: %v", err)
+	}
+	if code := call("PUT", store1Path, key.Key); code != http.StatusOK {
+		t.Errorf("Expected old key to work during grace period, got %d", code)
+	}
+	if code := call("PUT", store1Path, rotated.Key); code != http.StatusOK {
+		t.Errorf("Expected rotated key to work, got %d", code)
+	}
+	if _, err := app.APIKeyService.RevokeKey(context.Background(), admin, key.ID); err != nil {
+		t.Fatalf("Failed to revoke api key: %v", err)
+	}
+	if code := call("PUT", store1Path, key.Key); code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked key to be rejected, got %d", code)
+	}
+}
@@ -1,9 +1,12 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
 	"github.com/atomi-ai/atomi/app"
 	"github.com/atomi-ai/atomi/middlewares"
 	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"net/http/httptest"
@@ -19,12 +22,12 @@ func TestAuthMiddleware(t *testing.T) {
 
 	// 创建一个用户
 	user := &models.User{Name: "John Doe", Email: "john.doe@example.com"}
-	if user, err = app.UserRepository.Save(user); err != nil {
+	if user, err = app.UserRepository.Save(context.Background(), user); err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
 
 	// 初始化AuthMiddleware
-	authMiddleware := middlewares.NewAuthMiddleware(app.UserRepository, app.AuthWrapper)
+	authMiddleware := middlewares.NewAuthMiddleware(app.Authenticator, app.APIKeyService, app.UserProvisioningService)
 
 	// 准备一个测试上下文
 	w := httptest.NewRecorder()
@@ -36,10 +39,40 @@ func TestAuthMiddleware(t *testing.T) {
 	c.Request.Header.Set("Authorization", "Bearer "+idToken)
 
 	// 调用AuthMiddleware的handler
-	authMiddleware.Handler()(c)
+	authMiddleware.Registered()(c)
 
 	// 检查用户是否正确设置
 	if cUser, exists := c.Get("user"); !exists || cUser.(*models.User).Email != user.Email {
 		t.Errorf("User not set correctly in context")
 	}
 }
+
+// failingLinkProvisioning 找到一个还没关联subject的老用户，但是关联的时候出错。
+type failingLinkProvisioning struct{}
+
+func (failingLinkProvisioning) Lookup(ctx context.Context, principal *utils.Principal) (*models.User, error) {
+	return &models.User{BaseModel: models.BaseModel{ID: 1}, Email: principal.Email}, nil
+}
+
+func (failingLinkProvisioning) Provision(ctx context.Context, principal *utils.Principal) (*models.User, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestAuthMiddlewareLinkFailure(t *testing.T) {
+	app, err := app.InitializeTestingApplication("auth_link")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	authMiddleware := middlewares.NewAuthMiddleware(app.Authenticator, app.APIKeyService, failingLinkProvisioning{})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/test", nil)
+	c.Request.Header.Set("Authorization", "Bearer test-id-token")
+	authMiddleware.Registered()(c)
+
+	// 关联失败的时候返回500，不能panic
+	if w.Code != http.StatusInternalServerError || !c.IsAborted() {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+}
@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/atomi-ai/atomi/app"
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestAuthMiddlewareTiers(t *testing.T) {
+	// 初始化测试应用
+	app, err := app.InitializeTestingApplication("auth2")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+
+	// 用本地签发的token，这样可以造出没有email的token
+	secret := []byte("tier-secret")
+	issuer, err := utils.NewHMACLocalIssuer(secret)
+	if err != nil {
+		t.Fatalf("Failed to create local issuer: %v", err)
+	}
+	authMiddleware := middlewares.NewAuthMiddleware(issuer, app.APIKeyService, app.UserProvisioningService)
+
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		_, hasUser := c.Get("user")
+		c.JSON(http.StatusOK, gin.H{"user": hasUser})
+	}
+	r.GET("/public", authMiddleware.Public(), handler)
+	r.GET("/authenticated", authMiddleware.Authenticated(), handler)
+	r.GET("/registered", authMiddleware.Registered(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, c.MustGet("user"))
+	})
+
+	call := func(path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 手机号登录的token里没有email
+	phoneToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":          "atomi-local",
+		"sub":          "phone-user",
+		"phone_number": "+15550100",
+		"exp":          time.Now().Add(time.Minute).Unix(),
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	emailToken, err := issuer.IssueToken("email-user", "Tier@Example.com", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"public without token", "/public", "", http.StatusOK},
+		{"public with bad token", "/public", "garbage", http.StatusUnauthorized},
+		{"authenticated without token", "/authenticated", "", http.StatusUnauthorized},
+		{"authenticated first-time user", "/authenticated", emailToken, http.StatusOK},
+		{"registered without token", "/registered", "", http.StatusUnauthorized},
+		{"registered with bad token", "/registered", "garbage", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		if w := call(tc.path, tc.token); w.Code != tc.status {
+			t.Errorf("%v: expected status %d, got %d: %s", tc.name, tc.status, w.Code, w.Body.String())
+		}
+	}
+
+	// Authenticated不会创建用户
+	if _, err := app.UserRepository.FindByEmail(context.Background(), "tier@example.com"); err == nil {
+		t.Errorf("Expected user not to be provisioned by the authenticated tier")
+	}
+
+	// 第一次访问registered的接口自动注册，再次访问是同一个用户
+	var first, second models.User
+	for _, user := range []*models.User{&first, &second} {
+		w := call("/registered", phoneToken)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), user); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+	}
+	if first.ID == 0 || first.ID != second.ID || first.Phone != "+15550100" || first.StripeCustomerID != "cus_mock_id" {
+		t.Errorf("Unexpected provisioned users: %+v, %+v", first, second)
+	}
+	if w := call("/public", phoneToken); w.Body.String() != `{"user":true}` {
+		t.Errorf("Expected public route to see the registered user, got %s", w.Body.String())
+	}
+
+	// 以前只有email的用户第一次带subject登录的时候关联上
+	legacy := &models.User{Email: "legacy@example.com"}
+	if legacy, err = app.UserRepository.Save(context.Background(), legacy); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	legacyToken, err := issuer.IssueToken("legacy-user", "legacy@example.com", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if w := call("/registered", legacyToken); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+	user, err := app.UserRepository.FindByAuthSubject(context.Background(), utils.AuthProviderLocal, "legacy-user")
+	if err != nil || user.ID != legacy.ID {
+		t.Errorf("Expected user %d to be linked to its subject, got %+v, err: %v", legacy.ID, user, err)
+	}
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	r := gin.New()
+	r.Use(middlewares.Metrics())
+	r.GET("/store/:store_id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, path := range []string{"/store/1", "/store/2", "/missing"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+	}
+
+	// 按路由模板统计，不会每个store ID一个label
+	if count := testutil.ToFloat64(utils.HTTPRequestsTotal.WithLabelValues("GET", "/store/:store_id", "204")); count != 2 {
+		t.Errorf("Expected 2 requests for the route template, got %v", count)
+	}
+	if count := testutil.ToFloat64(utils.HTTPRequestsTotal.WithLabelValues("GET", "unmatched", "404")); count != 1 {
+		t.Errorf("Expected 1 unmatched request, got %v", count)
+	}
+}
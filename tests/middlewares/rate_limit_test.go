@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestRateLimiter(t *testing.T) {
+	viper.Set("rateLimits.test.perMinute", 60)
+	viper.Set("rateLimits.test.burst", 2)
+	defer viper.Set("rateLimits.test.perMinute", 0)
+
+	rateLimiter := middlewares.NewRateLimiter(utils.NewMemoryRateLimitBackend())
+	users := map[string]*models.User{
+		"user":    {BaseModel: models.BaseModel{ID: 1}, Role: models.RoleUser},
+		"admin":   {BaseModel: models.BaseModel{ID: 2}, Role: models.RoleAdmin},
+		"service": {BaseModel: models.BaseModel{ID: 3}, Role: models.RoleUser, ServiceAccount: true},
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user, ok := users[c.GetHeader("X-Test-User")]; ok {
+			c.Set("user", user)
+		}
+	})
+	r.GET("/limited", rateLimiter.Limit("test"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	call := func(user, ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/limited", nil)
+		req.Header.Set("X-Test-User", user)
+		req.RemoteAddr = ip + ":12345"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 桶里有2个令牌，第3个请求被拒绝
+	for i, remaining := range []string{"1", "0"} {
+		w := call("user", "10.0.0.1")
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Errorf("Request %d: unexpected response %d with headers %v", i, w.Code, w.Header())
+		}
+	}
+	w := call("user", "10.0.0.2")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" || w.Header().Get("RateLimit-Reset") != "2" {
+		t.Errorf("Expected status 429 with Retry-After, got %d with headers %v", w.Code, w.Header())
+	}
+
+	// 匿名请求按IP计数，互不影响
+	for _, ip := range []string{"10.0.0.1", "10.0.0.1", "10.0.0.2"} {
+		if w := call("", ip); w.Code != http.StatusOK {
+			t.Errorf("Expected anonymous request from %v to pass, got %d", ip, w.Code)
+		}
+	}
+	if w := call("", "10.0.0.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected anonymous request to be limited, got %d", w.Code)
+	}
+
+	// admin和service account不限流
+	for _, user := range []string{"admin", "service"} {
+		for i := 0; i < 5; i++ {
+			if w := call(user, "10.0.0.3"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+				t.Errorf("Expected %v to be exempt, got %d", user, w.Code)
+			}
+		}
+	}
+}
+
+func TestRateLimiterIgnoresSpoofedForwardedFor(t *testing.T) {
+	viper.Set("rateLimits.test.perMinute", 60)
+	viper.Set("rateLimits.test.burst", 1)
+	defer viper.Set("rateLimits.test.perMinute", 0)
+
+	newRouter := func(trustedProxies []string) *gin.Engine {
+		r := gin.New()
+		if err := r.SetTrustedProxies(trustedProxies); err != nil {
+			t.Fatalf("Failed to set trusted proxies: %v", err)
+		}
+		r.GET("/limited", middlewares.NewRateLimiter(utils.NewMemoryRateLimitBackend()).Limit("test"), func(c *gin.Context) { c.Status(http.StatusOK) })
+		return r
+	}
+	call := func(r *gin.Engine, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/limited", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.RemoteAddr = "10.0.0.1:12345"
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 没配置代理的时候换X-Forwarded-For也还是同一个IP
+	r := newRouter(utils.LoadHTTPServerConfig().TrustedProxies)
+	if code := call(r, "1.1.1.1"); code != http.StatusOK {
+		t.Errorf("Expected status 200 OK, got %d", code)
+	}
+	if code := call(r, "2.2.2.2"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a spoofed X-Forwarded-For to be limited, got %d", code)
+	}
+
+	// 从负载均衡来的请求按X-Forwarded-For里的IP计数
+	viper.Set("trustedProxies", []string{"10.0.0.0/8"})
+	defer viper.Set("trustedProxies", nil)
+	r = newRouter(utils.LoadHTTPServerConfig().TrustedProxies)
+	for _, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+		if code := call(r, ip); code != http.StatusOK {
+			t.Errorf("Expected request from %v behind the proxy to pass, got %d", ip, code)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atomi-ai/atomi/app"
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/gin-gonic/gin"
+)
+
+func newRBACRouter(authorizer middlewares.Authorizer, user *models.User) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user != nil {
+			c.Set("user", user)
+		}
+	})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/images", authorizer.Require(models.PermissionImageUpload), ok)
+	r.PUT("/store/:storeId/product", authorizer.Require(models.PermissionProductEdit, middlewares.StoreParam("storeId")), ok)
+	return r
+}
+
+func TestAuthorizerRequire(t *testing.T) {
+	// 初始化测试应用
+	app, err := app.InitializeTestingApplication("rbac")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+
+	// 创建两个商店，manager只拥有第一个
+	store1 := &models.Store{Name: "RBAC Store 1"}
+	store2 := &models.Store{Name: "RBAC Store 2"}
+	for _, store := range []*models.Store{store1, store2} {
+		if err = app.ManagerStoreRepository.Save(context.Background(), store); err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+	}
+
+	manager := &models.User{Email: "rbac.mgr@example.com", Role: models.RoleMgr}
+	if manager, err = app.UserRepository.Save(context.Background(), manager); err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if err = app.StoreMembershipRepository.SetStaffRelationship(context.Background(), store1.ID, manager.ID, models.StoreRelationshipOwner); err != nil {
+		t.Fatalf("Failed to assign store: %v", err)
+	}
+	customer := &models.User{Email: "rbac.user@example.com", Role: models.RoleUser}
+	admin := &models.User{Email: "rbac.admin@example.com", Role: models.RoleAdmin}
+
+	cases := []struct {
+		name   string
+		user   *models.User
+		method string
+		path   string
+		status int
+	}{
+		{"anonymous", nil, "GET", "/images", http.StatusUnauthorized},
+		{"customer without permission", customer, "GET", "/images", http.StatusForbidden},
+		{"manager with permission", manager, "GET", "/images", http.StatusOK},
+		{"owner of store", manager, "PUT", fmt.Sprintf("/store/%d/product", store1.ID), http.StatusOK},
+		{"manager of another store", manager, "PUT", fmt.Sprintf("/store/%d/product", store2.ID), http.StatusForbidden},
+		{"invalid store id", manager, "PUT", "/store/abc/product", http.StatusBadRequest},
+		{"admin", admin, "PUT", fmt.Sprintf("/store/%d/product", store2.ID), http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		newRBACRouter(app.Authorizer, tc.user).ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%v: expected status %d, got %d", tc.name, tc.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestRequestLogger(t *testing.T) {
+	hook := test.NewGlobal()
+	log.AddHook(utils.RequestIDHook{})
+
+	r := gin.New()
+	r.Use(middlewares.RequestID(), middlewares.RequestLogger())
+	r.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{BaseModel: models.BaseModel{ID: 42}})
+	})
+	r.POST("/store/:store_id/login", func(c *gin.Context) {
+		log.WithContext(c.Request.Context()).Info("downstream")
+		var body map[string]interface{}
+		_ = c.ShouldBindJSON(&body)
+		if body["password"] != "correct" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bad password", "email": body["email"]})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": "secret-token"})
+	})
+
+	call := func(requestID, body string) *httptest.ResponseRecorder {
+		hook.Reset()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/store/7/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer raw-id-token")
+		if requestID != "" {
+			req.Header.Set(middlewares.RequestIDHeader, requestID)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 成功的请求沿用客户端的请求ID，不记录body
+	w := call("req-123", `{"email":"jane@example.com","password":"correct"}`)
+	if w.Header().Get(middlewares.RequestIDHeader) != "req-123" {
+		t.Errorf("Expected request id to be propagated, got %q", w.Header().Get(middlewares.RequestIDHeader))
+	}
+	entries := hook.AllEntries()
+	if len(entries) != 2 || entries[0].Message != "downstream" || entries[0].Data["request_id"] != "req-123" {
+		t.Fatalf("Expected downstream log with request id, got %+v", entries)
+	}
+	access := entries[1]
+	if access.Data["request_id"] != "req-123" || access.Data["status"] != http.StatusOK ||
+		access.Data["user_id"] != int64(42) || access.Data["store_id"] != "7" || access.Data["route"] != "/store/:store_id/login" {
+		t.Errorf("Unexpected access log fields: %+v", access.Data)
+	}
+	if _, ok := access.Data["request_body"]; ok {
+		t.Errorf("Expected body not to be logged for successful requests")
+	}
+	// 路径里可能有邀请token，只记路由
+	if _, ok := access.Data["path"]; ok {
+		t.Errorf("Expected the raw path not to be logged")
+	}
+
+	// 出错的请求记录body，但是敏感字段被替换掉；非法的请求ID重新生成
+	w = call("bad id!", `{"email":"jane@example.com","password":"wrong","note":"hello"}`)
+	requestID := w.Header().Get(middlewares.RequestIDHeader)
+	if requestID == "" || requestID == "bad id!" {
+		t.Errorf("Expected a generated request id, got %q", requestID)
+	}
+	access = hook.LastEntry()
+	if access.Level != log.WarnLevel || access.Data["request_id"] != requestID {
+		t.Errorf("Unexpected access log: %+v", access)
+	}
+	reqBody, _ := access.Data["request_body"].(map[string]interface{})
+	respBody, _ := access.Data["response_body"].(map[string]interface{})
+	if reqBody["password"] != "[REDACTED]" || reqBody["email"] != "[REDACTED]" || reqBody["note"] != "hello" ||
+		respBody["email"] != "[REDACTED]" || respBody["error"] != "bad password" {
+		t.Errorf("Expected secrets to be redacted, got %+v, %+v", reqBody, respBody)
+	}
+	for _, entry := range hook.AllEntries() {
+		line, _ := entry.String()
+		if strings.Contains(line, "raw-id-token") || strings.Contains(line, "jane@example.com") || strings.Contains(line, "wrong") {
+			t.Errorf("Expected secrets not to be logged, got %v", line)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	viper.Set("requestTimeout", "50ms")
+	defer viper.Set("requestTimeout", nil)
+
+	r := gin.New()
+	r.Use(middlewares.RequestTimeout())
+	r.GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+	r.GET("/fast", func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); !ok {
+			t.Errorf("Expected the request context to have a deadline")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/fast", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+func TestRepositoryHonorsCanceledContext(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	if err = db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	userRepo := repositories.NewUserRepository(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	cancel()
+	if _, err = userRepo.FindByEmail(ctx, "john.doe@example.com"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected query to be canceled, got %v", err)
+	}
+}
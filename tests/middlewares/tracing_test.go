@@ -0,0 +1,70 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atomi-ai/atomi/middlewares"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if err = db.Use(models.TracingPlugin{}); err != nil {
+		t.Fatalf("Failed to register tracing plugin: %v", err)
+	}
+	if err = db.AutoMigrate(&models.Store{}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	r := gin.New()
+	r.Use(middlewares.Tracing())
+	r.GET("/store/:store_id", func(c *gin.Context) {
+		var store models.Store
+		db.WithContext(c.Request.Context()).Where("id = ?", c.Param("store_id")).First(&store)
+		c.Status(http.StatusNotFound)
+	})
+
+	// 沿用上游传过来的trace
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/store/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(w, req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected a query span and a server span, got %d spans", len(spans))
+	}
+	query, server := spans[0], spans[1]
+	if server.Name() != "GET /store/:store_id" || server.SpanContext().TraceID().String() != traceID {
+		t.Errorf("Unexpected server span %v in trace %v", server.Name(), server.SpanContext().TraceID())
+	}
+	if query.Name() != "gorm.query" || query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("Expected gorm.query to be a child of the server span, got %v with parent %v", query.Name(), query.Parent().SpanID())
+	}
+
+	// 没有trace的context（譬如后台任务）不会产生孤立的span
+	var store models.Store
+	db.First(&store)
+	if len(recorder.Ended()) != 2 {
+		t.Errorf("Expected no span for queries without a parent span, got %d spans", len(recorder.Ended()))
+	}
+}
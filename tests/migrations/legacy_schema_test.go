@@ -0,0 +1,237 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/atomi-ai/atomi/migrations"
+	"github.com/atomi-ai/atomi/models"
+)
+
+// 下面是引入版本化迁移之前（ca6cf73）的models，升级测试用AutoMigrate建出当时的库。
+
+type legacyConfig struct {
+	models.BaseModel
+	Key   string `gorm:"column:config_key;unique"`
+	Value string `gorm:"column:config_value"`
+}
+
+func (legacyConfig) TableName() string { return "configs" }
+
+type legacyUser struct {
+	models.BaseModel
+	Email                    string `gorm:"unique"`
+	Role                     string
+	Phone                    string
+	Name                     string
+	DefaultShippingAddressID int64
+	DefaultBillingAddressID  int64
+	StripeCustomerID         string
+	PaymentMethodID          *string
+}
+
+func (legacyUser) TableName() string { return "users" }
+
+type legacyProduct struct {
+	models.BaseModel
+	Name        string      `gorm:"unique"`
+	Creator     *legacyUser `gorm:"foreignKey:CreatorID"`
+	CreatorID   int64
+	Description string
+	Price       float64
+	Discount    float64
+	Category    string
+	ImageURL    string `gorm:"column:image_url"`
+}
+
+func (legacyProduct) TableName() string { return "products" }
+
+type legacyStore struct {
+	models.BaseModel
+	Name    string `gorm:"unique"`
+	Address string
+	City    string
+	State   string
+	ZipCode string `gorm:"column:zip_code"`
+	Phone   string
+}
+
+func (legacyStore) TableName() string { return "stores" }
+
+type legacyProductStore struct {
+	models.BaseModel
+	Store     *legacyStore   `gorm:"foreignKey:StoreID"`
+	StoreID   int64          `gorm:"uniqueIndex:idx_store_product"`
+	Product   *legacyProduct `gorm:"foreignKey:ProductID"`
+	ProductID int64          `gorm:"uniqueIndex:idx_store_product"`
+	IsEnable  bool           `gorm:"column:is_enable"`
+}
+
+func (legacyProductStore) TableName() string { return "product_stores" }
+
+type legacyUserStore struct {
+	models.BaseModel
+	User     *legacyUser `gorm:"foreignKey:UserID"`
+	UserID   int64
+	Store    *legacyStore `gorm:"foreignKey:StoreID"`
+	StoreID  int64
+	IsEnable bool `gorm:"column:is_enable"`
+}
+
+func (legacyUserStore) TableName() string { return "user_stores" }
+
+type legacyAddress struct {
+	models.BaseModel
+	Line1      string
+	Line2      string
+	City       string
+	State      string
+	Country    string
+	PostalCode string `gorm:"column:postal_code"`
+}
+
+func (legacyAddress) TableName() string { return "addresses" }
+
+type legacyUserAddress struct {
+	models.BaseModel
+	User      *legacyUser `gorm:"foreignKey:UserID"`
+	UserID    int64
+	Address   *legacyAddress `gorm:"foreignKey:AddressID"`
+	AddressID int64
+}
+
+func (legacyUserAddress) TableName() string { return "user_addresses" }
+
+type legacyOrder struct {
+	models.BaseModel
+	UserID          int64
+	StoreID         int64
+	PaymentIntentID *string           `gorm:"unique"`
+	DeliveryID      *string           `gorm:"unique"`
+	OrderItems      []legacyOrderItem `gorm:"foreignKey:OrderID"`
+	DisplayStatus   string            `gorm:"column:status"`
+}
+
+func (legacyOrder) TableName() string { return "orders" }
+
+type legacyOrderItem struct {
+	models.BaseModel
+	OrderID   int64
+	Product   *legacyProduct `gorm:"foreignKey:ProductID"`
+	ProductID int64
+	Quantity  int64
+}
+
+func (legacyOrderItem) TableName() string { return "order_items" }
+
+type legacyManagerStores struct {
+	models.BaseModel
+	UserID  int64 `gorm:"uniqueIndex:idx_manager_stores"`
+	StoreID int64 `gorm:"uniqueIndex:idx_manager_stores"`
+}
+
+func (legacyManagerStores) TableName() string { return "manager_stores" }
+
+type legacyDeleteUserRequest struct {
+	models.BaseModel
+	UserID int64 `gorm:"unique"`
+}
+
+func (legacyDeleteUserRequest) TableName() string { return "delete_user_requests" }
+
+type legacyTaxRate struct {
+	models.BaseModel
+	Csv                   string
+	State                 string `gorm:"column:tax_state"`
+	ZipCode               string
+	EstimatedCombinedRate float64
+}
+
+func (legacyTaxRate) TableName() string { return "tax_rates" }
+
+func TestUpgradeLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "migrate_legacy")
+	// 和以前的models.AutoMigrate一样的顺序
+	for _, entity := range []interface{}{
+		&legacyConfig{}, &legacyUser{}, &legacyProduct{}, &legacyStore{}, &legacyProductStore{}, &legacyUserStore{},
+		&legacyUserAddress{}, &legacyOrder{}, &legacyOrderItem{}, &legacyManagerStores{}, &legacyDeleteUserRequest{}, &legacyTaxRate{},
+	} {
+		if err := db.AutoMigrate(entity); err != nil {
+			t.Fatalf("Failed to create legacy schema: %v", err)
+		}
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, email, role, name) VALUES (1, 'mgr@example.com', 'MGR', 'Manager'), (2, 'user@example.com', 'USER', 'User')",
+		"INSERT INTO stores (id, name) VALUES (1, 'Mission Store'), (2, 'Sunset Store')",
+		"INSERT INTO manager_stores (user_id, store_id) VALUES (1, 1)",
+		"INSERT INTO user_stores (user_id, store_id, is_enable) VALUES (2, 1, false), (2, 2, true)",
+	} {
+		if err := db.Exec(sql).Error; err != nil {
+			t.Fatalf("Failed to insert legacy rows: %v", err)
+		}
+	}
+
+	if err := migrations.Migrate(ctx, db); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	migrator, _ := migrations.NewMigrator(db)
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.Applied == nil {
+			t.Errorf("Expected %v to be applied", status.Migration)
+		}
+	}
+	checkSchemaMatchesModels(t, db)
+
+	// 以前的店长和默认店都变成了store_memberships，旧表删掉了
+	var memberships []models.StoreMembership
+	if err = db.Order("user_id").Find(&memberships).Error; err != nil {
+		t.Fatalf("Failed to load memberships: %v", err)
+	}
+	if len(memberships) != 2 ||
+		memberships[0].UserID != 1 || memberships[0].StoreID != 1 || memberships[0].Relationship != models.StoreRelationshipOwner ||
+		memberships[1].UserID != 2 || memberships[1].StoreID != 2 || memberships[1].Relationship != models.StoreRelationshipDefault {
+		t.Errorf("Unexpected memberships %+v", memberships)
+	}
+	if db.Migrator().HasTable("manager_stores") || db.Migrator().HasTable("user_stores") {
+		t.Errorf("Expected legacy store tables to be dropped")
+	}
+
+	var user models.User
+	if err = db.First(&user, 2).Error; err != nil || user.Email != "user@example.com" || user.ServiceAccount || user.SuspendedAt != nil {
+		t.Errorf("Expected legacy user to load with defaults, got %+v, err: %v", user, err)
+	}
+}
+
+func TestMismatchedSchemaIsRejected(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "migrate_mismatch")
+	// 有users但是缺了基线里的其他表，不能当成基线
+	if err := db.AutoMigrate(&legacyUser{}); err != nil {
+		t.Fatalf("Failed to create users: %v", err)
+	}
+	migrator, _ := migrations.NewMigrator(db)
+	if _, err := migrator.Up(ctx, 0); !errors.Is(err, migrations.ErrSchemaMismatch) {
+		t.Errorf("Expected ErrSchemaMismatch, got %v", err)
+	}
+
+	// 基线之后的表已经有了，也不能当成基线
+	db = openDB(t, "migrate_newer")
+	all, _ := migrations.Load("sqlite")
+	schema, _ := migrations.NewMigratorWithMigrations(db, all[:2])
+	if _, err := schema.Up(ctx, 0); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	if err := db.Migrator().DropTable(&migrations.SchemaMigration{}); err != nil {
+		t.Fatalf("Failed to drop schema_migrations: %v", err)
+	}
+	migrator, _ = migrations.NewMigrator(db)
+	if _, err := migrator.Up(ctx, 0); !errors.Is(err, migrations.ErrSchemaMismatch) {
+		t.Errorf("Expected ErrSchemaMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/atomi-ai/atomi/migrations"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/repositories"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to open db: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return db
+}
+
+func TestUpAppliesAllMigrations(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "migrate_up")
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+
+	count, err := migrator.Up(ctx, 0)
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if count != len(statuses) {
+		t.Errorf("Expected %d migrations applied, got %d", len(statuses), count)
+	}
+	for _, status := range statuses {
+		if status.Applied == nil || status.Modified {
+			t.Errorf("Expected %v to be applied and unmodified", status.Migration)
+		}
+	}
+
+	// 再执行一次什么都不做
+	if count, err = migrator.Up(ctx, 0); err != nil || count != 0 {
+		t.Errorf("Expected no migrations on second run, got %d, err: %v", count, err)
+	}
+}
+
+func TestMigrationsMatchModels(t *testing.T) {
+	db := openDB(t, "migrate_models")
+	if err := migrations.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	checkSchemaMatchesModels(t, db)
+}
+
+// checkSchemaMatchesModels 检查models里的表、字段、索引都在库里，否则说明models改了但是没有加迁移。
+func checkSchemaMatchesModels(t *testing.T, db *gorm.DB) {
+	migrator := db.Migrator()
+	for _, model := range []interface{}{
+		&models.Config{}, &models.User{}, &models.Product{}, &models.Store{}, &models.ProductStore{},
+		&models.StoreMembership{}, &models.Address{}, &models.UserAddress{}, &models.Order{}, &models.OrderItem{},
+		&models.DeleteUserRequest{}, &models.TaxRate{}, &models.UserExportRequest{}, &models.AuditLog{},
+		&models.StoreInvitation{}, &models.APIKey{}, &models.TaxRateDataset{},
+	} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("Failed to parse %T: %v", model, err)
+		}
+		if !migrator.HasTable(model) {
+			t.Errorf("Missing table %v", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				t.Errorf("Missing column %v.%v", stmt.Schema.Table, field.DBName)
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !migrator.HasIndex(model, index.Name) {
+				t.Errorf("Missing index %v on %v", index.Name, stmt.Schema.Table)
+			}
+		}
+	}
+}
+
+func testMigrations() []*migrations.Migration {
+	return []*migrations.Migration{
+		{Version: 1, Name: "create_widgets", UpSQL: "CREATE TABLE widgets (id integer PRIMARY KEY);", DownSQL: "DROP TABLE widgets;"},
+		{Version: 2, Name: "add_widget_name", UpSQL: "ALTER TABLE widgets ADD COLUMN name text;", DownSQL: "ALTER TABLE widgets DROP COLUMN name;"},
+	}
+}
+
+func TestDownAndUp(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "migrate_down")
+	migrator, err := migrations.NewMigratorWithMigrations(db, testMigrations())
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+
+	if count, err := migrator.Up(ctx, 1); err != nil || count != 1 {
+		t.Fatalf("Expected 1 migration up to version 1, got %d, err: %v", count, err)
+	}
+	if db.Migrator().HasColumn("widgets", "name") {
+		t.Errorf("Expected version 2 not to be applied")
+	}
+	if count, err := migrator.Up(ctx, 0); err != nil || count != 1 {
+		t.Fatalf("Expected 1 more migration, got %d, err: %v", count, err)
+	}
+	if !db.Migrator().HasColumn("widgets", "name") {
+		t.Errorf("Expected version 2 to be applied")
+	}
+
+	if count, err := migrator.Down(ctx, 1); err != nil || count != 1 {
+		t.Fatalf("Expected 1 migration reverted, got %d, err: %v", count, err)
+	}
+	if db.Migrator().HasColumn("widgets", "name") || !db.Migrator().HasTable("widgets") {
+		t.Errorf("Expected only version 2 to be reverted")
+	}
+	if count, err := migrator.Down(ctx, 5); err != nil || count != 1 {
+		t.Fatalf("Expected 1 migration reverted, got %d, err: %v", count, err)
+	}
+	if db.Migrator().HasTable("widgets") {
+		t.Errorf("Expected widgets to be dropped")
+	}
+}
+
+func TestIrreversibleMigration(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "migrate_irreversible")
+	migrator, _ := migrations.NewMigratorWithMigrations(db, []*migrations.Migration{
+		{Version: 1, Name: "create_widgets", UpSQL: "CREATE TABLE widgets (id integer PRIMARY KEY);", DownSQL: "-- 不能回滚\n"},
+	})
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if _, err := migrator.Down(ctx, 1); !errors.Is(err, migrations.ErrIrreversible) {
+		t.Errorf("Expected ErrIrreversible, got %v", err)
+	}
+}
+
+func TestModifiedMigrationIsRejected(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "migrate_checksum")
+	migrator, _ := migrations.NewMigratorWithMigrations(db, testMigrations())
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	modified := testMigrations()
+	modified[1].UpSQL = "ALTER TABLE widgets ADD COLUMN title text;"
+	migrator, _ = migrations.NewMigratorWithMigrations(db, modified)
+	statuses, err := migrator.Status(ctx)
+	if err != nil || !statuses[1].Modified {
+		t.Errorf("Expected status to report modified migration, err: %v", err)
+	}
+	if _, err = migrator.Up(ctx, 0); !errors.Is(err, migrations.ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+
+	// 代码回滚到了没有version 2的版本
+	migrator, _ = migrations.NewMigratorWithMigrations(db, testMigrations()[:1])
+	if _, err = migrator.Up(ctx, 0); !errors.Is(err, migrations.ErrUnknownMigration) {
+		t.Errorf("Expected ErrUnknownMigration, got %v", err)
+	}
+}
+
+func TestExistingSchemaAdoptsBaseline(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "migrate_existing")
+	// 引入迁移之前AutoMigrate建的库：表结构和基线一样，但是没有schema_migrations
+	all, err := migrations.Load("sqlite")
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	baseline, _ := migrations.NewMigratorWithMigrations(db, all[:1])
+	if _, err = baseline.Up(ctx, 0); err != nil {
+		t.Fatalf("Failed to create baseline schema: %v", err)
+	}
+	if err = db.Migrator().DropTable(&migrations.SchemaMigration{}); err != nil {
+		t.Fatalf("Failed to drop schema_migrations: %v", err)
+	}
+	if err = db.Exec("INSERT INTO tax_rates (tax_state, zip_code, estimated_combined_rate) VALUES ('CA', '94016', 0.08625)").Error; err != nil {
+		t.Fatalf("Failed to insert tax rate: %v", err)
+	}
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+	count, err := migrator.Up(ctx, 0)
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	statuses, _ := migrator.Status(ctx)
+	if count != len(statuses)-1 {
+		t.Errorf("Expected all migrations but the baseline to run, got %d of %d", count, len(statuses))
+	}
+	if statuses[0].Migration.Version != migrations.BaselineVersion || statuses[0].Applied == nil {
+		t.Errorf("Expected baseline to be marked as applied")
+	}
+
+	// 已经导入的税率变成第一个版本，查询不受影响
+	if rate, err := repositories.NewTaxRateRepository(db).FindByZipCode(ctx, "94016"); err != nil || rate.EstimatedCombinedRate != 0.08625 {
+		t.Errorf("Expected legacy tax rate to stay visible, got %+v, err: %v", rate, err)
+	}
+}
+
+func TestMoneyMigrationConvertsPrices(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "migrate_money")
+	all, err := migrations.Load("sqlite")
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	money := 0
+	for all[money].Name != "money" {
+		money++
+	}
+	migrator, _ := migrations.NewMigratorWithMigrations(db, all[:money+1])
+	if _, err = migrator.Up(ctx, all[money-1].Version); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if err = db.Exec("INSERT INTO products (name, price, discount) VALUES ('Akara', 10.99, 0), ('Pasta', 1.005, 0.1)").Error; err != nil {
+		t.Fatalf("Failed to insert products: %v", err)
+	}
+	if _, err = migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	var products []models.Product
+	if err = db.Order("id").Find(&products).Error; err != nil || len(products) != 2 {
+		t.Fatalf("Failed to load products %v, err: %v", products, err)
+	}
+	// 和models.MoneyFromFloat一样按十进制四舍五入，1.005是1.01
+	if products[0].Price != models.NewMoney(1099, "USD") || products[1].Price != models.NewMoney(101, "USD") ||
+		products[1].Discount != models.NewMoney(10, "USD") {
+		t.Errorf("Unexpected converted prices %+v", products)
+	}
+
+	if _, err = migrator.Down(ctx, 1); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	var price float64
+	if err = db.Raw("SELECT price FROM products WHERE name = 'Akara'").Scan(&price).Error; err != nil || price != 10.99 {
+		t.Errorf("Expected price 10.99 after rollback, got %v, err: %v", price, err)
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGormLoggerHidesQueryParameters(t *testing.T) {
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: models.NewGormLogger()})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	// 成功的查询不记日志
+	if err = db.Exec("SELECT ?", "secret-token").Error; err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("Expected no logs for a successful query, got %+v", hook.AllEntries())
+	}
+
+	// 出错的查询记日志，但是不带参数
+	if err = db.Exec("SELECT * FROM missing WHERE token = ?", "secret-token").Error; err == nil {
+		t.Fatalf("Expected an error querying a missing table")
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != log.WarnLevel || strings.Contains(entry.Message, "secret-token") || !strings.Contains(entry.Message, "missing") {
+		t.Errorf("Expected a warning without the query parameters, got %+v", entry)
+	}
+}
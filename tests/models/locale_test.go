@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		money    models.Money
+		locale   string
+		expected string
+	}{
+		{models.NewMoney(123450, "USD"), "en-US", "$1,234.50"},
+		{models.NewMoney(-5, "USD"), "en-US", "-$0.05"},
+		{models.NewMoney(123450, "USD"), "en-CA", "US$1,234.50"},
+		{models.NewMoney(123450, "CAD"), "en-CA", "$1,234.50"},
+		{models.NewMoney(123450, "CAD"), "fr-CA", "1\u202f234,50\u00a0$"},
+		{models.NewMoney(123450, "EUR"), "de-DE", "1.234,50\u00a0€"},
+		{models.NewMoney(1234567, "JPY"), "ja-JP", "¥1,234,567"},
+		{models.NewMoney(99, "CHF"), "en-US", "CHF\u00a00.99"},
+		{models.NewMoney(123450, "SEK"), "sv-SE", "1\u00a0234,50\u00a0SEK"},
+		// 不支持的locale按en-US
+		{models.NewMoney(100, "USD"), "xx", "$1.00"},
+	} {
+		if formatted := tc.money.Format(tc.locale); formatted != tc.expected {
+			t.Errorf("Format(%v, %q): expected %q, got %q", tc.money, tc.locale, tc.expected, formatted)
+		}
+	}
+}
+
+func TestParseLocaleAndCurrency(t *testing.T) {
+	for locale, expected := range map[string]string{"en_us": "en-US", "FR-ca": "fr-CA", "de": "de", " ja-JP ": "ja-JP"} {
+		if parsed, err := models.ParseLocale(locale); err != nil || parsed != expected {
+			t.Errorf("ParseLocale(%q): expected %q, got %q, err: %v", locale, expected, parsed, err)
+		}
+	}
+	for _, locale := range []string{"", "xx-US", "en-USA", "en-1"} {
+		if _, err := models.ParseLocale(locale); !errors.Is(err, models.ErrInvalidLocale) {
+			t.Errorf("ParseLocale(%q): expected ErrInvalidLocale, got %v", locale, err)
+		}
+	}
+	if currency, err := models.ParseCurrency(" cad "); err != nil || currency != "CAD" {
+		t.Errorf("Expected CAD, got %q, err: %v", currency, err)
+	}
+	for _, currency := range []string{"", "US", "US$", "DOLLAR"} {
+		if _, err := models.ParseCurrency(currency); !errors.Is(err, models.ErrInvalidCurrency) {
+			t.Errorf("ParseCurrency(%q): expected ErrInvalidCurrency, got %v", currency, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"testing/quick"
+
+	"github.com/atomi-ai/atomi/models"
+)
+
+var quickConfig = &quick.Config{MaxCount: 2000}
+
+// 随机金额限制在 ±1e12 之内，乘以数量和税率不会溢出
+func bounded(amount int64) int64 {
+	return amount % 1000000000000
+}
+
+func TestParseMoney(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		currency string
+		amount   int64
+	}{
+		{"9.99", "usd", 999},
+		{"10", "USD", 1000},
+		{".5", "USD", 50},
+		{"1.005", "USD", 101},
+		{"1.0049", "USD", 100},
+		{"-0.005", "USD", -1},
+		{"+2.5", "USD", 250},
+		{"1999.6", "JPY", 2000},
+		{"1.2345", "KWD", 1235},
+	} {
+		m, err := models.ParseMoney(tc.value, tc.currency)
+		if err != nil || m.Amount != tc.amount || m.Currency != "USD" && m.Currency != tc.currency {
+			t.Errorf("ParseMoney(%q, %q): expected %d, got %+v, err: %v", tc.value, tc.currency, tc.amount, m, err)
+		}
+	}
+	for _, value := range []string{"", ".", "abc", "1.2.3", "1e3", "--1", "99999999999999999999"} {
+		if _, err := models.ParseMoney(value, "USD"); !errors.Is(err, models.ErrInvalidMoney) {
+			t.Errorf("ParseMoney(%q): expected ErrInvalidMoney, got %v", value, err)
+		}
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	for value, amount := range map[float64]int64{9.99: 999, 1.005: 101, 0.1 + 0.2: 30, -2.675: -268, 25: 2500} {
+		if m := models.MoneyFromFloat(value, "USD"); m.Amount != amount {
+			t.Errorf("MoneyFromFloat(%v): expected %d, got %d", value, amount, m.Amount)
+		}
+	}
+}
+
+// Decimal之后再ParseMoney得到原来的金额
+func TestDecimalRoundTrip(t *testing.T) {
+	for _, currency := range []string{"USD", "JPY", "KWD"} {
+		f := func(amount int64) bool {
+			m := models.NewMoney(amount, currency)
+			parsed, err := models.ParseMoney(m.Decimal(), currency)
+			return err == nil && parsed == m
+		}
+		if err := quick.Check(f, quickConfig); err != nil {
+			t.Errorf("%v: %v", currency, err)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	f := func(amount int64) bool {
+		m := models.NewMoney(amount, "EUR")
+		data, err := json.Marshal(m)
+		var decoded models.Money
+		return err == nil && json.Unmarshal(data, &decoded) == nil && decoded == m
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+	if data, _ := json.Marshal(models.NewMoney(999, "usd")); string(data) != `{"amount":999,"currency":"USD","formatted":"$9.99"}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+}
+
+// 加减互逆，满足交换律
+func TestAddSub(t *testing.T) {
+	f := func(a, b int64) bool {
+		x, y := models.NewMoney(bounded(a), "USD"), models.NewMoney(bounded(b), "USD")
+		sum, err := x.Add(y)
+		if err != nil {
+			return false
+		}
+		reversed, _ := y.Add(x)
+		back, err := sum.Sub(y)
+		return err == nil && back == x && reversed == sum
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := models.NewMoney(1, "USD").Add(models.NewMoney(1, "EUR")); !errors.Is(err, models.ErrCurrencyMismatch) {
+		t.Errorf("Expected ErrCurrencyMismatch, got %v", err)
+	}
+	if sum, err := (models.Money{}).Add(models.NewMoney(1, "EUR")); err != nil || sum != models.NewMoney(1, "EUR") {
+		t.Errorf("Expected a zero Money to take the other currency, got %+v, err: %v", sum, err)
+	}
+}
+
+// MulRate和精确结果的差不超过半个最小单位，0.5远离0
+func TestMulRate(t *testing.T) {
+	f := func(a int64, r uint32) bool {
+		amount := bounded(a) / 1000
+		rateMicros := int64(r % 1000000)
+		rate := float64(rateMicros) / 1000000
+		result := models.NewMoney(amount, "USD").MulRate(rate)
+		diff := result.Amount*1000000 - amount*rateMicros
+		return diff <= 500000 && diff >= -500000 && (diff != 500000 || amount < 0) && (diff != -500000 || amount > 0)
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoundDiv(t *testing.T) {
+	f := func(n int64, d uint16) bool {
+		n = bounded(n)
+		divisor := int64(d) + 1
+		result := models.RoundDiv(n, divisor)
+		exact := float64(n) / float64(divisor)
+		// -RoundDiv(n) == RoundDiv(-n)，结果和math.Round一致
+		return models.RoundDiv(-n, divisor) == -result && math.Abs(float64(result)-exact) <= 0.5
+	}
+	if err := quick.Check(f, quickConfig); err != nil {
+		t.Error(err)
+	}
+	for _, tc := range [][3]int64{{5, 10, 1}, {-5, 10, -1}, {4, 10, 0}, {15, 10, 2}, {-25, 10, -3}} {
+		if result := models.RoundDiv(tc[0], tc[1]); result != tc[2] {
+			t.Errorf("RoundDiv(%d, %d): expected %d, got %d", tc[0], tc[1], tc[2], result)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	for _, tc := range []struct {
+		money    models.Money
+		expected string
+	}{
+		{models.NewMoney(999, "USD"), "9.99"},
+		{models.NewMoney(-5, "USD"), "-0.05"},
+		{models.NewMoney(0, "USD"), "0.00"},
+		{models.NewMoney(100, "JPY"), "100"},
+		{models.NewMoney(1, "KWD"), "0.001"},
+		{models.NewMoney(math.MinInt64, "USD"), "-92233720368547758.08"},
+	} {
+		if decimal := tc.money.Decimal(); decimal != tc.expected {
+			t.Errorf("Decimal(%+v): expected %v, got %v", tc.money, tc.expected, decimal)
+		}
+	}
+}
+
+// 按汇率换算，不同的最小单位位数
+func TestConvert(t *testing.T) {
+	for _, tc := range []struct {
+		money    models.Money
+		rate     float64
+		currency string
+		expected models.Money
+	}{
+		{models.NewMoney(10000, "CAD"), 0.73, "USD", models.NewMoney(7300, "USD")},
+		{models.NewMoney(1, "CAD"), 0.735, "USD", models.NewMoney(1, "USD")},
+		{models.NewMoney(1000, "USD"), 149.5, "JPY", models.NewMoney(1495, "JPY")},
+		{models.NewMoney(1495, "JPY"), 0.00669, "USD", models.NewMoney(1000, "USD")},
+		{models.NewMoney(-250, "EUR"), 1.08, "usd", models.NewMoney(-270, "USD")},
+	} {
+		if converted := tc.money.Convert(tc.rate, tc.currency); converted != tc.expected {
+			t.Errorf("Convert(%v, %v, %v): expected %v, got %v", tc.money, tc.rate, tc.currency, tc.expected, converted)
+		}
+	}
+}
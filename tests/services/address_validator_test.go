@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+)
+
+type fakeGeocoder struct {
+	err error
+}
+
+func (g *fakeGeocoder) Geocode(ctx context.Context, address *models.Address) (float64, float64, error) {
+	return 37.7, -122.4, g.err
+}
+
+func TestValidateAddress(t *testing.T) {
+	app, err := tests.Setup("address_validator")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	if _, err = app.TaxRateImportService.Import(ctx, nil, []services.TaxRateFile{
+		{Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.092500\n")},
+	}); err != nil {
+		t.Fatalf("Failed to import tax rates: %v", err)
+	}
+	validator := services.NewAddressValidator(app.TaxRateRepository, services.NewGeocoder())
+
+	for _, tc := range []struct {
+		name    string
+		address models.Address
+		want    models.Address
+		fields  []string
+	}{
+		{name: "normalized",
+			address: models.Address{Line1: "  1 Main  St ", City: "San Francisco", State: "california", Country: "United States", PostalCode: "940161234"},
+			want:    models.Address{Line1: "1 Main St", City: "San Francisco", State: "CA", Country: "US", PostalCode: "94016-1234"}},
+		// 税率数据里没有的ZIP不检查州
+		{name: "unknown zip", address: models.Address{Line1: "1 Main St", City: "Austin", State: "TX", PostalCode: "73301"},
+			want: models.Address{Line1: "1 Main St", City: "Austin", State: "TX", Country: "US", PostalCode: "73301"}},
+		{name: "details",
+			address: models.Address{Line1: "1 Main St", City: "Austin", State: "TX", PostalCode: "73301", Label: " Home ", Phone: "+1 (512) 555-0100", DeliveryInstructions: " Ring twice "},
+			want:    models.Address{Line1: "1 Main St", City: "Austin", State: "TX", Country: "US", PostalCode: "73301", Label: "Home", Phone: "+15125550100", DeliveryInstructions: "Ring twice"}},
+		{name: "invalid phone and label", address: models.Address{Line1: "1 Main St", City: "Austin", State: "TX", PostalCode: "73301",
+			Label: strings.Repeat("x", 33), Phone: "555-0100"}, fields: []string{"label", "phone"}},
+		{name: "required", address: models.Address{Country: "US"}, fields: []string{"line1", "city", "state", "postal_code"}},
+		{name: "invalid state and zip", address: models.Address{Line1: "1 Main St", City: "SF", State: "XX", PostalCode: "9401"},
+			fields: []string{"state", "postal_code"}},
+		{name: "zip in another state", address: models.Address{Line1: "1 Main St", City: "SF", State: "NV", PostalCode: "94016"},
+			fields: []string{"postal_code"}},
+		{name: "foreign country", address: models.Address{Line1: "1 Main St", City: "Toronto", State: "ON", Country: "CA", PostalCode: "M5V 2T6"},
+			fields: []string{"country", "state", "postal_code"}},
+	} {
+		address := tc.address
+		err := validator.Validate(ctx, &address)
+		if len(tc.fields) == 0 {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", tc.name, err)
+				continue
+			}
+			if address.ValidatedAt == nil {
+				t.Errorf("%v: expected validated_at to be set", tc.name)
+			}
+			if address.HasCoordinates() {
+				t.Errorf("%v: expected no coordinates without a geocoder", tc.name)
+			}
+			address.ValidatedAt = nil
+			if address != tc.want {
+				t.Errorf("%v: expected %+v, got %+v", tc.name, tc.want, address)
+			}
+			continue
+		}
+
+		var validationErr *services.AddressValidationError
+		if !errors.As(err, &validationErr) || !errors.Is(err, services.ErrInvalidAddress) {
+			t.Errorf("%v: expected AddressValidationError, got %v", tc.name, err)
+			continue
+		}
+		if len(validationErr.Fields) != len(tc.fields) {
+			t.Errorf("%v: expected errors for %v, got %v", tc.name, tc.fields, validationErr.Fields)
+		}
+		for _, field := range tc.fields {
+			if validationErr.Fields[field] == "" {
+				t.Errorf("%v: expected an error for %v, got %v", tc.name, field, validationErr.Fields)
+			}
+		}
+	}
+}
+
+func TestValidateAddressGeocoding(t *testing.T) {
+	app, err := tests.Setup("address_validator")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	newAddress := func() *models.Address {
+		return &models.Address{Line1: "1 Main St", City: "San Francisco", State: "CA", PostalCode: "94016"}
+	}
+
+	address := newAddress()
+	if err := services.NewAddressValidator(app.TaxRateRepository, &fakeGeocoder{}).Validate(ctx, address); err != nil {
+		t.Fatalf("Failed to validate address: %v", err)
+	}
+	if !address.HasCoordinates() || *address.Latitude != 37.7 || *address.Longitude != -122.4 {
+		t.Errorf("Expected coordinates (37.7, -122.4), got (%v, %v)", address.Latitude, address.Longitude)
+	}
+	quote := &models.QuoteRequest{}
+	quote.SetDropoff(address)
+	if quote.DropoffAddress != "1 Main St, San Francisco, CA 94016" || quote.DropoffLatitude != address.Latitude {
+		t.Errorf("Expected dropoff from the address, got %q (%v, %v)", quote.DropoffAddress, quote.DropoffLatitude, quote.DropoffLongitude)
+	}
+
+	err = services.NewAddressValidator(app.TaxRateRepository, &fakeGeocoder{err: services.ErrAddressNotFound}).Validate(ctx, newAddress())
+	if !errors.Is(err, services.ErrInvalidAddress) {
+		t.Errorf("Expected ErrInvalidAddress for an address the geocoder can't find, got %v", err)
+	}
+
+	// geocoder出错的时候地址照样保存，只是没有坐标
+	address = newAddress()
+	if err := services.NewAddressValidator(app.TaxRateRepository, &fakeGeocoder{err: errors.New("timeout")}).Validate(ctx, address); err != nil {
+		t.Errorf("Expected geocoder errors to be ignored, got %v", err)
+	}
+	if address.HasCoordinates() || address.ValidatedAt == nil {
+		t.Errorf("Expected a validated address without coordinates, got %+v", address)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+)
+
+type failingAuditLogRepository struct{}
+
+func (failingAuditLogRepository) Save(ctx context.Context, auditLog *models.AuditLog) error {
+	return errors.New("audit log unavailable")
+}
+
+func (failingAuditLogRepository) FindByTarget(ctx context.Context, targetType string, targetID int64) ([]models.AuditLog, error) {
+	return nil, nil
+}
+
+func TestAuditLogIsWrittenWithTheChange(t *testing.T) {
+	app, err := tests.Setup("admin_service")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	admin := &models.User{Email: "admin@example.com", Role: models.RoleAdmin}
+	user := &models.User{Email: "john.doe@example.com", Role: models.RoleUser}
+	for _, u := range []*models.User{admin, user} {
+		if _, err = app.UserRepository.Save(ctx, u); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	// 审计日志写不进去的时候修改也回滚
+	failing := services.NewAdminService(app.UserRepository, app.OrderRepository, app.StoreRepository, app.StoreMembershipRepository,
+		failingAuditLogRepository{}, app.Transactor)
+	if _, err = failing.ChangeRole(ctx, admin, user.ID, models.RoleMgr); err == nil {
+		t.Errorf("Expected an error when the audit log can't be written")
+	}
+	if saved, err := app.UserRepository.GetByID(ctx, user.ID); err != nil || saved.Role != models.RoleUser {
+		t.Errorf("Expected the role change to be rolled back, got %+v, err: %v", saved, err)
+	}
+
+	if _, err = app.AdminService.ChangeRole(ctx, admin, user.ID, models.RoleMgr); err != nil {
+		t.Fatalf("Failed to change role: %v", err)
+	}
+	logs, err := app.AdminService.GetAuditLogs(ctx, user.ID)
+	if err != nil || len(logs) != 1 || logs[0].Action != "user.change_role" || logs[0].ActorID != admin.ID {
+		t.Errorf("Expected one user.change_role audit log, got %+v, err: %v", logs, err)
+	}
+}
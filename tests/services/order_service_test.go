@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+)
+
+func TestCaptureOrderContact(t *testing.T) {
+	app, err := tests.Setup("order_contact")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	if _, err = app.TaxRateImportService.Import(ctx, nil, []services.TaxRateFile{
+		{Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.086250\n")},
+	}); err != nil {
+		t.Fatalf("Failed to import tax rates: %v", err)
+	}
+	user := &models.User{Name: "John Doe", Email: "john.doe@example.com", Phone: "415-555-0100"}
+	other := &models.User{Name: "Jane Doe", Email: "jane.doe@example.com"}
+	for _, u := range []*models.User{user, other} {
+		if _, err = app.UserRepository.Save(ctx, u); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	address, err := app.AddressService.AddAddressForUser(ctx, user, &models.Address{Line1: "1 Main St", City: "San Francisco", State: "CA",
+		PostalCode: "94016", DeliveryInstructions: "Ring twice"})
+	if err != nil {
+		t.Fatalf("Failed to create address: %v", err)
+	}
+	store := &models.Store{Name: "Mission Store", Address: "2 Valencia St", City: "San Francisco", State: "CA", ZipCode: "94016", Phone: "+14155550199"}
+	if err = app.ManagerStoreRepository.Save(ctx, store); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	burger := &models.Product{Name: "Burger", Price: models.NewMoney(1250, "USD"), Category: models.ProductCategoryPreparedFood}
+	if err = app.ProductRepository.Save(ctx, burger); err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	newOrder := func() *models.Order {
+		// 客户端传的快照不算数
+		order := &models.Order{StoreID: store.ID, OrderItems: []models.OrderItem{{ProductID: burger.ID, Quantity: 2}},
+			Fulfillment: models.FulfillmentDelivery, Contact: models.OrderContact{Line1: "Somewhere else"}, DeliveryFee: models.NewMoney(1, "USD")}
+		if order, err = app.OrderService.AddOrderForUser(ctx, user, order); err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		if order.ContactCapturedAt != nil || order.Contact.Line1 != "" || order.DeliveryFee.Amount != 0 {
+			t.Errorf("Expected the client-supplied contact and delivery fee to be cleared, got %+v %v", order.Contact, order.DeliveryFee)
+		}
+		if order, err = app.OrderService.CalculateTax(ctx, user, order.ID, address); err != nil {
+			t.Fatalf("Failed to calculate tax: %v", err)
+		}
+		return order
+	}
+
+	// 送货：收货人、电话和说明默认用用户和地址上的
+	order := newOrder()
+	order, err = app.OrderService.CaptureContact(ctx, user, order.ID, &services.CheckoutContact{Fulfillment: models.FulfillmentDelivery, Address: address})
+	if err != nil {
+		t.Fatalf("Failed to capture contact: %v", err)
+	}
+	want := models.OrderContact{Line1: "1 Main St", City: "San Francisco", State: "CA", Country: "US", PostalCode: "94016",
+		Name: "John Doe", Phone: "+14155550100", Notes: "Ring twice"}
+	if order.Contact != want || order.Fulfillment != models.FulfillmentDelivery || order.ContactCapturedAt == nil {
+		t.Errorf("Expected contact %+v, got %v %+v", want, order.Fulfillment, order.Contact)
+	}
+
+	// 改地址不影响订单，Delivery按订单的快照建
+	if _, err = app.AddressService.UpdateAddressForUser(ctx, user, address.ID, &models.Address{Line1: "9 Other St", City: "San Francisco",
+		State: "CA", PostalCode: "94016"}); err != nil {
+		t.Fatalf("Failed to update address: %v", err)
+	}
+	if order, err = app.OrderService.FindOrderByID(ctx, order.ID); err != nil {
+		t.Fatalf("Failed to load order: %v", err)
+	}
+	data, err := app.OrderService.BuildDeliveryData(ctx, order)
+	if err != nil {
+		t.Fatalf("Failed to build delivery data: %v", err)
+	}
+	if data.DropoffAddress != "1 Main St, San Francisco, CA 94016" || data.DropoffName != "John Doe" || data.DropoffPhoneNumber != "+14155550100" ||
+		data.DropoffNotes == nil || *data.DropoffNotes != "Ring twice" {
+		t.Errorf("Expected dropoff from the order contact, got %+v", data)
+	}
+	if data.PickupAddress != "2 Valencia St, San Francisco, CA 94016" || data.PickupName != "Mission Store" || data.PickupPhoneNumber != "+14155550199" {
+		t.Errorf("Expected pickup from the store, got %+v", data)
+	}
+	if len(data.ManifestItems) != 1 || data.ManifestItems[0].Name != "Burger" || data.ManifestItems[0].Quantity != 2 ||
+		*data.ManifestItems[0].Price != 1250 || *data.ManifestTotalValue != 2500 {
+		t.Errorf("Expected manifest from the order items, got %+v", data.ManifestItems)
+	}
+
+	// 付款之后快照不再改变
+	if _, err = app.OrderService.UpdatePaymentIntentID(ctx, order.ID, "pi_contact"); err != nil {
+		t.Fatalf("Failed to update payment intent: %v", err)
+	}
+	order, err = app.OrderService.CaptureContact(ctx, user, order.ID, &services.CheckoutContact{Fulfillment: models.FulfillmentPickup, RecipientName: "Someone"})
+	if err != nil || order.Fulfillment != models.FulfillmentDelivery || order.Contact != want {
+		t.Errorf("Expected the contact of a placed order to be unchanged, got %v %+v, err: %v", order.Fulfillment, order.Contact, err)
+	}
+
+	// 到店自取：地址是店的，收货人和电话可以另外指定
+	order = newOrder()
+	order, err = app.OrderService.CaptureContact(ctx, user, order.ID, &services.CheckoutContact{Fulfillment: models.FulfillmentPickup,
+		RecipientName: " Jane  Roe ", Phone: "(415) 555-0123", Notes: "Extra napkins"})
+	if err != nil {
+		t.Fatalf("Failed to capture contact: %v", err)
+	}
+	want = models.OrderContact{Line1: "2 Valencia St", City: "San Francisco", State: "CA", PostalCode: "94016",
+		Name: "Jane Roe", Phone: "+14155550123", Notes: "Extra napkins"}
+	if order.Contact != want || order.Fulfillment != models.FulfillmentPickup {
+		t.Errorf("Expected contact %+v, got %v %+v", want, order.Fulfillment, order.Contact)
+	}
+	if _, err = app.OrderService.BuildDeliveryData(ctx, order); !errors.Is(err, services.ErrInvalidCheckout) {
+		t.Errorf("Expected ErrInvalidCheckout for a pickup order, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		user    *models.User
+		contact services.CheckoutContact
+		err     error
+	}{
+		{name: "another user's order", user: other, contact: services.CheckoutContact{Fulfillment: models.FulfillmentPickup}, err: services.ErrOrderNotFound},
+		{name: "delivery without address", user: user, contact: services.CheckoutContact{Fulfillment: models.FulfillmentDelivery}, err: services.ErrInvalidCheckout},
+		{name: "unknown fulfillment", user: user, contact: services.CheckoutContact{Fulfillment: "DRONE", Address: address}, err: services.ErrInvalidCheckout},
+		{name: "invalid phone", user: user, contact: services.CheckoutContact{Fulfillment: models.FulfillmentPickup, Phone: "555"}, err: services.ErrInvalidCheckout},
+	} {
+		if _, err := app.OrderService.CaptureContact(ctx, tc.user, order.ID, &tc.contact); !errors.Is(err, tc.err) {
+			t.Errorf("%v: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+}
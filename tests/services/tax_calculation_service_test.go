@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/quick"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+	"github.com/spf13/viper"
+)
+
+// newTaxTestOrder 是一个熟食、一个食品杂货和一个饮料的订单，运费5.99
+func newTaxTestOrder() *models.Order {
+	return &models.Order{
+		DeliveryFee: models.NewMoney(599, "USD"),
+		OrderItems: []models.OrderItem{
+			{ProductID: 1, Quantity: 3, Product: &models.Product{Price: models.MoneyFromFloat(9.99, "USD"), Category: models.ProductCategoryPreparedFood}},
+			{ProductID: 2, Quantity: 1, Product: &models.Product{Price: models.MoneyFromFloat(4.5, "USD"), Category: models.ProductCategoryGrocery}},
+			{ProductID: 3, Quantity: 1, Product: &models.Product{Price: models.MoneyFromFloat(1.99, "USD"), Category: models.ProductCategoryDrink}},
+		},
+	}
+}
+
+func itemTaxes(order *models.Order) []int64 {
+	var taxes []int64
+	for _, item := range order.OrderItems {
+		taxes = append(taxes, item.Tax.Amount)
+	}
+	return taxes
+}
+
+func TestCalculateOrderTax(t *testing.T) {
+	app, err := tests.Setup("tax_calculation")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	if _, err = app.TaxRateImportService.Import(ctx, nil, []services.TaxRateFile{
+		{Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.092500\n")},
+	}); err != nil {
+		t.Fatalf("Failed to import tax rates: %v", err)
+	}
+	address := &models.Address{State: "CA", PostalCode: "94016"}
+	defer viper.Set("deliveryFeeTaxableStates", nil)
+	defer viper.Set("stateTaxExemptCategories", nil)
+
+	for _, tc := range []struct {
+		name           string
+		taxExempt      bool
+		config         map[string]interface{}
+		itemTaxes      []int64
+		deliveryFeeTax int64
+		taxAmount      int64
+	}{
+		// 29.97*9.25%=2.772225，1.99*9.25%=0.184075，分别四舍五入是2.77+0.18，整单是2.96，多出来的1分给余数大的饮料
+		{name: "default", itemTaxes: []int64{277, 0, 19}, taxAmount: 296},
+		{name: "taxable delivery fee", config: map[string]interface{}{"deliveryFeeTaxableStates": []string{"CA"}},
+			itemTaxes: []int64{277, 0, 19}, deliveryFeeTax: 55, taxAmount: 351},
+		{name: "state exempt categories", config: map[string]interface{}{"stateTaxExemptCategories": map[string][]string{"CA": {"GROCERY", "DRINK"}}},
+			itemTaxes: []int64{277, 0, 0}, taxAmount: 277},
+		{name: "tax exempt user", taxExempt: true, itemTaxes: []int64{0, 0, 0}, taxAmount: 0},
+	} {
+		viper.Set("deliveryFeeTaxableStates", nil)
+		viper.Set("stateTaxExemptCategories", nil)
+		for key, value := range tc.config {
+			viper.Set(key, value)
+		}
+
+		order := newTaxTestOrder()
+		if err = app.TaxCalculationService.CalculateOrderTax(ctx, &models.User{TaxExempt: tc.taxExempt}, order, address); err != nil {
+			t.Fatalf("%v: failed to calculate tax: %v", tc.name, err)
+		}
+		if taxes := itemTaxes(order); !equalInt64s(taxes, tc.itemTaxes) {
+			t.Errorf("%v: expected item taxes %v, got %v", tc.name, tc.itemTaxes, taxes)
+		}
+		if order.DeliveryFeeTax.Amount != tc.deliveryFeeTax || order.Tax.Amount != tc.taxAmount {
+			t.Errorf("%v: expected delivery fee tax %d and tax %d, got %d and %d", tc.name, tc.deliveryFeeTax, tc.taxAmount, order.DeliveryFeeTax.Amount, order.Tax.Amount)
+		}
+		if order.Subtotal.Amount != 3646 || order.Total.Amount != 3646+599+tc.taxAmount {
+			t.Errorf("%v: unexpected subtotal %d and total %d", tc.name, order.Subtotal.Amount, order.Total.Amount)
+		}
+		if order.TaxState != "CA" || order.TaxRate != 0.0925 || order.TaxExempt != tc.taxExempt || order.TaxCalculatedAt == nil {
+			t.Errorf("%v: unexpected tax breakdown %+v", tc.name, order)
+		}
+	}
+
+	order := newTaxTestOrder()
+	if err = app.TaxCalculationService.CalculateOrderTax(ctx, &models.User{}, order, &models.Address{State: "CA", PostalCode: "00000"}); !errors.Is(err, services.ErrTaxRateNotFound) {
+		t.Errorf("Expected ErrTaxRateNotFound, got %v", err)
+	}
+	order.OrderItems[0].Product = nil
+	if err = app.TaxCalculationService.CalculateOrderTax(ctx, &models.User{}, order, address); !errors.Is(err, services.ErrInvalidOrderItem) {
+		t.Errorf("Expected ErrInvalidOrderItem, got %v", err)
+	}
+}
+
+// 随机的订单：每一项的税加起来等于整单的税，整单的税等于应税金额乘以税率四舍五入，每一项和精确值差不到1分
+func TestCalculateOrderTaxAllocation(t *testing.T) {
+	app, err := tests.Setup("tax_allocation")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	if _, err = app.TaxRateImportService.Import(ctx, nil, []services.TaxRateFile{
+		{Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.092500\n")},
+	}); err != nil {
+		t.Fatalf("Failed to import tax rates: %v", err)
+	}
+	address := &models.Address{State: "CA", PostalCode: "94016"}
+	categories := []models.ProductCategory{models.ProductCategoryPreparedFood, models.ProductCategoryGrocery, models.ProductCategoryDrink}
+	const rateMicros = 92500
+
+	f := func(prices []uint32, quantities []uint8, deliveryFee uint16) bool {
+		order := &models.Order{DeliveryFee: models.NewMoney(int64(deliveryFee), "USD")}
+		for i, price := range prices {
+			quantity := int64(1)
+			if i < len(quantities) {
+				quantity += int64(quantities[i] % 10)
+			}
+			order.OrderItems = append(order.OrderItems, models.OrderItem{ProductID: int64(i + 1), Quantity: quantity,
+				Product: &models.Product{Price: models.NewMoney(int64(price%100000), "USD"), Category: categories[i%len(categories)]}})
+		}
+		if err := app.TaxCalculationService.CalculateOrderTax(ctx, &models.User{}, order, address); err != nil {
+			t.Logf("Failed to calculate tax: %v", err)
+			return false
+		}
+		sum := order.DeliveryFeeTax.Amount
+		for _, item := range order.OrderItems {
+			exact := item.UnitPrice.Amount * item.Quantity * rateMicros
+			if !item.Taxable {
+				exact = 0
+			}
+			if diff := item.Tax.Amount*1000000 - exact; diff <= -1000000 || diff >= 1000000 {
+				return false
+			}
+			sum += item.Tax.Amount
+		}
+		return sum == order.Tax.Amount && order.Tax.Amount == models.RoundDiv(order.TaxableSales.Amount*rateMicros, 1000000) &&
+			order.Total.Amount == order.Subtotal.Amount+order.DeliveryFee.Amount+order.Tax.Amount
+	}
+	if err = quick.Check(f, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func equalInt64s(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
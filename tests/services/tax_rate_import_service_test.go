@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+	"github.com/spf13/viper"
+)
+
+func writeTaxRateFile(t *testing.T, dir, name, content string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %v: %v", name, err)
+	}
+}
+
+func TestImportDirOnlyImportsChangedFiles(t *testing.T) {
+	app, err := tests.Setup("tax_rate_import")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTaxRateFile(t, dir, "TAXRATES_ZIP5_CA202304.csv", "State,ZipCode,EstimatedCombinedRate\nCA,94016,0.086250\n")
+
+	dataset, err := app.TaxRateImportService.ImportDir(ctx, dir)
+	if err != nil || dataset == nil {
+		t.Fatalf("Expected first import to create a dataset, got %v, err: %v", dataset, err)
+	}
+	if dataset.SourceFiles != "TAXRATES_ZIP5_CA202304.csv" || dataset.ImportedBy != 0 {
+		t.Errorf("Unexpected dataset %+v", dataset)
+	}
+
+	// 重启的时候文件没变，不再导入
+	if again, err := app.TaxRateImportService.ImportDir(ctx, dir); err != nil || again != nil {
+		t.Errorf("Expected unchanged files to be skipped, got %v, err: %v", again, err)
+	}
+
+	writeTaxRateFile(t, dir, "TAXRATES_ZIP5_CA202304.csv", "State,ZipCode,EstimatedCombinedRate\nCA,94016,0.090000\n")
+	if changed, err := app.TaxRateImportService.ImportDir(ctx, dir); err != nil || changed == nil || changed.ID == dataset.ID {
+		t.Errorf("Expected changed files to be imported, got %v, err: %v", changed, err)
+	}
+}
+
+func TestImportValidatesFiles(t *testing.T) {
+	app, err := tests.Setup("tax_rate_import_invalid")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	for name, file := range map[string]services.TaxRateFile{
+		"bad name":       {Name: "rates.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.08\n")},
+		"missing column": {Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode\nCA,94016\n")},
+		"wrong state":    {Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nWA,98004,0.1\n")},
+		"bad rate":       {Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,1.5\n")},
+		"duplicated zip": {Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.08\nCA,94016,0.09\n")},
+		"empty":          {Name: "TAXRATES_ZIP5_CA202304.csv", Content: []byte("State,ZipCode,EstimatedCombinedRate\n")},
+	} {
+		if _, err := app.TaxRateImportService.Import(context.Background(), nil, []services.TaxRateFile{file}); !errors.Is(err, services.ErrInvalidTaxRateFile) {
+			t.Errorf("%v: expected ErrInvalidTaxRateFile, got %v", name, err)
+		}
+	}
+	if datasets, _ := app.TaxRateImportService.ListDatasets(context.Background()); len(datasets) != 0 {
+		t.Errorf("Expected no datasets after failed imports, got %d", len(datasets))
+	}
+}
+
+func TestImportKeepsRecentDatasets(t *testing.T) {
+	app, err := tests.Setup("tax_rate_import_retention")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	viper.Set("taxRateDatasetRetention", 2)
+	defer viper.Set("taxRateDatasetRetention", nil)
+
+	ctx := context.Background()
+	for month := 1; month <= 4; month++ {
+		file := services.TaxRateFile{
+			Name:    fmt.Sprintf("TAXRATES_ZIP5_CA20230%d.csv", month),
+			Content: []byte(fmt.Sprintf("State,ZipCode,EstimatedCombinedRate\nCA,94016,0.0%d\n", month)),
+		}
+		if _, err := app.TaxRateImportService.Import(ctx, nil, []services.TaxRateFile{file}); err != nil {
+			t.Fatalf("Failed to import %v: %v", file.Name, err)
+		}
+	}
+	datasets, _ := app.TaxRateImportService.ListDatasets(ctx)
+	if len(datasets) != 2 || !datasets[0].Active || datasets[1].EffectiveDate.Format("2006-01") != "2023-03" {
+		t.Errorf("Expected the 2 latest datasets to be kept, got %+v", datasets)
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+	"github.com/spf13/viper"
+)
+
+func TestTaxLiabilityReport(t *testing.T) {
+	app, err := tests.Setup("tax_report")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	day := func(d int) *time.Time {
+		paidAt := time.Date(2026, 9, d, 12, 0, 0, 0, time.UTC)
+		return &paidAt
+	}
+	usd := func(amount int64) models.Money { return models.NewMoney(amount, "USD") }
+	taxed := func(paidAt *time.Time, storeID, datasetID int64, rate float64, taxable, exempt, tax, refunded int64) *models.Order {
+		return &models.Order{StoreID: storeID, PaidAt: paidAt, TaxCalculatedAt: paidAt, TaxState: "CA", TaxZipCode: "94016",
+			TaxRateDatasetID: datasetID, TaxRate: rate, Subtotal: usd(taxable + exempt), TaxableSales: usd(taxable), ExemptSales: usd(exempt),
+			Tax: usd(tax), Total: usd(taxable + exempt + tax), Refunded: usd(refunded)}
+	}
+	for _, order := range []*models.Order{
+		taxed(day(1), 1, 1, 0.0925, 10000, 2000, 925, 0),
+		taxed(day(2), 1, 1, 0.0925, 20000, 0, 1850, 0),
+		// 退了一半
+		taxed(day(3), 1, 1, 0.0925, 10000, 0, 925, 5463),
+		// 全部退款
+		taxed(day(4), 2, 1, 0.0925, 5000, 0, 463, 5463),
+		// 月中换了税率版本
+		taxed(day(20), 1, 2, 0.095, 10000, 0, 950, 0),
+		// 不在时间范围里
+		taxed(day(30), 1, 2, 0.095, 10000, 0, 950, 0),
+		// 没有付款
+		taxed(nil, 1, 2, 0.095, 10000, 0, 950, 0),
+		// 算税上线之前的订单
+		{StoreID: 1, PaidAt: day(5), Total: usd(1000)},
+		// 别的币种单独统计
+		{StoreID: 1, PaidAt: day(6), TaxCalculatedAt: day(6), TaxState: "CA", TaxZipCode: "94016", TaxRateDatasetID: 1, TaxRate: 0.0925,
+			Subtotal: models.NewMoney(1000, "CAD"), TaxableSales: models.NewMoney(1000, "CAD"), Tax: models.NewMoney(93, "CAD"),
+			Total: models.NewMoney(1093, "CAD")},
+	} {
+		if err = app.OrderRepository.Save(ctx, order); err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+	}
+
+	viper.Set("fxRates", map[string]interface{}{"CAD": 0.75})
+	defer viper.Set("fxRates", nil)
+	report, err := app.TaxReportService.TaxLiabilityReport(ctx, *day(1), *day(30))
+	if err != nil {
+		t.Fatalf("Failed to build report: %v", err)
+	}
+	if len(report.Rows) != 4 || report.UncalculatedOrders != 1 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	expected := []services.TaxLiabilityRow{
+		{State: "CA", ZipCode: "94016", StoreID: 1, TaxRateDatasetID: 1, TaxRate: 0.0925, Currency: "CAD", OrderCount: 1,
+			TaxableSales: models.NewMoney(1000, "CAD"), ExemptSales: models.NewMoney(0, "CAD"), TaxCollected: models.NewMoney(93, "CAD"),
+			Refunded: models.NewMoney(0, "CAD")},
+		{State: "CA", ZipCode: "94016", StoreID: 1, TaxRateDatasetID: 1, TaxRate: 0.0925, Currency: "USD", OrderCount: 3,
+			TaxableSales: usd(10000 + 20000 + 5000), ExemptSales: usd(2000), TaxCollected: usd(925 + 1850 + 462), Refunded: usd(5463)},
+		{State: "CA", ZipCode: "94016", StoreID: 1, TaxRateDatasetID: 2, TaxRate: 0.095, Currency: "USD", OrderCount: 1,
+			TaxableSales: usd(10000), ExemptSales: usd(0), TaxCollected: usd(950), Refunded: usd(0)},
+		{State: "CA", ZipCode: "94016", StoreID: 2, TaxRateDatasetID: 1, TaxRate: 0.0925, Currency: "USD", OrderCount: 1,
+			TaxableSales: usd(0), ExemptSales: usd(0), TaxCollected: usd(0), Refunded: usd(5463)},
+	}
+	for i, row := range report.Rows {
+		if *row != expected[i] {
+			t.Errorf("Row %d: expected %+v, got %+v", i, expected[i], *row)
+		}
+	}
+	if len(report.Totals) != 2 || report.Totals[0].Currency != "CAD" || report.Totals[1].TaxCollected != usd(925+1850+462+950) ||
+		report.Totals[1].OrderCount != 5 {
+		t.Errorf("Unexpected totals %+v", report.Totals)
+	}
+	// CAD按0.75换算成USD再加起来，0.93*0.75=0.6975
+	expectedReportingTotal := services.TaxLiabilityRow{Currency: "USD", OrderCount: 6, TaxableSales: usd(45000 + 750), ExemptSales: usd(2000),
+		TaxCollected: usd(4187 + 70), Refunded: usd(10926)}
+	if report.ReportingCurrency != "USD" || report.ReportingTotal == nil || *report.ReportingTotal != expectedReportingTotal {
+		t.Errorf("Unexpected reporting total %+v", report.ReportingTotal)
+	}
+
+	var buf bytes.Buffer
+	if err = services.WriteTaxLiabilityCSV(&buf, report); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 8 || lines[2] != "CA,94016,1,1,0.0925,USD,3,350.00,20.00,32.37,54.63" || lines[6] != "TOTAL,,,,,USD,5,450.00,20.00,41.87,109.26" ||
+		lines[7] != "REPORTING_TOTAL,,,,,USD,6,457.50,20.00,42.57,109.26" {
+		t.Errorf("Unexpected CSV:\n%v", buf.String())
+	}
+
+	// 没有汇率的时候报表照样出，只是没有换算的合计
+	viper.Set("fxRates", nil)
+	if report, err = app.TaxReportService.TaxLiabilityReport(ctx, *day(1), *day(30)); err != nil || report.ReportingTotal != nil {
+		t.Errorf("Expected no reporting total without exchange rates, got %+v, err: %v", report, err)
+	}
+}
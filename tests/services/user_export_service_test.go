@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	application "github.com/atomi-ai/atomi/app"
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/tests"
+)
+
+func TestPurgeExpiredExports(t *testing.T) {
+	app, err := tests.Setup("user_export")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	user := &models.User{Email: "john.doe@example.com"}
+	if user, err = app.UserRepository.Save(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	request, err := app.UserExportService.RequestExport(ctx, user, models.UserExportFormatJSON)
+	if err != nil {
+		t.Fatalf("Failed to request export: %v", err)
+	}
+	app.UserExportService.Wait()
+	if request, err = app.UserExportService.GetExport(ctx, user, request.ID); err != nil {
+		t.Fatalf("Failed to get export: %v", err)
+	}
+	if request.Status != models.UserExportStatusReady || request.BlobName == "" {
+		t.Fatalf("Expected a ready export with a blob, got %+v", request)
+	}
+
+	// 没过期的不删
+	blob := app.BlobStorage.(*application.MockBlobStorage)
+	if purged, err := app.UserExportService.PurgeExpired(ctx); err != nil || purged != 0 || len(blob.Deleted) != 0 {
+		t.Errorf("Expected nothing to be purged, got %d %v, err: %v", purged, blob.Deleted, err)
+	}
+
+	expiresAt := time.Now().Add(-time.Minute)
+	request.ExpiresAt = &expiresAt
+	if err = app.UserExportRequestRepository.Save(ctx, request); err != nil {
+		t.Fatalf("Failed to update export: %v", err)
+	}
+	if purged, err := app.UserExportService.PurgeExpired(ctx); err != nil || purged != 1 || len(blob.Deleted) != 1 || blob.Deleted[0] != request.BlobName {
+		t.Errorf("Expected %v to be purged, got %d %v, err: %v", request.BlobName, purged, blob.Deleted, err)
+	}
+	expired, err := app.UserExportService.GetExport(ctx, user, request.ID)
+	if err != nil || expired.Status != models.UserExportStatusExpired || expired.DownloadURL != "" || expired.BlobName != "" {
+		t.Errorf("Expected the export to be expired without a file, got %+v, err: %v", expired, err)
+	}
+
+	// 已经清理过的不会再删一次
+	if purged, err := app.UserExportService.PurgeExpired(ctx); err != nil || purged != 0 {
+		t.Errorf("Expected nothing to be purged again, got %d, err: %v", purged, err)
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/services"
+	"github.com/atomi-ai/atomi/tests"
+	"github.com/atomi-ai/atomi/utils"
+)
+
+func TestProvisionRequiresVerifiedEmail(t *testing.T) {
+	app, err := tests.Setup("user_provisioning")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	owner := &models.User{Email: "owner@example.com"}
+	if owner, err = app.UserRepository.Save(ctx, owner); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Firebase的token里没验证过的email不能认领已有的账号
+	principal := &utils.Principal{Subject: "attacker", Email: "owner@example.com", Provider: utils.AuthProviderFirebase}
+	if _, err = app.UserProvisioningService.Provision(ctx, principal); !errors.Is(err, services.ErrEmailInUse) {
+		t.Errorf("Expected ErrEmailInUse for an unverified email, got %v", err)
+	}
+	if user, err := app.UserRepository.GetByID(ctx, owner.ID); err != nil || user.AuthSubject != nil {
+		t.Errorf("Expected the existing user not to be linked, got %+v, err: %v", user, err)
+	}
+
+	// 也不能接受发给这个email的店员邀请
+	store := &models.Store{Name: "Mission Store"}
+	if err = app.ManagerStoreRepository.Save(ctx, store); err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if _, err = app.StoreInvitationService.Invite(ctx, owner, store.ID, "staff@example.com", models.StoreRelationshipStaff); err != nil {
+		t.Fatalf("Failed to invite: %v", err)
+	}
+	principal = &utils.Principal{Subject: "staff", Email: "staff@example.com", Provider: utils.AuthProviderFirebase}
+	staff, err := app.UserProvisioningService.Provision(ctx, principal)
+	if err != nil {
+		t.Fatalf("Failed to provision user: %v", err)
+	}
+	if stores, err := app.StoreMembershipRepository.FindStoresByStaff(ctx, staff.ID); err != nil || len(stores) != 0 {
+		t.Errorf("Expected no stores for an unverified email, got %v, err: %v", stores, err)
+	}
+	// 没验证过的email不存
+	if staff.Email != "staff@firebase.users.invalid" {
+		t.Errorf("Expected a placeholder email for an unverified email, got %v", staff.Email)
+	}
+
+	// email验证过之后再登录就接受了
+	principal.EmailVerified = true
+	if staff, err = app.UserProvisioningService.Provision(ctx, principal); err != nil {
+		t.Fatalf("Failed to provision user: %v", err)
+	}
+	if staff.Email != "staff@example.com" {
+		t.Errorf("Expected the verified email to replace the placeholder, got %v", staff.Email)
+	}
+	if stores, err := app.StoreMembershipRepository.FindStoresByStaff(ctx, staff.ID); err != nil || len(stores) != 1 || stores[0].ID != store.ID {
+		t.Errorf("Expected store %d after verifying the email, got %v, err: %v", store.ID, stores, err)
+	}
+}
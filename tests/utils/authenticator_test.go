@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestLocalIssuer(t *testing.T) {
+	issuer, err := utils.NewHMACLocalIssuer([]byte("dev-secret"))
+	if err != nil {
+		t.Fatalf("Failed to create local issuer: %v", err)
+	}
+
+	token, err := issuer.IssueToken("dev-user", "Dev@Example.com", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	principal, err := issuer.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if principal.Subject != "dev-user" || principal.Email != "dev@example.com" || !principal.EmailVerified || principal.Provider != utils.AuthProviderLocal {
+		t.Errorf("Unexpected principal: %+v", principal)
+	}
+
+	// 其他secret签的token和过期的token都不能通过
+	other, _ := utils.NewHMACLocalIssuer([]byte("other-secret"))
+	if _, err := other.Authenticate(context.Background(), token); err == nil {
+		t.Errorf("Expected token signed by another secret to be rejected")
+	}
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss":   "atomi-local",
+		"email": "dev@example.com",
+		"exp":   time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte("dev-secret"))
+	if _, err := issuer.Authenticate(context.Background(), expired); err == nil {
+		t.Errorf("Expected expired token to be rejected")
+	}
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var issuerURL string
+	var jwksRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuerURL + "/jwks"})
+		case "/jwks":
+			atomic.AddInt32(&jwksRequests, 1)
+			time.Sleep(50 * time.Millisecond)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]string{{
+					"kty": "RSA",
+					"kid": "key-1",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	issuerURL = server.URL
+
+	authenticator, err := utils.NewOIDCAuthenticator(utils.OIDCConfig{Issuer: issuerURL, Audience: "atomi"})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+
+	sign := func(kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+	claims := func(aud string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            issuerURL,
+			"aud":            aud,
+			"sub":            "oidc-user",
+			"email":          "oidc@example.com",
+			"email_verified": "true",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	// 同时来的请求只取一次JWKS
+	token := sign("key-1", claims("atomi"))
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := authenticator.Authenticate(context.Background(), token)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Failed to authenticate concurrently: %v", err)
+		}
+	}
+	if requests := atomic.LoadInt32(&jwksRequests); requests != 1 {
+		t.Errorf("Expected JWKS to be fetched once, got %d", requests)
+	}
+
+	principal, err := authenticator.Authenticate(context.Background(), sign("key-1", claims("atomi")))
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if principal.Subject != "oidc-user" || principal.Email != "oidc@example.com" || !principal.EmailVerified || principal.Provider != utils.AuthProviderOIDC {
+		t.Errorf("Unexpected principal: %+v", principal)
+	}
+
+	if _, err := authenticator.Authenticate(context.Background(), sign("key-1", claims("someone-else"))); err == nil {
+		t.Errorf("Expected token for another audience to be rejected")
+	}
+	if _, err := authenticator.Authenticate(context.Background(), sign("unknown", claims("atomi"))); err == nil {
+		t.Errorf("Expected token with unknown key id to be rejected")
+	}
+}
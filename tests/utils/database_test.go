@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/atomi-ai/atomi/models"
+	"github.com/atomi-ai/atomi/tests"
+)
+
+func TestNewDialector(t *testing.T) {
+	for _, tc := range []struct{ driver, dsn, name string }{
+		{"", "atomi:secret@tcp(localhost:3306)/atomi", "mysql"},
+		{"mysql", "atomi:secret@tcp(localhost:3306)/atomi", "mysql"},
+		{"postgres", "host=localhost user=atomi dbname=atomi sslmode=verify-full", "postgres"},
+		{"sqlite", "file::memory:", "sqlite"},
+	} {
+		dialector, err := models.NewDialector(tc.driver, tc.dsn)
+		if err != nil {
+			t.Fatalf("Failed to create dialector for %q: %v", tc.driver, err)
+		}
+		if dialector.Name() != tc.name {
+			t.Errorf("Expected %v dialector for %q, got %v", tc.name, tc.driver, dialector.Name())
+		}
+	}
+	if _, err := models.NewDialector("oracle", ""); err == nil {
+		t.Errorf("Expected error for unsupported driver")
+	}
+}
+
+func TestUpsertKeepsExistingID(t *testing.T) {
+	app, err := tests.Setup("database")
+	if err != nil {
+		t.Fatalf("Failed to initialize testing application: %v", err)
+	}
+	ctx := context.Background()
+	first, err := app.UserRepository.Save(ctx, &models.User{Email: "upsert@example.com", Name: "First"})
+	if err != nil {
+		t.Fatalf("Failed to save user: %v", err)
+	}
+	second, err := app.UserRepository.Save(ctx, &models.User{Email: "upsert@example.com", Name: "Second"})
+	if err != nil {
+		t.Fatalf("Failed to upsert user: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("Expected upsert to keep id %d, got %d", first.ID, second.ID)
+	}
+	user, _ := app.UserRepository.GetByID(ctx, first.ID)
+	if user.Name != "Second" {
+		t.Errorf("Expected name to be updated, got %v", user.Name)
+	}
+}
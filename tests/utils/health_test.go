@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/atomi-ai/atomi/utils"
+)
+
+func TestHealthRegistry(t *testing.T) {
+	registry := utils.NewHealthRegistry()
+	stripeCalls := 0
+	registry.Register(utils.HealthCheck{
+		Name:     "database",
+		Check:    func(ctx context.Context) error { return nil },
+		Critical: true,
+	})
+	registry.Register(utils.HealthCheck{
+		Name: "stripe",
+		Check: func(ctx context.Context) error {
+			stripeCalls++
+			return errors.New("stripe is down")
+		},
+		CacheTTL: time.Minute,
+	})
+	registry.Register(utils.HealthCheck{
+		Name:    "uber",
+		Check:   func(ctx context.Context) error { time.Sleep(time.Second); return nil },
+		Timeout: 20 * time.Millisecond,
+	})
+
+	// 非critical的检查失败只是degraded，并且结果会被缓存
+	for i := 0; i < 2; i++ {
+		report := registry.Readiness(context.Background())
+		if report.Status != utils.HealthStatusDegraded || !report.Healthy() {
+			t.Fatalf("Expected degraded report, got %+v", report)
+		}
+		if stripe := report.Checks["stripe"]; stripe.Status != utils.HealthStatusFailing || stripe.Error != "stripe is down" || stripe.Cached != (i == 1) {
+			t.Errorf("Unexpected stripe result %+v", stripe)
+		}
+		if uber := report.Checks["uber"]; uber.Status != utils.HealthStatusFailing || uber.LatencyMs >= 1000 {
+			t.Errorf("Expected uber check to time out, got %+v", uber)
+		}
+	}
+	if stripeCalls != 1 {
+		t.Errorf("Expected stripe to be checked once, got %d", stripeCalls)
+	}
+
+	registry.Register(utils.HealthCheck{
+		Name:     "database",
+		Check:    func(ctx context.Context) error { return errors.New("connection refused") },
+		Critical: true,
+	})
+	if report := registry.Readiness(context.Background()); report.Status != utils.HealthStatusFailing || report.Healthy() {
+		t.Errorf("Expected failing report, got %+v", report)
+	}
+	if report := registry.Liveness(context.Background()); report.Status != utils.HealthStatusOK || len(report.Checks) != 0 {
+		t.Errorf("Expected liveness to skip dependency checks, got %+v", report)
+	}
+}
+
+func TestWorkerHeartbeat(t *testing.T) {
+	heartbeat := utils.NewWorkerHeartbeat(20 * time.Millisecond)
+	if err := heartbeat.CheckHealth(context.Background()); err != nil {
+		t.Errorf("Expected idle worker to be healthy, got %v", err)
+	}
+
+	heartbeat.Beat(1)
+	if err := heartbeat.CheckHealth(context.Background()); err != nil {
+		t.Errorf("Expected running job to be healthy, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := heartbeat.CheckHealth(context.Background()); err == nil {
+		t.Errorf("Expected stalled job to fail the check")
+	}
+	heartbeat.Done(1)
+	if err := heartbeat.CheckHealth(context.Background()); err != nil {
+		t.Errorf("Expected finished job to be healthy, got %v", err)
+	}
+}
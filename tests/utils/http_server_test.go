@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/spf13/viper"
+)
+
+func TestHTTPServerConfig(t *testing.T) {
+	cfg := utils.LoadHTTPServerConfig()
+	if cfg.Addr != ":8081" || cfg.ShutdownTimeout != 30*time.Second || cfg.MaxHeaderBytes != 1<<20 || cfg.TLSEnabled() {
+		t.Errorf("Unexpected default config %+v", cfg)
+	}
+
+	viper.Set("listenAddr", "127.0.0.1:0")
+	viper.Set("writeTimeout", "90s")
+	viper.Set("tlsCertFile", "/etc/atomi/tls.crt")
+	viper.Set("tlsKeyFile", "/etc/atomi/tls.key")
+	defer func() {
+		for _, key := range []string{"listenAddr", "writeTimeout", "tlsCertFile", "tlsKeyFile"} {
+			viper.Set(key, nil)
+		}
+	}()
+
+	cfg = utils.LoadHTTPServerConfig()
+	server := cfg.NewServer(http.NotFoundHandler())
+	if server.Addr != "127.0.0.1:0" || server.WriteTimeout != 90*time.Second || server.ReadHeaderTimeout != 5*time.Second || !cfg.TLSEnabled() {
+		t.Errorf("Unexpected server %+v from config %+v", server, cfg)
+	}
+}
+
+func TestWaitWithContext(t *testing.T) {
+	if err := utils.WaitWithContext(context.Background(), func() {}); err != nil {
+		t.Errorf("Expected wait to finish, got %v", err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := utils.WaitWithContext(ctx, func() { <-release }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atomi-ai/atomi/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentedTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/payment_intents/pi_3MtwBw" {
+			w.WriteHeader(http.StatusPaymentRequired)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: utils.NewInstrumentedTransport("test", nil)}
+	for _, path := range []string{"/v1/customers", "/v1/payment_intents/pi_3MtwBw"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to call test server: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if count := testutil.ToFloat64(utils.OutboundRequestsTotal.WithLabelValues("test", "GET /v1/customers", "200")); count != 1 {
+		t.Errorf("Expected 1 customers call, got %v", count)
+	}
+	// 路径里的ID被换成:id
+	if count := testutil.ToFloat64(utils.OutboundRequestsTotal.WithLabelValues("test", "GET /v1/payment_intents/:id", "402")); count != 1 {
+		t.Errorf("Expected 1 payment intent call, got %v", count)
+	}
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/spf13/viper"
+)
+
+const (
+	AuthProviderFirebase = "firebase"
+	AuthProviderOIDC     = "oidc"
+	AuthProviderLocal    = "local"
+	// AuthProviderAPIKey 是service account用X-API-Key访问时的provider。
+	AuthProviderAPIKey = "api_key"
+)
+
+var ErrMissingIdentity = errors.New("token contains neither a subject nor an email")
+
+// Principal 是验证过的token里我们关心的信息，和具体的认证服务无关。
+type Principal struct {
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// Phone 是手机号登录的时候token里的号码，其他情况为空。
+	Phone    string `json:"phone"`
+	Provider string `json:"provider"`
+}
+
+// Authenticator 验证客户端传过来的bearer token。
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// NewAuthenticator 按照 authProvider 的配置创建Authenticator，默认是firebase。
+func NewAuthenticator() (Authenticator, error) {
+	switch provider := viper.GetString("authProvider"); provider {
+	case "", AuthProviderFirebase:
+		return NewFirebaseAuthenticator(FirebaseAppProvider()), nil
+	case AuthProviderOIDC:
+		return NewOIDCAuthenticator(OIDCConfig{
+			Issuer:   viper.GetString("oidcIssuer"),
+			Audience: viper.GetString("oidcAudience"),
+			JWKSURL:  viper.GetString("oidcJWKSURL"),
+		})
+	case AuthProviderLocal:
+		return NewLocalIssuerFromConfig()
+	default:
+		return nil, fmt.Errorf("unknown auth provider: %v", provider)
+	}
+}
+
+// principalFromClaims 从标准的OIDC claims里取出Principal，email统一转成小写。
+// 手机号和匿名登录的token没有email，这时候只靠sub来识别用户。
+func principalFromClaims(claims jwt.MapClaims, provider string) (*Principal, error) {
+	email, _ := claims["email"].(string)
+	subject, _ := claims["sub"].(string)
+	if email == "" && subject == "" {
+		return nil, ErrMissingIdentity
+	}
+	phone, _ := claims["phone_number"].(string)
+	return &Principal{
+		Subject:       subject,
+		Email:         strings.ToLower(email),
+		EmailVerified: email != "" && claimBool(claims["email_verified"]),
+		Phone:         phone,
+		Provider:      provider,
+	}, nil
+}
+
+// claimBool 兼容有些服务把email_verified写成字符串的情况。
+func claimBool(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,14 +12,22 @@ import (
 	"time"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type BlobStorage interface {
-	UploadFile(filePath string) (string, error)
+	UploadFile(ctx context.Context, filePath string) (string, error)
+	// UploadPrivateFile 上传到不能公开访问的container，返回blob的名字和一个只读并且在ttl之后失效的下载链接。
+	UploadPrivateFile(ctx context.Context, filePath string, ttl time.Duration) (string, string, error)
+	// DeletePrivateFile 删除UploadPrivateFile上传的文件，文件已经不存在的时候不算错误。
+	DeletePrivateFile(ctx context.Context, blobName string) error
 }
 
 type AzureBlobStorage struct {
 	ContainerURL azblob.ContainerURL
+	// privateContainer 是单独的private container，用account key访问，不用公开container的SAS
+	privateContainer *azblob.ContainerURL
+	credential       *azblob.SharedKeyCredential
 }
 
 func NewAzureBlobStorage(containerURL string) (*AzureBlobStorage, error) {
@@ -36,29 +45,40 @@ func NewAzureBlobStorage(containerURL string) (*AzureBlobStorage, error) {
 }
 
 func (abs *AzureBlobStorage) validateAzureBlobStorage() error {
-	// Create a temporary file with content "host_port_timestamp"
-	tempFilePath := filepath.Join(os.TempDir(), "init_check.temp")
-	tempFile, err := os.Create(tempFilePath)
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+	return abs.CheckHealth(ctx)
+}
+
+// CheckHealth 上传一个内容是时间戳的临时文件再下载回来，确认container可以读写。启动的时候和readiness检查都用它。
+func (abs *AzureBlobStorage) CheckHealth(ctx context.Context) error {
+	// 每次检查都用同一个blob名字，不会在container里越积越多；本地文件放在单独的临时目录里，避免并发检查互相覆盖。
+	tempDir, err := os.MkdirTemp("", "atomi-blob-check")
 	if err != nil {
-		return fmt.Errorf("azure blob storage error: failed to create temp file: %w", err)
+		return fmt.Errorf("azure blob storage error: failed to create temp dir: %w", err)
 	}
-	defer os.Remove(tempFile.Name())
+	defer os.RemoveAll(tempDir)
 
-	timestamp := time.Now().Format(time.RFC3339)
-	if _, err := tempFile.WriteString(timestamp); err != nil {
+	tempFilePath := filepath.Join(tempDir, "init_check.temp")
+	timestamp := time.Now().Format(time.RFC3339Nano)
+	if err := os.WriteFile(tempFilePath, []byte(timestamp), 0o600); err != nil {
 		return fmt.Errorf("azure blob storage error: failed to write to temp file: %w", err)
 	}
 
-	uploadedURL, err := abs.UploadFileWithTimeout(tempFile.Name(), 3*time.Second)
+	uploadedURL, err := abs.UploadFileWithTimeout(ctx, tempFilePath, 3*time.Second)
 	if err != nil {
 		return fmt.Errorf("azure blob storage error: failed to upload temp file to Azure Blob Storage: %w", err)
 	}
 
 	// Download the temporary file from the container
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, uploadedURL, nil)
+	if err != nil {
+		return fmt.Errorf("azure blob storage error: failed to create download request: %w", err)
+	}
 	client := &http.Client{
 		Timeout: 3 * time.Second,
 	}
-	response, err := client.Get(uploadedURL)
+	response, err := client.Do(request)
 	if err != nil {
 		return fmt.Errorf("azure blob storage error: failed to download temp file from Azure Blob Storage: %w", err)
 	}
@@ -78,25 +98,30 @@ func (abs *AzureBlobStorage) validateAzureBlobStorage() error {
 	return nil
 }
 
-func (abs *AzureBlobStorage) UploadFile(filePath string) (string, error) {
-	return abs.UploadFileWithTimeout(filePath, 10*time.Second)
-}
-
-func (abs *AzureBlobStorage) UploadFileWithTimeout(filePath string, timeout time.Duration) (string, error) {
-	// Set the default timeout value to 3 seconds
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	fileName := filepath.Base(filePath)
-	blockBlobURL := abs.ContainerURL.NewBlockBlobURL(fileName)
-
-	file, err := os.Open(filePath)
+// SetPrivateContainer 设置存放private文件（比如用户数据导出）的container和storage account key。
+// 这个container不能开公开访问；containerUrlWithSasToken里的SAS也没法派生出更短期的token，所以用account key签发下载链接。
+func (abs *AzureBlobStorage) SetPrivateContainer(accountName, accountKey, containerName string) error {
+	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("azure blob storage error: invalid shared key: %w", err)
 	}
-	defer file.Close()
+	// 和公开的container在同一个account下面，只换container的名字
+	parts := azblob.NewBlobURLParts(abs.ContainerURL.URL())
+	parts.ContainerName = containerName
+	parts.SAS = azblob.SASQueryParameters{}
+	container := azblob.NewContainerURL(parts.URL(), azblob.NewPipeline(credential, azblob.PipelineOptions{}))
+	abs.privateContainer = &container
+	abs.credential = credential
+	return nil
+}
 
-	_, err = azblob.UploadFileToBlockBlob(ctx, file, blockBlobURL, azblob.UploadToBlockBlobOptions{})
+func (abs *AzureBlobStorage) UploadFile(ctx context.Context, filePath string) (string, error) {
+	return abs.UploadFileWithTimeout(ctx, filePath, 10*time.Second)
+}
+
+// UploadFileWithTimeout 的超时在调用方ctx的基础上再加一层，请求被取消的时候上传也会停下来。
+func (abs *AzureBlobStorage) UploadFileWithTimeout(ctx context.Context, filePath string, timeout time.Duration) (string, error) {
+	blockBlobURL, err := upload(ctx, abs.ContainerURL, filePath, timeout)
 	if err != nil {
 		return "", err
 	}
@@ -113,3 +138,74 @@ func (abs *AzureBlobStorage) UploadFileWithTimeout(filePath string, timeout time
 
 	return cleanURL.String(), nil
 }
+
+func upload(ctx context.Context, container azblob.ContainerURL, filePath string, timeout time.Duration) (azblob.BlockBlobURL, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fileName := filepath.Base(filePath)
+	blockBlobURL := container.NewBlockBlobURL(fileName)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return blockBlobURL, err
+	}
+	defer file.Close()
+
+	start := time.Now()
+	ctx, span := Tracer().Start(ctx, "azure_blob.upload", trace.WithSpanKind(trace.SpanKindClient))
+	_, err = azblob.UploadFileToBlockBlob(ctx, file, blockBlobURL, azblob.UploadToBlockBlobOptions{})
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+	ObserveOutbound("azure_blob", "upload", start, err)
+	return blockBlobURL, err
+}
+
+func (abs *AzureBlobStorage) UploadPrivateFile(ctx context.Context, filePath string, ttl time.Duration) (string, string, error) {
+	if abs.privateContainer == nil {
+		return "", "", errors.New("azure blob storage error: private container is not configured")
+	}
+
+	blockBlobURL, err := upload(ctx, *abs.privateContainer, filePath, 10*time.Second)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := azblob.NewBlobURLParts(blockBlobURL.URL())
+	sas, err := azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPS,
+		ExpiryTime:    time.Now().UTC().Add(ttl),
+		ContainerName: parts.ContainerName,
+		BlobName:      parts.BlobName,
+		Permissions:   azblob.BlobSASPermissions{Read: true}.String(),
+	}.NewSASQueryParameters(abs.credential)
+	if err != nil {
+		return "", "", fmt.Errorf("azure blob storage error: failed to sign url: %w", err)
+	}
+	parts.SAS = sas
+
+	signedURL := parts.URL()
+	return parts.BlobName, signedURL.String(), nil
+}
+
+func (abs *AzureBlobStorage) DeletePrivateFile(ctx context.Context, blobName string) error {
+	if abs.privateContainer == nil {
+		return errors.New("azure blob storage error: private container is not configured")
+	}
+
+	start := time.Now()
+	ctx, span := Tracer().Start(ctx, "azure_blob.delete", trace.WithSpanKind(trace.SpanKindClient))
+	_, err := abs.privateContainer.NewBlockBlobURL(blobName).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	var storageErr azblob.StorageError
+	if errors.As(err, &storageErr) && storageErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+		err = nil
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+	ObserveOutbound("azure_blob", "delete", start, err)
+	return err
+}
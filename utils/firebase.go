@@ -4,40 +4,61 @@ import (
 	"context"
 	"fmt"
 	"os"
-
-	"firebase.google.com/go/v4/auth"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/auth"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/option"
 )
 
-type AuthAppWrapper interface {
-	AuthAndDecode(ctx context.Context, token string) (*auth.Token, error)
-}
+// readiness检查用这个UID查用户，期望返回用户不存在。
+const firebaseHealthCheckUID = "atomi-health-check"
 
-type FirebaseAppWrapper struct {
+type FirebaseAuthenticator struct {
 	FirebaseApp *firebase.App
 }
 
-func NewFirebaseAppWrapper(firebaseApp *firebase.App) AuthAppWrapper {
-	return &FirebaseAppWrapper{
+func NewFirebaseAuthenticator(firebaseApp *firebase.App) Authenticator {
+	return &FirebaseAuthenticator{
 		FirebaseApp: firebaseApp,
 	}
 }
 
-func (w *FirebaseAppWrapper) AuthAndDecode(ctx context.Context, token string) (*auth.Token, error) {
-	client, err := w.FirebaseApp.Auth(ctx)
+func (a *FirebaseAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	client, err := a.FirebaseApp.Auth(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	start := time.Now()
+	ctx, span := Tracer().Start(ctx, "firebase.verify_id_token", trace.WithSpanKind(trace.SpanKindClient))
 	decodedToken, err := client.VerifyIDToken(ctx, token)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+	ObserveOutbound("firebase", "verify_id_token", start, err)
 	if err != nil {
 		return nil, err
 	}
 
-	return decodedToken, nil
+	// Claims里不一定有sub，以UID为准。
+	decodedToken.Claims["sub"] = decodedToken.UID
+	return principalFromClaims(decodedToken.Claims, AuthProviderFirebase)
+}
+
+// CheckHealth 查一个不存在的用户，能拿到"用户不存在"的错误说明credential是有效的。
+func (a *FirebaseAuthenticator) CheckHealth(ctx context.Context) error {
+	client, err := a.FirebaseApp.Auth(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err = client.GetUser(ctx, firebaseHealthCheckUID); err != nil && !auth.IsUserNotFound(err) {
+		return err
+	}
+	return nil
 }
 
 func FirebaseAppProvider() *firebase.App {
@@ -45,9 +66,7 @@ func FirebaseAppProvider() *firebase.App {
 	if viper.GetBool("firebaseEnableEmulator") {
 		os.Setenv("FIREBASE_AUTH_EMULATOR_HOST", viper.GetString("firebaseAuthEmulatorHost"))
 	}
-	// TODO(lamuguo): 得有个check来确认这个cred file被正确的load了，
-	// 像check azure storage那样。也许创建一个validate@atomi.ai的token，然后
-	// 让这个模块来验证下，看看是不是能正确decode。
+	// cred file是不是有效由readiness检查里的CheckHealth确认。
 	opt := option.WithCredentialsFile(viper.GetString("firebaseCredentialsFile"))
 	firebaseApp, err := firebase.NewApp(context.Background(), nil, opt)
 	if err != nil {
@@ -0,0 +1,248 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded"
+	HealthStatusFailing  = "failing"
+	HealthStatusDraining = "draining"
+
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultHealthCheckCacheTTL = 10 * time.Second
+)
+
+// HealthChecker 由需要做健康检查的组件实现（DB以外的外部依赖、后台任务），注册的时候用类型断言判断。
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// HealthCheck 是注册到HealthRegistry里的一个检查。
+// Timeout、CacheTTL、Critical可以用 healthChecks.<name>.timeout / .cacheTTL / .critical 覆盖。
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	// 每次检查最多等这么久
+	Timeout time.Duration
+	// 结果缓存这么久，避免探针把Stripe、Uber这些外部服务打爆。0用默认值，负数表示不缓存
+	CacheTTL time.Duration
+	// Critical的检查失败时readiness返回503，否则只是degraded
+	Critical bool
+	// Liveness的检查也会出现在 /healthz 里，失败说明进程需要重启
+	Liveness bool
+}
+
+type HealthCheckResult struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Cached    bool      `json:"cached"`
+}
+
+type HealthReport struct {
+	Status string `json:"status"`
+	// 只有Report接口返回每个检查的结果，公开的探针只返回Status
+	Checks map[string]*HealthCheckResult `json:"checks,omitempty"`
+}
+
+// Healthy 表示没有critical的检查失败。
+func (r *HealthReport) Healthy() bool {
+	return r.Status == HealthStatusOK || r.Status == HealthStatusDegraded
+}
+
+type HealthRegistry interface {
+	Register(check HealthCheck)
+	// Liveness 只运行Liveness的检查。
+	Liveness(ctx context.Context) *HealthReport
+	// Readiness 并发运行所有检查。
+	Readiness(ctx context.Context) *HealthReport
+}
+
+type registeredHealthCheck struct {
+	HealthCheck
+	// mu保证同一个检查同时只跑一次，其他请求等着用它的结果
+	mu     sync.Mutex
+	result *HealthCheckResult
+}
+
+type healthRegistryImpl struct {
+	mu     sync.RWMutex
+	checks map[string]*registeredHealthCheck
+}
+
+func NewHealthRegistry() HealthRegistry {
+	return &healthRegistryImpl{checks: map[string]*registeredHealthCheck{}}
+}
+
+func (r *healthRegistryImpl) Register(check HealthCheck) {
+	key := "healthChecks." + check.Name
+	if check.Timeout <= 0 {
+		check.Timeout = defaultHealthCheckTimeout
+	}
+	if check.CacheTTL == 0 {
+		check.CacheTTL = defaultHealthCheckCacheTTL
+	}
+	if viper.IsSet(key + ".timeout") {
+		check.Timeout = viper.GetDuration(key + ".timeout")
+	}
+	if viper.IsSet(key + ".cacheTTL") {
+		check.CacheTTL = viper.GetDuration(key + ".cacheTTL")
+	}
+	if viper.IsSet(key + ".critical") {
+		check.Critical = viper.GetBool(key + ".critical")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[check.Name] = &registeredHealthCheck{HealthCheck: check}
+}
+
+func (r *healthRegistryImpl) Liveness(ctx context.Context) *HealthReport {
+	return r.run(ctx, true)
+}
+
+func (r *healthRegistryImpl) Readiness(ctx context.Context) *HealthReport {
+	return r.run(ctx, false)
+}
+
+func (r *healthRegistryImpl) run(ctx context.Context, livenessOnly bool) *HealthReport {
+	r.mu.RLock()
+	var checks []*registeredHealthCheck
+	for _, check := range r.checks {
+		if !livenessOnly || check.Liveness {
+			checks = append(checks, check)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]*HealthCheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = checks[i].run(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	report := &HealthReport{Status: HealthStatusOK, Checks: map[string]*HealthCheckResult{}}
+	for i, result := range results {
+		report.Checks[checks[i].Name] = result
+		if result.Status == HealthStatusOK {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthStatusFailing
+		} else if report.Status == HealthStatusOK {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+func (c *registeredHealthCheck) run(parent context.Context) *HealthCheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.result != nil && time.Since(c.result.CheckedAt) < c.CacheTTL {
+		cached := *c.result
+		cached.Cached = true
+		return &cached
+	}
+
+	ctx, cancel := context.WithTimeout(parent, c.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := runHealthCheck(ctx, c.Check)
+	result := &HealthCheckResult{
+		Status:    HealthStatusOK,
+		Critical:  c.Critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = HealthStatusFailing
+		result.Error = err.Error()
+	}
+	// 探针请求自己被取消的时候结果不可信，不缓存
+	if parent.Err() == nil {
+		c.result = result
+	}
+	copied := *result
+	return &copied
+}
+
+// runHealthCheck 在ctx结束的时候立即返回，不管check本身有没有处理ctx。
+func runHealthCheck(ctx context.Context, check func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("health check panicked: %v", r)
+			}
+		}()
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DBHealthCheck ping一下数据库连接池。
+func DBHealthCheck(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// WorkerHeartbeat 跟踪正在运行的后台任务。任务在每个阶段调用Beat，
+// 有任务超过maxAge没有进展的时候CheckHealth返回错误（没有任务在跑的时候总是健康的）。
+type WorkerHeartbeat struct {
+	mu     sync.Mutex
+	maxAge time.Duration
+	jobs   map[int64]time.Time
+}
+
+func NewWorkerHeartbeat(maxAge time.Duration) *WorkerHeartbeat {
+	return &WorkerHeartbeat{maxAge: maxAge, jobs: map[int64]time.Time{}}
+}
+
+func (h *WorkerHeartbeat) Beat(jobID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.jobs[jobID] = time.Now()
+}
+
+func (h *WorkerHeartbeat) Done(jobID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.jobs, jobID)
+}
+
+func (h *WorkerHeartbeat) CheckHealth(_ context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for jobID, lastBeat := range h.jobs {
+		if age := time.Since(lastBeat); age > h.maxAge {
+			return fmt.Errorf("job %v has made no progress for %v", jobID, age.Round(time.Second))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// HTTPServerConfig 是主服务的监听配置，对应的配置项见 LoadHTTPServerConfig。
+type HTTPServerConfig struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// TrustedProxies 是负载均衡的IP或者CIDR，只有从这些地址来的请求才看X-Forwarded-For，
+	// 没配的时候不信任任何代理，ClientIP就是连接的地址。限流按ClientIP计数，不能让客户端自己伪造。
+	TrustedProxies []string
+	// 两个都配了才用HTTPS
+	TLSCertFile string
+	TLSKeyFile  string
+	// ShutdownTimeout 是收到SIGTERM之后等待正在处理的请求和后台任务的最长时间。
+	ShutdownTimeout time.Duration
+	// DrainDelay 是readiness变成失败之后、停止接受新连接之前等待的时间，给负载均衡摘掉这个实例留时间。
+	DrainDelay time.Duration
+}
+
+// LoadHTTPServerConfig 读取 listenAddr、readTimeout、readHeaderTimeout、writeTimeout、idleTimeout、
+// maxHeaderBytes、trustedProxies、tlsCertFile、tlsKeyFile、shutdownTimeout、drainDelay，没配的用默认值。
+// writeTimeout要比requestTimeout长，否则超时的请求连504都返回不了。
+func LoadHTTPServerConfig() HTTPServerConfig {
+	return HTTPServerConfig{
+		Addr:              stringOrDefault("listenAddr", ":8081"),
+		ReadTimeout:       durationOrDefault("readTimeout", 15*time.Second),
+		ReadHeaderTimeout: durationOrDefault("readHeaderTimeout", 5*time.Second),
+		WriteTimeout:      durationOrDefault("writeTimeout", 60*time.Second),
+		IdleTimeout:       durationOrDefault("idleTimeout", 120*time.Second),
+		MaxHeaderBytes:    intOrDefault("maxHeaderBytes", 1<<20),
+		TrustedProxies:    viper.GetStringSlice("trustedProxies"),
+		TLSCertFile:       viper.GetString("tlsCertFile"),
+		TLSKeyFile:        viper.GetString("tlsKeyFile"),
+		ShutdownTimeout:   durationOrDefault("shutdownTimeout", 30*time.Second),
+		DrainDelay:        durationOrDefault("drainDelay", 0),
+	}
+}
+
+func (cfg HTTPServerConfig) NewServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+func (cfg HTTPServerConfig) TLSEnabled() bool {
+	return cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+}
+
+// Serve 一直运行到server被Shutdown，正常关闭的时候返回nil。
+func (cfg HTTPServerConfig) Serve(server *http.Server) error {
+	var err error
+	if cfg.TLSEnabled() {
+		log.Infof("Listening on %v (TLS)", server.Addr)
+		err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		log.Infof("Listening on %v", server.Addr)
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+var draining atomic.Bool
+
+// SetDraining 标记服务正在关闭，之后readiness检查会返回失败。
+func SetDraining(value bool) {
+	draining.Store(value)
+}
+
+func IsDraining() bool {
+	return draining.Load()
+}
+
+// WaitWithContext 等wait返回，或者ctx结束（返回ctx.Err()）。用来给后台任务的收尾加上deadline。
+func WaitWithContext(ctx context.Context, wait func()) error {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func stringOrDefault(key, value string) string {
+	if viper.IsSet(key) {
+		return viper.GetString(key)
+	}
+	return value
+}
+
+func durationOrDefault(key string, value time.Duration) time.Duration {
+	if viper.IsSet(key) {
+		return viper.GetDuration(key)
+	}
+	return value
+}
+
+func intOrDefault(key string, value int) int {
+	if viper.IsSet(key) {
+		return viper.GetInt(key)
+	}
+	return value
+}
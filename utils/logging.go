@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID 把请求ID放进context里，用 log.WithContext(ctx) 打的日志都会带上它。
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// RequestIDHook 给带context的日志加上request_id字段，有trace的时候也加上trace_id，方便从日志跳到trace。
+type RequestIDHook struct{}
+
+func (RequestIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (RequestIDHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if requestID := RequestIDFromContext(entry.Context); requestID != "" {
+		entry.Data["request_id"] = requestID
+	}
+	if spanContext := trace.SpanContextFromContext(entry.Context); spanContext.IsValid() {
+		entry.Data["trace_id"] = spanContext.TraceID().String()
+	}
+	return nil
+}
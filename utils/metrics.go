@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 所有的Prometheus指标都在这里定义，注册在默认的registry上，/metrics 直接用promhttp.Handler()输出。
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "atomi_http_requests_total",
+		Help: "HTTP requests handled, by route template and status code.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "atomi_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "atomi_db_query_duration_seconds",
+		Help:    "GORM query latency by operation and table.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	OutboundRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "atomi_outbound_requests_total",
+		Help: "Calls to external services (Stripe, Uber, Firebase, Azure Blob) by operation and status.",
+	}, []string{"service", "operation", "status"})
+	OutboundRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "atomi_outbound_request_duration_seconds",
+		Help:    "Latency of calls to external services by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "operation"})
+
+	OrdersCreatedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "atomi_orders_created_total",
+		Help: "Orders created.",
+	})
+	OrdersPaidTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "atomi_orders_paid_total",
+		Help: "Orders whose payment intent succeeded.",
+	})
+	OrdersRefundedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "atomi_orders_refunded_total",
+		Help: "Orders with at least one refund.",
+	})
+	DeliveriesCreatedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "atomi_deliveries_created_total",
+		Help: "Uber deliveries created.",
+	})
+)
+
+// ObserveOutbound 记录一次SDK调用（不是直接发HTTP请求的那种），status是ok或者error。
+func ObserveOutbound(service, operation string, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	OutboundRequestsTotal.WithLabelValues(service, operation, status).Inc()
+	OutboundRequestDuration.WithLabelValues(service, operation).Observe(time.Since(start).Seconds())
+}
+
+// NewInstrumentedTransport 包装http.RoundTripper，按照 "方法 路径模板" 记录每个请求，status是HTTP状态码。
+func NewInstrumentedTransport(service string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &instrumentedTransport{service: service, base: base}
+}
+
+type instrumentedTransport struct {
+	service string
+	base    http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	operation := req.Method + " " + pathTemplate(req.URL.Path)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	OutboundRequestsTotal.WithLabelValues(t.service, operation, status).Inc()
+	OutboundRequestDuration.WithLabelValues(t.service, operation).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// pathTemplate 把路径里带数字的段（譬如 pi_3Mx... 或者订单号）换成:id，避免label的基数爆炸。
+func pathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		// 版本号（v1）保留
+		if len(segment) > 2 && strings.IndexFunc(segment, unicode.IsDigit) >= 0 {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Notifier 用来给用户发通知（譬如数据导出完成）。
+type Notifier interface {
+	Notify(ctx context.Context, email, subject, message string) error
+}
+
+// LogNotifier 只把通知的收件人和标题写到日志里，正文里有下载链接、邀请token这些凭证，不能写日志。
+// 等接入邮件/推送服务之后再替换掉。
+type LogNotifier struct{}
+
+func NewLogNotifier() Notifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, email, subject, message string) error {
+	log.WithContext(ctx).Infof("Notify %v: [%v]", email, subject)
+	return nil
+}
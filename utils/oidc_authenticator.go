@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	jwksRefreshInterval = time.Hour
+	// 遇到不认识的kid时最多这么久刷新一次，防止被随便构造的token打爆JWKS服务。
+	jwksMinRefreshInterval = time.Minute
+)
+
+type OIDCConfig struct {
+	Issuer   string
+	Audience string
+	// JWKSURL 为空的时候从 <Issuer>/.well-known/openid-configuration 里读取。
+	JWKSURL string
+}
+
+// OIDCAuthenticator 验证任意OIDC服务签发的JWT，签名的公钥从JWKS里读取并缓存。
+type OIDCAuthenticator struct {
+	config     OIDCConfig
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+	// 同时只有一个请求去取JWKS，其他的等它的结果
+	refreshes singleflight.Group
+}
+
+func NewOIDCAuthenticator(config OIDCConfig) (Authenticator, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("oidcIssuer and oidcAudience are required")
+	}
+	return &OIDCAuthenticator{
+		config:     config,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (a *OIDCAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(a.config.Issuer, true) {
+		return nil, fmt.Errorf("unexpected issuer: %v", claims["iss"])
+	}
+	if !claims.VerifyAudience(a.config.Audience, true) {
+		return nil, fmt.Errorf("unexpected audience: %v", claims["aud"])
+	}
+	return principalFromClaims(claims, AuthProviderOIDC)
+}
+
+func (a *OIDCAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.Lock()
+	key, ok := a.keys[kid]
+	stale := time.Since(a.lastRefresh) > jwksRefreshInterval
+	recent := time.Since(a.lastRefresh) < jwksMinRefreshInterval
+	a.mu.Unlock()
+	if ok && !stale {
+		return key, nil
+	}
+	if !ok && !stale && recent {
+		return nil, fmt.Errorf("unknown key id: %v", kid)
+	}
+
+	// 取JWKS的时候不拿着锁，不然JWKS服务慢的时候所有的请求都卡在这里
+	_, err, _ := a.refreshes.Do("jwks", func() (interface{}, error) {
+		return nil, a.refresh(ctx)
+	})
+	if err != nil {
+		// 刷新失败的时候继续用旧的key，总比所有请求都失败要好。
+		log.Errorf("Errors in refreshing JWKS from %v, err: \n%v", a.config.JWKSURL, err)
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key, ok = a.keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown key id: %v", kid)
+	}
+	return key, nil
+}
+
+// refresh 重新取JWKS，别的请求刚刚刷新过的时候直接用它的结果。
+func (a *OIDCAuthenticator) refresh(ctx context.Context) error {
+	a.mu.Lock()
+	recent := time.Since(a.lastRefresh) < jwksMinRefreshInterval
+	a.mu.Unlock()
+	if recent {
+		return nil
+	}
+
+	keys, err := a.fetchKeys(ctx)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.keys = keys
+	a.lastRefresh = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *OIDCAuthenticator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if a.config.JWKSURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		discoveryURL := strings.TrimSuffix(a.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := a.getJSON(ctx, discoveryURL, &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("no jwks_uri in %v", discoveryURL)
+		}
+		a.config.JWKSURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := a.getJSON(ctx, a.config.JWKSURL, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Warnf("Skip JWK %v: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (a *OIDCAuthenticator) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %v returned %v", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, fmt.Errorf("unsupported key use: %v", k.Use)
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %v", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %v", k.Kty)
+	}
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RateLimit 是一个令牌桶：每分钟补充PerMinute个令牌，最多存Burst个。
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// Capacity 返回桶的大小，没配Burst的时候和PerMinute一样。
+func (l RateLimit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.PerMinute
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter 是被拒绝的时候要等多久才有下一个令牌。
+	RetryAfter time.Duration
+	// ResetAfter 是桶重新装满要多久。
+	ResetAfter time.Duration
+}
+
+// RateLimitBackend 保存令牌桶的状态。单实例部署用内存的实现就够了，
+// 多副本部署的时候需要换成共享存储（比如Redis）的实现，保证所有副本看到同一个桶。
+type RateLimitBackend interface {
+	// Take 从key对应的桶里拿一个令牌。
+	Take(ctx context.Context, key string, limit RateLimit) (*RateLimitResult, error)
+}
+
+// NewRateLimitBackend 按照 rateLimitBackend 的配置创建backend，默认是memory。
+func NewRateLimitBackend() (RateLimitBackend, error) {
+	switch backend := viper.GetString("rateLimitBackend"); backend {
+	case "", "memory":
+		return NewMemoryRateLimitBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend: %v", backend)
+	}
+}
+
+// 每隔这么久清理一次已经装满的桶，避免map无限增长。
+const rateLimitSweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens    float64
+	capacity  float64
+	rate      float64
+	updatedAt time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*b.rate)
+	b.updatedAt = now
+}
+
+type MemoryRateLimitBackend struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitBackend() RateLimitBackend {
+	return &MemoryRateLimitBackend{
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryRateLimitBackend) Take(_ context.Context, key string, limit RateLimit) (*RateLimitResult, error) {
+	capacity := float64(limit.Capacity())
+	rate := float64(limit.PerMinute) / 60
+	if capacity <= 0 || rate <= 0 {
+		return nil, fmt.Errorf("invalid rate limit %+v", limit)
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+
+	bucket, ok := m.buckets[key]
+	if !ok || bucket.capacity != capacity || bucket.rate != rate {
+		bucket = &tokenBucket{tokens: capacity, capacity: capacity, rate: rate, updatedAt: now}
+		m.buckets[key] = bucket
+	}
+	bucket.refill(now)
+
+	result := &RateLimitResult{Limit: limit.Capacity()}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.tokens) / rate)
+	}
+	result.Remaining = int(bucket.tokens)
+	result.ResetAfter = secondsToDuration((capacity - bucket.tokens) / rate)
+	return result, nil
+}
+
+func (m *MemoryRateLimitBackend) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, bucket := range m.buckets {
+		if bucket.refill(now); bucket.tokens >= bucket.capacity {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -1,12 +1,15 @@
 package utils
 
 import (
+	"context"
+
 	"github.com/stripe/stripe-go/v74"
+	"github.com/stripe/stripe-go/v74/balance"
 	"github.com/stripe/stripe-go/v74/customer"
 )
 
 type StripeWrapper interface {
-	CreateCustomer(email string) (*stripe.Customer, error)
+	CreateCustomer(ctx context.Context, email string) (*stripe.Customer, error)
 }
 
 type StripeWrapperImpl struct{}
@@ -15,10 +18,19 @@ func NewStripeWrapper() StripeWrapper {
 	return &StripeWrapperImpl{}
 }
 
-func (s *StripeWrapperImpl) CreateCustomer(email string) (*stripe.Customer, error) {
+func (s *StripeWrapperImpl) CreateCustomer(ctx context.Context, email string) (*stripe.Customer, error) {
 	params := &stripe.CustomerParams{
 		Email: stripe.String(email),
 	}
+	params.Context = ctx
 
 	return customer.New(params)
 }
+
+// CheckHealth 读一下账户余额，确认Stripe可以访问并且key有效。
+func (s *StripeWrapperImpl) CheckHealth(ctx context.Context) error {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	_, err := balance.Get(params)
+	return err
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/atomi-ai/atomi"
+
+// Tracer 返回全局的tracer。没有调用InitTracing的时候（譬如测试）是noop的。
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// InitTracing 按照 tracingExporter 的配置初始化OpenTelemetry：
+//   - otlp：发到 otlpEndpoint（host:port，默认localhost:4318），otlpInsecure 为true的时候用http
+//   - stdout：打印到标准输出，本地调试用
+//   - 不配：不导出任何span
+//
+// 返回的shutdown要在退出前调用，把没发出去的span发完。
+func InitTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := viper.GetString("tracingExporter"); name {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	case "otlp":
+		options := []otlptracehttp.Option{}
+		if endpoint := viper.GetString("otlpEndpoint"); endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(endpoint))
+		}
+		if viper.GetBool("otlpInsecure") {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %v", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := viper.GetString("tracingServiceName")
+	if serviceName == "" {
+		serviceName = "atomi"
+	}
+	ratio := 1.0
+	if viper.IsSet("tracingSampleRatio") {
+		ratio = viper.GetFloat64("tracingSampleRatio")
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewTracingTransport 给每个发出去的HTTP请求创建一个client span，并把traceparent带给对方。
+// 请求要带着context（req.WithContext）才能挂到当前的trace上。
+func NewTracingTransport(service string, base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base,
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return service + " " + req.Method + " " + pathTemplate(req.URL.Path)
+		}))
+}